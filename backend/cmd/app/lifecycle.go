@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lifecycle owns the order in which the process winds down. When the run context is cancelled readiness starts failing
+// and, after DrainDelay, the server stops accepting connections and drains in-flight requests, then background workers
+// are stopped (newest first), then shared resources such as the DB pool are closed. Every step shares one deadline so
+// the whole shutdown fits inside the grace period the platform gives us
+type Lifecycle struct {
+	ShutdownTimeout time.Duration
+	// DrainDelay keeps the server accepting connections after the drain hooks ran, long enough for load balancers to
+	// see readiness fail and stop sending new requests. It counts against ShutdownTimeout
+	DrainDelay time.Duration
+	Logger     *zap.Logger
+	draining   []func()
+	workers    []lifecycleHook
+	closers    []lifecycleHook
+}
+
+type lifecycleHook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+func NewLifecycle(shutdownTimeout time.Duration, logger *zap.Logger) *Lifecycle {
+	return &Lifecycle{
+		ShutdownTimeout: shutdownTimeout,
+		Logger:          logger.Named("lifecycle"),
+	}
+}
+
+// OnDrain registers a func that runs as soon as shutdown begins, before the server stops accepting connections, e.g.
+// to start failing readiness probes
+func (l *Lifecycle) OnDrain(fn func()) {
+	l.draining = append(l.draining, fn)
+}
+
+// OnStopWorker registers a background worker's stop func. Workers are stopped after the HTTP server has drained, so
+// requests that are still finishing can rely on them
+func (l *Lifecycle) OnStopWorker(name string, stop func(ctx context.Context) error) {
+	l.workers = append(l.workers, lifecycleHook{name: name, stop: stop})
+}
+
+// OnClose registers a resource to close once every worker has stopped
+func (l *Lifecycle) OnClose(name string, close func() error) {
+	l.closers = append(l.closers, lifecycleHook{name: name, stop: func(context.Context) error { return close() }})
+}
+
+// Run serves on listener until ctx is cancelled or the server fails, then shuts everything down. It returns the serve
+// error, if any, joined with every shutdown error
+func (l *Lifecycle) Run(ctx context.Context, server *http.Server, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	var errs []error
+	serving := true
+	select {
+	case err := <-serveErr:
+		serving = false
+		if !errors.Is(err, http.ErrServerClosed) {
+			l.Logger.Error("server stopped unexpectedly", zap.Error(err))
+			errs = append(errs, err)
+		}
+	case <-ctx.Done():
+		l.Logger.Info("shutdown signal received, draining in-flight requests",
+			zap.Duration("timeout", l.ShutdownTimeout), zap.Duration("drain_delay", l.DrainDelay))
+	}
+
+	// ctx is already cancelled by now, so the deadline hangs off a fresh context
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.ShutdownTimeout)
+	defer cancel()
+
+	for _, fn := range l.draining {
+		fn()
+	}
+	if serving && l.DrainDelay > 0 {
+		select {
+		case <-time.After(l.DrainDelay):
+		case <-shutdownCtx.Done():
+		}
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// the deadline passed with requests still running; cut them off so the remaining steps still get to run
+		l.Logger.Warn("server did not drain before the deadline, closing remaining connections", zap.Error(err))
+		server.Close()
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, l.stop(shutdownCtx))
+
+	l.Logger.Info("shutdown complete")
+	return errors.Join(errs...)
+}
+
+// Abort stops the workers and closes the resources registered so far, within ShutdownTimeout. It is for startup
+// failures that happen before Run, so what was already started does not outlive the process's last log lines
+func (l *Lifecycle) Abort() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ShutdownTimeout)
+	defer cancel()
+	return l.stop(ctx)
+}
+
+// stop stops the workers, newest first, then closes the resources
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var errs []error
+	for i := len(l.workers) - 1; i >= 0; i-- {
+		errs = append(errs, l.runHook(ctx, "worker", l.workers[i]))
+	}
+	for i := len(l.closers) - 1; i >= 0; i-- {
+		errs = append(errs, l.runHook(ctx, "resource", l.closers[i]))
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Lifecycle) runHook(ctx context.Context, kind string, hook lifecycleHook) error {
+	if err := hook.stop(ctx); err != nil {
+		l.Logger.Error("failed to stop "+kind, zap.String("name", hook.name), zap.Error(err))
+		return err
+	}
+	l.Logger.Debug("stopped "+kind, zap.String("name", hook.name))
+	return nil
+}
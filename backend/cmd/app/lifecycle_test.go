@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startLifecycle serves handler on a random port and returns the base url plus a channel carrying Run's result
+func startLifecycle(t *testing.T, ctx context.Context, lc *Lifecycle, handler http.Handler) (string, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lc.Run(ctx, &http.Server{Handler: handler}, listener)
+	}()
+	return "http://" + listener.Addr().String(), done
+}
+
+func TestLifecycle_DrainsInFlightRequestsThenStopsInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var order []string
+	lc := NewLifecycle(2*time.Second, zap.NewNop())
+	lc.OnClose("db", func() error { order = append(order, "db"); return nil })
+	lc.OnStopWorker("first", func(context.Context) error { order = append(order, "first"); return nil })
+	lc.OnStopWorker("second", func(context.Context) error { order = append(order, "second"); return nil })
+
+	started := make(chan struct{})
+	url, done := startLifecycle(t, ctx, lc, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		order = append(order, "request")
+		w.Write([]byte("ok"))
+	}))
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			respCh <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if body := <-respCh; body != "ok" {
+		t.Errorf("in-flight request was not drained, got %q", body)
+	}
+
+	want := []string{"request", "second", "first", "db"}
+	if !slices.Equal(order, want) {
+		t.Errorf("shutdown order = %v, want %v", order, want)
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestLifecycle_DeadlineExceededStillClosesResources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	closed := false
+	lc := NewLifecycle(50*time.Millisecond, zap.NewNop())
+	lc.OnClose("db", func() error { closed = true; return nil })
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	url, done := startLifecycle(t, ctx, lc, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go http.Get(url)
+	<-started
+	cancel()
+
+	err := <-done
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if !closed {
+		t.Error("resources were not closed after the drain deadline passed")
+	}
+}
+
+func TestLifecycle_ReportsHookErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	workerErr := errors.New("worker stuck")
+	closed := false
+	lc := NewLifecycle(time.Second, zap.NewNop())
+	lc.OnStopWorker("stuck", func(context.Context) error { return workerErr })
+	lc.OnClose("db", func() error { closed = true; return nil })
+
+	_, done := startLifecycle(t, ctx, lc, http.NotFoundHandler())
+	if err := <-done; !errors.Is(err, workerErr) {
+		t.Errorf("expected worker error, got %v", err)
+	}
+	if !closed {
+		t.Error("a failing worker should not prevent resources from being closed")
+	}
+}
+
+func TestLifecycle_AbortStopsWorkersThenClosesResources(t *testing.T) {
+	var order []string
+	lc := NewLifecycle(time.Second, zap.NewNop())
+	lc.OnStopWorker("tracing", func(context.Context) error { order = append(order, "tracing"); return nil })
+	lc.OnClose("db", func() error { order = append(order, "db"); return nil })
+	lc.OnStopWorker("relay", func(context.Context) error { order = append(order, "relay"); return nil })
+	drained := false
+	lc.OnDrain(func() { drained = true })
+
+	if err := lc.Abort(); err != nil {
+		t.Fatalf("expected a clean abort, got %v", err)
+	}
+	if want := []string{"relay", "tracing", "db"}; !slices.Equal(order, want) {
+		t.Errorf("expected %v, got %v", want, order)
+	}
+	if drained {
+		t.Error("expected no drain hooks without a server")
+	}
+}
+
+func TestLifecycle_KeepsServingThroughTheDrainDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	drained := make(chan struct{})
+	lc := NewLifecycle(2*time.Second, zap.NewNop())
+	lc.DrainDelay = 300 * time.Millisecond
+	lc.OnDrain(func() { close(drained) })
+
+	url, done := startLifecycle(t, ctx, lc, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if _, err := http.Get(url); err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	cancel()
+	<-drained
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("new requests should still be served during the drain delay, got %v", err)
+	}
+	resp.Body.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
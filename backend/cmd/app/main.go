@@ -3,113 +3,350 @@ package main
 import (
 	"context"
 	"database/sql"
-	"flag"
-	"log"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
-	"github.com/jshelley8117/CodeCart/internal/middleware"
+	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/health"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/migrate"
+	"github.com/jshelley8117/CodeCart/internal/notify"
+	"github.com/jshelley8117/CodeCart/internal/outbox"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/ratelimit"
+	"github.com/jshelley8117/CodeCart/internal/realtime"
 	"github.com/jshelley8117/CodeCart/internal/resource"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
+	"github.com/jshelley8117/CodeCart/internal/webhook"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/impersonate"
 )
 
 const EXIT_STATUS = 1
 
+const PUBSUB_SCOPE = "https://www.googleapis.com/auth/pubsub"
+
 type ResourceConfig struct {
-	GCloudDB    *sql.DB
-	Logger      *zap.Logger
-	TokenSource oauth2.TokenSource
+	Config       config.Config
+	GCloudDB     *sql.DB
+	Repositories persistence.Repositories
+	Transactor   persistence.Transactor
+	Health       *health.Checker
+	Metrics      *metrics.Metrics
+	RateLimiter  *ratelimit.Limiter
+	Logger       *zap.Logger
+	TokenSource  oauth2.TokenSource
+	Functions    *client.Registry
+	// InProcessFunctions, when set, serves every cloud function call instead of the network. Tests use it to stand in
+	// for the functions
+	InProcessFunctions http.Handler
+	// OrderEvents wakes the order event streams when the relay publishes an order's events
+	OrderEvents *realtime.Hub
 }
 
+// main only picks the command; each returns its exit status, so their deferred cleanup, such as flushing the logger,
+// runs before the process exits
 func main() {
-	dbMode := flag.String("db", "", "Database mode: 'gcp' or 'local'")
-	flag.Parse()
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		os.Exit(printConfig(os.Args[3:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		os.Exit(runWorker(os.Args[2:]))
+	}
+	os.Exit(runServer(os.Args[1:]))
+}
+
+// runServer implements `app [flags]`: it serves the API, along with the relay, dispatcher and job worker when enabled,
+// until SIGTERM or SIGINT
+func runServer(args []string) int {
+	cfg, err := config.Load(args, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		return EXIT_STATUS
+	}
+
+	logger, err := utils.NewLogger(utils.Config{Env: cfg.Env, Level: cfg.LogLevel})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: cannot instantiate logger")
+		return EXIT_STATUS
+	}
+	// flushes buffered entries, including everything logged during shutdown. Sync on a console fd reports an error on
+	// some platforms, which is safe to ignore
+	defer func() { _ = logger.Sync() }()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error("failed to set up tracing", zap.Error(err))
+		return EXIT_STATUS
+	}
+
+	// every failure from here on aborts the lifecycle, which stops whatever was started and closes what was opened
+	lifecycle := NewLifecycle(cfg.HTTP.ShutdownTimeout, logger)
+	lifecycle.DrainDelay = cfg.HTTP.DrainDelay
+	// registered first so it stops last and flushes the spans of everything that shuts down before it
+	lifecycle.OnStopWorker("tracing", shutdownTracing)
+
+	dbHandle, sqlDialect, reusableTS, err := openDatabase(cfg, logger)
+	if err != nil {
+		logger.Error("failed to set up the database", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+	lifecycle.OnClose("db", dbHandle.Close)
+
+	repos, unitOfWork := persistence.NewSQLRepositories(dbHandle, sqlDialect, logger)
+	healthChecker := newHealthChecker(cfg, dbHandle, sqlDialect, reusableTS, logger)
 
-	if *dbMode == "" {
-		log.Fatal("Error: -db flag is required. Use '-db=gcp' or '-db=local' when spinning up the server")
+	appMetrics := metrics.New()
+	if err := appMetrics.RegisterDB(dbHandle, cfg.DBMode); err != nil {
+		logger.Error("failed to register db pool metrics", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
 	}
 
-	if err := godotenv.Load("./.env"); err != nil {
-		log.Fatal("Error: cannot load env vars")
+	functionRegistry, err := client.NewRegistryFromConfig(cfg.CloudFunctions)
+	if err != nil {
+		logger.Error("failed to register cloud functions", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+
+	rateLimiter, err := newRateLimiter(cfg.RateLimit)
+	if err != nil {
+		logger.Error("failed to configure rate limiting", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+
+	resourceConfig := ResourceConfig{
+		Config:       cfg,
+		GCloudDB:     dbHandle,
+		Repositories: repos,
+		Transactor:   unitOfWork,
+		Health:       healthChecker,
+		Metrics:      appMetrics,
+		RateLimiter:  rateLimiter,
+		Functions:    functionRegistry,
+		Logger:       logger,
+		TokenSource:  reusableTS,
+		OrderEvents:  realtime.NewHub(cfg.OrderEvents.Buffer),
+	}
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, resourceConfig)
+	handler := ApplyMiddleware(mux, resourceConfig)
+
+	server := &http.Server{
+		Addr:              cfg.HTTP.Addr(),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	lifecycle.OnDrain(healthChecker.SetShuttingDown)
+	// open event streams would otherwise hold the drain up until the shutdown deadline
+	lifecycle.OnDrain(resourceConfig.OrderEvents.Close)
+
+	if cfg.Outbox.RelayEnabled {
+		publisher, err := newEventPublisher(context.Background(), cfg.Outbox, logger)
+		if err != nil {
+			logger.Error("failed to set up the event bus", zap.Error(err))
+			lifecycle.Abort()
+			return EXIT_STATUS
+		}
+		// partner webhooks and order event streams are fed from the relay whatever the bus
+		publishers := outbox.Publishers{publisher, webhook.NewFanout(repos.Webhooks, logger), resourceConfig.OrderEvents}
+		email, sms := cfg.Notifications.EmailSender != "none", cfg.Notifications.SMSProvider != "none"
+		if email || sms {
+			// the emails and texts themselves are sent by whichever process runs the jobs
+			publishers = append(publishers, notify.NewTrigger(repos.Jobs, email, sms, logger))
+		}
+		publisher = publishers
+		relay := outbox.NewRelay(persistence.NewSQLOutboxClaimer(dbHandle, sqlDialect, logger), publisher, cfg.Outbox, appMetrics, logger)
+		relay.Start()
+		lifecycle.OnStopWorker("outbox_relay", relay.Stop)
+	}
+	if cfg.Webhooks.DispatcherEnabled {
+		dispatcher := webhook.NewDispatcher(repos.Webhooks, cfg.Webhooks, appMetrics, logger)
+		dispatcher.Start()
+		lifecycle.OnStopWorker("webhook_dispatcher", dispatcher.Stop)
+	}
+	if cfg.Jobs.WorkerEnabled {
+		if err := startJobs(lifecycle, cfg, repos, appMetrics, logger); err != nil {
+			logger.Error("failed to set up background jobs", zap.Error(err))
+			lifecycle.Abort()
+			return EXIT_STATUS
+		}
 	}
 
-	logger, err := utils.NewLogger(utils.Config{Env: os.Getenv("ENV")})
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		log.Fatal("Error: cannot instantiate logger")
+		logger.Error("error starting server", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
 	}
 
+	// Cloud Run and Kubernetes send SIGTERM before killing the container; SIGINT covers ctrl-c locally
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Debug("go server initiating", zap.String("addr", server.Addr))
+	if err := lifecycle.Run(ctx, server, listener); err != nil {
+		logger.Error("server exited with errors", zap.Error(err))
+		return EXIT_STATUS
+	}
+	return 0
+}
+
+// openDatabase connects to the database cfg.DBMode selects and applies pending migrations when asked to, which SQLite
+// mode always is. The token source is only set in GCP mode
+func openDatabase(cfg config.Config, logger *zap.Logger) (*sql.DB, dialect.Dialect, oauth2.TokenSource, error) {
 	var dbHandle *sql.DB
 	var reusableTS oauth2.TokenSource
+	var err error
+	sqlDialect := dialect.Postgres
+	runMigrations := cfg.Migrate
 
-	switch *dbMode {
-	case "local":
+	switch cfg.DBMode {
+	case config.DB_MODE_LOCAL:
 		logger.Debug("Attempting to connect to local PostgreSQL database")
-		dbHandle, err = resource.NewPostgreSqlDb()
+		dbHandle, err = resource.NewPostgreSqlDb(cfg.LocalDB)
 		if err != nil {
-			logger.Error("Failed to establish connection to local PostgreSQL DB", zap.Error(err))
-			os.Exit(EXIT_STATUS)
+			return nil, sqlDialect, nil, fmt.Errorf("failed to establish connection to local PostgreSQL DB: %w", err)
 		}
-	case "gcp":
+	case config.DB_MODE_GCP:
 		logger.Debug("Attempting to connect to Google Cloud Platform SQL DB")
-		targetSA := os.Getenv("GCP_IMP_SA")
-		if targetSA == "" {
-			logger.Error("GCP_IMP_SA is not set")
-			os.Exit(EXIT_STATUS)
-		}
-
 		ctx := context.Background()
 		ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
-			TargetPrincipal: targetSA,
+			TargetPrincipal: cfg.GCP.ImpersonateServiceAccount,
 			Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
 		})
 		if err != nil {
-			logger.Error("failed to create impersonated token source: %v", zap.Error(err))
-			os.Exit(EXIT_STATUS)
+			return nil, sqlDialect, nil, fmt.Errorf("failed to create impersonated token source: %w", err)
 		}
 
 		tok, err := ts.Token()
 		if err != nil {
-			logger.Error("failed to mint impersonated token: %v", zap.Error(err))
-			os.Exit(EXIT_STATUS)
+			return nil, sqlDialect, nil, fmt.Errorf("failed to mint impersonated token: %w", err)
 		}
 
 		logger.Debug("impersonation OK; token expires at %s (in ~%s)", zap.String("expiry", tok.Expiry.Format(time.RFC3339)), zap.String("duration", time.Until(tok.Expiry).Round(time.Second).String()))
 
-		reusableTS := oauth2.ReuseTokenSource(tok, ts)
+		reusableTS = oauth2.ReuseTokenSource(tok, ts)
 
-		dbHandle, err = resource.NewGCloudDB(reusableTS)
+		dbHandle, err = resource.NewGCloudDB(reusableTS, cfg.GCP)
 		if err != nil {
-			logger.Error("could not connect to db: %v", zap.Error(err))
-			os.Exit(EXIT_STATUS)
+			return nil, sqlDialect, nil, fmt.Errorf("could not connect to db: %w", err)
 		}
-	default:
-		logger.Error("invalid db mode provided", zap.String("mode", *dbMode))
-		os.Exit(EXIT_STATUS)
+	case config.DB_MODE_SQLITE:
+		logger.Debug("Attempting to open embedded SQLite database", zap.String("path", cfg.SQLite.Path))
+		dbHandle, err = resource.NewSQLiteDb(cfg.SQLite.Path)
+		if err != nil {
+			return nil, sqlDialect, nil, fmt.Errorf("failed to open SQLite DB: %w", err)
+		}
+		sqlDialect = dialect.SQLite
+		// a fresh sqlite file is useless without its schema, so offline mode always migrates
+		runMigrations = true
 	}
 
 	logger.Debug("db connection established")
 
-	mux := http.NewServeMux()
-	SetupRoutes(mux, ResourceConfig{
-		GCloudDB:    dbHandle,
-		Logger:      logger,
-		TokenSource: reusableTS,
-	})
+	if runMigrations {
+		applied, err := migrate.Apply(context.Background(), dbHandle, sqlDialect)
+		if err != nil {
+			dbHandle.Close()
+			return nil, sqlDialect, nil, fmt.Errorf("failed to apply migrations: %w", err)
+		}
+		logger.Info("migrations applied", zap.Ints("versions", applied))
+	}
+	return dbHandle, sqlDialect, reusableTS, nil
+}
+
+// newHealthChecker assembles the readiness checks for the dependencies this process was started with
+func newHealthChecker(cfg config.Config, dbHandle *sql.DB, sqlDialect dialect.Dialect, tokenSource oauth2.TokenSource, logger *zap.Logger) *health.Checker {
+	checks := []health.Check{health.DBPing(dbHandle, cfg.Health.DBTimeout)}
+	if cfg.Health.CheckMigrations || cfg.Migrate || cfg.DBMode == config.DB_MODE_SQLITE {
+		checks = append(checks, health.Migrations(dbHandle, sqlDialect, cfg.Health.MigrationsTimeout))
+	}
+	if tokenSource != nil {
+		checks = append(checks, health.TokenSource(tokenSource, cfg.Health.TokenSourceTimeout))
+	}
+	if cfg.Health.CheckCloudFunctions && cfg.CloudFunctions.HelloWorldURL != "" {
+		checks = append(checks, health.HTTPReachable("cloud_function_hello_world", http.DefaultClient, cfg.CloudFunctions.HelloWorldURL, cfg.Health.CloudFunctionTimeout))
+	}
+	return health.NewChecker(logger, checks...)
+}
+
+// newEventPublisher builds the bus the outbox relay publishes to, see config.OutboxConfig
+func newEventPublisher(ctx context.Context, cfg config.OutboxConfig, logger *zap.Logger) (outbox.Publisher, error) {
+	switch cfg.Bus {
+	case "pubsub":
+		if cfg.PubSubEmulatorHost == "" {
+			client, err := google.DefaultClient(ctx, PUBSUB_SCOPE)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create pubsub credentials: %w", err)
+			}
+			return outbox.NewPubSubPublisher(outbox.PUBSUB_ENDPOINT, cfg.PubSubProject, cfg.PubSubTopic, client), nil
+		}
+		publisher := outbox.NewPubSubPublisher("http://"+cfg.PubSubEmulatorHost, cfg.PubSubProject, cfg.PubSubTopic, http.DefaultClient)
+		// the emulator forgets its topics on restart; the relay keeps retrying if it is not up yet
+		if err := publisher.EnsureTopic(ctx); err != nil {
+			logger.Warn("failed to create the topic on the pubsub emulator", zap.Error(err))
+		}
+		return publisher, nil
+	case "webhook":
+		return outbox.NewWebhookPublisher(cfg.WebhookURL, http.DefaultClient), nil
+	default:
+		return outbox.NewMemoryBus(), nil
+	}
+}
 
-	handler := middleware.Recoverer(logger)(middleware.RequestLogger(logger)(mux))
+// newRateLimiter builds the in-memory limiter, or returns nil when rate limiting is disabled
+func newRateLimiter(cfg config.RateLimitConfig) (*ratelimit.Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	rules, err := ratelimit.ParseRules(cfg.Default, cfg.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_DEFAULT or RATE_LIMIT_ROUTES: %w", err)
+	}
+	identifier := ratelimit.Identifier{
+		UserHeader:     cfg.UserHeader,
+		APIKeyHeader:   cfg.APIKeyHeader,
+		ClientIPHeader: cfg.ClientIPHeader,
+		TrustedProxies: cfg.TrustedProxies,
+	}
+	if strings.EqualFold(identifier.ClientIPHeader, "none") {
+		identifier.ClientIPHeader = ""
+	}
+	return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), rules, identifier), nil
+}
 
-	server := http.Server{
-		Addr:    ":8081",
-		Handler: handler,
+// printConfig implements `app config print [flags]`: it prints the resolved configuration with secrets redacted and
+// exits non-zero when the configuration would not let the server start
+func printConfig(args []string) int {
+	cfg, loadErr := config.Load(args, os.LookupEnv)
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print configuration: %v\n", err)
+		return EXIT_STATUS
 	}
-	logger.Debug("go server initiating", zap.String("addr", server.Addr))
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Error("error starting server", zap.Error(err))
+	if loadErr != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", loadErr)
+		return EXIT_STATUS
 	}
+	return 0
 }
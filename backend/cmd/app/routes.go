@@ -2,25 +2,42 @@ package main
 
 import (
 	"net/http"
-	"os"
 
+	"github.com/jshelley8117/CodeCart/internal/auth"
 	"github.com/jshelley8117/CodeCart/internal/client"
 	"github.com/jshelley8117/CodeCart/internal/handler"
-	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/health"
+	"github.com/jshelley8117/CodeCart/internal/middleware"
+	"github.com/jshelley8117/CodeCart/internal/realtime"
 	"github.com/jshelley8117/CodeCart/internal/service"
 )
 
 func SetupRoutes(mux *http.ServeMux, resourceConfig ResourceConfig) {
+	repos := resourceConfig.Repositories
+
+	// ---------- HEALTH ----------
+	healthChecker := resourceConfig.Health
+	if healthChecker == nil {
+		healthChecker = health.NewChecker(resourceConfig.Logger)
+	}
+	healthHandler := handler.NewHealthHandler(healthChecker, resourceConfig.Logger)
+
+	mux.HandleFunc("GET /healthz", healthHandler.HandleLiveness)
+	mux.HandleFunc("GET /readyz", healthHandler.HandleReadiness)
+
+	// ---------- METRICS ----------
+	if resourceConfig.Metrics != nil {
+		mux.Handle("GET /metrics", resourceConfig.Metrics.Handler())
+	}
+
 	// ---------- USERS DOMAIN ----------
-	userPersistence := persistence.NewUserPersistence(resourceConfig.GCloudDB, resourceConfig.Logger)
-	userService := service.NewUserService(userPersistence, resourceConfig.Logger)
+	userService := service.NewUserService(repos.Users, resourceConfig.Transactor, resourceConfig.Logger)
 	userHandler := handler.NewUserHandler(userService, resourceConfig.Logger)
 
 	mux.HandleFunc("POST /api/v1/users", userHandler.HandleCreateUser)
 
 	// ---------- CUSTOMERS DOMAIN ----------
-	customerPersistence := persistence.NewCustomerPersistence(resourceConfig.GCloudDB, resourceConfig.Logger)
-	customerService := service.NewCustomerService(customerPersistence, resourceConfig.Logger)
+	customerService := service.NewCustomerService(repos.Customers, resourceConfig.Transactor, resourceConfig.Logger)
 	customerHandler := handler.NewCustomerHandler(customerService, resourceConfig.Logger)
 
 	mux.HandleFunc("POST /api/v1/customers", customerHandler.HandleCreateCustomer)
@@ -29,32 +46,130 @@ func SetupRoutes(mux *http.ServeMux, resourceConfig ResourceConfig) {
 	mux.HandleFunc("PATCH /api/v1/customers/{id}", customerHandler.HandleUpdateCustomerById)
 
 	// ---------- ADDRESS DOMAIN ----------
-	addressPersistence := persistence.NewAddressPersistence(resourceConfig.GCloudDB)
-	addressService := service.NewAddressService(addressPersistence)
+	addressService := service.NewAddressService(repos.Addresses)
 	addressHandler := handler.NewAddressHandler(addressService)
 
 	mux.HandleFunc("POST /api/v1/addresses", addressHandler.HandleCreateAddress)
 	mux.HandleFunc("GET /api/v1/addresses", addressHandler.HandleGetAllAddresses)
 
 	// ---------- CLOUD FUNCTION POC DOMAIN ----------
-	cloudFunctionClient := client.NewCloudFunctionClient(resourceConfig.TokenSource, os.Getenv("GCP_IMP_SA"), resourceConfig.Logger)
-	cloudFunctionService := service.NewCloudFunctionService(
-		cloudFunctionClient,
-		os.Getenv("CLOUD_FUNCTION_HELLO_WORLD_URL"),
+	functionRegistry := resourceConfig.Functions
+	if functionRegistry == nil {
+		functionRegistry, _ = client.NewRegistry()
+	}
+	cloudFunctionClient := client.NewCloudFunctionClient(
+		resourceConfig.TokenSource,
+		resourceConfig.Config.GCP.ImpersonateServiceAccount,
+		functionRegistry,
+		resourceConfig.Config.CloudFunctions,
+		resourceConfig.Metrics,
 		resourceConfig.Logger,
 	)
+	if resourceConfig.InProcessFunctions != nil {
+		cloudFunctionClient.ServeInProcess(resourceConfig.InProcessFunctions)
+	}
+	cloudFunctionService := service.NewCloudFunctionService(cloudFunctionClient, resourceConfig.Logger)
 	cloudFunctionHandler := handler.NewCloudFunctionHandler(cloudFunctionService, resourceConfig.Logger)
 
 	mux.HandleFunc("GET /api/v1/hw", cloudFunctionHandler.HandleGetHelloWorld)
 
+	// ---------- SMS DOMAIN ----------
+	smsService := service.NewSMSService(repos.SMS, repos.Customers, resourceConfig.Config.Notifications.SMSProvider, resourceConfig.Logger)
+	smsHandler := handler.NewSMSHandler(smsService, resourceConfig.Logger)
+
+	// the provider's callbacks carry their own token and are registered only when one is configured
+	if token := resourceConfig.Config.Notifications.SMSCallbackToken; token != "" {
+		smsProviderOnly := middleware.BearerOnly("sms", token, resourceConfig.Logger)
+
+		mux.Handle("POST /api/v1/sms/status", smsProviderOnly(http.HandlerFunc(smsHandler.HandleStatusCallback)))
+		mux.Handle("POST /api/v1/sms/inbound", smsProviderOnly(http.HandlerFunc(smsHandler.HandleInbound)))
+	}
+
+	// ---------- ADMIN ----------
+	// registered only when a token is configured, so a missing ADMIN_TOKEN cannot leave them open. The webhook
+	// subscription API is admin-only as well
+	if token := resourceConfig.Config.Admin.Token; token != "" {
+		adminOnly := middleware.AdminOnly(token, resourceConfig.Logger)
+		adminHandler := handler.NewAdminHandler(cloudFunctionClient, resourceConfig.Logger)
+
+		mux.Handle("GET /api/v1/admin/functions", adminOnly(http.HandlerFunc(adminHandler.HandleListFunctions)))
+
+		// ---------- JOBS DOMAIN ----------
+		jobService := service.NewJobService(repos.Jobs, resourceConfig.Logger)
+		jobHandler := handler.NewJobHandler(jobService, resourceConfig.Logger)
+
+		mux.Handle("GET /api/v1/admin/jobs", adminOnly(http.HandlerFunc(jobHandler.HandleGetJobs)))
+		mux.Handle("GET /api/v1/admin/jobs/{id}", adminOnly(http.HandlerFunc(jobHandler.HandleGetJobById)))
+		mux.Handle("POST /api/v1/admin/jobs/{id}/retry", adminOnly(http.HandlerFunc(jobHandler.HandleRetryJob)))
+
+		// ---------- SMS DOMAIN ----------
+		mux.Handle("GET /api/v1/admin/sms/messages", adminOnly(http.HandlerFunc(smsHandler.HandleGetSMSMessages)))
+
+		// ---------- WEBHOOKS DOMAIN ----------
+		webhookService := service.NewWebhookService(repos.Webhooks, resourceConfig.Logger)
+		webhookHandler := handler.NewWebhookHandler(webhookService, resourceConfig.Logger)
+
+		mux.Handle("POST /api/v1/webhooks/subscriptions", adminOnly(http.HandlerFunc(webhookHandler.HandleCreateSubscription)))
+		mux.Handle("GET /api/v1/webhooks/subscriptions", adminOnly(http.HandlerFunc(webhookHandler.HandleGetAllSubscriptions)))
+		mux.Handle("GET /api/v1/webhooks/subscriptions/{id}", adminOnly(http.HandlerFunc(webhookHandler.HandleGetSubscriptionById)))
+		mux.Handle("PATCH /api/v1/webhooks/subscriptions/{id}", adminOnly(http.HandlerFunc(webhookHandler.HandleUpdateSubscriptionById)))
+		mux.Handle("DELETE /api/v1/webhooks/subscriptions/{id}", adminOnly(http.HandlerFunc(webhookHandler.HandleDeleteSubscriptionById)))
+		mux.Handle("GET /api/v1/webhooks/subscriptions/{id}/deliveries", adminOnly(http.HandlerFunc(webhookHandler.HandleGetDeliveries)))
+		mux.Handle("POST /api/v1/webhooks/subscriptions/{id}/deliveries/{deliveryId}/redeliver", adminOnly(http.HandlerFunc(webhookHandler.HandleRedeliver)))
+	}
+
 	// ---------- ORDERS DOMAIN ----------
-	orderPersistence := persistence.NewOrderPersistence(resourceConfig.GCloudDB, resourceConfig.Logger)
-	orderService := service.NewOrderService(orderPersistence, resourceConfig.Logger)
+	orderService := service.NewOrderService(repos.Orders, resourceConfig.Transactor, resourceConfig.Metrics, resourceConfig.Logger)
 	orderHandler := handler.NewOrderHandler(orderService, resourceConfig.Logger)
 
 	mux.HandleFunc("POST /api/v1/orders", orderHandler.HandleCreateOrder)
 	mux.HandleFunc("GET /api/v1/orders", orderHandler.HandleGetAllOrders)
-	mux.HandleFunc("GET /api/v1/orders/{id}", orderHandler.HandleGetAllOrders)
+	mux.HandleFunc("GET /api/v1/orders/{id}", orderHandler.HandleFetchOrderById)
 	mux.HandleFunc("PATCH /api/v1/orders/{id}", orderHandler.HandleUpdateOrderById)
 
+	// receipts and event streams answer the same callers: admins, and the users of the order's customer
+	orderAuthenticator := auth.NewAuthenticator(resourceConfig.Config.Auth.UserHeader, resourceConfig.Config.Admin.Token)
+	receiptService := service.NewReceiptService(repos.Orders, repos.Users, cloudFunctionClient, resourceConfig.Config.Store, resourceConfig.Logger)
+	receiptHandler := handler.NewReceiptHandler(receiptService, orderAuthenticator, resourceConfig.Logger)
+
+	mux.HandleFunc("GET /api/v1/orders/{id}/receipt", receiptHandler.HandleGetReceipt)
+
+	// the hub is fed by the outbox relay; without one nothing wakes the streams early and they rely on their poll
+	orderEventsHub := resourceConfig.OrderEvents
+	if orderEventsHub == nil {
+		orderEventsHub = realtime.NewHub(resourceConfig.Config.OrderEvents.Buffer)
+	}
+	orderEventService := service.NewOrderEventService(repos, resourceConfig.Logger)
+	orderEventsHandler := handler.NewOrderEventsHandler(
+		orderEventService,
+		orderEventsHub,
+		orderAuthenticator,
+		resourceConfig.Config.OrderEvents,
+		resourceConfig.Metrics,
+		resourceConfig.Logger,
+	)
+
+	mux.HandleFunc("GET /api/v1/orders/{id}/events", orderEventsHandler.HandleStreamOrderEvents)
+}
+
+// wraps the routed mux in the middleware chain every request goes through. The request id is assigned first so every
+// later layer can log it. CORS answers preflights before any of the remaining work. The recoverer comes next so a
+// panic anywhere further in, including in the request logger, still produces a 500. Tracing runs before the request
+// logger so every log line carries the trace id. Metrics and TraceRoute sit innermost, see middleware.RequestMetrics.
+// The rate limiter is the last layer before the mux, so rejected requests are still logged, traced and counted under
+// the route they were aimed at
+func ApplyMiddleware(mux *http.ServeMux, resourceConfig ResourceConfig) http.Handler {
+	var handler http.Handler = mux
+	if resourceConfig.RateLimiter != nil {
+		handler = middleware.RateLimit(resourceConfig.RateLimiter, mux, resourceConfig.Logger)(handler)
+	}
+	handler = middleware.TraceRoute()(handler)
+	if resourceConfig.Metrics != nil {
+		handler = middleware.RequestMetrics(resourceConfig.Metrics)(handler)
+	}
+	handler = middleware.RequestLogger(resourceConfig.Logger)(handler)
+	handler = middleware.Tracing()(handler)
+	handler = middleware.Recoverer(resourceConfig.Logger)(handler)
+	handler = middleware.CORS(resourceConfig.Config.CORS)(handler)
+	return middleware.RequestId()(handler)
 }
@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/health"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/outbox"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"github.com/jshelley8117/CodeCart/internal/ratelimit"
+	"github.com/jshelley8117/CodeCart/internal/realtime"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"github.com/jshelley8117/CodeCart/internal/webhook"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// the suite drives the real mux built by SetupRoutes through the production middleware chain, with the in-memory
+// store standing in for postgres
+
+type testServer struct {
+	*httptest.Server
+	store  *memory.Store
+	header http.Header
+}
+
+func newTestServer(t *testing.T, extraRoutes ...func(mux *http.ServeMux)) testServer {
+	t.Helper()
+	return newTestServerWith(t, func(*ResourceConfig) {}, extraRoutes...)
+}
+
+// newTestServerWith lets a test adjust the ResourceConfig before the routes are built
+func newTestServerWith(t *testing.T, configure func(rc *ResourceConfig), extraRoutes ...func(mux *http.ServeMux)) testServer {
+	t.Helper()
+
+	store := memory.NewStore()
+	logger := zap.NewNop()
+
+	resourceConfig := ResourceConfig{
+		Repositories: store.Repositories(),
+		Transactor:   store,
+		Logger:       logger,
+	}
+	configure(&resourceConfig)
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, resourceConfig)
+	for _, register := range extraRoutes {
+		register(mux)
+	}
+
+	srv := httptest.NewServer(ApplyMiddleware(mux, resourceConfig))
+	t.Cleanup(srv.Close)
+	return testServer{Server: srv, store: store}
+}
+
+func (ts testServer) do(t *testing.T, method, path, body string) (*http.Response, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range ts.header {
+		req.Header[name] = values
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	return resp, respBody
+}
+
+// withHeader returns a copy of the server whose requests all carry the header
+func (ts testServer) withHeader(name, value string) testServer {
+	ts.header = ts.header.Clone()
+	if ts.header == nil {
+		ts.header = http.Header{}
+	}
+	ts.header.Set(name, value)
+	return ts
+}
+
+func (ts testServer) mustStatus(t *testing.T, method, path, body string, want int) []byte {
+	t.Helper()
+	resp, respBody := ts.do(t, method, path, body)
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s: expected status %d, got %d (body: %s)", method, path, want, resp.StatusCode, respBody)
+	}
+	return respBody
+}
+
+func decodeBody[T any](t *testing.T, body []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("failed to decode response %s: %v", body, err)
+	}
+	return v
+}
+
+func TestCustomersAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/customers",
+		`{"first_name":"Ada","last_name":"Lovelace","phone_number":"+15555550100","email":"Ada@Example.com"}`,
+		http.StatusCreated)
+
+	customers := decodeBody[[]model.Customer](t, ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK))
+	if len(customers) != 1 || customers[0].Email != "ada@example.com" {
+		t.Fatalf("unexpected customers: %+v", customers)
+	}
+	path := "/api/v1/customers/" + strconv.Itoa(customers[0].Id)
+
+	ts.mustStatus(t, http.MethodPatch, path, `{"last_name":"Byron"}`, http.StatusOK)
+	customers = decodeBody[[]model.Customer](t, ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK))
+	if customers[0].LastName != "byron" {
+		t.Errorf("expected last name to be updated, got %+v", customers[0])
+	}
+
+	if customers[0].SMSOptIn {
+		t.Errorf("expected customers not to be texted unless they opt in, got %+v", customers[0])
+	}
+
+	ts.mustStatus(t, http.MethodPatch, path, `{"locale":"es","email_opt_out":true,"sms_opt_in":true}`, http.StatusOK)
+	customers = decodeBody[[]model.Customer](t, ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK))
+	if customers[0].Locale != "es" || !customers[0].EmailOptOut || !customers[0].SMSOptIn || customers[0].LastName != "byron" {
+		t.Errorf("expected the notification preferences to be updated, got %+v", customers[0])
+	}
+
+	ts.mustStatus(t, http.MethodPatch, path, `{"locale":""}`, http.StatusOK)
+	customers = decodeBody[[]model.Customer](t, ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK))
+	if customers[0].Locale != "" || !customers[0].EmailOptOut {
+		t.Errorf("expected the customer to be back on the default locale, got %+v", customers[0])
+	}
+
+	ts.mustStatus(t, http.MethodDelete, path, "", http.StatusOK)
+	customers = decodeBody[[]model.Customer](t, ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK))
+	if len(customers) != 0 {
+		t.Errorf("expected customer to be deleted, got %+v", customers)
+	}
+}
+
+func TestCustomersAPI_Errors(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"malformed json", http.MethodPost, "/api/v1/customers", `{"first_name":`, http.StatusBadRequest},
+		{"missing email", http.MethodPost, "/api/v1/customers", `{"first_name":"a","last_name":"b"}`, http.StatusBadRequest},
+		{"invalid phone number", http.MethodPost, "/api/v1/customers", `{"first_name":"a","last_name":"b","email":"a@b.co","phone_number":"555"}`, http.StatusBadRequest},
+		{"non-numeric id on update", http.MethodPatch, "/api/v1/customers/abc", `{"first_name":"a"}`, http.StatusBadRequest},
+		{"non-numeric id on delete", http.MethodDelete, "/api/v1/customers/abc", "", http.StatusBadRequest},
+		{"invalid email on update", http.MethodPatch, "/api/v1/customers/1", `{"email":"not-an-email"}`, http.StatusBadRequest},
+		{"unsupported locale", http.MethodPost, "/api/v1/customers", `{"first_name":"a","last_name":"b","email":"a@b.co","phone_number":"+15555550100","locale":"fr"}`, http.StatusBadRequest},
+		{"unsupported locale on update", http.MethodPatch, "/api/v1/customers/1", `{"locale":"fr"}`, http.StatusBadRequest},
+		{"unsupported method", http.MethodPut, "/api/v1/customers/1", `{}`, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.mustStatus(t, tt.method, tt.path, tt.body, tt.want)
+		})
+	}
+}
+
+func TestRequestDecoding(t *testing.T) {
+	ts := newTestServer(t)
+	const order = `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`
+
+	post := func(contentType, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/orders", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(respBody)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantMessage string
+	}{
+		{"valid", "application/json; charset=utf-8", order, http.StatusCreated, ""},
+		{"missing content type", "", order, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"wrong content type", "text/plain", order, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+		{"empty body", "application/json", "", http.StatusBadRequest, "must not be empty"},
+		{"unknown field", "application/json", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP","discount":100}`, http.StatusBadRequest, `unknown field "discount"`},
+		{"trailing data", "application/json", order + `{"customer_id":2}`, http.StatusBadRequest, "single JSON object"},
+		{"wrong type", "application/json", `{"customer_id":"one","total_price":12.5,"order_type":"PICKUP"}`, http.StatusBadRequest, `field "customer_id"`},
+		{"not an object", "application/json", `[1,2]`, http.StatusBadRequest, "must be a JSON object"},
+		{"validation names json fields", "application/json", `{"total_price":12.5,"order_type":"PICKUP"}`, http.StatusBadRequest, "customer_id (required)"},
+		{"unknown order type", "application/json", `{"customer_id":1,"total_price":12.5,"order_type":"DRONE"}`, http.StatusBadRequest, "order_type (oneof)"},
+		{"too large", "application/json", `{"order_type":"` + strings.Repeat("x", 2<<20) + `"}`, http.StatusRequestEntityTooLarge, "must not be larger than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(tt.contentType, tt.body)
+			if status != tt.want || !strings.Contains(body, tt.wantMessage) {
+				t.Errorf("expected %d containing %q, got %d %q", tt.want, tt.wantMessage, status, body)
+			}
+		})
+	}
+}
+
+func TestCustomersAPI_PersistenceFailure(t *testing.T) {
+	ts := newTestServer(t)
+	ts.store.FailWith(errors.New("database is down"))
+
+	ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusInternalServerError)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/customers", `{"first_name":"a","last_name":"b","email":"a@b.co","phone_number":"+15555550100"}`, http.StatusInternalServerError)
+}
+
+func TestAddressesAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/addresses",
+		`{"user_id":1,"street_address":"1 Main St","city":"Springfield","state":"IL","zip_code":"62701","country":"US"}`,
+		http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/addresses", `{"user_id":1,"city":"Springfield"}`, http.StatusBadRequest)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/addresses", `not json`, http.StatusBadRequest)
+
+	addresses := decodeBody[[]model.Address](t, ts.mustStatus(t, http.MethodGet, "/api/v1/addresses", "", http.StatusOK))
+	if len(addresses) != 1 || addresses[0].City != "springfield" || addresses[0].IsDefault {
+		t.Fatalf("unexpected addresses: %+v", addresses)
+	}
+}
+
+func TestUsersAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"User@Example.com","customer_id":1,"gc_auth_id":"abc"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"nope","customer_id":1,"gc_auth_id":"abc"}`, http.StatusBadRequest)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"a@b.co","gc_auth_id":"abc"}`, http.StatusBadRequest)
+	ts.mustStatus(t, http.MethodGet, "/api/v1/users", "", http.StatusMethodNotAllowed)
+}
+
+func TestOrdersAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders",
+		`{"customer_id":1,"total_price":30,"order_type":"DELIVERY","address_id":4,"delivery_address":{"street_address":"1 main st"}}`,
+		http.StatusCreated)
+
+	orders := decodeBody[[]model.Order](t, ts.mustStatus(t, http.MethodGet, "/api/v1/orders", "", http.StatusOK))
+	if len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %+v", orders)
+	}
+	delivery := orders[1]
+
+	// GET by id must return the single order, not the full list
+	got := decodeBody[model.Order](t, ts.mustStatus(t, http.MethodGet, "/api/v1/orders/"+strconv.Itoa(delivery.Id), "", http.StatusOK))
+	if got.Id != delivery.Id || got.AddressId != 4 || got.Status != model.OrderStatusPending {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+
+	ts.mustStatus(t, http.MethodPatch, "/api/v1/orders/"+strconv.Itoa(delivery.Id), `{"status":"CANCELLED"}`, http.StatusOK)
+	got = decodeBody[model.Order](t, ts.mustStatus(t, http.MethodGet, "/api/v1/orders/"+strconv.Itoa(delivery.Id), "", http.StatusOK))
+	if got.Status != "CANCELLED" {
+		t.Errorf("expected status to be updated, got %s", got.Status)
+	}
+}
+
+func TestOrdersAPI_Errors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"missing order type", http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":1}`, http.StatusBadRequest},
+		{"malformed json", http.MethodPost, "/api/v1/orders", `[`, http.StatusBadRequest},
+		{"unknown order", http.MethodGet, "/api/v1/orders/999", "", http.StatusNotFound},
+		{"non-numeric id", http.MethodGet, "/api/v1/orders/abc", "", http.StatusBadRequest},
+		{"non-numeric id on update", http.MethodPatch, "/api/v1/orders/abc", `{"status":"PENDING"}`, http.StatusBadRequest},
+		{"malformed update", http.MethodPatch, "/api/v1/orders/1", `{"status":`, http.StatusBadRequest},
+		{"unknown order on update", http.MethodPatch, "/api/v1/orders/999", `{"picker":"sam"}`, http.StatusNotFound},
+		{"unknown order on status update", http.MethodPatch, "/api/v1/orders/999", `{"status":"CANCELLED"}`, http.StatusNotFound},
+		{"unsupported method", http.MethodDelete, "/api/v1/orders/1", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.mustStatus(t, tt.method, tt.path, tt.body, tt.want)
+		})
+	}
+}
+
+func TestMiddleware_RecoversFromPanics(t *testing.T) {
+	ts := newTestServer(t, func(mux *http.ServeMux) {
+		mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("handler exploded")
+		})
+	})
+
+	ts.mustStatus(t, http.MethodGet, "/panic", "", http.StatusInternalServerError)
+
+	// the server must keep serving after a recovered panic
+	ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK)
+}
+
+func TestUnknownRoute(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mustStatus(t, http.MethodGet, "/api/v1/nope", "", http.StatusNotFound)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	var dbDown atomic.Bool
+	checker := health.NewChecker(zap.NewNop(), health.Check{
+		Name: "database",
+		Run: func(ctx context.Context) (health.CheckDetail, error) {
+			if dbDown.Load() {
+				return nil, errors.New("connection refused")
+			}
+			return nil, nil
+		},
+	})
+	ts := newTestServerWith(t, func(rc *ResourceConfig) { rc.Health = checker })
+
+	ts.mustStatus(t, http.MethodGet, "/healthz", "", http.StatusOK)
+
+	report := decodeBody[health.Report](t, ts.mustStatus(t, http.MethodGet, "/readyz", "", http.StatusOK))
+	if report.Status != health.STATUS_OK || report.Checks["database"].Status != health.STATUS_OK {
+		t.Errorf("unexpected ready report: %+v", report)
+	}
+
+	dbDown.Store(true)
+	report = decodeBody[health.Report](t, ts.mustStatus(t, http.MethodGet, "/readyz", "", http.StatusServiceUnavailable))
+	if report.Checks["database"].Error != "connection refused" {
+		t.Errorf("unexpected not-ready report: %+v", report)
+	}
+	// liveness must not depend on the database
+	ts.mustStatus(t, http.MethodGet, "/healthz", "", http.StatusOK)
+
+	dbDown.Store(false)
+	checker.SetShuttingDown()
+	report = decodeBody[health.Report](t, ts.mustStatus(t, http.MethodGet, "/readyz", "", http.StatusServiceUnavailable))
+	if report.Error != health.ErrShuttingDown.Error() {
+		t.Errorf("expected shutdown to fail readiness, got %+v", report)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServerWith(t, func(rc *ResourceConfig) { rc.Metrics = metrics.New() })
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPatch, "/api/v1/orders/1", `{"status":"CANCELLED"}`, http.StatusOK)
+	ts.mustStatus(t, http.MethodGet, "/api/v1/orders/1", "", http.StatusOK)
+	ts.mustStatus(t, http.MethodGet, "/api/v1/orders/999", "", http.StatusNotFound)
+	ts.mustStatus(t, http.MethodGet, "/wp-login.php", "", http.StatusNotFound)
+
+	body := string(ts.mustStatus(t, http.MethodGet, "/metrics", "", http.StatusOK))
+	for _, want := range []string{
+		// raw paths such as /api/v1/orders/1 must collapse into their pattern
+		`codecart_http_requests_total{method="GET",route="GET /api/v1/orders/{id}",status="200"} 1`,
+		`codecart_http_requests_total{method="GET",route="GET /api/v1/orders/{id}",status="404"} 1`,
+		`codecart_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`codecart_http_request_duration_seconds_count{method="POST",route="POST /api/v1/orders"} 1`,
+		`codecart_orders_created_total{order_type="PICKUP"} 1`,
+		`codecart_orders_status_transitions_total{from="PENDING",to="CANCELLED"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %s", want)
+		}
+	}
+	if strings.Contains(body, "/api/v1/orders/1") {
+		t.Error("raw request paths leaked into metric labels")
+	}
+}
+
+func TestTracing_ContinuesCallerTraceAndTagsLogs(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	core, logs := observer.New(zap.InfoLevel)
+	ts := newTestServerWith(t, func(rc *ResourceConfig) { rc.Logger = zap.New(core) })
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/orders/1", nil)
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	var server, svc sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceId {
+			continue
+		}
+		switch span.Name() {
+		case "GET /api/v1/orders/{id}":
+			server = span
+		case "OrderService.FetchOrderById":
+			svc = span
+		}
+	}
+	if server == nil || svc == nil {
+		t.Fatalf("expected server and service spans in the caller's trace, got %d spans", len(recorder.Ended()))
+	}
+	if svc.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("service span should be a child of the server span")
+	}
+
+	tagged := logs.FilterField(zap.String("traceId", traceId)).FilterMessage("request")
+	if tagged.Len() != 1 {
+		t.Errorf("expected the access log line to carry the trace id, got %d matching entries", tagged.Len())
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	ts := newTestServerWith(t, func(rc *ResourceConfig) { rc.Logger = zap.New(core) }, func(mux *http.ServeMux) {
+		mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("handler exploded")
+		})
+	})
+
+	get := func(path, requestId string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if requestId != "" {
+			req.Header.Set(utils.REQUEST_ID_HEADER, requestId)
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, _ := get("/api/v1/customers", "caller-id-1")
+	if got := resp.Header.Get(utils.REQUEST_ID_HEADER); got != "caller-id-1" {
+		t.Errorf("expected the caller's id to be echoed, got %q", got)
+	}
+
+	resp, _ = get("/api/v1/customers", "")
+	if got := resp.Header.Get(utils.REQUEST_ID_HEADER); len(got) != 32 {
+		t.Errorf("expected a generated id, got %q", got)
+	}
+
+	resp, _ = get("/api/v1/customers", "has spaces\tand tabs")
+	if got := resp.Header.Get(utils.REQUEST_ID_HEADER); got == "has spaces\tand tabs" || got == "" {
+		t.Errorf("expected an unsafe id to be replaced, got %q", got)
+	}
+
+	resp, body := get("/api/v1/orders/abc", "caller-id-2")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "request id: caller-id-2") {
+		t.Errorf("expected the id in the error body, got %d %q", resp.StatusCode, body)
+	}
+
+	resp, body = get("/panic", "caller-id-3")
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(body, "request id: caller-id-3") {
+		t.Errorf("expected the id in the panic response, got %d %q", resp.StatusCode, body)
+	}
+	if logs.FilterMessage("panic recovered").FilterField(zap.String("requestId", "caller-id-3")).Len() != 1 {
+		t.Error("expected the panic log to carry the request id")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	rules, err := ratelimit.ParseRules("100/1m", []string{"POST /api/v1/customers=2/1m", "GET /healthz=off"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	appMetrics := metrics.New()
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Metrics = appMetrics
+		rc.RateLimiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), rules, ratelimit.Identifier{})
+	})
+
+	const customer = `{"first_name":"Ada","last_name":"Lovelace","phone_number":"+15555550100","email":"ada@example.com"}`
+	resp, _ := ts.do(t, http.MethodPost, "/api/v1/customers", customer)
+	if resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Remaining") != "1" {
+		t.Errorf("unexpected rate limit headers: %v", resp.Header)
+	}
+	ts.mustStatus(t, http.MethodPost, "/api/v1/customers", customer, http.StatusCreated)
+
+	resp, body := ts.do(t, http.MethodPost, "/api/v1/customers", customer)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "30" {
+		t.Fatalf("expected 429 with Retry-After 30, got %d %v (body: %s)", resp.StatusCode, resp.Header, body)
+	}
+	if resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Policy") != "2;w=60;burst=2" {
+		t.Errorf("unexpected rate limit headers: %v", resp.Header)
+	}
+
+	// other routes have their own buckets, and unlimited routes carry no headers at all
+	ts.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK)
+	resp, _ = ts.do(t, http.MethodGet, "/healthz", "")
+	if resp.Header.Get("RateLimit-Limit") != "" {
+		t.Errorf("expected no rate limit headers on an unlimited route, got %v", resp.Header)
+	}
+
+	metricsBody := string(ts.mustStatus(t, http.MethodGet, "/metrics", "", http.StatusOK))
+	if want := `codecart_http_requests_total{method="POST",route="POST /api/v1/customers",status="429"} 1`; !strings.Contains(metricsBody, want) {
+		t.Errorf("expected rejected requests to be counted under their route, missing %s", want)
+	}
+}
+
+func TestRateLimit_DefaultsKeyOnForwardedClient(t *testing.T) {
+	cfg, err := config.Load([]string{"-db=sqlite", "-env-file="}, func(key string) (string, bool) {
+		if key == "RATE_LIMIT_ROUTES" {
+			return "GET /api/v1/customers=1/1m", true
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	limiter, err := newRateLimiter(cfg.RateLimit)
+	if err != nil {
+		t.Fatalf("newRateLimiter returned error: %v", err)
+	}
+	ts := newTestServerWith(t, func(rc *ResourceConfig) { rc.RateLimiter = limiter })
+
+	// behind Cloud Run every request arrives from the same front end, which appends the client to X-Forwarded-For
+	first := ts.withHeader("X-Forwarded-For", "203.0.113.7")
+	second := ts.withHeader("X-Forwarded-For", "198.51.100.2")
+	first.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK)
+	second.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusOK)
+	first.mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusTooManyRequests)
+
+	// a client prepending its own entries still lands in its own bucket
+	ts.withHeader("X-Forwarded-For", "192.0.2.99, 198.51.100.2").mustStatus(t, http.MethodGet, "/api/v1/customers", "", http.StatusTooManyRequests)
+}
+
+func TestNewRateLimiter_RejectsMalformedRules(t *testing.T) {
+	_, err := newRateLimiter(config.RateLimitConfig{Enabled: true, Default: "300/1m", Routes: []string{"POST /api/v1/users=ten/1m"}, TrustedProxies: 1})
+	if err == nil || !strings.Contains(err.Error(), "POST /api/v1/users") {
+		t.Fatalf("expected rate limit rule error, got %v", err)
+	}
+
+	limiter, err := newRateLimiter(config.RateLimitConfig{Enabled: false, Routes: []string{"POST /api/v1/users=ten/1m"}})
+	if err != nil || limiter != nil {
+		t.Errorf("expected disabled rate limiting to skip the rules, got %v %v", limiter, err)
+	}
+}
+
+func TestCloudFunctionsInProcess(t *testing.T) {
+	functions := http.NewServeMux()
+	functions.HandleFunc("/HelloWorldPOC", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"Hello World from Cloud Function!"}`))
+	})
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.CloudFunctions.Functions = []string{"hello_world=GET http://localhost:8080/HelloWorldPOC;timeout=2s;attempts=2"}
+		rc.Config.Admin.Token = "admin-secret"
+		rc.Functions = mustRegistry(t, rc.Config.CloudFunctions)
+		rc.InProcessFunctions = functions
+	})
+
+	resp := decodeBody[map[string]string](t, ts.mustStatus(t, http.MethodGet, "/api/v1/hw", "", http.StatusOK))
+	if resp["message"] != "Hello World from Cloud Function!" {
+		t.Errorf("unexpected response %v", resp)
+	}
+
+	ts.mustStatus(t, http.MethodGet, "/api/v1/admin/functions", "", http.StatusUnauthorized)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/functions", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	adminResp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer adminResp.Body.Close()
+	body, _ := io.ReadAll(adminResp.Body)
+	functionsList := decodeBody[[]client.FunctionStatus](t, body)
+	want := client.FunctionStatus{Name: "hello_world", URL: "http://localhost:8080/HelloWorldPOC", Method: "GET", Timeout: "2s", MaxAttempts: 2, Circuit: "closed"}
+	if len(functionsList) != 1 || functionsList[0] != want {
+		t.Errorf("expected %+v, got %+v", want, functionsList)
+	}
+}
+
+func TestOrderReceipt(t *testing.T) {
+	// the receipt function is its own module, so a stand-in answers for it
+	functions := http.NewServeMux()
+	functions.HandleFunc("POST /Receipt", func(w http.ResponseWriter, r *http.Request) {
+		var request service.ReceiptRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Order.Lines) != 1 {
+			http.Error(w, "bad receipt request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprintf(w, "%%PDF-1.3 receipt for order %d from %s", request.Order.Id, request.Store.Name)
+	})
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.CloudFunctions.Functions = []string{"receipt=POST http://localhost:8080/Receipt"}
+		rc.Config.Store = config.StoreConfig{Name: "CodeCart", Address: "1 Main St", Currency: "USD"}
+		rc.Config.Admin.Token = "admin-secret"
+		rc.Config.Auth.UserHeader = "X-User-Id"
+		rc.Functions = mustRegistry(t, rc.Config.CloudFunctions)
+		rc.InProcessFunctions = functions
+	})
+	ts.mustStatus(t, http.MethodPost, "/api/v1/customers", `{"first_name":"Ada","last_name":"Lovelace","phone_number":"+15555550100","email":"ada@example.com"}`, http.StatusCreated)
+	customerId := ts.store.OutboxEvents()[0].AggregateId
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"ada@example.com","customer_id":`+customerId+`,"gc_auth_id":"auth-ada"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"eve@example.com","customer_id":999,"gc_auth_id":"auth-eve"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":`+customerId+`,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	order := decodeBody[[]model.Order](t, ts.mustStatus(t, http.MethodGet, "/api/v1/orders", "", http.StatusOK))[0]
+	receiptPath := "/api/v1/orders/" + strconv.Itoa(order.Id) + "/receipt"
+
+	ts.mustStatus(t, http.MethodGet, receiptPath, "", http.StatusUnauthorized)
+	ts.withHeader("X-User-Id", "auth-eve").mustStatus(t, http.MethodGet, receiptPath, "", http.StatusForbidden)
+
+	ada := ts.withHeader("X-User-Id", "auth-ada")
+	resp, body := ada.do(t, http.MethodGet, receiptPath, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the receipt, got %d (body: %s)", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/pdf" || string(body) != fmt.Sprintf("%%PDF-1.3 receipt for order %d from CodeCart", order.Id) {
+		t.Errorf("expected the function's PDF, got %q %q", ct, body)
+	}
+	ts.withHeader("Authorization", "Bearer admin-secret").mustStatus(t, http.MethodGet, receiptPath, "", http.StatusOK)
+
+	ada.mustStatus(t, http.MethodGet, "/api/v1/orders/999/receipt", "", http.StatusNotFound)
+	ada.mustStatus(t, http.MethodGet, "/api/v1/orders/abc/receipt", "", http.StatusBadRequest)
+
+	// without a registered receipt function the endpoint reports itself unavailable rather than failing
+	unconfigured := newTestServerWith(t, func(rc *ResourceConfig) { rc.Config.Admin.Token = "admin-secret" })
+	unconfigured.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	order = decodeBody[[]model.Order](t, unconfigured.mustStatus(t, http.MethodGet, "/api/v1/orders", "", http.StatusOK))[0]
+	unconfigured.withHeader("Authorization", "Bearer admin-secret").mustStatus(t, http.MethodGet, "/api/v1/orders/"+strconv.Itoa(order.Id)+"/receipt", "", http.StatusServiceUnavailable)
+}
+
+func TestAdminRoutesNeedAToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mustStatus(t, http.MethodGet, "/api/v1/admin/functions", "", http.StatusNotFound)
+}
+
+func mustRegistry(t *testing.T, cfg config.CloudFunctionsConfig) *client.Registry {
+	t.Helper()
+	registry, err := client.NewRegistryFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("failed to build the function registry: %v", err)
+	}
+	return registry
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	var received atomic.Int32
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := webhook.Verify(secret, r.Header.Get(webhook.SIGNATURE_HEADER), r.Header.Get(webhook.TIMESTAMP_HEADER), body, time.Now(), time.Minute)
+		if err != nil || r.Header.Get(webhook.EVENT_HEADER) != model.EventOrderCreated {
+			t.Errorf("unexpected delivery %s with headers %v: %v", body, r.Header, err)
+		}
+		received.Add(1)
+	}))
+	defer receiver.Close()
+
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.Admin.Token = "admin-secret"
+	})
+	admin := ts.withHeader("Authorization", "Bearer admin-secret")
+
+	ts.mustStatus(t, http.MethodGet, "/api/v1/webhooks/subscriptions", "", http.StatusUnauthorized)
+	admin.mustStatus(t, http.MethodPost, "/api/v1/webhooks/subscriptions", `{"url":"ftp://partner","event_types":["OrderCreated"]}`, http.StatusBadRequest)
+	admin.mustStatus(t, http.MethodPost, "/api/v1/webhooks/subscriptions", `{"url":"`+receiver.URL+`","event_types":["OrderShipped"]}`, http.StatusBadRequest)
+
+	created := decodeBody[model.CreateWebhookSubscriptionResponse](t, admin.mustStatus(t, http.MethodPost, "/api/v1/webhooks/subscriptions",
+		`{"url":"`+receiver.URL+`","event_types":["OrderCreated"],"description":"delivery partner"}`, http.StatusCreated))
+	secret = created.Secret
+	if !strings.HasPrefix(secret, "whsec_") || !created.Active {
+		t.Fatalf("unexpected subscription %+v", created)
+	}
+	subscriptionPath := "/api/v1/webhooks/subscriptions/" + strconv.Itoa(created.Id)
+	if listed := admin.mustStatus(t, http.MethodGet, "/api/v1/webhooks/subscriptions", "", http.StatusOK); bytes.Contains(listed, []byte(secret)) {
+		t.Errorf("the secret must only be returned on creation, got %s", listed)
+	}
+
+	// an order created now reaches the partner through the outbox relay and the dispatcher
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":1,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	relay := outbox.NewRelay(ts.store, webhook.NewFanout(ts.store.Repositories().Webhooks, zap.NewNop()), config.OutboxConfig{BatchSize: 10}, nil, zap.NewNop())
+	dispatcher := webhook.NewDispatcher(ts.store.Repositories().Webhooks, config.WebhooksConfig{BatchSize: 10, Timeout: time.Second, MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Second}, nil, zap.NewNop())
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("RelayOnce returned %v", err)
+	}
+	if attempted, err := dispatcher.DispatchOnce(context.Background()); err != nil || attempted != 1 || received.Load() != 1 {
+		t.Fatalf("expected one delivery, attempted %d and received %d (err %v)", attempted, received.Load(), err)
+	}
+
+	deliveries := decodeBody[[]model.WebhookDelivery](t, admin.mustStatus(t, http.MethodGet, subscriptionPath+"/deliveries?status=DELIVERED", "", http.StatusOK))
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].LastStatusCode != http.StatusOK {
+		t.Fatalf("unexpected delivery log %+v", deliveries)
+	}
+	admin.mustStatus(t, http.MethodGet, subscriptionPath+"/deliveries?status=LOST", "", http.StatusBadRequest)
+
+	redeliverPath := subscriptionPath + "/deliveries/" + strconv.FormatInt(deliveries[0].Id, 10) + "/redeliver"
+	admin.mustStatus(t, http.MethodPost, redeliverPath, "", http.StatusAccepted)
+	dispatcher.DispatchOnce(context.Background())
+	if received.Load() != 2 {
+		t.Errorf("expected the redelivery to reach the partner, received %d", received.Load())
+	}
+	admin.mustStatus(t, http.MethodPost, "/api/v1/webhooks/subscriptions/999/deliveries/"+strconv.FormatInt(deliveries[0].Id, 10)+"/redeliver", "", http.StatusNotFound)
+
+	admin.mustStatus(t, http.MethodPatch, subscriptionPath, `{"active":false}`, http.StatusOK)
+	if subscription := decodeBody[model.WebhookSubscription](t, admin.mustStatus(t, http.MethodGet, subscriptionPath, "", http.StatusOK)); subscription.Active {
+		t.Error("expected the subscription to be switched off")
+	}
+	admin.mustStatus(t, http.MethodDelete, subscriptionPath, "", http.StatusNoContent)
+	admin.mustStatus(t, http.MethodGet, subscriptionPath+"/deliveries", "", http.StatusNotFound)
+}
+
+func TestAdminJobs(t *testing.T) {
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.Admin.Token = "admin-secret"
+	})
+	admin := ts.withHeader("Authorization", "Bearer admin-secret")
+	repo := ts.store.Repositories().Jobs
+
+	ts.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs", "", http.StatusUnauthorized)
+
+	registry := jobs.NewRegistry()
+	registry.Register("email.send", func(ctx context.Context, job model.Job) error {
+		return jobs.Permanent(errors.New("mailbox does not exist"))
+	})
+	worker := jobs.NewWorker(repo, registry, config.JobsConfig{Concurrency: 1, Timeout: time.Second, MaxAttempts: 3, RetryBase: time.Second, RetryMax: time.Second}, nil, zap.NewNop())
+	id, err := jobs.Enqueue(context.Background(), repo, "email.send", map[string]string{"to": "someone@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Enqueue(context.Background(), repo, "report.build", nil); err != nil {
+		t.Fatal(err)
+	}
+	worker.WorkOnce(context.Background())
+
+	dead := decodeBody[[]model.Job](t, admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs?status=DEAD", "", http.StatusOK))
+	if len(dead) != 1 || dead[0].Id != id || dead[0].LastError != "mailbox does not exist" || dead[0].Attempts != 1 {
+		t.Fatalf("unexpected dead jobs %+v", dead)
+	}
+	if all := decodeBody[[]model.Job](t, admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs?limit=1", "", http.StatusOK)); len(all) != 1 || all[0].Type != "report.build" {
+		t.Errorf("expected the newest job only, got %+v", all)
+	}
+	if emails := decodeBody[[]model.Job](t, admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs?type=email.send", "", http.StatusOK)); len(emails) != 1 {
+		t.Errorf("expected one email job, got %+v", emails)
+	}
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs?status=LOST", "", http.StatusBadRequest)
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs?limit=0", "", http.StatusBadRequest)
+
+	jobPath := "/api/v1/admin/jobs/" + strconv.FormatInt(id, 10)
+	if job := decodeBody[model.Job](t, admin.mustStatus(t, http.MethodGet, jobPath, "", http.StatusOK)); string(job.Payload) != `{"to":"someone@example.com"}` {
+		t.Errorf("unexpected job %+v", job)
+	}
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs/999", "", http.StatusNotFound)
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/jobs/abc", "", http.StatusBadRequest)
+
+	admin.mustStatus(t, http.MethodPost, jobPath+"/retry", "", http.StatusAccepted)
+	if job := decodeBody[model.Job](t, admin.mustStatus(t, http.MethodGet, jobPath, "", http.StatusOK)); job.Status != model.JobPending || job.Attempts != 0 {
+		t.Errorf("expected the job to be pending with a fresh budget, got %+v", job)
+	}
+
+	// a worker holds the job now
+	if claimed, _ := repo.ClaimJobs(context.Background(), []string{"email.send"}, time.Now(), time.Now().Add(time.Minute), 1); len(claimed) != 1 {
+		t.Fatalf("expected to claim the retried job, got %+v", claimed)
+	}
+	admin.mustStatus(t, http.MethodPost, jobPath+"/retry", "", http.StatusConflict)
+	admin.mustStatus(t, http.MethodPost, "/api/v1/admin/jobs/999/retry", "", http.StatusNotFound)
+}
+
+func TestSMSCallbacks(t *testing.T) {
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.Admin.Token = "admin-secret"
+		rc.Config.Notifications.SMSProvider = "fake"
+		rc.Config.Notifications.SMSCallbackToken = "sms-secret"
+	})
+	provider := ts.withHeader("Authorization", "Bearer sms-secret")
+	admin := ts.withHeader("Authorization", "Bearer admin-secret")
+	repos := ts.store.Repositories()
+	ctx := context.Background()
+
+	customerId, _ := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ana", PhoneNumber: "+15555550100", SMSOptIn: true})
+	message, _, _ := repos.SMS.PersistCreateSMSMessage(ctx, model.SMSMessage{DedupeKey: "1:ready_for_pickup", CustomerId: customerId, OrderId: 1,
+		Template: "ready_for_pickup", To: "+15555550100", Body: "ready", Encoding: "GSM-7", Segments: 1, Status: model.SMSPending, Provider: "fake", CreatedAt: time.Now()})
+	if err := repos.SMS.PersistSMSMessageSent(ctx, message.Id, "fake-1", model.SMSSent, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	optedIn := func() bool {
+		customer, _ := repos.Customers.FetchCustomerById(ctx, customerId)
+		return customer.SMSOptIn
+	}
+
+	ts.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":"STOP"}`, http.StatusUnauthorized)
+	admin.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":"STOP"}`, http.StatusUnauthorized)
+
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":"thanks!"}`, http.StatusNoContent)
+	if !optedIn() {
+		t.Fatal("expected a text that is not a keyword to change nothing")
+	}
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":" stop "}`, http.StatusNoContent)
+	if optedIn() {
+		t.Fatal("expected STOP to opt the customer out")
+	}
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":"Start"}`, http.StatusNoContent)
+	if !optedIn() {
+		t.Fatal("expected START to opt the customer back in")
+	}
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550199","body":"STOP"}`, http.StatusNoContent)
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"5550100","body":"STOP"}`, http.StatusBadRequest)
+
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/status", `{"message_id":"fake-1","status":"DELIVERED"}`, http.StatusNoContent)
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/status", `{"message_id":"fake-1","status":"FAILED","error":"late"}`, http.StatusNoContent)
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/status", `{"message_id":"unknown","status":"DELIVERED"}`, http.StatusNoContent)
+	provider.mustStatus(t, http.MethodPost, "/api/v1/sms/status", `{"message_id":"fake-1","status":"READ"}`, http.StatusBadRequest)
+
+	ts.mustStatus(t, http.MethodGet, "/api/v1/admin/sms/messages", "", http.StatusUnauthorized)
+	listed := decodeBody[[]model.SMSMessage](t, admin.mustStatus(t, http.MethodGet, "/api/v1/admin/sms/messages?status=DELIVERED&customer_id="+strconv.Itoa(customerId), "", http.StatusOK))
+	if len(listed) != 1 || listed[0].Id != message.Id || listed[0].DeliveredAt == nil || listed[0].Error != "" {
+		t.Fatalf("expected the text delivered despite the late failure report, got %+v", listed)
+	}
+	if failed := decodeBody[[]model.SMSMessage](t, admin.mustStatus(t, http.MethodGet, "/api/v1/admin/sms/messages?status=FAILED", "", http.StatusOK)); len(failed) != 0 {
+		t.Errorf("expected no failed texts, got %+v", failed)
+	}
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/sms/messages?status=LOST", "", http.StatusBadRequest)
+	admin.mustStatus(t, http.MethodGet, "/api/v1/admin/sms/messages?customer_id=x", "", http.StatusBadRequest)
+
+	// without a callback token the provider routes are not there at all
+	newTestServer(t).mustStatus(t, http.MethodPost, "/api/v1/sms/inbound", `{"from":"+15555550100","body":"STOP"}`, http.StatusNotFound)
+}
+
+type sseMessage struct {
+	id, event, data string
+}
+
+// sseReader reads messages off an event stream, skipping comments and retry hints
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func (sr *sseReader) next(t *testing.T) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for sr.scanner.Scan() {
+		line := sr.scanner.Text()
+		switch {
+		case line == "":
+			if msg.event != "" {
+				return msg
+			}
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended before the next message: %v", sr.scanner.Err())
+	return msg
+}
+
+// awaitHeartbeat reads on until the next comment; only call it between messages
+func (sr *sseReader) awaitHeartbeat(t *testing.T) {
+	t.Helper()
+	for sr.scanner.Scan() {
+		if strings.HasPrefix(sr.scanner.Text(), ":") {
+			return
+		}
+	}
+	t.Fatalf("stream ended before a heartbeat: %v", sr.scanner.Err())
+}
+
+// openStream opens an event stream that is closed when the test ends
+func (ts testServer) openStream(t *testing.T, path string, header http.Header) (*http.Response, *sseReader) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	req.Header = header
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, &sseReader{scanner: bufio.NewScanner(resp.Body)}
+}
+
+func TestOrderEventStream(t *testing.T) {
+	hub := realtime.NewHub(4)
+	ts := newTestServerWith(t, func(rc *ResourceConfig) {
+		rc.Config.Admin.Token = "admin-secret"
+		rc.Config.Auth.UserHeader = "X-User-Id"
+		rc.Config.OrderEvents = config.OrderEventsConfig{Heartbeat: 10 * time.Millisecond, PollInterval: time.Hour, Retry: time.Second}
+		rc.OrderEvents = hub
+	})
+	ts.mustStatus(t, http.MethodPost, "/api/v1/customers", `{"first_name":"Ada","last_name":"Lovelace","phone_number":"+15555550100","email":"ada@example.com"}`, http.StatusCreated)
+	customerId := ts.store.OutboxEvents()[0].AggregateId
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"ada@example.com","customer_id":`+customerId+`,"gc_auth_id":"auth-ada"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/users", `{"email":"eve@example.com","customer_id":999,"gc_auth_id":"auth-eve"}`, http.StatusCreated)
+	ts.mustStatus(t, http.MethodPost, "/api/v1/orders", `{"customer_id":`+customerId+`,"total_price":12.5,"order_type":"PICKUP"}`, http.StatusCreated)
+	orders := decodeBody[[]model.Order](t, ts.mustStatus(t, http.MethodGet, "/api/v1/orders", "", http.StatusOK))
+	orderPath := "/api/v1/orders/" + strconv.Itoa(orders[0].Id)
+
+	ts.mustStatus(t, http.MethodGet, orderPath+"/events", "", http.StatusUnauthorized)
+	ts.withHeader("X-User-Id", "auth-eve").mustStatus(t, http.MethodGet, orderPath+"/events", "", http.StatusForbidden)
+	ts.withHeader("X-User-Id", "auth-ada").mustStatus(t, http.MethodGet, "/api/v1/orders/999/events", "", http.StatusNotFound)
+	ts.withHeader("X-User-Id", "auth-ada").mustStatus(t, http.MethodGet, orderPath+"/events?last_event_id=-1", "", http.StatusBadRequest)
+
+	// the stream opens with the order's history and follows its changes as the relay publishes them
+	resp, stream := ts.openStream(t, orderPath+"/events", http.Header{"X-User-Id": {"auth-ada"}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	created := stream.next(t)
+	if created.event != model.EventOrderCreated || created.id == "" {
+		t.Fatalf("expected the order's history first, got %+v", created)
+	}
+	stream.awaitHeartbeat(t)
+
+	ts.mustStatus(t, http.MethodPatch, orderPath, `{"status":"DELIVERED","driver":"Grace","estimated_ready_at":"2026-01-02T15:04:05Z"}`, http.StatusOK)
+	relay := outbox.NewRelay(ts.store, hub, config.OutboxConfig{BatchSize: 10}, nil, zap.NewNop())
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatalf("RelayOnce returned %v", err)
+	}
+	var changes []string
+	for range 3 {
+		changes = append(changes, stream.next(t).event)
+	}
+	if want := []string{model.EventOrderStatusChanged, model.EventOrderAssignmentChanged, model.EventOrderEtaChanged}; !slices.Equal(changes, want) {
+		t.Fatalf("expected %v, got %v", want, changes)
+	}
+
+	// a client resuming with Last-Event-ID only gets what it missed
+	_, resumed := ts.openStream(t, orderPath+"/events", http.Header{"Authorization": {"Bearer admin-secret"}, "Last-Event-ID": {created.id}})
+	if msg := resumed.next(t); msg.event != model.EventOrderStatusChanged {
+		t.Fatalf("expected to resume after %s, got %+v", created.id, msg)
+	}
+
+	// disconnected clients leave no subscribers behind
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Subscribers(model.AggregateOrder, strconv.Itoa(orders[0].Id)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the closed stream to unsubscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
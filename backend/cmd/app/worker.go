@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/handler"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/notify"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// runWorker implements `app worker [flags]`: it runs the background job worker and scheduler without the API, so jobs
+// can be scaled apart from the server, which should then be started with JOBS_WORKER_ENABLED=false. It takes the same
+// flags and settings as the server and serves /healthz, /readyz and /metrics on PORT for the platform's probes
+func runWorker(args []string) int {
+	cfg, err := config.Load(args, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		return EXIT_STATUS
+	}
+
+	logger, err := utils.NewLogger(utils.Config{Env: cfg.Env, Level: cfg.LogLevel})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: cannot instantiate logger")
+		return EXIT_STATUS
+	}
+	defer func() { _ = logger.Sync() }()
+	logger = logger.Named("worker")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error("failed to set up tracing", zap.Error(err))
+		return EXIT_STATUS
+	}
+
+	lifecycle := NewLifecycle(cfg.HTTP.ShutdownTimeout, logger)
+	lifecycle.DrainDelay = cfg.HTTP.DrainDelay
+	lifecycle.OnStopWorker("tracing", shutdownTracing)
+
+	dbHandle, sqlDialect, reusableTS, err := openDatabase(cfg, logger)
+	if err != nil {
+		logger.Error("failed to set up the database", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+	lifecycle.OnClose("db", dbHandle.Close)
+
+	repos, _ := persistence.NewSQLRepositories(dbHandle, sqlDialect, logger)
+	healthChecker := newHealthChecker(cfg, dbHandle, sqlDialect, reusableTS, logger)
+
+	appMetrics := metrics.New()
+	if err := appMetrics.RegisterDB(dbHandle, cfg.DBMode); err != nil {
+		logger.Error("failed to register db pool metrics", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+
+	healthHandler := handler.NewHealthHandler(healthChecker, logger)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthHandler.HandleLiveness)
+	mux.HandleFunc("GET /readyz", healthHandler.HandleReadiness)
+	mux.Handle("GET /metrics", appMetrics.Handler())
+
+	server := &http.Server{
+		Addr:              cfg.HTTP.Addr(),
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	lifecycle.OnDrain(healthChecker.SetShuttingDown)
+
+	if err := startJobs(lifecycle, cfg, repos, appMetrics, logger); err != nil {
+		logger.Error("failed to set up background jobs", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logger.Error("error starting server", zap.Error(err))
+		lifecycle.Abort()
+		return EXIT_STATUS
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("job worker running", zap.String("addr", server.Addr), zap.Int("concurrency", cfg.Jobs.Concurrency))
+	if err := lifecycle.Run(ctx, server, listener); err != nil {
+		logger.Error("worker exited with errors", zap.Error(err))
+		return EXIT_STATUS
+	}
+	return 0
+}
+
+// startJobs starts the job worker and scheduler and registers them with the lifecycle. The scheduler is registered
+// last so it stops first and enqueues nothing once the worker is winding down
+func startJobs(lifecycle *Lifecycle, cfg config.Config, repos persistence.Repositories, appMetrics *metrics.Metrics, logger *zap.Logger) error {
+	registry, schedules, err := newJobRegistry(cfg, repos, appMetrics, logger)
+	if err != nil {
+		return err
+	}
+	scheduler, err := jobs.NewScheduler(repos.Jobs, schedules, logger)
+	if err != nil {
+		return err
+	}
+
+	worker := jobs.NewWorker(repos.Jobs, registry, cfg.Jobs, appMetrics, logger)
+	worker.Start()
+	lifecycle.OnStopWorker("job_worker", worker.Stop)
+	scheduler.Start()
+	lifecycle.OnStopWorker("job_scheduler", scheduler.Stop)
+
+	logger.Info("background jobs started", zap.Strings("types", registry.Types()), zap.Int("schedules", len(schedules)))
+	return nil
+}
+
+// newJobRegistry registers the handler of every job type along with the schedules of the recurring ones
+func newJobRegistry(cfg config.Config, repos persistence.Repositories, appMetrics *metrics.Metrics, logger *zap.Logger) (*jobs.Registry, []jobs.Schedule, error) {
+	registry := jobs.NewRegistry()
+	registry.Register(jobs.PURGE_JOB_TYPE, jobs.PurgeHandler(repos.Jobs, cfg.Jobs.Retention, logger))
+
+	sender, err := notify.NewSender(cfg.Notifications)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := notify.NewSMSProvider(cfg.Notifications, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sender != nil || provider != nil {
+		storeLocation, err := cfg.Store.Location()
+		if err != nil {
+			return nil, nil, err
+		}
+		templates, err := notify.LoadTemplates(cfg.Notifications.DefaultLocale, cfg.Store.Currency, storeLocation)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sender != nil {
+			notifier := notify.NewNotifier(repos.Orders, repos.Customers, templates, sender, cfg.Store, appMetrics, logger)
+			registry.Register(notify.EMAIL_JOB_TYPE, notifier.HandleJob)
+		}
+		if provider != nil {
+			quietHours, err := notify.ParseQuietHours(cfg.Notifications.SMSQuietHours, storeLocation)
+			if err != nil {
+				return nil, nil, err
+			}
+			texter := notify.NewTexter(repos.Orders, repos.Customers, repos.SMS, templates, provider, quietHours,
+				cfg.Notifications, cfg.Store, appMetrics, logger)
+			registry.Register(notify.SMS_JOB_TYPE, texter.HandleJob)
+			logger.Info("texting customers", zap.String("provider", provider.Name()), zap.Stringer("quiet_hours", quietHours))
+		}
+	}
+
+	schedules := []jobs.Schedule{jobs.PurgeSchedule}
+	return registry, schedules, nil
+}
@@ -0,0 +1,72 @@
+// Package auth works out who is calling. The backend does not verify credentials itself: customers are authenticated
+// by the gateway in front of it, which forwards the verified identity in a header, and staff tools present the admin
+// token.
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Principal is the caller of a request. Admin callers presented the admin token and may act on any customer's data;
+// everyone else is the user the identity provider knows as AuthId
+type Principal struct {
+	AuthId string
+	Admin  bool
+}
+
+// Authenticator identifies principals from the configured user header and the admin token. Either may be empty, which
+// switches that way of identifying off
+type Authenticator struct {
+	UserHeader string
+	AdminToken string
+}
+
+func NewAuthenticator(userHeader, adminToken string) Authenticator {
+	return Authenticator{UserHeader: userHeader, AdminToken: adminToken}
+}
+
+// Identify returns the request's principal, or false when the request carries no identity it accepts
+func (a Authenticator) Identify(r *http.Request) (Principal, bool) {
+	if a.AdminToken != "" && BearerMatches(r, a.AdminToken) {
+		return Principal{Admin: true}, true
+	}
+	if a.UserHeader == "" {
+		return Principal{}, false
+	}
+	authId := parseUserInfo(r.Header.Get(a.UserHeader))
+	if authId == "" {
+		return Principal{}, false
+	}
+	return Principal{AuthId: authId}, true
+}
+
+// BearerMatches reports whether the request carries "Authorization: Bearer <token>". The comparison takes the same
+// time whatever the presented token
+func BearerMatches(r *http.Request, token string) bool {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// parseUserInfo reads the subject out of API Gateway's base64url encoded JWT claims, and takes any other value to be
+// the id itself, which is what simpler proxies and local setups send
+func parseUserInfo(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return value
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(decoded, &claims); err != nil || claims.Subject == "" {
+		return value
+	}
+	return claims.Subject
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticator_Identify(t *testing.T) {
+	authenticator := NewAuthenticator("X-Apigateway-Api-Userinfo", "admin-secret")
+	gatewayClaims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"uid-123","email":"ada@example.com"}`))
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   Principal
+		ok     bool
+	}{
+		{"admin token", map[string]string{"Authorization": "Bearer admin-secret"}, Principal{Admin: true}, true},
+		{"wrong admin token", map[string]string{"Authorization": "Bearer guess"}, Principal{}, false},
+		{"gateway claims", map[string]string{"X-Apigateway-Api-Userinfo": gatewayClaims}, Principal{AuthId: "uid-123"}, true},
+		{"plain id", map[string]string{"X-Apigateway-Api-Userinfo": "uid-456"}, Principal{AuthId: "uid-456"}, true},
+		{"anonymous", nil, Principal{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			got, ok := authenticator.Identify(r)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("expected %+v/%v, got %+v/%v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+
+	if _, ok := NewAuthenticator("", "").Identify(httptest.NewRequest("GET", "/", nil)); ok {
+		t.Error("expected nothing to be accepted without a header or token")
+	}
+}
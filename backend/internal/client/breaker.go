@@ -0,0 +1,124 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the function while its circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState int
+
+const (
+	CIRCUIT_CLOSED CircuitState = iota
+	CIRCUIT_HALF_OPEN
+	CIRCUIT_OPEN
+)
+
+func (cs CircuitState) String() string {
+	switch cs {
+	case CIRCUIT_CLOSED:
+		return "closed"
+	case CIRCUIT_HALF_OPEN:
+		return "half_open"
+	case CIRCUIT_OPEN:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops calls to a function that keeps failing. It opens after FailureThreshold consecutive failures,
+// rejects calls for OpenTimeout, then lets a single probe through (half-open): a successful probe closes the circuit,
+// a failed one opens it for another OpenTimeout
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	Now              func() time.Time
+	// OnStateChange, when set, is called with the new state after every transition, while the breaker's lock is held
+	OnStateChange func(state CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		Now:              time.Now,
+	}
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be followed by exactly one Record or Release
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CIRCUIT_OPEN:
+		if cb.Now().Sub(cb.openedAt) < cb.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		cb.transition(CIRCUIT_HALF_OPEN)
+		cb.probing = true
+		return nil
+	case CIRCUIT_HALF_OPEN:
+		// only one probe at a time; everyone else keeps failing fast until it reports back
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a call that Allow let through
+func (cb *CircuitBreaker) Record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if success {
+		cb.failures = 0
+		if cb.state != CIRCUIT_CLOSED {
+			cb.transition(CIRCUIT_CLOSED)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CIRCUIT_HALF_OPEN || cb.failures >= cb.FailureThreshold {
+		cb.openedAt = cb.Now()
+		if cb.state != CIRCUIT_OPEN {
+			cb.transition(CIRCUIT_OPEN)
+		}
+	}
+}
+
+// Release gives back a call Allow let through without judging the function, e.g. when the caller gave up on it
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) transition(state CircuitState) {
+	cb.state = state
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(state)
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+func TestServeInProcess(t *testing.T) {
+	var gotAuth, gotRequestId, gotPath string
+	functions := http.NewServeMux()
+	functions.HandleFunc("/HelloWorldPOC", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotRequestId, gotPath = r.Header.Get("Authorization"), r.Header.Get(utils.REQUEST_ID_HEADER), r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"hello from the emulator"}`))
+	})
+
+	registry, _ := NewRegistry(
+		config.FunctionSpec{Name: config.FUNCTION_HELLO_WORLD, URL: "http://localhost:8080/HelloWorldPOC", Method: http.MethodGet},
+		config.FunctionSpec{Name: "missing", URL: "http://localhost:8080/Missing", Method: http.MethodGet},
+	)
+	cfc := NewCloudFunctionClient(nil, "", registry, testCloudFunctionsConfig, nil, zap.NewNop())
+	cfc.ServeInProcess(functions)
+
+	ctx := utils.WithRequestId(context.Background(), "req-1")
+	resp, err := Invoke[NoRequest, helloWorldResponse](ctx, cfc, config.FUNCTION_HELLO_WORLD, NoRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Message != "hello from the emulator" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if gotAuth != "Bearer "+EMULATOR_ID_TOKEN || gotRequestId != "req-1" || gotPath != "/HelloWorldPOC" {
+		t.Errorf("unexpected request: auth %q, request id %q, path %q", gotAuth, gotRequestId, gotPath)
+	}
+
+	// statuses pass through untouched, so retries and the breaker behave as they would over the network
+	if _, err := Invoke[NoRequest, helloWorldResponse](ctx, cfc, "missing", NoRequest{}); err == nil {
+		t.Error("expected a 404 from the in-process mux to fail the call")
+	}
+}
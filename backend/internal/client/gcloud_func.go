@@ -7,124 +7,278 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
-	"google.golang.org/api/impersonate"
 )
 
 type CloudFunctionClient struct {
 	HttpClient          *http.Client
+	Registry            *Registry
+	RetryPolicy         RetryPolicy
+	Metrics             *metrics.Metrics
 	Logger              *zap.Logger
 	TokenSource         oauth2.TokenSource
 	ServiceAccountEmail string
+	// IdToken returns the bearer token for a function URL. It is backed by an IdTokenCache over an ImpersonatedMinter
+	// for ServiceAccountEmail unless replaced, e.g. in tests
+	IdToken func(ctx context.Context, audience string) (string, error)
+
+	breakerFailures    int
+	breakerOpenTimeout time.Duration
+	breakersMu         sync.Mutex
+	breakers           map[string]*CircuitBreaker
 }
 
-func NewCloudFunctionClient(tokenSource oauth2.TokenSource, serviceAccountEmail string, logger *zap.Logger) *CloudFunctionClient {
-	return &CloudFunctionClient{
+func NewCloudFunctionClient(tokenSource oauth2.TokenSource, serviceAccountEmail string, registry *Registry, cfg config.CloudFunctionsConfig, metrics *metrics.Metrics, logger *zap.Logger) *CloudFunctionClient {
+	cfc := &CloudFunctionClient{
 		HttpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: cfg.Timeout,
 		},
+		Registry:            registry,
+		RetryPolicy:         NewRetryPolicy(max(cfg.MaxAttempts, 1), cfg.BackoffBase, cfg.BackoffMax),
+		Metrics:             metrics,
 		Logger:              logger.Named("cloud_function_client"),
 		TokenSource:         tokenSource,
 		ServiceAccountEmail: serviceAccountEmail,
+		breakerFailures:     max(cfg.BreakerFailures, 1),
+		breakerOpenTimeout:  cfg.BreakerOpenTimeout,
+		breakers:            make(map[string]*CircuitBreaker),
+	}
+	if cfg.Emulator {
+		cfc.Logger.Info("cloud functions in emulator mode, ID tokens are stubbed")
+		cfc.IdToken = emulatorIdToken
+	} else {
+		cfc.IdToken = NewIdTokenCache(ImpersonatedMinter{ServiceAccountEmail: serviceAccountEmail}, cfg.IdTokenRefreshBefore, cfc.Logger).Token
+	}
+	return cfc
+}
+
+// Breaker returns the circuit breaker guarding the named function, creating it on first use
+func (cfc *CloudFunctionClient) Breaker(name string) *CircuitBreaker {
+	cfc.breakersMu.Lock()
+	defer cfc.breakersMu.Unlock()
+
+	if breaker, ok := cfc.breakers[name]; ok {
+		return breaker
+	}
+	breaker := NewCircuitBreaker(cfc.breakerFailures, cfc.breakerOpenTimeout)
+	breaker.OnStateChange = func(state CircuitState) {
+		cfc.Logger.Warn("cloud function circuit changed state", zap.String("function", name), zap.Stringer("state", state))
+		cfc.Metrics.SetCloudFunctionCircuitState(name, int(state))
+	}
+	cfc.Metrics.SetCloudFunctionCircuitState(name, int(CIRCUIT_CLOSED))
+	cfc.breakers[name] = breaker
+	return breaker
+}
+
+// FunctionStatus describes a registered function and the current state of its circuit
+type FunctionStatus struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Method      string `json:"method"`
+	Timeout     string `json:"timeout"`
+	MaxAttempts int    `json:"max_attempts"`
+	Circuit     string `json:"circuit"`
+}
+
+// Functions reports every registered function ordered by name
+func (cfc *CloudFunctionClient) Functions() []FunctionStatus {
+	specs := cfc.Registry.List()
+	statuses := make([]FunctionStatus, 0, len(specs))
+	for _, spec := range specs {
+		maxAttempts := spec.MaxAttempts
+		if maxAttempts == 0 {
+			maxAttempts = cfc.RetryPolicy.MaxAttempts
+		}
+		timeout := spec.Timeout
+		if timeout == 0 {
+			timeout = cfc.HttpClient.Timeout
+		}
+		statuses = append(statuses, FunctionStatus{
+			Name:        spec.Name,
+			URL:         spec.URL,
+			Method:      spec.Method,
+			Timeout:     timeout.String(),
+			MaxAttempts: maxAttempts,
+			Circuit:     cfc.Breaker(spec.Name).State().String(),
+		})
 	}
+	return statuses
 }
 
-func (cfc *CloudFunctionClient) invokeFunction(ctx context.Context, url, method string, requestBody, response any) error {
+// invokeFunction calls the function at url and records the call's latency and outcome under name. Idempotent calls
+// that fail with a transport error or a retryable status are attempted again per RetryPolicy, and every attempt goes
+// through the function's circuit breaker
+func (cfc *CloudFunctionClient) invokeFunction(ctx context.Context, spec config.FunctionSpec, requestBody, response any) (err error) {
+	name, url, method := spec.Name, spec.URL, spec.Method
 	cfc.Logger.Debug("invoking cloud function",
+		zap.String("function", name),
 		zap.String("url", url),
 		zap.String("method", method))
 
-	var req *http.Request
-	var err error
+	ctx, span := tracing.Start(ctx, "cloud_function "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(method), semconv.URLFull(url)),
+	)
+	defer span.End()
 
+	start := time.Now()
+	failure := ""
+	defer func() {
+		if err != nil && failure == "" {
+			failure = "request"
+		}
+		tracing.RecordError(span, err)
+		cfc.Metrics.ObserveCloudFunctionCall(name, failure, time.Since(start))
+	}()
+
+	var bodyBytes []byte
 	if requestBody != nil {
-		bodyBytes, err := json.Marshal(requestBody)
+		bodyBytes, err = json.Marshal(requestBody)
 		if err != nil {
 			cfc.Logger.Error("failed to marshal request body", zap.Error(err))
 			return fmt.Errorf("failed to marshal request body: %w", err)
 		}
-
-		req, err = http.NewRequestWithContext(ctx, method, url, io.NopCloser(bytes.NewReader(bodyBytes)))
-		if err != nil {
-			cfc.Logger.Error("failed to create request", zap.Error(err))
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequestWithContext(ctx, method, url, nil)
-		if err != nil {
-			cfc.Logger.Error("failed to create request", zap.Error(err))
-			return fmt.Errorf("failed to create request: %w", err)
-		}
 	}
 
-	idToken, err := cfc.getIdToken(ctx, url)
+	idToken, err := cfc.IdToken(ctx, url)
 	if err != nil {
+		failure = "token"
 		cfc.Logger.Error("failed to get ID token", zap.Error(err))
 		return fmt.Errorf("failed to get ID token: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", idToken))
+	breaker := cfc.Breaker(name)
+	for attempt := 1; ; attempt++ {
+		if err := breaker.Allow(); err != nil {
+			failure = "circuit_open"
+			cfc.Logger.Warn("cloud function call rejected", zap.String("function", name), zap.Error(err))
+			return fmt.Errorf("cloud function %s unavailable: %w", name, err)
+		}
 
-	resp, err := cfc.HttpClient.Do(req)
-	if err != nil {
-		cfc.Logger.Error("failed to invoke cloud function", zap.Error(err))
-		return fmt.Errorf("failed to invoke cloud function: %w", err)
-	}
-	defer resp.Body.Close()
+		resp, body, err := cfc.attempt(ctx, spec, bodyBytes, idToken)
+		var retryAfter time.Duration
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// the caller gave up, which says nothing about the function's health
+			breaker.Release()
+			failure = "transport"
+			cfc.Logger.Error("failed to invoke cloud function", zap.Error(err))
+			return fmt.Errorf("failed to invoke cloud function: %w", err)
+		case err != nil:
+			breaker.Record(false)
+			failure = "transport"
+			cfc.Logger.Error("failed to invoke cloud function", zap.Int("attempt", attempt), zap.Error(err))
+			err = fmt.Errorf("failed to invoke cloud function: %w", err)
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			breaker.Record(true)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			return cfc.decodeResponse(body, response, &failure)
+		default:
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			// a 4xx means the function is up and rejected this particular call
+			breaker.Record(resp.StatusCode < 500 && !isRetryableStatus(resp.StatusCode))
+			failure = fmt.Sprintf("status_%dxx", resp.StatusCode/100)
+			cfc.Logger.Error("cloud function returned a non-success status",
+				zap.Int("attempt", attempt),
+				zap.Int("status", resp.StatusCode),
+				zap.String("body", string(body)))
+			err = fmt.Errorf("cloud function returned status %d: %s", resp.StatusCode, string(body))
+			if !isRetryableStatus(resp.StatusCode) {
+				return err
+			}
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		cfc.Logger.Error("failed to read response body", zap.Error(err))
-		return fmt.Errorf("failed to read response body: %w", err)
+		// once this failure has opened the circuit, another attempt would only be rejected after the backoff
+		maxAttempts := cfc.RetryPolicy.MaxAttempts
+		if spec.MaxAttempts > 0 {
+			maxAttempts = spec.MaxAttempts
+		}
+		if !isIdempotent(method) || attempt >= maxAttempts || breaker.State() == CIRCUIT_OPEN {
+			return err
+		}
+		wait, ok := cfc.RetryPolicy.delay(attempt, retryAfter)
+		if !ok {
+			cfc.Logger.Warn("not retrying, Retry-After exceeds the maximum backoff", zap.Duration("retryAfter", retryAfter))
+			return err
+		}
+
+		cfc.Logger.Warn("retrying cloud function call", zap.String("function", name), zap.Int("attempt", attempt), zap.Duration("wait", wait))
+		cfc.Metrics.CloudFunctionRetried(name)
+		span.AddEvent("retry", trace.WithAttributes(semconv.HTTPRequestResendCount(attempt)))
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return err
+		}
+		failure = ""
 	}
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		cfc.Logger.Error("cloud function returned a non-success status",
-			zap.Int("status", resp.StatusCode),
-			zap.String("body", string(body)))
-		return fmt.Errorf("cloud function returned status %d: %s", resp.StatusCode, string(body))
+// attempt makes a single request, bounded by the function's timeout on top of the client's. The response body has been
+// read and closed when it returns
+func (cfc *CloudFunctionClient) attempt(ctx context.Context, spec config.FunctionSpec, bodyBytes []byte, idToken string) (*http.Response, []byte, error) {
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.Timeout)
+		defer cancel()
 	}
 
-	if response != nil {
-		if err := json.Unmarshal(body, response); err != nil {
-			cfc.Logger.Error("failed to unmarshal response", zap.Error(err))
-			return fmt.Errorf("failed to unmarshal response: %w", err)
-		}
+	var reqBody io.Reader
+	if bodyBytes != nil {
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, spec.Method, spec.URL, reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if bodyBytes != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	return nil
-}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", idToken))
+	if reqId := utils.RequestIdFromContext(ctx); reqId != "" {
+		req.Header.Set(utils.REQUEST_ID_HEADER, reqId)
+	}
+	// adds traceparent so the function's spans join this request's trace
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-func (cfc *CloudFunctionClient) getIdToken(ctx context.Context, audience string) (string, error) {
-	ts, err := impersonate.IDTokenSource(ctx, impersonate.IDTokenConfig{
-		Audience:        audience,
-		TargetPrincipal: cfc.ServiceAccountEmail,
-		IncludeEmail:    true,
-	})
+	resp, err := cfc.HttpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to create impersonated ID token source: %w", err)
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
-	token, err := ts.Token()
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to get impersonated ID token: %w", err)
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
-
-	return token.AccessToken, nil
+	return resp, body, nil
 }
 
-func (cfc *CloudFunctionClient) InvokeHelloWorld(ctx context.Context, url string) (*HelloWorldResponse, error) {
-	var response HelloWorldResponse
-	if err := cfc.invokeFunction(ctx, url, http.MethodGet, nil, &response); err != nil {
-		return nil, err
+func (cfc *CloudFunctionClient) decodeResponse(body []byte, response any, failure *string) error {
+	if response == nil {
+		return nil
 	}
-	return &response, nil
-}
-
-type HelloWorldResponse struct {
-	Message string `json:"message"`
+	// functions answering with a document rather than JSON, e.g. the receipt PDF, are read as-is
+	if raw, ok := response.(*[]byte); ok {
+		*raw = body
+		return nil
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		*failure = "decode"
+		cfc.Logger.Error("failed to unmarshal response", zap.Error(err))
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"go.uber.org/zap"
+)
+
+var testCloudFunctionsConfig = config.CloudFunctionsConfig{
+	Timeout:            time.Second,
+	MaxAttempts:        3,
+	BackoffBase:        time.Millisecond,
+	BackoffMax:         50 * time.Millisecond,
+	BreakerFailures:    3,
+	BreakerOpenTimeout: time.Minute,
+}
+
+// newTestClient points a client at handler with a fixed ID token and jitter turned off
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*CloudFunctionClient, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	registry, _ := NewRegistry(config.FunctionSpec{Name: config.FUNCTION_HELLO_WORLD, URL: srv.URL, Method: http.MethodGet})
+	cfc := NewCloudFunctionClient(nil, "", registry, testCloudFunctionsConfig, metrics.New(), zap.NewNop())
+	cfc.IdToken = func(context.Context, string) (string, error) { return "test-token", nil }
+	cfc.RetryPolicy.Jitter = func(d time.Duration) time.Duration { return d }
+	return cfc, srv
+}
+
+// testSpec describes a function named "fn" at url
+func testSpec(url, method string) config.FunctionSpec {
+	return config.FunctionSpec{Name: "fn", URL: url, Method: method}
+}
+
+type helloWorldResponse struct {
+	Message string `json:"message"`
+}
+
+// respondInSequence answers with the given statuses in order, repeating the last one, and counts the calls
+func respondInSequence(calls *atomic.Int32, statuses ...int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		if status == http.StatusOK {
+			w.Write([]byte(`{"message":"hello"}`))
+			return
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func TestInvokeFunction_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	cfc, _ := newTestClient(t, respondInSequence(&calls, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK))
+
+	resp, err := Invoke[NoRequest, helloWorldResponse](context.Background(), cfc, config.FUNCTION_HELLO_WORLD, NoRequest{})
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if resp.Message != "hello" || calls.Load() != 3 {
+		t.Errorf("expected 3 calls and the decoded response, got %d calls and %+v", calls.Load(), resp)
+	}
+	if state := cfc.Breaker("hello_world").State(); state != CIRCUIT_CLOSED {
+		t.Errorf("expected the circuit to stay closed after a success, got %s", state)
+	}
+}
+
+func TestInvokeFunction_DoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{"non-idempotent method", http.MethodPost, http.StatusServiceUnavailable},
+		{"client error", http.MethodGet, http.StatusBadRequest},
+		{"non-retryable server error", http.MethodGet, http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			cfc, srv := newTestClient(t, respondInSequence(&calls, tt.status))
+
+			err := cfc.invokeFunction(context.Background(), testSpec(srv.URL, tt.method), map[string]string{}, nil)
+			if err == nil || calls.Load() != 1 {
+				t.Errorf("expected a single failed attempt, got %d calls and err %v", calls.Load(), err)
+			}
+		})
+	}
+}
+
+func TestInvokeFunction_HonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	var firstCall time.Time
+	cfc, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			firstCall = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"message":"hello"}`))
+	})
+
+	// Retry-After beyond the maximum backoff fails immediately rather than holding the caller
+	err := cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil)
+	if err == nil || calls.Load() != 1 {
+		t.Fatalf("expected to give up after one call, got %d calls and err %v", calls.Load(), err)
+	}
+
+	calls.Store(0)
+	cfc.RetryPolicy.MaxDelay = 2 * time.Second
+	if err := cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if waited := time.Since(firstCall); waited < time.Second {
+		t.Errorf("expected to wait for Retry-After, retried after %s", waited)
+	}
+}
+
+func TestInvokeFunction_StopsRetryingWhenCallerGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	cfc, srv := newTestClient(t, respondInSequence(&calls, http.StatusServiceUnavailable))
+	cfc.RetryPolicy.BaseDelay = time.Minute
+	cfc.RetryPolicy.MaxDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cfc.invokeFunction(ctx, testSpec(srv.URL, http.MethodGet), nil, nil); err == nil || calls.Load() != 1 {
+		t.Errorf("expected the backoff to be cut short, got %d calls and err %v", calls.Load(), err)
+	}
+}
+
+func TestInvokeFunction_CircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	healthy := atomic.Bool{}
+	cfc, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if healthy.Load() {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	now := time.Now()
+	breaker := cfc.Breaker("fn")
+	breaker.Now = func() time.Time { return now }
+
+	// three failed attempts of the first call open the circuit
+	cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil)
+	if breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("expected the circuit to open, got %s", breaker.State())
+	}
+
+	err := cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) || calls.Load() != 3 {
+		t.Fatalf("expected an open circuit to fail fast, got %d calls and err %v", calls.Load(), err)
+	}
+
+	// after the open timeout a failed probe re-opens the circuit straight away
+	now = now.Add(testCloudFunctionsConfig.BreakerOpenTimeout)
+	cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil)
+	if breaker.State() != CIRCUIT_OPEN || calls.Load() != 4 {
+		t.Fatalf("expected a single failed probe to re-open the circuit, got %s after %d calls", breaker.State(), calls.Load())
+	}
+
+	now = now.Add(testCloudFunctionsConfig.BreakerOpenTimeout)
+	healthy.Store(true)
+	if err := cfc.invokeFunction(context.Background(), testSpec(srv.URL, http.MethodGet), nil, nil); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if breaker.State() != CIRCUIT_CLOSED {
+		t.Errorf("expected a successful probe to close the circuit, got %s", breaker.State())
+	}
+
+	rec := httptest.NewRecorder()
+	cfc.Metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`codecart_cloud_function_circuit_state{function="fn"} 0`,
+		`codecart_cloud_function_retries_total{function="fn"} 2`,
+		`codecart_cloud_function_errors_total{function="fn",reason="circuit_open"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics output missing %s", want)
+		}
+	}
+}
+
+func TestCircuitBreaker_SingleProbeWhileHalfOpen(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(1, time.Second)
+	cb.Now = func() time.Time { return now }
+
+	cb.Allow()
+	cb.Record(false)
+	now = now.Add(time.Second)
+
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("expected the probe to be let through, got %v", err)
+	}
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected concurrent calls to be rejected during the probe, got %v", err)
+	}
+	cb.Release()
+	if err := cb.Allow(); err != nil {
+		t.Errorf("expected a released probe to free the slot, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{now.Add(-time.Second).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q): expected %s, got %s", tt.header, tt.want, got)
+		}
+	}
+}
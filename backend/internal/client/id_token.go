@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/impersonate"
+)
+
+// DEFAULT_ID_TOKEN_LIFETIME is assumed for tokens minted without an expiry. Google ID tokens are valid for an hour
+const DEFAULT_ID_TOKEN_LIFETIME = time.Hour
+
+// MINT_TIMEOUT bounds a single mint. Minting is detached from the caller that triggered it, since other callers may be
+// waiting on the same result
+const MINT_TIMEOUT = 10 * time.Second
+
+// IdTokenMinter produces a fresh ID token for an audience, i.e. the URL of the function being called
+type IdTokenMinter interface {
+	MintIdToken(ctx context.Context, audience string) (*oauth2.Token, error)
+}
+
+// ImpersonatedMinter mints ID tokens as ServiceAccountEmail through the IAM credentials API
+type ImpersonatedMinter struct {
+	ServiceAccountEmail string
+}
+
+func (im ImpersonatedMinter) MintIdToken(ctx context.Context, audience string) (*oauth2.Token, error) {
+	ts, err := impersonate.IDTokenSource(ctx, impersonate.IDTokenConfig{
+		Audience:        audience,
+		TargetPrincipal: im.ServiceAccountEmail,
+		IncludeEmail:    true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create impersonated ID token source: %w", err)
+	}
+
+	token, err := ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonated ID token: %w", err)
+	}
+	return token, nil
+}
+
+// IdTokenCache keeps one ID token per audience and mints a new one RefreshBefore it expires. Concurrent callers that
+// need the same audience refreshed share a single mint. When a refresh fails while the cached token is still valid,
+// the cached token is served and the refresh is retried on the next call
+type IdTokenCache struct {
+	Minter        IdTokenMinter
+	RefreshBefore time.Duration
+	Now           func() time.Time
+	Logger        *zap.Logger
+
+	mu     sync.Mutex
+	tokens map[string]*oauth2.Token
+	group  singleflight.Group
+}
+
+func NewIdTokenCache(minter IdTokenMinter, refreshBefore time.Duration, logger *zap.Logger) *IdTokenCache {
+	return &IdTokenCache{
+		Minter:        minter,
+		RefreshBefore: refreshBefore,
+		Now:           time.Now,
+		Logger:        logger,
+		tokens:        make(map[string]*oauth2.Token),
+	}
+}
+
+// Token returns a valid ID token for audience, minting one only when the cached token is missing or due for refresh
+func (itc *IdTokenCache) Token(ctx context.Context, audience string) (string, error) {
+	cached := itc.cached(audience)
+	now := itc.Now()
+	if cached != nil && now.Before(cached.Expiry.Add(-itc.RefreshBefore)) {
+		return cached.AccessToken, nil
+	}
+
+	result := itc.group.DoChan(audience, func() (any, error) {
+		mintCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), MINT_TIMEOUT)
+		defer cancel()
+		return itc.mint(mintCtx, audience)
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-result:
+		if res.Err == nil {
+			return res.Val.(*oauth2.Token).AccessToken, nil
+		}
+		if cached != nil && itc.Now().Before(cached.Expiry) {
+			itc.Logger.Warn("ID token refresh failed, using the cached token until it expires",
+				zap.String("audience", audience),
+				zap.Time("expiry", cached.Expiry),
+				zap.Error(res.Err))
+			return cached.AccessToken, nil
+		}
+		return "", res.Err
+	}
+}
+
+func (itc *IdTokenCache) cached(audience string) *oauth2.Token {
+	itc.mu.Lock()
+	defer itc.mu.Unlock()
+	return itc.tokens[audience]
+}
+
+func (itc *IdTokenCache) mint(ctx context.Context, audience string) (*oauth2.Token, error) {
+	token, err := itc.Minter.MintIdToken(ctx, audience)
+	if err != nil {
+		return nil, err
+	}
+	if token.Expiry.IsZero() {
+		// copy rather than modify a token the minter may hold on to
+		withExpiry := *token
+		withExpiry.Expiry = itc.Now().Add(DEFAULT_ID_TOKEN_LIFETIME)
+		token = &withExpiry
+	}
+
+	itc.mu.Lock()
+	itc.tokens[audience] = token
+	itc.mu.Unlock()
+
+	itc.Logger.Debug("minted ID token", zap.String("audience", audience), zap.Time("expiry", token.Expiry))
+	return token, nil
+}
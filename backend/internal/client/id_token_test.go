@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// fakeMinter hands out numbered tokens valid for lifetime, optionally blocking until release is closed
+type fakeMinter struct {
+	mints    atomic.Int32
+	lifetime time.Duration
+	now      func() time.Time
+	release  chan struct{}
+	err      error
+}
+
+func (fm *fakeMinter) MintIdToken(ctx context.Context, audience string) (*oauth2.Token, error) {
+	n := fm.mints.Add(1)
+	if fm.release != nil {
+		<-fm.release
+	}
+	if fm.err != nil {
+		return nil, fm.err
+	}
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("%s#%d", audience, n),
+		Expiry:      fm.now().Add(fm.lifetime),
+	}, nil
+}
+
+func newTestCache(minter *fakeMinter) (*IdTokenCache, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	minter.now = func() time.Time { return now }
+	cache := NewIdTokenCache(minter, 5*time.Minute, zap.NewNop())
+	cache.Now = minter.now
+	return cache, &now
+}
+
+func TestIdTokenCache_ReusesTokensPerAudience(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour}
+	cache, now := newTestCache(minter)
+	ctx := context.Background()
+
+	first, _ := cache.Token(ctx, "https://a")
+	second, _ := cache.Token(ctx, "https://a")
+	other, _ := cache.Token(ctx, "https://b")
+	if first != second || first == other || minter.mints.Load() != 2 {
+		t.Fatalf("expected one mint per audience, got %q %q %q after %d mints", first, second, other, minter.mints.Load())
+	}
+
+	// inside the refresh window the token is replaced ahead of its expiry
+	*now = now.Add(56 * time.Minute)
+	if refreshed, _ := cache.Token(ctx, "https://a"); refreshed == first {
+		t.Errorf("expected a token within RefreshBefore of expiry to be refreshed, still got %q", refreshed)
+	}
+}
+
+func TestIdTokenCache_ConcurrentCallersShareOneMint(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour, release: make(chan struct{})}
+	cache, _ := newTestCache(minter)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = cache.Token(context.Background(), "https://a")
+		}()
+	}
+
+	// give every caller time to join the in-flight mint before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(minter.release)
+	wg.Wait()
+
+	if minter.mints.Load() != 1 {
+		t.Errorf("expected concurrent callers to share one mint, got %d", minter.mints.Load())
+	}
+	for _, token := range tokens {
+		if token != tokens[0] {
+			t.Fatalf("expected every caller to get the same token, got %q and %q", token, tokens[0])
+		}
+	}
+}
+
+func TestIdTokenCache_ServesCachedTokenWhenRefreshFails(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour}
+	cache, now := newTestCache(minter)
+	ctx := context.Background()
+
+	cached, _ := cache.Token(ctx, "https://a")
+	minter.err = errors.New("iam unavailable")
+
+	*now = now.Add(58 * time.Minute)
+	if token, err := cache.Token(ctx, "https://a"); err != nil || token != cached {
+		t.Errorf("expected the still valid token despite the failed refresh, got %q, %v", token, err)
+	}
+
+	*now = now.Add(5 * time.Minute)
+	if _, err := cache.Token(ctx, "https://a"); err == nil {
+		t.Error("expected an error once the cached token has expired")
+	}
+}
+
+func TestIdTokenCache_CallerCancellation(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour, release: make(chan struct{})}
+	cache, _ := newTestCache(minter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.Token(ctx, "https://a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to return, got %v", err)
+	}
+
+	// the mint carries on for whoever asks next
+	close(minter.release)
+	if _, err := cache.Token(context.Background(), "https://a"); err != nil || minter.mints.Load() != 1 {
+		t.Errorf("expected the detached mint to be reused, got %v after %d mints", err, minter.mints.Load())
+	}
+}
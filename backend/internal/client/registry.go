@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+)
+
+// ErrUnknownFunction is returned when invoking a name the registry does not know
+var ErrUnknownFunction = errors.New("unknown cloud function")
+
+// Registry maps logical function names to where and how they are called. It is built once at startup and read-only
+// afterwards
+type Registry struct {
+	functions map[string]config.FunctionSpec
+}
+
+func NewRegistry(specs ...config.FunctionSpec) (*Registry, error) {
+	r := &Registry{functions: make(map[string]config.FunctionSpec, len(specs))}
+	for _, spec := range specs {
+		if _, ok := r.functions[spec.Name]; ok {
+			return nil, fmt.Errorf("cloud function %q is registered twice", spec.Name)
+		}
+		if spec.Method == "" {
+			spec.Method = http.MethodPost
+		}
+		r.functions[spec.Name] = spec
+	}
+	return r, nil
+}
+
+// NewRegistryFromConfig registers every function declared in cfg, see config.CloudFunctionsConfig.FunctionSpecs
+func NewRegistryFromConfig(cfg config.CloudFunctionsConfig) (*Registry, error) {
+	specs, err := cfg.FunctionSpecs()
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(specs...)
+}
+
+func (r *Registry) Lookup(name string) (config.FunctionSpec, bool) {
+	if r == nil {
+		return config.FunctionSpec{}, false
+	}
+	spec, ok := r.functions[name]
+	return spec, ok
+}
+
+// List returns every registered function ordered by name
+func (r *Registry) List() []config.FunctionSpec {
+	if r == nil {
+		return nil
+	}
+	specs := make([]config.FunctionSpec, 0, len(r.functions))
+	for _, spec := range r.functions {
+		specs = append(specs, spec)
+	}
+	slices.SortFunc(specs, func(a, b config.FunctionSpec) int { return strings.Compare(a.Name, b.Name) })
+	return specs
+}
+
+// Invoke calls the registered function name with request as its JSON body and decodes the JSON response into Resp. A
+// []byte Resp receives the response body undecoded. GET and HEAD functions are called without a body. Go methods cannot take type parameters, hence the client argument
+func Invoke[Req, Resp any](ctx context.Context, cfc *CloudFunctionClient, name string, request Req) (Resp, error) {
+	var response Resp
+
+	spec, ok := cfc.Registry.Lookup(name)
+	if !ok {
+		return response, fmt.Errorf("%w: %s", ErrUnknownFunction, name)
+	}
+
+	var body any
+	if spec.Method != http.MethodGet && spec.Method != http.MethodHead {
+		body = request
+	}
+	if err := cfc.invokeFunction(ctx, spec, body, &response); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// NoRequest is the request type for functions that take no input
+type NoRequest struct{}
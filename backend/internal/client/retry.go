@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed attempt is tried again
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 1 disables retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter returns a random duration in [0, d); replaced in tests to make delays deterministic
+	Jitter func(d time.Duration) time.Duration
+}
+
+func NewRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		Jitter:      fullJitter,
+	}
+}
+
+// idempotent methods can be repeated without the function doing the work twice; only these are ever retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryableStatus covers throttling, cold starts and instances being replaced. Other statuses, in particular the
+// remaining 4xx, will not change by asking again
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// delay returns how long to wait before the given retry (1 for the first retry). A Retry-After from the function wins
+// over the backoff when it is longer. ok is false when the wait would exceed MaxDelay, in which case it is better to
+// fail now than to hold the caller's request open
+func (rp RetryPolicy) delay(retry int, retryAfter time.Duration) (time.Duration, bool) {
+	backoff := rp.MaxDelay
+	if shift := retry - 1; shift < 32 {
+		backoff = min(rp.BaseDelay<<shift, rp.MaxDelay)
+	}
+	if rp.Jitter != nil {
+		backoff = rp.Jitter(backoff)
+	}
+	if retryAfter > rp.MaxDelay {
+		return 0, false
+	}
+	return max(backoff, retryAfter), true
+}
+
+// fullJitter spreads retries from many callers evenly over the backoff window so they do not arrive in waves
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// sleep waits for d unless ctx ends first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
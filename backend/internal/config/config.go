@@ -0,0 +1,583 @@
+// Package config loads the backend's settings into a typed struct. Values are resolved, highest precedence first, from
+// command line flags, the process environment, an optional .env file and finally the defaults declared on the struct.
+//
+// Every setting is described once, by its struct tags:
+//
+//	env     the environment variable (and .env key) the value is read from
+//	default the value used when the variable is unset or empty
+//	secret  redacted when the config is printed
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const DEFAULT_ENV_FILE = ".env"
+
+const (
+	DB_MODE_GCP    = "gcp"
+	DB_MODE_LOCAL  = "local"
+	DB_MODE_SQLITE = "sqlite"
+)
+
+type Config struct {
+	Env      string `env:"ENV" default:"dev"`
+	LogLevel string `env:"LOG_LEVEL"`
+	DBMode   string `env:"DB_MODE"`
+	Migrate  bool   `env:"DB_MIGRATE" default:"false"`
+
+	HTTP           HTTPConfig
+	LocalDB        LocalDBConfig
+	GCP            GCPConfig
+	SQLite         SQLiteConfig
+	CloudFunctions CloudFunctionsConfig
+	Health         HealthConfig
+	Tracing        TracingConfig
+	CORS           CORSConfig
+	RateLimit      RateLimitConfig
+	Admin          AdminConfig
+	Store          StoreConfig
+	Outbox         OutboxConfig
+	Webhooks       WebhooksConfig
+	Auth           AuthConfig
+	OrderEvents    OrderEventsConfig
+	Jobs           JobsConfig
+	Notifications  NotificationsConfig
+}
+
+type HTTPConfig struct {
+	// Cloud Run injects PORT, so the same name is used locally
+	Port string `env:"PORT" default:"8081"`
+
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" default:"15s"`
+	WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"120s"`
+	// Cloud Run sends SIGKILL 10s after SIGTERM, so in-flight requests get slightly less than that to finish
+	ShutdownTimeout time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT" default:"8s"`
+	// DrainDelay is how long the server keeps accepting connections once readiness fails, out of ShutdownTimeout
+	DrainDelay time.Duration `env:"HTTP_DRAIN_DELAY" default:"2s"`
+}
+
+func (hc HTTPConfig) Addr() string {
+	return ":" + hc.Port
+}
+
+type LocalDBConfig struct {
+	Host     string `env:"LOCAL_DB_HOST"`
+	Port     string `env:"LOCAL_DB_PORT" default:"5432"`
+	User     string `env:"LOCAL_DB_USER"`
+	Password string `env:"LOCAL_DB_PASSWORD" secret:"true"`
+	Name     string `env:"LOCAL_DB_NAME"`
+}
+
+type GCPConfig struct {
+	ImpersonateServiceAccount string `env:"GCP_IMP_SA"`
+	DBUser                    string `env:"GCP_DB_USER"`
+	DBName                    string `env:"GCP_DB_NAME"`
+	InstanceConnectionName    string `env:"GCP_INSTANCE_CONNECTION_NAME"`
+}
+
+type SQLiteConfig struct {
+	Path string `env:"SQLITE_DB_PATH" default:"codecart.db"`
+}
+
+// CloudFunctionsConfig locates the functions and sets how hard the client tries to reach them. Timeout bounds a single
+// attempt; idempotent calls are retried up to MaxAttempts times in total with jittered exponential backoff. After
+// BreakerFailures consecutive failures a function's circuit opens and calls fail fast for BreakerOpenTimeout, after
+// which a single probe decides whether it closes again
+//
+// Emulator sends calls to functions served on this machine, e.g. by cloud/functions/local, with a stub ID token instead
+// of impersonating a service account, so no GCP credentials are needed. The function code itself is never linked into
+// the backend; each function is its own module with its own dependencies
+//
+// Functions declares the functions callers can invoke by name, see FunctionSpecs
+type CloudFunctionsConfig struct {
+	Functions     []string `env:"CLOUD_FUNCTIONS"`
+	HelloWorldURL string   `env:"CLOUD_FUNCTION_HELLO_WORLD_URL"`
+	Emulator      bool     `env:"CLOUD_FUNCTION_EMULATOR" default:"false"`
+
+	Timeout            time.Duration `env:"CLOUD_FUNCTION_TIMEOUT" default:"10s"`
+	MaxAttempts        int           `env:"CLOUD_FUNCTION_MAX_ATTEMPTS" default:"3"`
+	BackoffBase        time.Duration `env:"CLOUD_FUNCTION_BACKOFF_BASE" default:"200ms"`
+	BackoffMax         time.Duration `env:"CLOUD_FUNCTION_BACKOFF_MAX" default:"5s"`
+	BreakerFailures    int           `env:"CLOUD_FUNCTION_BREAKER_FAILURES" default:"5"`
+	BreakerOpenTimeout time.Duration `env:"CLOUD_FUNCTION_BREAKER_OPEN_TIMEOUT" default:"30s"`
+
+	// IdTokenRefreshBefore is how long before expiry a cached ID token is replaced
+	IdTokenRefreshBefore time.Duration `env:"CLOUD_FUNCTION_ID_TOKEN_REFRESH_BEFORE" default:"5m"`
+}
+
+// HealthConfig bounds each readiness check separately. The optional checks only run when their dependency is in use
+type HealthConfig struct {
+	DBTimeout time.Duration `env:"HEALTH_DB_TIMEOUT" default:"1s"`
+	// CheckMigrations makes readiness wait for the schema to be at this binary's version. It is also on whenever the
+	// process applies migrations itself; a database migrated by other means would otherwise never be ready
+	CheckMigrations      bool          `env:"HEALTH_CHECK_MIGRATIONS" default:"false"`
+	MigrationsTimeout    time.Duration `env:"HEALTH_MIGRATIONS_TIMEOUT" default:"2s"`
+	TokenSourceTimeout   time.Duration `env:"HEALTH_TOKEN_SOURCE_TIMEOUT" default:"3s"`
+	CheckCloudFunctions  bool          `env:"HEALTH_CHECK_CLOUD_FUNCTIONS" default:"false"`
+	CloudFunctionTimeout time.Duration `env:"HEALTH_CLOUD_FUNCTION_TIMEOUT" default:"2s"`
+}
+
+// TracingConfig picks where spans go: "none", "stdout" or "file" for local work, "otlp" for a collector
+type TracingConfig struct {
+	Exporter     string  `env:"OTEL_TRACES_EXPORTER" default:"none"`
+	File         string  `env:"OTEL_TRACES_FILE" default:"traces.jsonl"`
+	OTLPEndpoint string  `env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	ServiceName  string  `env:"OTEL_SERVICE_NAME" default:"codecart-backend"`
+	SampleRatio  float64 `env:"OTEL_TRACES_SAMPLE_RATIO" default:"1"`
+}
+
+// CORSConfig is the cross-origin policy for browser clients. Origins are exact ("https://codecart.app") or contain a
+// single wildcard for the subdomain part ("https://*.codecart.app"); a lone "*" allows any origin. The default covers
+// the deployed storefront and admin frontends plus the local dev server
+type CORSConfig struct {
+	AllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" default:"https://codecart.app,https://*.codecart.app,http://localhost:3000"`
+	AllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE"`
+	AllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" default:"Accept,Authorization,Cache-Control,Content-Type,Last-Event-ID,X-Requested-With,X-Request-Id"`
+	ExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" default:"X-Request-Id"`
+	MaxAge           time.Duration `env:"CORS_MAX_AGE" default:"10m"`
+	AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" default:"false"`
+}
+
+// RateLimitConfig sets the per-client token buckets. Limits read "N/period[:burst]" or "off", and Routes overrides the
+// default for individual mux patterns, e.g. "POST /api/v1/users=10/1m"; they are parsed when the limiter is built. The
+// identity headers must only be set when a proxy in front of the server owns them, see ratelimit.Identifier.
+// ClientIPHeader defaults to the X-Forwarded-For that Cloud Run's front end appends to, where the connection's own
+// address is the same for every client; "none" keys on the connection address instead
+type RateLimitConfig struct {
+	Enabled        bool     `env:"RATE_LIMIT_ENABLED" default:"true"`
+	Default        string   `env:"RATE_LIMIT_DEFAULT" default:"300/1m"`
+	Routes         []string `env:"RATE_LIMIT_ROUTES" default:"POST /api/v1/users=10/1m,POST /api/v1/customers=10/1m,GET /healthz=off,GET /readyz=off,GET /metrics=off"`
+	UserHeader     string   `env:"RATE_LIMIT_USER_HEADER"`
+	APIKeyHeader   string   `env:"RATE_LIMIT_API_KEY_HEADER"`
+	ClientIPHeader string   `env:"RATE_LIMIT_CLIENT_IP_HEADER" default:"X-Forwarded-For"`
+	TrustedProxies int      `env:"RATE_LIMIT_TRUSTED_PROXIES" default:"1"`
+}
+
+// AdminConfig guards the operational endpoints under /api/v1/admin. They are not registered at all without a token
+type AdminConfig struct {
+	Token string `env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// StoreConfig is what the store prints about itself, e.g. on receipts. Timezone is where the store is, the zone the
+// times in emails and texts are written in; it is UTC when unset
+type StoreConfig struct {
+	Name     string `env:"STORE_NAME" default:"CodeCart"`
+	Address  string `env:"STORE_ADDRESS"`
+	Phone    string `env:"STORE_PHONE"`
+	Currency string `env:"STORE_CURRENCY" default:"USD"`
+	Timezone string `env:"STORE_TIMEZONE"`
+}
+
+// Location is the store's time zone
+func (sc StoreConfig) Location() (*time.Location, error) {
+	if sc.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(sc.Timezone)
+}
+
+// OutboxConfig drives the relay that publishes domain events from the outbox table. Bus picks where they go: "memory"
+// keeps them in this process, "pubsub" publishes to PubSubTopic (on the emulator when PUBSUB_EMULATOR_HOST is set) and
+// "webhook" POSTs each one to WebhookURL. Failed events are retried with exponential backoff from RetryBase to
+// RetryMax, and published ones are deleted after Retention, except order events, which the order event streams replay.
+// Those go OrderHistoryRetention after the order's last event once it is over, i.e. delivered, cancelled or refunded
+type OutboxConfig struct {
+	RelayEnabled          bool          `env:"OUTBOX_RELAY_ENABLED" default:"true"`
+	Bus                   string        `env:"OUTBOX_BUS" default:"memory"`
+	PollInterval          time.Duration `env:"OUTBOX_POLL_INTERVAL" default:"1s"`
+	BatchSize             int           `env:"OUTBOX_BATCH_SIZE" default:"100"`
+	RetryBase             time.Duration `env:"OUTBOX_RETRY_BASE" default:"1s"`
+	RetryMax              time.Duration `env:"OUTBOX_RETRY_MAX" default:"5m"`
+	PublishTimeout        time.Duration `env:"OUTBOX_PUBLISH_TIMEOUT" default:"10s"`
+	Retention             time.Duration `env:"OUTBOX_RETENTION" default:"168h"`
+	OrderHistoryRetention time.Duration `env:"OUTBOX_ORDER_HISTORY_RETENTION" default:"720h"`
+	PubSubProject         string        `env:"PUBSUB_PROJECT_ID"`
+	PubSubTopic           string        `env:"PUBSUB_TOPIC" default:"codecart-events"`
+	PubSubEmulatorHost    string        `env:"PUBSUB_EMULATOR_HOST"`
+	WebhookURL            string        `env:"OUTBOX_WEBHOOK_URL"`
+}
+
+// WebhooksConfig drives the dispatcher that delivers domain events to partner webhook subscriptions. Each delivery is
+// attempted up to MaxAttempts times, each attempt bounded by Timeout, with waits doubling from RetryBase to RetryMax;
+// after the last failure the delivery is dead until redelivered by hand
+type WebhooksConfig struct {
+	DispatcherEnabled bool          `env:"WEBHOOK_DISPATCHER_ENABLED" default:"true"`
+	PollInterval      time.Duration `env:"WEBHOOK_POLL_INTERVAL" default:"1s"`
+	BatchSize         int           `env:"WEBHOOK_BATCH_SIZE" default:"50"`
+	Timeout           time.Duration `env:"WEBHOOK_TIMEOUT" default:"10s"`
+	MaxAttempts       int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	RetryBase         time.Duration `env:"WEBHOOK_RETRY_BASE" default:"30s"`
+	RetryMax          time.Duration `env:"WEBHOOK_RETRY_MAX" default:"1h"`
+}
+
+// AuthConfig identifies customers on the routes that need to know who is calling. UserHeader carries the caller's
+// identity provider id, either as is or as the base64url encoded claims API Gateway forwards in
+// X-Apigateway-Api-Userinfo. Like the rate limiter's identity headers it must only be set when a proxy in front of the
+// server owns the header; without it only the admin token is accepted on those routes
+type AuthConfig struct {
+	UserHeader string `env:"AUTH_USER_HEADER"`
+}
+
+// OrderEventsConfig tunes the order event streams. Heartbeat is how often an idle stream sends a comment so proxies
+// keep it open, and PollInterval how often it checks the outbox for events relayed by another instance. Buffer is how
+// many events a slow client may fall behind before it catches up from the outbox instead
+type OrderEventsConfig struct {
+	Heartbeat    time.Duration `env:"ORDER_EVENTS_HEARTBEAT" default:"15s"`
+	PollInterval time.Duration `env:"ORDER_EVENTS_POLL_INTERVAL" default:"5s"`
+	Buffer       int           `env:"ORDER_EVENTS_BUFFER" default:"16"`
+	Retry        time.Duration `env:"ORDER_EVENTS_RETRY" default:"3s"`
+}
+
+// JobsConfig drives the background job worker. WorkerEnabled runs it inside the server; turn it off when the jobs are
+// left to separate `app worker` processes. Concurrency jobs run at once, each bounded by Timeout. A failed job is
+// retried with waits doubling from RetryBase to RetryMax until MaxAttempts attempts have failed, unless the job sets a
+// limit of its own, and is dead after that. Succeeded jobs are deleted after Retention
+type JobsConfig struct {
+	WorkerEnabled bool          `env:"JOBS_WORKER_ENABLED" default:"true"`
+	Concurrency   int           `env:"JOBS_CONCURRENCY" default:"4"`
+	PollInterval  time.Duration `env:"JOBS_POLL_INTERVAL" default:"1s"`
+	Timeout       time.Duration `env:"JOBS_TIMEOUT" default:"5m"`
+	MaxAttempts   int           `env:"JOBS_MAX_ATTEMPTS" default:"10"`
+	RetryBase     time.Duration `env:"JOBS_RETRY_BASE" default:"10s"`
+	RetryMax      time.Duration `env:"JOBS_RETRY_MAX" default:"1h"`
+	Retention     time.Duration `env:"JOBS_RETENTION" default:"168h"`
+}
+
+// NotificationsConfig drives the emails and texts customers get about their orders. EmailSender picks how emails
+// leave: "none" sends nothing, "smtp" hands them to the SMTP server, "file" writes each one as an .eml file into
+// EmailDir and "stdout" prints them, the last two for development. SMSProvider does the same for texts, where "fake"
+// only records them. Texts due during SMSQuietHours, a daily window in the store's time zone or "none", wait until it
+// ends; texting with quiet hours needs STORE_TIMEZONE, so they are not silently read in UTC. DefaultLocale is the
+// language of customers without one
+type NotificationsConfig struct {
+	EmailSender   string `env:"EMAIL_SENDER" default:"none"`
+	EmailFrom     string `env:"EMAIL_FROM" default:"CodeCart <orders@codecart.local>"`
+	EmailDir      string `env:"EMAIL_DIR" default:"emails"`
+	DefaultLocale string `env:"EMAIL_DEFAULT_LOCALE" default:"en"`
+	SMTPHost      string `env:"SMTP_HOST"`
+	SMTPPort      string `env:"SMTP_PORT" default:"587"`
+	SMTPUsername  string `env:"SMTP_USERNAME"`
+	SMTPPassword  string `env:"SMTP_PASSWORD" secret:"true"`
+
+	SMSProvider    string `env:"SMS_PROVIDER" default:"none"`
+	SMSFrom        string `env:"SMS_FROM"`
+	SMSMaxSegments int    `env:"SMS_MAX_SEGMENTS" default:"3"`
+	SMSQuietHours  string `env:"SMS_QUIET_HOURS" default:"21:00-08:00"`
+	// SMSCallbackToken is the bearer token the provider's delivery reports and inbound texts must carry; without one
+	// those routes are not registered
+	SMSCallbackToken string `env:"SMS_CALLBACK_TOKEN" secret:"true"`
+}
+
+// Load parses args as the server's command line flags, then resolves every setting. A missing .env file is not an
+// error. The returned config has been validated; when validation fails the partially loaded config is returned along
+// with an error that lists every problem at once
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	var cfg Config
+
+	flags := flag.NewFlagSet("codecart", flag.ContinueOnError)
+	dbMode := flags.String("db", "", "Database mode: 'gcp', 'local' or 'sqlite' (overrides DB_MODE)")
+	migrate := flags.Bool("migrate", false, "Apply pending database migrations before serving requests (overrides DB_MIGRATE)")
+	envFile := flags.String("env-file", DEFAULT_ENV_FILE, "Path to an optional .env file")
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	fileValues, err := readEnvFile(*envFile)
+	if err != nil {
+		return cfg, err
+	}
+
+	lookup := func(key string) (string, bool) {
+		if v, ok := lookupEnv(key); ok && v != "" {
+			return v, true
+		}
+		v, ok := fileValues[key]
+		return v, ok && v != ""
+	}
+
+	var problems []error
+	populate(reflect.ValueOf(&cfg).Elem(), lookup, &problems)
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DBMode = *dbMode
+		case "migrate":
+			cfg.Migrate = *migrate
+		}
+	})
+
+	problems = append(problems, cfg.validate()...)
+	return cfg, errors.Join(problems...)
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	values, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// validate reports every problem rather than stopping at the first, so a misconfigured deploy can be fixed in one go
+func (c Config) validate() []error {
+	var problems []error
+	var missing []string
+
+	require := func(value, key string) {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	switch c.DBMode {
+	case DB_MODE_LOCAL:
+		require(c.LocalDB.Host, "LOCAL_DB_HOST")
+		require(c.LocalDB.User, "LOCAL_DB_USER")
+		require(c.LocalDB.Name, "LOCAL_DB_NAME")
+	case DB_MODE_GCP:
+		require(c.GCP.ImpersonateServiceAccount, "GCP_IMP_SA")
+		require(c.GCP.DBUser, "GCP_DB_USER")
+		require(c.GCP.DBName, "GCP_DB_NAME")
+		require(c.GCP.InstanceConnectionName, "GCP_INSTANCE_CONNECTION_NAME")
+	case DB_MODE_SQLITE:
+		require(c.SQLite.Path, "SQLITE_DB_PATH")
+	case "":
+		missing = append(missing, "DB_MODE (or -db)")
+	default:
+		problems = append(problems, fmt.Errorf("DB_MODE must be one of %q, %q or %q, got %q", DB_MODE_GCP, DB_MODE_LOCAL, DB_MODE_SQLITE, c.DBMode))
+	}
+
+	if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Errorf("PORT must be a number between 1 and 65535, got %q", c.HTTP.Port))
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Errorf("HTTP_SHUTDOWN_TIMEOUT must be positive, got %s", c.HTTP.ShutdownTimeout))
+	}
+	if c.HTTP.DrainDelay < 0 || c.HTTP.DrainDelay >= c.HTTP.ShutdownTimeout {
+		problems = append(problems, fmt.Errorf("HTTP_DRAIN_DELAY must be at least 0 and less than HTTP_SHUTDOWN_TIMEOUT, got %s", c.HTTP.DrainDelay))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		require(c.Tracing.File, "OTEL_TRACES_FILE")
+	default:
+		problems = append(problems, fmt.Errorf("OTEL_TRACES_EXPORTER must be one of none, stdout, file or otlp, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, fmt.Errorf("OTEL_TRACES_SAMPLE_RATIO must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			// browsers refuse credentialed responses that allow every origin, so this combination can never work
+			if c.CORS.AllowCredentials {
+				problems = append(problems, errors.New(`CORS_ALLOWED_ORIGINS cannot contain "*" when CORS_ALLOW_CREDENTIALS is true`))
+			}
+			continue
+		}
+		if strings.Count(origin, "*") > 1 || !strings.Contains(origin, "://") {
+			problems = append(problems, fmt.Errorf("CORS_ALLOWED_ORIGINS entry %q must look like scheme://host with at most one *", origin))
+		}
+	}
+
+	specs, err := c.CloudFunctions.FunctionSpecs()
+	if err != nil {
+		problems = append(problems, fmt.Errorf("CLOUD_FUNCTIONS: %w", err))
+	}
+	for _, spec := range specs {
+		// the stub token would be rejected anyway, but a deployed URL in emulator mode is almost certainly a mistake
+		if c.CloudFunctions.Emulator && !isLoopbackURL(spec.URL) {
+			problems = append(problems, fmt.Errorf("cloud function %s must point to this machine when CLOUD_FUNCTION_EMULATOR is true, got %q", spec.Name, spec.URL))
+		}
+	}
+	if c.CloudFunctions.MaxAttempts < 1 {
+		problems = append(problems, fmt.Errorf("CLOUD_FUNCTION_MAX_ATTEMPTS must be at least 1, got %d", c.CloudFunctions.MaxAttempts))
+	}
+	if c.CloudFunctions.BreakerFailures < 1 {
+		problems = append(problems, fmt.Errorf("CLOUD_FUNCTION_BREAKER_FAILURES must be at least 1, got %d", c.CloudFunctions.BreakerFailures))
+	}
+
+	switch c.Outbox.Bus {
+	case "memory":
+	case "pubsub":
+		if c.Outbox.PubSubProject == "" || c.Outbox.PubSubTopic == "" {
+			problems = append(problems, errors.New("PUBSUB_PROJECT_ID and PUBSUB_TOPIC are required when OUTBOX_BUS is pubsub"))
+		}
+	case "webhook":
+		if u, err := url.Parse(c.Outbox.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Errorf("OUTBOX_WEBHOOK_URL must be an absolute URL when OUTBOX_BUS is webhook, got %q", c.Outbox.WebhookURL))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("OUTBOX_BUS must be one of memory, pubsub or webhook, got %q", c.Outbox.Bus))
+	}
+	if c.Outbox.BatchSize < 1 {
+		problems = append(problems, fmt.Errorf("OUTBOX_BATCH_SIZE must be at least 1, got %d", c.Outbox.BatchSize))
+	}
+	if c.Outbox.PollInterval <= 0 || c.Outbox.RetryBase <= 0 || c.Outbox.RetryMax < c.Outbox.RetryBase {
+		problems = append(problems, errors.New("OUTBOX_POLL_INTERVAL and OUTBOX_RETRY_BASE must be positive, and OUTBOX_RETRY_MAX at least OUTBOX_RETRY_BASE"))
+	}
+
+	if c.Webhooks.BatchSize < 1 || c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, fmt.Errorf("WEBHOOK_BATCH_SIZE and WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d and %d", c.Webhooks.BatchSize, c.Webhooks.MaxAttempts))
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 || c.Webhooks.RetryBase <= 0 || c.Webhooks.RetryMax < c.Webhooks.RetryBase {
+		problems = append(problems, errors.New("WEBHOOK_POLL_INTERVAL, WEBHOOK_TIMEOUT and WEBHOOK_RETRY_BASE must be positive, and WEBHOOK_RETRY_MAX at least WEBHOOK_RETRY_BASE"))
+	}
+
+	if c.OrderEvents.Heartbeat <= 0 || c.OrderEvents.PollInterval <= 0 || c.OrderEvents.Retry <= 0 || c.OrderEvents.Buffer < 1 {
+		problems = append(problems, errors.New("ORDER_EVENTS_HEARTBEAT, ORDER_EVENTS_POLL_INTERVAL and ORDER_EVENTS_RETRY must be positive, and ORDER_EVENTS_BUFFER at least 1"))
+	}
+
+	if c.Jobs.Concurrency < 1 || c.Jobs.MaxAttempts < 1 {
+		problems = append(problems, fmt.Errorf("JOBS_CONCURRENCY and JOBS_MAX_ATTEMPTS must be at least 1, got %d and %d", c.Jobs.Concurrency, c.Jobs.MaxAttempts))
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.Timeout <= 0 || c.Jobs.RetryBase <= 0 || c.Jobs.RetryMax < c.Jobs.RetryBase || c.Jobs.Retention <= 0 {
+		problems = append(problems, errors.New("JOBS_POLL_INTERVAL, JOBS_TIMEOUT, JOBS_RETRY_BASE and JOBS_RETENTION must be positive, and JOBS_RETRY_MAX at least JOBS_RETRY_BASE"))
+	}
+
+	switch c.Notifications.EmailSender {
+	case "none", "stdout":
+	case "file":
+		require(c.Notifications.EmailDir, "EMAIL_DIR")
+	case "smtp":
+		require(c.Notifications.SMTPHost, "SMTP_HOST")
+		if port, err := strconv.Atoi(c.Notifications.SMTPPort); err != nil || port < 1 || port > 65535 {
+			problems = append(problems, fmt.Errorf("SMTP_PORT must be a number between 1 and 65535, got %q", c.Notifications.SMTPPort))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("EMAIL_SENDER must be one of none, smtp, file or stdout, got %q", c.Notifications.EmailSender))
+	}
+	if c.Notifications.SMSProvider != "none" && c.Notifications.SMSProvider != "fake" {
+		problems = append(problems, fmt.Errorf("SMS_PROVIDER must be one of none or fake, got %q", c.Notifications.SMSProvider))
+	}
+	if c.Notifications.SMSMaxSegments < 1 || c.Notifications.SMSMaxSegments > 10 {
+		problems = append(problems, fmt.Errorf("SMS_MAX_SEGMENTS must be between 1 and 10, got %d", c.Notifications.SMSMaxSegments))
+	}
+	if _, err := c.Store.Location(); err != nil {
+		problems = append(problems, fmt.Errorf("STORE_TIMEZONE must be an IANA time zone such as America/New_York, got %q", c.Store.Timezone))
+	}
+	if c.Notifications.SMSProvider != "none" && c.Notifications.SMSQuietHours != "none" && c.Store.Timezone == "" {
+		problems = append(problems, errors.New("STORE_TIMEZONE must be set to read SMS_QUIET_HOURS in, or SMS_QUIET_HOURS set to none"))
+	}
+	if _, err := mail.ParseAddress(c.Notifications.EmailFrom); err != nil {
+		problems = append(problems, fmt.Errorf("EMAIL_FROM must be an email address, optionally with a name, got %q", c.Notifications.EmailFrom))
+	}
+
+	if c.RateLimit.Enabled && c.RateLimit.TrustedProxies < 1 {
+		problems = append(problems, fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES must be at least 1, got %d", c.RateLimit.TrustedProxies))
+	}
+
+	if len(missing) > 0 {
+		problems = append([]error{fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))}, problems...)
+	}
+	return problems
+}
+
+func isLoopbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// populate walks the struct, recursing into nested config structs, and sets every field that carries an env tag
+func populate(v reflect.Value, lookup func(string) (string, bool), problems *[]error) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		key, ok := field.Tag.Lookup("env")
+		if !ok {
+			if value.Kind() == reflect.Struct {
+				populate(value, lookup, problems)
+			}
+			continue
+		}
+
+		raw, ok := lookup(key)
+		if !ok {
+			raw = field.Tag.Get("default")
+		}
+		if raw == "" {
+			continue
+		}
+
+		if err := setValue(value, raw); err != nil {
+			*problems = append(*problems, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+}
+
+func setValue(value reflect.Value, raw string) error {
+	switch {
+	case value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(d))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(int64(n))
+	case value.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(f)
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config field type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func writeEnvFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_DefaultsAndMissingEnvFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "does-not-exist.env")
+	cfg, err := Load([]string{"-db=sqlite", "-env-file=" + missing}, envFrom(nil))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.Env != "dev" || cfg.HTTP.Port != "8081" || cfg.LocalDB.Port != "5432" || cfg.SQLite.Path != "codecart.db" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+	if cfg.HTTP.Addr() != ":8081" {
+		t.Errorf("Addr() = %q, want %q", cfg.HTTP.Addr(), ":8081")
+	}
+	if !slices.Contains(cfg.CORS.AllowedOrigins, "https://codecart.app") {
+		t.Errorf("CORS defaults should allow the deployed frontend, got %v", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	envFile := writeEnvFile(t, "DB_MODE=local\nLOCAL_DB_HOST=file-host\nLOCAL_DB_USER=file-user\nLOCAL_DB_NAME=codecart\nPORT=9000\n")
+	env := envFrom(map[string]string{
+		"LOCAL_DB_HOST": "env-host",
+		// empty variables fall through to the file, matching how the server treated them before
+		"LOCAL_DB_USER": "",
+	})
+
+	cfg, err := Load([]string{"-env-file=" + envFile, "-migrate"}, env)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.LocalDB.Host != "env-host" {
+		t.Errorf("LocalDB.Host = %q, want env value", cfg.LocalDB.Host)
+	}
+	if cfg.LocalDB.User != "file-user" || cfg.HTTP.Port != "9000" {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if !cfg.Migrate {
+		t.Error("-migrate flag not applied")
+	}
+
+	cfg, err = Load([]string{"-env-file=" + envFile, "-db=sqlite"}, env)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.DBMode != DB_MODE_SQLITE {
+		t.Errorf("DBMode = %q, flag should override the file", cfg.DBMode)
+	}
+}
+
+func TestLoad_ReportsEveryProblemAtOnce(t *testing.T) {
+	_, err := Load([]string{"-db=gcp", "-env-file="}, envFrom(map[string]string{
+		"GCP_DB_USER": "codecart",
+		"PORT":        "http",
+		"DB_MIGRATE":  "sometimes",
+	}))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"missing required configuration: GCP_IMP_SA, GCP_DB_NAME, GCP_INSTANCE_CONNECTION_NAME",
+		"PORT must be a number",
+		`DB_MIGRATE: invalid boolean "sometimes"`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not mention %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "GCP_DB_USER") {
+		t.Errorf("error %q reports a key that is set", msg)
+	}
+}
+
+func TestLoad_RejectsUnknownDBMode(t *testing.T) {
+	_, err := Load([]string{"-db=mysql", "-env-file="}, envFrom(nil))
+	if err == nil || !strings.Contains(err.Error(), `got "mysql"`) {
+		t.Fatalf("expected unknown DB_MODE error, got %v", err)
+	}
+}
+
+func TestLoad_RejectsCredentialedWildcardCORS(t *testing.T) {
+	_, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(map[string]string{
+		"CORS_ALLOWED_ORIGINS":   "*, https://*.*.codecart.app",
+		"CORS_ALLOW_CREDENTIALS": "true",
+	}))
+	if err == nil {
+		t.Fatal("expected CORS validation errors")
+	}
+	for _, want := range []string{`cannot contain "*"`, `"https://*.*.codecart.app"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoad_ValidatesEmailSender(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"unknown sender", map[string]string{"EMAIL_SENDER": "sendgrid"}, `got "sendgrid"`},
+		{"smtp without a host", map[string]string{"EMAIL_SENDER": "smtp"}, "SMTP_HOST"},
+		{"smtp with a bad port", map[string]string{"EMAIL_SENDER": "smtp", "SMTP_HOST": "localhost", "SMTP_PORT": "smtp"}, "SMTP_PORT"},
+		{"bad from address", map[string]string{"EMAIL_FROM": "orders"}, "EMAIL_FROM"},
+		{"valid smtp", map[string]string{"EMAIL_SENDER": "smtp", "SMTP_HOST": "localhost", "SMTP_PORT": "1025"}, ""},
+		{"valid stdout", map[string]string{"EMAIL_SENDER": "stdout"}, ""},
+		{"unknown store time zone", map[string]string{"EMAIL_SENDER": "stdout", "STORE_TIMEZONE": "Mars/Olympus"}, "STORE_TIMEZONE"},
+		{"valid store time zone", map[string]string{"EMAIL_SENDER": "stdout", "STORE_TIMEZONE": "America/New_York"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(tt.env))
+			if tt.want == "" && err != nil {
+				t.Errorf("expected the configuration to load, got %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("expected an error mentioning %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_ValidatesSMSProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"unknown provider", map[string]string{"SMS_PROVIDER": "twilio"}, `got "twilio"`},
+		{"no segments", map[string]string{"SMS_PROVIDER": "fake", "SMS_MAX_SEGMENTS": "0"}, "SMS_MAX_SEGMENTS"},
+		{"too many segments", map[string]string{"SMS_PROVIDER": "fake", "SMS_MAX_SEGMENTS": "11"}, "SMS_MAX_SEGMENTS"},
+		{"quiet hours without a time zone", map[string]string{"SMS_PROVIDER": "fake"}, "STORE_TIMEZONE"},
+		{"unknown time zone", map[string]string{"SMS_PROVIDER": "fake", "STORE_TIMEZONE": "Mars/Olympus"}, "STORE_TIMEZONE"},
+		{"no quiet hours", map[string]string{"SMS_PROVIDER": "fake", "SMS_QUIET_HOURS": "none"}, ""},
+		{"valid fake", map[string]string{"SMS_PROVIDER": "fake", "SMS_MAX_SEGMENTS": "1", "STORE_TIMEZONE": "America/New_York"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(tt.env))
+			if tt.want == "" && err != nil {
+				t.Errorf("expected the configuration to load, got %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("expected an error mentioning %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_ValidatesOutboxBus(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"unknown bus", map[string]string{"OUTBOX_BUS": "kafka"}, `got "kafka"`},
+		{"pubsub without a project", map[string]string{"OUTBOX_BUS": "pubsub"}, "PUBSUB_PROJECT_ID"},
+		{"webhook without a url", map[string]string{"OUTBOX_BUS": "webhook"}, "OUTBOX_WEBHOOK_URL"},
+		{"valid pubsub", map[string]string{"OUTBOX_BUS": "pubsub", "PUBSUB_PROJECT_ID": "codecart"}, ""},
+		{"valid webhook", map[string]string{"OUTBOX_BUS": "webhook", "OUTBOX_WEBHOOK_URL": "https://hooks.example.com/events"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(tt.env))
+			if tt.want == "" && err != nil {
+				t.Errorf("expected the configuration to load, got %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("expected an error mentioning %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_EmulatorRequiresLocalFunctions(t *testing.T) {
+	env := map[string]string{
+		"CLOUD_FUNCTION_EMULATOR":        "true",
+		"CLOUD_FUNCTION_HELLO_WORLD_URL": "https://us-central1-codecart.cloudfunctions.net/HelloWorldPOC",
+	}
+	if _, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(env)); err == nil || !strings.Contains(err.Error(), "CLOUD_FUNCTION_EMULATOR") {
+		t.Fatalf("expected a deployed URL to be rejected in emulator mode, got %v", err)
+	}
+
+	for _, local := range []string{"http://localhost:8080/HelloWorldPOC", "http://127.0.0.1:8080/HelloWorldPOC", "http://[::1]:8080/HelloWorldPOC"} {
+		env["CLOUD_FUNCTION_HELLO_WORLD_URL"] = local
+		if _, err := Load([]string{"-db=sqlite", "-env-file="}, envFrom(env)); err != nil {
+			t.Errorf("expected %s to be accepted, got %v", local, err)
+		}
+	}
+}
+
+func TestFunctionSpecs(t *testing.T) {
+	cfg := CloudFunctionsConfig{
+		Functions: []string{
+			"receipt=POST https://example.cloudfunctions.net/Receipt;timeout=20s;attempts=1",
+			"lookup=get http://localhost:8080/Lookup",
+			"notify=https://example.cloudfunctions.net/Notify",
+		},
+		HelloWorldURL: "https://example.cloudfunctions.net/HelloWorldPOC",
+		Timeout:       10 * time.Second,
+		MaxAttempts:   3,
+	}
+
+	specs, err := cfg.FunctionSpecs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []FunctionSpec{
+		{Name: "receipt", URL: "https://example.cloudfunctions.net/Receipt", Method: "POST", Timeout: 20 * time.Second, MaxAttempts: 1},
+		{Name: "lookup", URL: "http://localhost:8080/Lookup", Method: "GET", Timeout: 10 * time.Second, MaxAttempts: 3},
+		{Name: "notify", URL: "https://example.cloudfunctions.net/Notify", Method: "POST", Timeout: 10 * time.Second, MaxAttempts: 3},
+		{Name: FUNCTION_HELLO_WORLD, URL: "https://example.cloudfunctions.net/HelloWorldPOC", Method: "GET", Timeout: 10 * time.Second, MaxAttempts: 3},
+	}
+	if !slices.Equal(specs, want) {
+		t.Errorf("expected %+v, got %+v", want, specs)
+	}
+
+	for _, bad := range []string{"receipt", "receipt=POST not-a-url", "receipt=POST https://x.test;timeout=soon", "receipt=POST https://x.test;retries=2"} {
+		cfg.Functions = []string{bad}
+		if _, err := cfg.FunctionSpecs(); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	cfg.Functions = []string{"a=https://x.test/A", "a=https://x.test/B"}
+	if _, err := cfg.FunctionSpecs(); err == nil {
+		t.Error("expected duplicate names to be rejected")
+	}
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	cfg, err := Load([]string{"-db=local", "-env-file="}, envFrom(map[string]string{
+		"LOCAL_DB_HOST":     "localhost",
+		"LOCAL_DB_USER":     "codecart",
+		"LOCAL_DB_NAME":     "codecart",
+		"LOCAL_DB_PASSWORD": "hunter2",
+	}))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print returned error: %v", err)
+	}
+
+	printed := out.String()
+	if strings.Contains(printed, "hunter2") {
+		t.Errorf("secret leaked in output:\n%s", printed)
+	}
+	for _, want := range []string{"LOCAL_DB_PASSWORD=" + REDACTED, "LOCAL_DB_HOST=localhost", "DB_MODE=local", "PORT=8081"} {
+		if !strings.Contains(printed, want+"\n") {
+			t.Errorf("output missing %q:\n%s", want, printed)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FUNCTION_HELLO_WORLD is the registry name CLOUD_FUNCTION_HELLO_WORLD_URL is registered under
+const FUNCTION_HELLO_WORLD = "hello_world"
+
+// FUNCTION_RECEIPT renders an order's PDF receipt, see cloud/functions/receipt
+const FUNCTION_RECEIPT = "receipt"
+
+// FunctionSpec describes one cloud function the backend calls
+type FunctionSpec struct {
+	Name        string
+	URL         string
+	Method      string
+	Timeout     time.Duration
+	MaxAttempts int
+}
+
+// FunctionSpecs parses the CLOUD_FUNCTIONS entries, which look like
+//
+//	name=METHOD URL[;timeout=DURATION][;attempts=N]
+//
+// e.g. "receipt=POST https://example.cloudfunctions.net/Receipt;timeout=20s". The method defaults to POST, and the
+// timeout and attempts to CLOUD_FUNCTION_TIMEOUT and CLOUD_FUNCTION_MAX_ATTEMPTS. CLOUD_FUNCTION_HELLO_WORLD_URL is
+// registered as a GET hello_world unless an entry of that name exists
+func (c CloudFunctionsConfig) FunctionSpecs() ([]FunctionSpec, error) {
+	specs := make([]FunctionSpec, 0, len(c.Functions)+1)
+	seen := make(map[string]bool, len(c.Functions))
+
+	for _, entry := range c.Functions {
+		spec, err := c.parseFunctionSpec(entry)
+		if err != nil {
+			return nil, err
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("cloud function %q is declared twice", spec.Name)
+		}
+		seen[spec.Name] = true
+		specs = append(specs, spec)
+	}
+
+	if c.HelloWorldURL != "" && !seen[FUNCTION_HELLO_WORLD] {
+		specs = append(specs, FunctionSpec{
+			Name:        FUNCTION_HELLO_WORLD,
+			URL:         c.HelloWorldURL,
+			Method:      http.MethodGet,
+			Timeout:     c.Timeout,
+			MaxAttempts: c.MaxAttempts,
+		})
+	}
+	return specs, nil
+}
+
+func (c CloudFunctionsConfig) parseFunctionSpec(entry string) (FunctionSpec, error) {
+	name, rest, ok := strings.Cut(strings.TrimSpace(entry), "=")
+	if !ok || name == "" {
+		return FunctionSpec{}, fmt.Errorf("cloud function entry %q must look like name=METHOD URL[;option=value...]", entry)
+	}
+
+	target, options, _ := strings.Cut(rest, ";")
+	spec := FunctionSpec{
+		Name:        name,
+		Method:      http.MethodPost,
+		Timeout:     c.Timeout,
+		MaxAttempts: c.MaxAttempts,
+	}
+	if method, rawURL, hasMethod := strings.Cut(strings.TrimSpace(target), " "); hasMethod {
+		spec.Method, spec.URL = strings.ToUpper(method), strings.TrimSpace(rawURL)
+	} else {
+		spec.URL = method
+	}
+	if u, err := url.Parse(spec.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return FunctionSpec{}, fmt.Errorf("cloud function %s has an invalid URL %q", name, spec.URL)
+	}
+
+	for _, option := range strings.Split(options, ";") {
+		if option = strings.TrimSpace(option); option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return FunctionSpec{}, fmt.Errorf("cloud function %s has an invalid timeout %q", name, value)
+			}
+			spec.Timeout = timeout
+		case "attempts":
+			attempts, err := strconv.Atoi(value)
+			if err != nil || attempts < 1 {
+				return FunctionSpec{}, fmt.Errorf("cloud function %s has an invalid attempts %q", name, value)
+			}
+			spec.MaxAttempts = attempts
+		default:
+			return FunctionSpec{}, fmt.Errorf("cloud function %s has an unknown option %q", name, key)
+		}
+	}
+	return spec, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const REDACTED = "********"
+
+// Print writes every setting as KEY=value in declaration order. Fields tagged secret are redacted, but still show
+// whether they are set at all, which is usually what matters when debugging a deploy
+func (c Config) Print(w io.Writer) error {
+	var lines []string
+	collect(reflect.ValueOf(c), &lines)
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func collect(v reflect.Value, lines *[]string) {
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		key, ok := field.Tag.Lookup("env")
+		if !ok {
+			if value.Kind() == reflect.Struct {
+				collect(value, lines)
+			}
+			continue
+		}
+
+		formatted := formatValue(value)
+		if field.Tag.Get("secret") == "true" && formatted != "" {
+			formatted = REDACTED
+		}
+		*lines = append(*lines, key+"="+formatted)
+	}
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range value.Len() {
+			items[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
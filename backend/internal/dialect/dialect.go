@@ -0,0 +1,66 @@
+// Package dialect captures the handful of differences between the SQL databases the backend can run against. Queries
+// throughout the persistence layer are written for postgres; Rebind adapts them for the other engines.
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+func Parse(name string) (Dialect, error) {
+	switch d := Dialect(strings.ToLower(strings.TrimSpace(name))); d {
+	case Postgres, SQLite:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown SQL dialect %q", name)
+	}
+}
+
+// Rebind rewrites postgres-style $N placeholders into the form the dialect expects. SQLite understands ?NNN, which
+// keeps the argument numbering intact, so queries that reuse or reorder placeholders behave the same on both engines.
+// Placeholders inside quoted literals and identifiers are left alone
+func (d Dialect) Rebind(query string) string {
+	if d != SQLite || !strings.Contains(query, "$") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			c = '?'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// SkipLocked is the row locking clause for queue-style claims: postgres locks the selected rows and skips any another
+// transaction already holds. SQLite has no row locks; it serializes writers, so the plain select is already safe
+func (d Dialect) SkipLocked() string {
+	if d == Postgres {
+		return "FOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package dialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{"postgres is untouched", Postgres, "SELECT * FROM t WHERE a = $1", "SELECT * FROM t WHERE a = $1"},
+		{"numbered placeholders", SQLite, "UPDATE t SET a = $1, b = $2 WHERE id = $10", "UPDATE t SET a = ?1, b = ?2 WHERE id = ?10"},
+		{"single quoted literal", SQLite, "SELECT '$1' FROM t WHERE a = $1", "SELECT '$1' FROM t WHERE a = ?1"},
+		{"quoted identifier", SQLite, `SELECT "col$1" FROM t WHERE a = $2`, `SELECT "col$1" FROM t WHERE a = ?2`},
+		{"dollar without digit", SQLite, "SELECT $a, $1", "SELECT $a, ?1"},
+		{"trailing dollar", SQLite, "SELECT $", "SELECT $"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.Rebind(tt.query); got != tt.want {
+				t.Errorf("Rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	if d, err := Parse(" SQLite "); err != nil || d != SQLite {
+		t.Errorf("Parse(sqlite) = %q, %v", d, err)
+	}
+	if _, err := Parse("mysql"); err == nil {
+		t.Error("expected an error for an unsupported dialect")
+	}
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
 
 	"github.com/jshelley8117/CodeCart/internal/common"
@@ -30,24 +29,12 @@ func (ah AddressHandler) HandleCreateAddress(w http.ResponseWriter, r *http.Requ
 
 	var request model.CreateAddressRequest
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, common.ERR_REQ_BODY_READ_FAIL, http.StatusBadRequest)
-		return
-	}
-
-	if err := json.Unmarshal(body, &request); err != nil {
-		http.Error(w, common.ERR_REQ_UNMARSH_FAIL, http.StatusBadRequest)
-		return
-	}
-
-	if err := validate.Struct(request); err != nil {
-		http.Error(w, common.ERR_VALIDATION_FAIL, http.StatusBadRequest)
+	if !decodeRequest(w, r, zLog, &request) {
 		return
 	}
 
 	if err := ah.AddressService.CreateAddress(r.Context(), request); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		utils.HttpError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -61,14 +48,14 @@ func (ah AddressHandler) HandleGetAllAddresses(w http.ResponseWriter, r *http.Re
 	addresses, err := ah.AddressService.GetAllAddresses(r.Context())
 	if err != nil {
 		zLog.Error("service invocation failed", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		utils.HttpError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	addressesApiResponse, err := json.Marshal(addresses)
 	if err != nil {
 		zLog.Error("go marshaling failed", zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_DB_RETRIEVAL_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_RETRIEVAL_FAIL, http.StatusInternalServerError)
 		return
 	}
 
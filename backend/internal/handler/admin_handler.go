@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// AdminHandler serves the operational endpoints under /api/v1/admin
+type AdminHandler struct {
+	CloudFunctionClient *client.CloudFunctionClient
+	Logger              *zap.Logger
+}
+
+func NewAdminHandler(cloudFunctionClient *client.CloudFunctionClient, logger *zap.Logger) AdminHandler {
+	return AdminHandler{
+		CloudFunctionClient: cloudFunctionClient,
+		Logger:              logger.Named("admin_handler"),
+	}
+}
+
+// HandleListFunctions lists the registered cloud functions with their call settings and circuit state
+func (ah AdminHandler) HandleListFunctions(w http.ResponseWriter, r *http.Request) {
+	zLog := ah.getZLog(r.Context())
+	zLog.Debug("entered HandleListFunctions")
+
+	response, err := json.Marshal(ah.CloudFunctionClient.Functions())
+	if err != nil {
+		zLog.Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (ah AdminHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, ah.Logger)
+}
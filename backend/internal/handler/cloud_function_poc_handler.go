@@ -29,14 +29,14 @@ func (cfh CloudFunctionHandler) HandleGetHelloWorld(w http.ResponseWriter, r *ht
 	response, err := cfh.CloudFunctionService.GetHelloWorld(r.Context())
 	if err != nil {
 		zLog.Error("service invocation failed", zap.Error(err))
-		http.Error(w, "Failed to invoke cloud function", http.StatusInternalServerError)
+		utils.HttpError(w, r, "Failed to invoke cloud function", http.StatusInternalServerError)
 		return
 	}
 
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
 		zLog.Error("go marshaling failed", zap.Error(err))
-		http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
+		utils.HttpError(w, r, "Failed to serialize response", http.StatusInternalServerError)
 		return
 	}
 
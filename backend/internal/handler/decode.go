@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// validate reports fields by their JSON names, the ones clients actually send
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// MAX_REQUEST_BODY_BYTES caps every JSON request body. The largest legitimate payload, an order, is well under 1KB
+const MAX_REQUEST_BODY_BYTES = 1 << 20
+
+// requestError is a decoding failure together with the status and client-safe message it should be answered with
+type requestError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (re *requestError) Error() string {
+	return fmt.Sprintf("%s: %v", re.Message, re.Err)
+}
+
+func (re *requestError) Unwrap() error {
+	return re.Err
+}
+
+// decodeRequest reads a JSON request body into dst and validates it, answering the request itself when either step
+// fails. Handlers return as soon as it reports false
+func decodeRequest(w http.ResponseWriter, r *http.Request, zLog *zap.Logger, dst any) bool {
+	if err := decodeJSON(w, r, dst); err != nil {
+		var re *requestError
+		if !errors.As(err, &re) {
+			re = &requestError{Status: http.StatusBadRequest, Message: common.ERR_REQ_BODY_READ_FAIL, Err: err}
+		}
+		zLog.Warn("request decoding failed", zap.Int("status", re.Status), zap.Error(re.Err))
+		utils.HttpError(w, r, re.Message, re.Status)
+		return false
+	}
+
+	if err := validate.Struct(dst); err != nil {
+		zLog.Warn(common.ERR_VALIDATION_FAIL, zap.Error(err))
+		utils.HttpError(w, r, validationMessage(err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// decodeJSON decodes exactly one JSON object of at most MAX_REQUEST_BODY_BYTES into dst. Unknown fields and anything
+// after the object are rejected, so typos in field names surface as errors instead of silently dropped values
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+		return &requestError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: common.ERR_REQ_UNSUPPORTED_MEDIA_TYPE,
+			Err:     fmt.Errorf("content type %q", contentType),
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY_BYTES)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("trailing data")
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return decodeError(err)
+		}
+		return &requestError{Status: http.StatusBadRequest, Message: "Request body must contain a single JSON object", Err: err}
+	}
+	return nil
+}
+
+// decodeError turns an encoding/json failure into a message that tells the client what to fix
+func decodeError(err error) error {
+	var (
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		maxBytesErr  *http.MaxBytesError
+		badRequest   = func(msg string) error { return &requestError{Status: http.StatusBadRequest, Message: msg, Err: err} }
+		unknownField = "json: unknown field "
+	)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &requestError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit),
+			Err:     err,
+		}
+	case errors.Is(err, io.EOF):
+		return badRequest("Request body must not be empty")
+	case errors.As(err, &syntaxErr):
+		return badRequest(fmt.Sprintf("Request body contains malformed JSON at position %d", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("Request body contains malformed JSON")
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return badRequest(fmt.Sprintf("Request body field %q must be a %s", typeErr.Field, typeErr.Type))
+		}
+		return badRequest("Request body must be a JSON object")
+	case strings.HasPrefix(err.Error(), unknownField):
+		// encoding/json has no typed error for unknown fields
+		return badRequest("Request body contains unknown field " + strings.TrimPrefix(err.Error(), unknownField))
+	default:
+		return badRequest(common.ERR_REQ_UNMARSH_FAIL)
+	}
+}
+
+// validationMessage names the fields that failed validation and the rule each one broke
+func validationMessage(err error) string {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return common.ERR_VALIDATION_FAIL
+	}
+	problems := make([]string, 0, len(fieldErrs))
+	for _, fe := range fieldErrs {
+		problems = append(problems, fmt.Sprintf("%s (%s)", fe.Field(), fe.Tag()))
+	}
+	return common.ERR_VALIDATION_FAIL + ": " + strings.Join(problems, ", ")
+}
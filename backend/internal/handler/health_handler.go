@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/health"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type HealthHandler struct {
+	Checker *health.Checker
+	Logger  *zap.Logger
+}
+
+func NewHealthHandler(checker *health.Checker, logger *zap.Logger) HealthHandler {
+	return HealthHandler{
+		Checker: checker,
+		Logger:  logger,
+	}
+}
+
+// HandleLiveness only proves the process can serve HTTP. It deliberately checks no dependencies, otherwise a database
+// outage would get every instance restarted instead of just taken out of rotation
+func (hh HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	hh.writeJSON(w, r, http.StatusOK, map[string]string{"status": health.STATUS_OK})
+}
+
+func (hh HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := hh.Checker.Readiness(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	hh.writeJSON(w, r, status, report)
+}
+
+func (hh HealthHandler) writeJSON(w http.ResponseWriter, r *http.Request, status int, body any) {
+	response, err := json.Marshal(body)
+	if err != nil {
+		hh.getZLog(r.Context()).Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// probes must always see the live state, never a cached answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func (hh HealthHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, hh.Logger).Named("health_handler")
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// JobHandler serves the admin API for the background job queue under /api/v1/admin/jobs
+type JobHandler struct {
+	JobService service.JobService
+	Logger     *zap.Logger
+}
+
+func NewJobHandler(jobService service.JobService, logger *zap.Logger) JobHandler {
+	return JobHandler{
+		JobService: jobService,
+		Logger:     logger.Named("job_handler"),
+	}
+}
+
+// HandleGetJobs lists jobs, newest first. The optional status and type query parameters narrow the list, and limit
+// caps how many are returned
+func (jh JobHandler) HandleGetJobs(w http.ResponseWriter, r *http.Request) {
+	zLog := jh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetJobs")
+
+	status := model.JobStatus(r.URL.Query().Get("status"))
+	validStatuses := []model.JobStatus{"", model.JobPending, model.JobRunning, model.JobSucceeded, model.JobDead}
+	if !slices.Contains(validStatuses, status) {
+		utils.HttpError(w, r, "status must be one of PENDING, RUNNING, SUCCEEDED or DEAD", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			utils.HttpError(w, r, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobs, err := jh.JobService.GetJobs(r.Context(), status, r.URL.Query().Get("type"), limit)
+	if !checkServiceError(w, r, zLog, err, "Job not found", common.ERR_CLIENT_DB_RETRIEVAL_FAIL) {
+		return
+	}
+
+	respond(w, r, zLog, http.StatusOK, jobs)
+}
+
+func (jh JobHandler) HandleGetJobById(w http.ResponseWriter, r *http.Request) {
+	zLog := jh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetJobById")
+
+	id, ok := jh.jobId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	job, err := jh.JobService.GetJobById(r.Context(), id)
+	if !checkServiceError(w, r, zLog, err, "Job not found", common.ERR_CLIENT_DB_RETRIEVAL_FAIL) {
+		return
+	}
+
+	respond(w, r, zLog, http.StatusOK, job)
+}
+
+// HandleRetryJob makes the job in the path due now and answers 202, or 409 while a worker is running it
+func (jh JobHandler) HandleRetryJob(w http.ResponseWriter, r *http.Request) {
+	zLog := jh.getZLog(r.Context())
+	zLog.Debug("entered HandleRetryJob")
+
+	id, ok := jh.jobId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	err := jh.JobService.RetryJob(r.Context(), id)
+	if errors.Is(err, service.ErrJobRunning) {
+		utils.HttpError(w, r, "Job is running and cannot be retried", http.StatusConflict)
+		return
+	}
+	if !checkServiceError(w, r, zLog, err, "Job not found", common.ERR_CLIENT_DB_PERSISTENCE_FAIL) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// jobId reads the job id from the path, answering the request itself when it is not an integer
+func (jh JobHandler) jobId(w http.ResponseWriter, r *http.Request, zLog *zap.Logger) (int64, bool) {
+	idPathVal := r.PathValue("id")
+	id, err := strconv.ParseInt(idPathVal, 10, 64)
+	if err != nil {
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (jh JobHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, jh.Logger)
+}
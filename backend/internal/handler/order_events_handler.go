@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/auth"
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/realtime"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// OrderEventsHandler streams an order's events as Server-Sent Events. Every event carries its outbox id, so a client
+// that reconnects with Last-Event-ID picks up exactly where it left off
+type OrderEventsHandler struct {
+	OrderEventService service.OrderEventService
+	Hub               *realtime.Hub
+	Authenticator     auth.Authenticator
+	Config            config.OrderEventsConfig
+	Metrics           *metrics.Metrics
+	Logger            *zap.Logger
+}
+
+func NewOrderEventsHandler(orderEventService service.OrderEventService, hub *realtime.Hub, authenticator auth.Authenticator, cfg config.OrderEventsConfig, metrics *metrics.Metrics, logger *zap.Logger) OrderEventsHandler {
+	return OrderEventsHandler{
+		OrderEventService: orderEventService,
+		Hub:               hub,
+		Authenticator:     authenticator,
+		Config:            cfg,
+		Metrics:           metrics,
+		Logger:            logger.Named("order_events_handler"),
+	}
+}
+
+// HandleStreamOrderEvents serves GET /api/v1/orders/{id}/events. Without Last-Event-ID (or the last_event_id query
+// parameter, for clients that cannot set headers) the stream starts with the order's recorded history.
+//
+// The outbox is the only source of events: the hub merely wakes the stream when the relay in this process publishes
+// something for the order, and the poll covers events relayed by other instances. Either way the stream reads
+// everything after the last id it sent, so it never skips or repeats an event
+func (oeh OrderEventsHandler) HandleStreamOrderEvents(w http.ResponseWriter, r *http.Request) {
+	zLog := utils.FromContext(r.Context(), oeh.Logger)
+	zLog.Debug("entered HandleStreamOrderEvents")
+
+	idPathVal := r.PathValue("id")
+	id, err := strconv.Atoi(idPathVal)
+	if err != nil {
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	lastEventId, ok := oeh.lastEventId(r)
+	if !ok {
+		utils.HttpError(w, r, "Last-Event-ID must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := oeh.Authenticator.Identify(r)
+	if !ok {
+		utils.HttpError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	err = oeh.OrderEventService.AuthorizeOrder(r.Context(), principal, id)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		utils.HttpError(w, r, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrForbidden):
+		utils.HttpError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	case err != nil:
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_RETRIEVAL_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	// subscribed before the history is read, so nothing recorded in between goes unnoticed
+	subscription := oeh.Hub.Subscribe(model.AggregateOrder, strconv.Itoa(id))
+	defer subscription.Close()
+
+	rc := http.NewResponseController(w)
+	// the server's write timeout is meant for ordinary requests and would cut every stream off after a few seconds
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		zLog.Warn("failed to lift the write deadline", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// stops nginx style proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	oeh.Metrics.OrderEventStreamOpened()
+	defer oeh.Metrics.OrderEventStreamClosed()
+	zLog = zLog.With(zap.Int("order_id", id))
+	zLog.Info("order event stream opened", zap.Int64("last_event_id", lastEventId))
+
+	stream := orderEventStream{w: w, rc: rc, lastEventId: lastEventId}
+	if err := stream.retry(oeh.Config.Retry); err != nil {
+		return
+	}
+	if err := oeh.catchUp(r.Context(), &stream, id); err != nil {
+		zLog.Warn("order event stream ended", zap.Error(err))
+		return
+	}
+
+	heartbeat, stopHeartbeat := ticker(oeh.Config.Heartbeat)
+	defer stopHeartbeat()
+	poll, stopPoll := ticker(oeh.Config.PollInterval)
+	defer stopPoll()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			zLog.Info("order event stream closed by the client")
+			return
+		case <-subscription.Done():
+			zLog.Info("order event stream closed for shutdown")
+			return
+		case <-heartbeat:
+			err = stream.heartbeat()
+		case event := <-subscription.Events():
+			if event.Id > stream.lastEventId {
+				err = oeh.catchUp(r.Context(), &stream, id)
+			}
+		case <-subscription.Missed():
+			err = oeh.catchUp(r.Context(), &stream, id)
+		case <-poll:
+			err = oeh.catchUp(r.Context(), &stream, id)
+		}
+		if err != nil {
+			zLog.Warn("order event stream ended", zap.Error(err))
+			return
+		}
+	}
+}
+
+// catchUp sends every event of the order recorded after the last one the stream sent
+func (oeh OrderEventsHandler) catchUp(ctx context.Context, stream *orderEventStream, orderId int) error {
+	for {
+		events, err := oeh.OrderEventService.GetEventsSince(ctx, orderId, stream.lastEventId)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := stream.send(event); err != nil {
+				return err
+			}
+		}
+		if len(events) < service.ORDER_EVENT_HISTORY_BATCH {
+			return nil
+		}
+	}
+}
+
+// lastEventId reads where a resuming client left off, 0 when it is starting afresh
+func (oeh OrderEventsHandler) lastEventId(r *http.Request) (int64, bool) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	return id, err == nil && id >= 0
+}
+
+// orderEventStream writes the text/event-stream framing and flushes after every message
+type orderEventStream struct {
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	lastEventId int64
+}
+
+func (s *orderEventStream) send(event model.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %d: %w", event.Id, err)
+	}
+	if err := s.write("id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data); err != nil {
+		return err
+	}
+	s.lastEventId = event.Id
+	return nil
+}
+
+// retry tells the client how long to wait before reconnecting
+func (s *orderEventStream) retry(after time.Duration) error {
+	if after <= 0 {
+		return nil
+	}
+	return s.write("retry: %d\n\n", after.Milliseconds())
+}
+
+// heartbeat is a comment line, which clients ignore but which keeps proxies from timing the connection out
+func (s *orderEventStream) heartbeat() error {
+	return s.write(": heartbeat\n\n")
+}
+
+func (s *orderEventStream) write(format string, args ...any) error {
+	if _, err := fmt.Fprintf(s.w, format, args...); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// ticker ticks every interval, or never when interval is not positive
+func ticker(interval time.Duration) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(interval)
+	return t.C, t.Stop
+}
@@ -2,12 +2,13 @@ package handler
 
 import (
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/jshelley8117/CodeCart/internal/common"
 	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
 	"github.com/jshelley8117/CodeCart/internal/service"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
@@ -32,27 +33,12 @@ func (oh OrderHandler) HandleCreateOrder(w http.ResponseWriter, r *http.Request)
 
 	zLog.Debug("Entered HandleCreateOrder")
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		zLog.Warn(common.ERR_REQ_BODY_READ_FAIL, zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusBadRequest)
-		return
-	}
-
-	if err := json.Unmarshal(body, &request); err != nil {
-		zLog.Warn(common.ERR_REQ_UNMARSH_FAIL, zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusBadRequest)
-		return
-	}
-
-	if err := validate.Struct(request); err != nil {
-		zLog.Warn(common.ERR_VALIDATION_FAIL, zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusBadRequest)
+	if !decodeRequest(w, r, zLog, &request) {
 		return
 	}
 	if err := oh.OrderService.CreateOrder(r.Context(), request); err != nil {
 		zLog.Error("service invocation failed", zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
 		return
 	}
 
@@ -67,14 +53,14 @@ func (oh OrderHandler) HandleGetAllOrders(w http.ResponseWriter, r *http.Request
 	orders, err := oh.OrderService.GetAllOrders(r.Context())
 	if err != nil {
 		zLog.Error("Service invocation failed", zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
 		return
 	}
 
 	ordersApiResponse, err := json.Marshal(orders)
 	if err != nil {
 		zLog.Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
 		return
 	}
 
@@ -90,28 +76,32 @@ func (oh OrderHandler) HandleFetchOrderById(w http.ResponseWriter, r *http.Reque
 	idPathVal := r.PathValue("id")
 	if idPathVal == "" {
 		zLog.Error("ID field in endpoint path parameter is missing")
-		http.Error(w, "ID is empty", http.StatusBadRequest)
+		utils.HttpError(w, r, "ID is empty", http.StatusBadRequest)
 		return
 	}
 
 	id, err := strconv.Atoi(idPathVal)
 	if err != nil {
-		zLog.Error("failed to convert id value from string to integer")
-		http.Error(w, "server failed to process ID value", http.StatusInternalServerError)
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
 		return
 	}
 
 	orders, err := oh.OrderService.FetchOrderById(r.Context(), id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		utils.HttpError(w, r, "Order not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		zLog.Error("Service invocation failed", zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
 		return
 	}
 
 	ordersApiResponse, err := json.Marshal(orders)
 	if err != nil {
 		zLog.Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
 		return
 	}
 
@@ -128,41 +118,31 @@ func (oh OrderHandler) HandleUpdateOrderById(w http.ResponseWriter, r *http.Requ
 	idPathVal := r.PathValue("id")
 	if idPathVal == "" {
 		zLog.Error("ID field in endpoint path parameter is missing")
-		http.Error(w, "ID is empty", http.StatusBadRequest)
+		utils.HttpError(w, r, "ID is empty", http.StatusBadRequest)
 		return
 	}
 
 	id, err := strconv.Atoi(idPathVal)
 	if err != nil {
-		zLog.Error("failed to convert id value from string to integer")
-		http.Error(w, "server failed to process ID value", http.StatusInternalServerError)
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
 		return
 	}
 
 	var request model.UpdateOrderRequest
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		zLog.Error("request body read failed", zap.Error(err))
-		http.Error(w, common.ERR_REQ_BODY_READ_FAIL, http.StatusBadRequest)
+	if !decodeRequest(w, r, zLog, &request) {
 		return
 	}
 
-	if err := json.Unmarshal(body, &request); err != nil {
-		zLog.Error("go unmarshaling failed", zap.Error(err))
-		http.Error(w, common.ERR_REQ_UNMARSH_FAIL, http.StatusBadRequest)
+	err = oh.OrderService.UpdateOrderById(r.Context(), request, id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		utils.HttpError(w, r, "Order not found", http.StatusNotFound)
 		return
 	}
-
-	if err := validate.Struct(request); err != nil {
-		zLog.Error("struct validation failed", zap.Error(err))
-		http.Error(w, common.ERR_VALIDATION_FAIL, http.StatusBadRequest)
-		return
-	}
-
-	if err := oh.OrderService.UpdateOrderById(r.Context(), request, id); err != nil {
+	if err != nil {
 		zLog.Error("service invocation failed", zap.Error(err))
-		http.Error(w, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/auth"
+	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type ReceiptHandler struct {
+	ReceiptService service.ReceiptService
+	Authenticator  auth.Authenticator
+	Logger         *zap.Logger
+}
+
+func NewReceiptHandler(receiptService service.ReceiptService, authenticator auth.Authenticator, logger *zap.Logger) ReceiptHandler {
+	return ReceiptHandler{
+		ReceiptService: receiptService,
+		Authenticator:  authenticator,
+		Logger:         logger.Named("receipt_handler"),
+	}
+}
+
+// HandleGetReceipt serves the PDF receipt of the order in the path to admins and to the users of the order's customer
+func (rh ReceiptHandler) HandleGetReceipt(w http.ResponseWriter, r *http.Request) {
+	zLog := rh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetReceipt")
+
+	idPathVal := r.PathValue("id")
+	id, err := strconv.Atoi(idPathVal)
+	if err != nil {
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := rh.Authenticator.Identify(r)
+	if !ok {
+		utils.HttpError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pdf, err := rh.ReceiptService.RenderReceipt(r.Context(), principal, id)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		utils.HttpError(w, r, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrForbidden):
+		utils.HttpError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	case errors.Is(err, client.ErrUnknownFunction), errors.Is(err, client.ErrCircuitOpen):
+		utils.HttpError(w, r, common.ERR_RECEIPT_UNAVAILABLE, http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%d.pdf"`, id))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+func (rh ReceiptHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, rh.Logger)
+}
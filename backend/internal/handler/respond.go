@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// checkServiceError answers the request with a 404 carrying notFound for persistence.ErrNotFound and a 500 carrying
+// message for any other error. Handlers return as soon as it reports false
+func checkServiceError(w http.ResponseWriter, r *http.Request, zLog *zap.Logger, err error, notFound string, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, persistence.ErrNotFound):
+		utils.HttpError(w, r, notFound, http.StatusNotFound)
+	default:
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, message, http.StatusInternalServerError)
+	}
+	return false
+}
+
+// respond writes body as an uncacheable JSON response with the given status
+func respond(w http.ResponseWriter, r *http.Request, zLog *zap.Logger, status int, body any) {
+	response, err := json.Marshal(body)
+	if err != nil {
+		zLog.Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(response)
+}
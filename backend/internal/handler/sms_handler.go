@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// SMSHandler serves the SMS provider's callbacks under /api/v1/sms and the admin list of texts under /api/v1/admin/sms
+type SMSHandler struct {
+	SMSService service.SMSService
+	Logger     *zap.Logger
+}
+
+func NewSMSHandler(smsService service.SMSService, logger *zap.Logger) SMSHandler {
+	return SMSHandler{
+		SMSService: smsService,
+		Logger:     logger.Named("sms_handler"),
+	}
+}
+
+// HandleStatusCallback records a delivery report from the provider and answers 204
+func (sh SMSHandler) HandleStatusCallback(w http.ResponseWriter, r *http.Request) {
+	zLog := sh.getZLog(r.Context())
+	zLog.Debug("entered HandleStatusCallback")
+
+	var request model.SMSStatusCallback
+	if !decodeRequest(w, r, zLog, &request) {
+		return
+	}
+
+	if err := sh.SMSService.RecordStatus(r.Context(), request); err != nil {
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleInbound takes a text a customer sent to the store's number, honouring STOP and START, and answers 204
+func (sh SMSHandler) HandleInbound(w http.ResponseWriter, r *http.Request) {
+	zLog := sh.getZLog(r.Context())
+	zLog.Debug("entered HandleInbound")
+
+	var request model.SMSInbound
+	if !decodeRequest(w, r, zLog, &request) {
+		return
+	}
+
+	if err := sh.SMSService.HandleInbound(r.Context(), request); err != nil {
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetSMSMessages lists texts, newest first. The optional status and customer_id query parameters narrow the
+// list, and limit caps how many are returned
+func (sh SMSHandler) HandleGetSMSMessages(w http.ResponseWriter, r *http.Request) {
+	zLog := sh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetSMSMessages")
+
+	query := r.URL.Query()
+	status := model.SMSStatus(query.Get("status"))
+	validStatuses := []model.SMSStatus{"", model.SMSPending, model.SMSSent, model.SMSDelivered, model.SMSFailed}
+	if !slices.Contains(validStatuses, status) {
+		utils.HttpError(w, r, "status must be one of PENDING, SENT, DELIVERED or FAILED", http.StatusBadRequest)
+		return
+	}
+
+	customerId := 0
+	if raw := query.Get("customer_id"); raw != "" {
+		var err error
+		if customerId, err = strconv.Atoi(raw); err != nil || customerId < 1 {
+			utils.HttpError(w, r, "customer_id must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			utils.HttpError(w, r, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages, err := sh.SMSService.GetSMSMessages(r.Context(), status, customerId, limit)
+	if err != nil {
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_RETRIEVAL_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(messages)
+	if err != nil {
+		zLog.Error(common.ERR_REQ_MARSH_FAIL, zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_REQUEST_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (sh SMSHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, sh.Logger)
+}
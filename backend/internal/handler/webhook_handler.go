@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/service"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// WebhookHandler serves the admin API for partner webhook subscriptions under /api/v1/webhooks/subscriptions
+type WebhookHandler struct {
+	WebhookService service.WebhookService
+	Logger         *zap.Logger
+}
+
+func NewWebhookHandler(webhookService service.WebhookService, logger *zap.Logger) WebhookHandler {
+	return WebhookHandler{
+		WebhookService: webhookService,
+		Logger:         logger.Named("webhook_handler"),
+	}
+}
+
+// HandleCreateSubscription answers 201 with the subscription and its signing secret
+func (wh WebhookHandler) HandleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleCreateSubscription")
+
+	var request model.CreateWebhookSubscriptionRequest
+	if !decodeRequest(w, r, zLog, &request) {
+		return
+	}
+
+	response, err := wh.WebhookService.CreateSubscription(r.Context(), request)
+	if err != nil {
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_PERSISTENCE_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, zLog, http.StatusCreated, response)
+}
+
+func (wh WebhookHandler) HandleGetAllSubscriptions(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetAllSubscriptions")
+
+	subscriptions, err := wh.WebhookService.GetAllSubscriptions(r.Context())
+	if err != nil {
+		zLog.Error("service invocation failed", zap.Error(err))
+		utils.HttpError(w, r, common.ERR_CLIENT_DB_RETRIEVAL_FAIL, http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, zLog, http.StatusOK, subscriptions)
+}
+
+func (wh WebhookHandler) HandleGetSubscriptionById(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetSubscriptionById")
+
+	id, ok := wh.subscriptionId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	subscription, err := wh.WebhookService.GetSubscriptionById(r.Context(), id)
+	if !checkServiceError(w, r, zLog, err, "Webhook subscription not found", common.ERR_CLIENT_DB_RETRIEVAL_FAIL) {
+		return
+	}
+
+	respond(w, r, zLog, http.StatusOK, subscription)
+}
+
+func (wh WebhookHandler) HandleUpdateSubscriptionById(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleUpdateSubscriptionById")
+
+	id, ok := wh.subscriptionId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	var request model.UpdateWebhookSubscriptionRequest
+	if !decodeRequest(w, r, zLog, &request) {
+		return
+	}
+
+	err := wh.WebhookService.UpdateSubscriptionById(r.Context(), request, id)
+	if !checkServiceError(w, r, zLog, err, "Webhook subscription not found", common.ERR_CLIENT_DB_PERSISTENCE_FAIL) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (wh WebhookHandler) HandleDeleteSubscriptionById(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleDeleteSubscriptionById")
+
+	id, ok := wh.subscriptionId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	err := wh.WebhookService.DeleteSubscriptionById(r.Context(), id)
+	if !checkServiceError(w, r, zLog, err, "Webhook subscription not found", common.ERR_CLIENT_DB_DELETE_FAIL) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetDeliveries serves the subscription's delivery log, newest first. The optional status query parameter
+// narrows it to PENDING, DELIVERED or DEAD deliveries, and limit caps how many are returned
+func (wh WebhookHandler) HandleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleGetDeliveries")
+
+	id, ok := wh.subscriptionId(w, r, zLog)
+	if !ok {
+		return
+	}
+
+	status := model.WebhookDeliveryStatus(r.URL.Query().Get("status"))
+	validStatuses := []model.WebhookDeliveryStatus{"", model.WebhookDeliveryPending, model.WebhookDeliveryDelivered, model.WebhookDeliveryDead}
+	if !slices.Contains(validStatuses, status) {
+		utils.HttpError(w, r, "status must be one of PENDING, DELIVERED or DEAD", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+			utils.HttpError(w, r, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := wh.WebhookService.GetDeliveries(r.Context(), id, status, limit)
+	if !checkServiceError(w, r, zLog, err, "Webhook subscription not found", common.ERR_CLIENT_DB_RETRIEVAL_FAIL) {
+		return
+	}
+
+	respond(w, r, zLog, http.StatusOK, deliveries)
+}
+
+// HandleRedeliver queues the delivery in the path for another attempt and answers 202
+func (wh WebhookHandler) HandleRedeliver(w http.ResponseWriter, r *http.Request) {
+	zLog := wh.getZLog(r.Context())
+	zLog.Debug("entered HandleRedeliver")
+
+	id, ok := wh.subscriptionId(w, r, zLog)
+	if !ok {
+		return
+	}
+	deliveryPathVal := r.PathValue("deliveryId")
+	deliveryId, err := strconv.ParseInt(deliveryPathVal, 10, 64)
+	if err != nil {
+		zLog.Warn("failed to convert delivery id value from string to integer", zap.String("delivery_id", deliveryPathVal))
+		utils.HttpError(w, r, "Delivery ID must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	err = wh.WebhookService.Redeliver(r.Context(), id, deliveryId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		utils.HttpError(w, r, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+	if !checkServiceError(w, r, zLog, err, "Webhook subscription not found", common.ERR_CLIENT_DB_PERSISTENCE_FAIL) {
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// subscriptionId reads the subscription id from the path, answering the request itself when it is not an integer
+func (wh WebhookHandler) subscriptionId(w http.ResponseWriter, r *http.Request, zLog *zap.Logger) (int, bool) {
+	idPathVal := r.PathValue("id")
+	id, err := strconv.Atoi(idPathVal)
+	if err != nil {
+		zLog.Warn("failed to convert id value from string to integer", zap.String("id", idPathVal))
+		utils.HttpError(w, r, "ID must be an integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (wh WebhookHandler) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, wh.Logger)
+}
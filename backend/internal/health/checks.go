@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/migrate"
+	"golang.org/x/oauth2"
+)
+
+// DBPing fails when the pool cannot reach the database. The ping latency is reported by the checker itself
+func DBPing(db *sql.DB, timeout time.Duration) Check {
+	return Check{
+		Name:    "database",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (CheckDetail, error) {
+			if err := db.PingContext(ctx); err != nil {
+				return nil, err
+			}
+			stats := db.Stats()
+			return CheckDetail{"open_connections": stats.OpenConnections, "in_use": stats.InUse}, nil
+		},
+	}
+}
+
+// Migrations fails until the schema is at the version embedded in this binary. A newer schema is fine, which keeps an
+// old revision ready while a rollout that migrated ahead of it is still in progress
+func Migrations(db *sql.DB, d dialect.Dialect, timeout time.Duration) Check {
+	return Check{
+		Name:    "migrations",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (CheckDetail, error) {
+			latest, err := migrate.LatestVersion(d)
+			if err != nil {
+				return nil, err
+			}
+			applied, err := migrate.AppliedVersion(ctx, db)
+			if err != nil {
+				return CheckDetail{"expected": latest}, err
+			}
+			detail := CheckDetail{"applied": applied, "expected": latest}
+			if applied < latest {
+				return detail, fmt.Errorf("schema is at version %d, expected %d", applied, latest)
+			}
+			return detail, nil
+		},
+	}
+}
+
+// TokenSource fails when no valid token can be minted. oauth2.TokenSource takes no context, so the call runs in its own
+// goroutine and is abandoned if it outlives the timeout
+func TokenSource(ts oauth2.TokenSource, timeout time.Duration) Check {
+	return Check{
+		Name:    "token_source",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (CheckDetail, error) {
+			type result struct {
+				token *oauth2.Token
+				err   error
+			}
+			done := make(chan result, 1)
+			go func() {
+				tok, err := ts.Token()
+				done <- result{tok, err}
+			}()
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case res := <-done:
+				if res.err != nil {
+					return nil, res.err
+				}
+				if !res.token.Valid() {
+					return nil, fmt.Errorf("token source returned an expired token")
+				}
+				return CheckDetail{"expires_in_s": int(time.Until(res.token.Expiry).Seconds())}, nil
+			}
+		},
+	}
+}
+
+// HTTPReachable fails when url cannot be reached or answers with a 5xx. The request is unauthenticated, so the 401 or
+// 403 a private cloud function answers with still counts as reachable
+func HTTPReachable(name string, client *http.Client, url string, timeout time.Duration) Check {
+	return Check{
+		Name:    name,
+		Timeout: timeout,
+		Run: func(ctx context.Context) (CheckDetail, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+
+			detail := CheckDetail{"status_code": resp.StatusCode}
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return detail, fmt.Errorf("%s answered %s", url, resp.Status)
+			}
+			return detail, nil
+		},
+	}
+}
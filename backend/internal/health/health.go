@@ -0,0 +1,129 @@
+// Package health runs the dependency checks behind the readiness probe. Each check gets its own timeout and all of
+// them run concurrently, so one slow dependency cannot hide the state of the others or hold the probe past the load
+// balancer's own deadline.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DEFAULT_CHECK_TIMEOUT = 2 * time.Second
+
+const (
+	STATUS_OK          = "ok"
+	STATUS_UNAVAILABLE = "unavailable"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) (CheckDetail, error)
+}
+
+// CheckDetail carries anything a check wants to surface beyond pass/fail, e.g. the applied migration version
+type CheckDetail map[string]any
+
+type CheckResult struct {
+	Status    string      `json:"status"`
+	LatencyMs float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Detail    CheckDetail `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == STATUS_OK
+}
+
+type Checker struct {
+	Checks       []Check
+	Logger       *zap.Logger
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(logger *zap.Logger, checks ...Check) *Checker {
+	return &Checker{
+		Checks: checks,
+		Logger: logger.Named("health"),
+	}
+}
+
+// SetShuttingDown makes every later readiness report fail, so load balancers stop routing new traffic here while
+// in-flight requests drain
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) Readiness(ctx context.Context) Report {
+	report := Report{Status: STATUS_OK, Checks: make(map[string]CheckResult, len(c.Checks))}
+	if c.shuttingDown.Load() {
+		report.Status = STATUS_UNAVAILABLE
+		report.Error = ErrShuttingDown.Error()
+		return report
+	}
+
+	results := make([]CheckResult, len(c.Checks))
+	var wg sync.WaitGroup
+	for i, check := range c.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range c.Checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != STATUS_OK {
+			report.Status = STATUS_UNAVAILABLE
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) (result CheckResult) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_CHECK_TIMEOUT
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		// a panicking check reports as failed instead of taking the probe down with it
+		if p := recover(); p != nil {
+			result.Status = STATUS_UNAVAILABLE
+			result.Error = fmt.Sprintf("check panicked: %v", p)
+		}
+		if result.Status != STATUS_OK {
+			c.Logger.Warn("readiness check failed", zap.String("check", check.Name), zap.String("error", result.Error))
+		}
+	}()
+
+	detail, err := check.Run(ctx)
+	if err == nil {
+		// a check that ignores ctx can still finish late; it is reported as failed all the same
+		err = ctx.Err()
+	}
+	if err != nil {
+		return CheckResult{Status: STATUS_UNAVAILABLE, Error: err.Error(), Detail: detail}
+	}
+	return CheckResult{Status: STATUS_OK, Detail: detail}
+}
@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/testutil/sqlitetest"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+func staticCheck(name string, err error) Check {
+	return Check{Name: name, Run: func(context.Context) (CheckDetail, error) { return nil, err }}
+}
+
+func TestChecker_Readiness(t *testing.T) {
+	checker := NewChecker(zap.NewNop(), staticCheck("db", nil), staticCheck("cache", nil))
+	report := checker.Readiness(context.Background())
+	if !report.Ready() || len(report.Checks) != 2 {
+		t.Fatalf("expected all checks to pass, got %+v", report)
+	}
+
+	checker.Checks = append(checker.Checks, staticCheck("queue", errors.New("unreachable")))
+	report = checker.Readiness(context.Background())
+	if report.Ready() {
+		t.Fatal("expected a failing check to fail readiness")
+	}
+	if report.Checks["queue"].Error != "unreachable" || report.Checks["db"].Status != STATUS_OK {
+		t.Errorf("failures should be reported per check, got %+v", report.Checks)
+	}
+}
+
+func TestChecker_EachCheckHasItsOwnTimeout(t *testing.T) {
+	slow := Check{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Run: func(ctx context.Context) (CheckDetail, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	// ignores its context entirely; the checker still reports it as failed once it finally returns
+	stubborn := Check{
+		Name:    "stubborn",
+		Timeout: 10 * time.Millisecond,
+		Run: func(context.Context) (CheckDetail, error) {
+			time.Sleep(30 * time.Millisecond)
+			return nil, nil
+		},
+	}
+	checker := NewChecker(zap.NewNop(), slow, stubborn, staticCheck("fast", nil))
+
+	report := checker.Readiness(context.Background())
+	if report.Ready() {
+		t.Fatal("expected timed out checks to fail readiness")
+	}
+	for _, name := range []string{"slow", "stubborn"} {
+		if !strings.Contains(report.Checks[name].Error, "deadline exceeded") {
+			t.Errorf("%s: expected deadline error, got %+v", name, report.Checks[name])
+		}
+	}
+	if report.Checks["fast"].Status != STATUS_OK {
+		t.Errorf("a slow check should not affect the others, got %+v", report.Checks["fast"])
+	}
+	if report.Checks["slow"].LatencyMs < 20 {
+		t.Errorf("expected latency to be recorded, got %v", report.Checks["slow"].LatencyMs)
+	}
+}
+
+func TestChecker_RecoversPanickingCheck(t *testing.T) {
+	checker := NewChecker(zap.NewNop(), Check{
+		Name: "broken",
+		Run:  func(context.Context) (CheckDetail, error) { panic("boom") },
+	})
+	report := checker.Readiness(context.Background())
+	if report.Ready() || !strings.Contains(report.Checks["broken"].Error, "boom") {
+		t.Errorf("expected panic to be reported as a failure, got %+v", report)
+	}
+}
+
+func TestChecker_ShuttingDown(t *testing.T) {
+	ran := false
+	checker := NewChecker(zap.NewNop(), Check{
+		Name: "db",
+		Run:  func(context.Context) (CheckDetail, error) { ran = true; return nil, nil },
+	})
+	checker.SetShuttingDown()
+
+	report := checker.Readiness(context.Background())
+	if report.Ready() || report.Error != ErrShuttingDown.Error() {
+		t.Errorf("expected shutting down report, got %+v", report)
+	}
+	if ran {
+		t.Error("checks should be skipped once shutdown has begun")
+	}
+}
+
+func TestDBChecks_SQLite(t *testing.T) {
+	db := sqlitetest.New(t)
+	checker := NewChecker(zap.NewNop(), DBPing(db, time.Second), Migrations(db, dialect.SQLite, time.Second))
+
+	report := checker.Readiness(context.Background())
+	if !report.Ready() {
+		t.Fatalf("expected migrated database to be ready, got %+v", report)
+	}
+	if report.Checks["migrations"].Detail["applied"] != report.Checks["migrations"].Detail["expected"] {
+		t.Errorf("unexpected migration detail: %+v", report.Checks["migrations"].Detail)
+	}
+
+	if _, err := db.Exec(`DELETE FROM schema_migrations`); err != nil {
+		t.Fatalf("failed to reset schema_migrations: %v", err)
+	}
+	report = checker.Readiness(context.Background())
+	if report.Ready() || !strings.Contains(report.Checks["migrations"].Error, "expected") {
+		t.Errorf("expected an unmigrated schema to fail readiness, got %+v", report.Checks["migrations"])
+	}
+
+	db.Close()
+	report = checker.Readiness(context.Background())
+	if report.Checks["database"].Status != STATUS_UNAVAILABLE {
+		t.Errorf("expected a closed pool to fail the ping, got %+v", report.Checks["database"])
+	}
+}
+
+func TestTokenSourceCheck(t *testing.T) {
+	valid := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "t", Expiry: time.Now().Add(time.Hour)})
+	expired := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "t", Expiry: time.Now().Add(-time.Hour)})
+
+	checker := NewChecker(zap.NewNop(), TokenSource(valid, time.Second))
+	if report := checker.Readiness(context.Background()); !report.Ready() {
+		t.Errorf("expected valid token to pass, got %+v", report)
+	}
+
+	checker = NewChecker(zap.NewNop(), TokenSource(expired, time.Second))
+	if report := checker.Readiness(context.Background()); report.Ready() {
+		t.Error("expected expired token to fail")
+	}
+}
+
+func TestHTTPReachableCheck(t *testing.T) {
+	status := http.StatusForbidden
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	checker := NewChecker(zap.NewNop(), HTTPReachable("fn", srv.Client(), srv.URL, time.Second))
+	if report := checker.Readiness(context.Background()); !report.Ready() {
+		t.Errorf("an auth rejection still proves the function is reachable, got %+v", report)
+	}
+
+	status = http.StatusBadGateway
+	if report := checker.Readiness(context.Background()); report.Ready() {
+		t.Error("expected a 5xx to fail the check")
+	}
+
+	srv.Close()
+	if report := checker.Readiness(context.Background()); report.Ready() {
+		t.Error("expected an unreachable url to fail the check")
+	}
+}
@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec says when a recurring job is due
+type Spec interface {
+	// Next returns the first time after t the job is due, or the zero time when it never is again
+	Next(t time.Time) time.Time
+}
+
+// ParseSpec reads a schedule in UTC. It accepts the five cron fields, minute hour day-of-month month day-of-week, each
+// a *, a number, a range such as 1-5 or a comma separated list of those, optionally stepped with /n, as well as the
+// shorthands @hourly, @daily, @weekly, @monthly and @every <duration>. Like cron, when both day fields are restricted
+// a day matching either one is due. @every intervals are counted from the Unix epoch, so every instance agrees on
+// when a job is due
+func ParseSpec(spec string) (Spec, error) {
+	spec = strings.TrimSpace(spec)
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("schedule %q: @every needs a duration of at least 1s", spec)
+		}
+		return everySpec(every), nil
+	}
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var c cronSpec
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule %q: minute: %w", spec, err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule %q: hour: %w", spec, err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of month: %w", spec, err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule %q: month: %w", spec, err)
+	}
+	// 7 is accepted for Sunday as well as 0
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of week: %w", spec, err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+type everySpec time.Duration
+
+func (e everySpec) Next(t time.Time) time.Time {
+	every := time.Duration(e)
+	return t.Truncate(every).Add(every)
+}
+
+// cronSpec holds one bit per allowed value of each field
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// Next skips whole months, days and hours that cannot match rather than testing every minute. Schedules that can
+// never match, such as 30 February, give up after a few years
+func (c cronSpec) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case !has(c.month, int(month)):
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+		case !has(c.hour, t.Hour()):
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, time.UTC)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	domMatch := has(c.dom, t.Day())
+	dowMatch := has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<value) != 0
+}
+
+func parseField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		from, to := lo, hi
+		if rangePart != "*" {
+			start, end, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = strconv.Atoi(start); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(end); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if stepped {
+				// 5/15 means from 5 onwards, as in most crons
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
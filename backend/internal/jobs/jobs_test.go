@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testJobsConfig = config.JobsConfig{
+	Concurrency:  2,
+	PollInterval: time.Millisecond,
+	Timeout:      time.Second,
+	MaxAttempts:  3,
+	RetryBase:    time.Minute,
+	RetryMax:     time.Hour,
+}
+
+func newTestWorker(store *memory.Store, registry *Registry) (*Worker, *time.Time) {
+	worker := NewWorker(store.Repositories().Jobs, registry, testJobsConfig, nil, zap.NewNop())
+	now := time.Now()
+	worker.Now = func() time.Time { return now }
+	return worker, &now
+}
+
+func TestWorker_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	var calls atomic.Int32
+	registry.Register("flaky", func(ctx context.Context, job model.Job) error {
+		calls.Add(1)
+		return errors.New("still broken")
+	})
+	worker, now := newTestWorker(store, registry)
+
+	id, err := EnqueueAt(context.Background(), store.Repositories().Jobs, "flaky", map[string]string{"a": "b"}, *now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantWaits := []time.Duration{time.Minute, 2 * time.Minute}
+	for attempt, wait := range wantWaits {
+		if ran, err := worker.WorkOnce(context.Background()); err != nil || ran != 1 {
+			t.Fatalf("attempt %d: ran %d, %v", attempt+1, ran, err)
+		}
+		job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id)
+		if job.Status != model.JobPending || job.LastError != "still broken" || !job.RunAt.Equal(now.Add(wait)) {
+			t.Fatalf("attempt %d: expected a retry after %s, got %+v", attempt+1, wait, job)
+		}
+		if ran, _ := worker.WorkOnce(context.Background()); ran != 0 {
+			t.Fatalf("attempt %d: expected nothing due before the backoff ends", attempt+1)
+		}
+		*now = now.Add(wait)
+	}
+
+	worker.WorkOnce(context.Background())
+	job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id)
+	if job.Status != model.JobDead || job.Attempts != 3 || calls.Load() != 3 {
+		t.Fatalf("expected the job to be dead after 3 attempts, got %+v after %d calls", job, calls.Load())
+	}
+}
+
+func TestWorker_PermanentErrorsAndPanicsAndSuccess(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	registry.Register("bad-payload", func(ctx context.Context, job model.Job) error {
+		return Permanent(errors.New("cannot decode"))
+	})
+	registry.Register("panics", func(ctx context.Context, job model.Job) error {
+		panic("boom")
+	})
+	registry.Register("works", func(ctx context.Context, job model.Job) error {
+		return nil
+	})
+	worker, now := newTestWorker(store, registry)
+	jobs := store.Repositories().Jobs
+
+	permanent, _ := EnqueueAt(context.Background(), jobs, "bad-payload", nil, *now)
+	panics, _ := EnqueueAt(context.Background(), jobs, "panics", nil, *now)
+	works, _ := EnqueueAt(context.Background(), jobs, "works", nil, *now)
+	unknown, _ := EnqueueAt(context.Background(), jobs, "unregistered", nil, *now)
+
+	worker.Concurrency = 10
+	if ran, err := worker.WorkOnce(context.Background()); err != nil || ran != 3 {
+		t.Fatalf("expected the three registered jobs to run, ran %d, %v", ran, err)
+	}
+
+	want := map[int64]model.JobStatus{permanent: model.JobDead, panics: model.JobPending, works: model.JobSucceeded, unknown: model.JobPending}
+	for id, status := range want {
+		job, _ := jobs.FetchJobById(context.Background(), id)
+		if job.Status != status {
+			t.Errorf("job %d (%s): expected %s, got %+v", id, job.Type, status, job)
+		}
+	}
+	if job, _ := jobs.FetchJobById(context.Background(), panics); job.LastError != "job panicked: boom" {
+		t.Errorf("expected the panic to be recorded, got %q", job.LastError)
+	}
+}
+
+func TestWorker_JobMaxAttemptsOverridesTheDefault(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	registry.Register("once", func(ctx context.Context, job model.Job) error { return errors.New("nope") })
+	worker, now := newTestWorker(store, registry)
+
+	job, _ := model.NewJob("once", nil)
+	job.RunAt, job.MaxAttempts = *now, 1
+	id, _, _ := store.Repositories().Jobs.PersistEnqueueJob(context.Background(), job)
+
+	worker.WorkOnce(context.Background())
+	if job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id); job.Status != model.JobDead {
+		t.Errorf("expected a single attempt, got %+v", job)
+	}
+}
+
+func TestWorker_SnoozeKeepsTheAttempt(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	var calls atomic.Int32
+	worker, now := newTestWorker(store, registry)
+	registry.Register("quiet", func(ctx context.Context, job model.Job) error {
+		if calls.Add(1) < 5 {
+			return Snooze(now.Add(time.Hour))
+		}
+		return nil
+	})
+
+	id, _ := EnqueueAt(context.Background(), store.Repositories().Jobs, "quiet", nil, *now)
+	for range 4 {
+		worker.WorkOnce(context.Background())
+		job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id)
+		if job.Status != model.JobPending || job.Attempts != 0 || !job.RunAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("expected the job back in the queue without using an attempt, got %+v", job)
+		}
+		*now = now.Add(time.Hour)
+	}
+
+	// more snoozes than testJobsConfig.MaxAttempts and it still runs
+	worker.WorkOnce(context.Background())
+	if job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id); job.Status != model.JobSucceeded || job.Attempts != 1 {
+		t.Errorf("expected the job to succeed on its first counted attempt, got %+v", job)
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	from := time.Date(2026, time.March, 14, 10, 17, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.March, 14, 10, 18, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.March, 14, 10, 30, 0, 0, time.UTC)},
+		{"5,50 9-17 * * *", time.Date(2026, time.March, 14, 10, 50, 0, 0, time.UTC)},
+		// the 14th is a Saturday
+		{"0 9 * * 1-5", time.Date(2026, time.March, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 0 1 * 1", time.Date(2026, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"30 4 29 2 *", time.Date(2028, time.February, 29, 4, 30, 0, 0, time.UTC)},
+		{"@every 10m", time.Date(2026, time.March, 14, 10, 20, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		spec, err := ParseSpec(c.spec)
+		if err != nil {
+			t.Errorf("ParseSpec(%q) returned %v", c.spec, err)
+			continue
+		}
+		if got := spec.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: Next = %s, want %s", c.spec, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 10", "@every 1ms", "@yearly"} {
+		if _, err := ParseSpec(bad); err == nil {
+			t.Errorf("expected ParseSpec(%q) to fail", bad)
+		}
+	}
+}
+
+func TestScheduler_EnqueuesEachDueTimeOnce(t *testing.T) {
+	store := memory.NewStore()
+	schedules := []Schedule{{Name: "digest", Spec: "@every 1h", Type: "digest.send", Payload: map[string]int{"days": 1}}}
+
+	// two instances share the table, as two replicas would
+	var schedulers []*Scheduler
+	now := time.Date(2026, time.March, 14, 10, 17, 0, 0, time.UTC)
+	for range 2 {
+		scheduler, err := NewScheduler(store.Repositories().Jobs, schedules, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		scheduler.Now = func() time.Time { return now }
+		schedulers = append(schedulers, scheduler)
+	}
+
+	for _, scheduler := range schedulers {
+		if enqueued, err := scheduler.ScheduleOnce(context.Background()); err != nil || enqueued != 0 {
+			t.Fatalf("expected the first round only to plan, enqueued %d, %v", enqueued, err)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	total := 0
+	for _, scheduler := range schedulers {
+		enqueued, err := scheduler.ScheduleOnce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += enqueued
+	}
+	jobs := store.Jobs()
+	if total != 1 || len(jobs) != 1 || jobs[0].Type != "digest.send" || string(jobs[0].Payload) != `{"days":1}` {
+		t.Fatalf("expected one job between both schedulers, enqueued %d: %+v", total, jobs)
+	}
+	if want := time.Date(2026, time.March, 14, 11, 0, 0, 0, time.UTC); !jobs[0].RunAt.Equal(want) {
+		t.Errorf("expected the job to be due at %s, got %s", want, jobs[0].RunAt)
+	}
+
+	if enqueued, _ := schedulers[0].ScheduleOnce(context.Background()); enqueued != 0 {
+		t.Errorf("expected nothing more until the next hour, enqueued %d", enqueued)
+	}
+}
+
+func TestNewScheduler_RejectsBadSchedules(t *testing.T) {
+	_, err := NewScheduler(memory.NewStore().Repositories().Jobs, []Schedule{
+		{Name: "a", Spec: "@hourly", Type: "x"},
+		{Name: "a", Spec: "@daily", Type: "x"},
+		{Name: "b", Spec: "not a spec", Type: "x"},
+	}, zap.NewNop())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestWorker_StopCancelsHandlersPastTheDeadline(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	started := make(chan struct{})
+	var returned atomic.Bool
+	registry.Register("slow", func(ctx context.Context, job model.Job) error {
+		close(started)
+		<-ctx.Done()
+		returned.Store(true)
+		return ctx.Err()
+	})
+	worker := NewWorker(store.Repositories().Jobs, registry, testJobsConfig, nil, zap.NewNop())
+
+	id, err := Enqueue(context.Background(), store.Repositories().Jobs, "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := worker.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Stop to report the missed deadline, got %v", err)
+	}
+
+	// by the time Stop returns the handler is gone and its job is back in the queue, so closing the database next is safe
+	if !returned.Load() {
+		t.Fatal("expected the handler to be cancelled and to have returned before Stop did")
+	}
+	job, _ := store.Repositories().Jobs.FetchJobById(context.Background(), id)
+	if job.Status != model.JobPending || job.Attempts != 0 {
+		t.Errorf("expected the interrupted job back in the queue without using an attempt, got %+v", job)
+	}
+}
+
+func TestWorker_StopLeavesHandlersThatIgnoreCancellationBehind(t *testing.T) {
+	store := memory.NewStore()
+	registry := NewRegistry()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	registry.Register("stuck", func(ctx context.Context, job model.Job) error {
+		close(started)
+		<-release
+		return nil
+	})
+	core, logs := observer.New(zap.ErrorLevel)
+	worker := NewWorker(store.Repositories().Jobs, registry, testJobsConfig, nil, zap.New(core))
+	worker.StopGrace = 20 * time.Millisecond
+
+	id, err := Enqueue(context.Background(), store.Repositories().Jobs, "stuck", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- worker.Stop(ctx) }()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Stop to report the missed deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Stop to give up on a handler that ignores its context")
+	}
+
+	entries := logs.FilterMessage("jobs did not return after being cancelled, leaving them behind").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected the jobs left behind to be logged, got %+v", logs.All())
+	}
+	if ids, _ := entries[0].ContextMap()["job_ids"].([]interface{}); len(ids) != 1 || ids[0] != id {
+		t.Errorf("expected job %d to be logged, got %v", id, entries[0].ContextMap()["job_ids"])
+	}
+}
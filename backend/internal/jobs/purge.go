@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"go.uber.org/zap"
+)
+
+// PURGE_JOB_TYPE deletes succeeded jobs once they are older than the retention, see PurgeSchedule
+const PURGE_JOB_TYPE = "jobs.purge"
+
+// PurgeSchedule runs the purge job every hour
+var PurgeSchedule = Schedule{Name: PURGE_JOB_TYPE, Spec: "@hourly", Type: PURGE_JOB_TYPE}
+
+// PurgeHandler deletes the jobs that succeeded more than retention ago. Dead jobs are left for someone to look at
+func PurgeHandler(jobs persistence.JobRepository, retention time.Duration, logger *zap.Logger) Handler {
+	return func(ctx context.Context, job model.Job) error {
+		purged, err := jobs.PurgeSucceededJobs(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			logger.Info("purged succeeded jobs", zap.Int64("purged", purged))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+// Package jobs runs background work queued in the jobs table. Anything that should happen outside of a request, or
+// happen again when it fails, is enqueued as a job of a registered type and picked up by a Worker, either inside the
+// server or in a separate `app worker` process. Workers claim jobs with a lease, so any number of them can share the
+// table, and a job whose worker died is claimed again once its lease runs out. Handlers must therefore be safe to run
+// more than once for the same job.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+)
+
+// Handler does the work of one job. A nil error completes it; any other error fails the attempt, which is retried
+// unless the error is Permanent or the job is out of attempts. The context ends when the job's timeout does
+type Handler func(ctx context.Context, job model.Job) error
+
+// Registry maps job types to their handlers. Workers only claim the types registered with them
+type Registry struct {
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[string]Handler{}}
+}
+
+// Register adds the handler for jobType, replacing any handler registered for it before
+func (r *Registry) Register(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+}
+
+// Handler returns the handler registered for jobType
+func (r *Registry) Handler(jobType string) (Handler, bool) {
+	handler, ok := r.handlers[jobType]
+	return handler, ok
+}
+
+// Types lists the registered job types in sorted order
+func (r *Registry) Types() []string {
+	return slices.Sorted(maps.Keys(r.handlers))
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying cannot fix, such as a payload that does not decode, so the job is dead
+// straight away instead of using up its attempts
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+type snoozeError struct {
+	until time.Time
+}
+
+func (e snoozeError) Error() string { return "snoozed until " + e.until.UTC().Format(time.RFC3339) }
+
+// Snooze puts the job back until the given time without using up an attempt, for work that is fine but must not
+// happen yet, such as a text message due during quiet hours
+func Snooze(until time.Time) error {
+	return snoozeError{until: until}
+}
+
+// SnoozedUntil reports whether err, or any error it wraps, came from Snooze and until when
+func SnoozedUntil(err error) (time.Time, bool) {
+	var snooze snoozeError
+	if !errors.As(err, &snooze) {
+		return time.Time{}, false
+	}
+	return snooze.until, true
+}
+
+// Enqueue queues a job of the given type, due now. Pass the repositories of a UnitOfWork to enqueue it together with
+// the change that calls for it
+func Enqueue(ctx context.Context, jobs persistence.JobRepository, jobType string, payload any) (int64, error) {
+	return EnqueueAt(ctx, jobs, jobType, payload, time.Now())
+}
+
+// EnqueueAt queues a job of the given type that is not due before runAt
+func EnqueueAt(ctx context.Context, jobs persistence.JobRepository, jobType string, payload any, runAt time.Time) (int64, error) {
+	job, err := model.NewJob(jobType, payload)
+	if err != nil {
+		return 0, err
+	}
+	job.RunAt = runAt.UTC()
+	id, _, err := jobs.PersistEnqueueJob(ctx, job)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue %s job: %w", jobType, err)
+	}
+	return id, nil
+}
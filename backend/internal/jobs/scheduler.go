@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"go.uber.org/zap"
+)
+
+// Schedule enqueues a job of Type, with Payload as its body, whenever Spec is due. Name identifies the schedule and
+// must be unique
+type Schedule struct {
+	Name    string
+	Spec    string
+	Type    string
+	Payload any
+}
+
+type scheduled struct {
+	Schedule
+	spec Spec
+	next time.Time
+}
+
+// Scheduler enqueues the jobs of recurring schedules. Every process may run one: each due time is enqueued under a
+// unique key built from the schedule's name and the time, so however many schedulers see it the job is queued once.
+// Times that passed while no scheduler was running are skipped rather than caught up on
+type Scheduler struct {
+	Jobs   persistence.JobRepository
+	Now    func() time.Time
+	Logger *zap.Logger
+
+	schedules []*scheduled
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewScheduler parses every schedule up front, so a bad spec stops the process at start up
+func NewScheduler(jobs persistence.JobRepository, schedules []Schedule, logger *zap.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		Jobs:   jobs,
+		Now:    time.Now,
+		Logger: logger.Named("job_scheduler"),
+	}
+	names := map[string]bool{}
+	var problems []error
+	for _, schedule := range schedules {
+		spec, err := ParseSpec(schedule.Spec)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("schedule %s: %w", schedule.Name, err))
+			continue
+		}
+		if names[schedule.Name] {
+			problems = append(problems, fmt.Errorf("schedule %s is defined twice", schedule.Name))
+		}
+		names[schedule.Name] = true
+		s.schedules = append(s.schedules, &scheduled{Schedule: schedule, spec: spec})
+	}
+	return s, errors.Join(problems...)
+}
+
+// Start enqueues due jobs in the background until Stop is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		for {
+			if _, err := s.ScheduleOnce(ctx); err != nil {
+				s.Logger.Error("job scheduling round failed", zap.Error(err))
+			}
+
+			// woken at least once a minute, so a clock that jumps does not leave a schedule waiting
+			wait := time.Minute
+			for _, schedule := range s.schedules {
+				if !schedule.next.IsZero() {
+					wait = min(wait, schedule.next.Sub(s.Now()))
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(max(wait, 0)):
+			}
+		}
+	}()
+}
+
+// Stop waits for the round in flight to finish, then stops the scheduler
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ScheduleOnce enqueues a job for every schedule that is due and returns how many it enqueued, not counting those
+// another scheduler got to first. The first round only works out when each schedule is next due
+func (s *Scheduler) ScheduleOnce(ctx context.Context) (int, error) {
+	ctx = context.WithoutCancel(ctx)
+	now := s.Now()
+
+	enqueued := 0
+	var problems []error
+	for _, schedule := range s.schedules {
+		if schedule.next.IsZero() {
+			schedule.next = schedule.spec.Next(now)
+			continue
+		}
+		if now.Before(schedule.next) {
+			continue
+		}
+
+		created, err := s.enqueue(ctx, schedule)
+		if err != nil {
+			// retried on the next round, when it is still due
+			problems = append(problems, fmt.Errorf("schedule %s: %w", schedule.Name, err))
+			continue
+		}
+		if created {
+			enqueued++
+		}
+		schedule.next = schedule.spec.Next(now)
+	}
+	return enqueued, errors.Join(problems...)
+}
+
+func (s *Scheduler) enqueue(ctx context.Context, schedule *scheduled) (bool, error) {
+	job, err := model.NewJob(schedule.Type, schedule.Payload)
+	if err != nil {
+		return false, err
+	}
+	job.RunAt = schedule.next.UTC()
+	job.UniqueKey = "schedule:" + schedule.Name + ":" + strconv.FormatInt(schedule.next.Unix(), 10)
+
+	id, created, err := s.Jobs.PersistEnqueueJob(ctx, job)
+	if err != nil {
+		return false, err
+	}
+	if created {
+		s.Logger.Info("scheduled job enqueued", zap.String("schedule", schedule.Name), zap.Int64("job_id", id), zap.Time("run_at", job.RunAt))
+	}
+	return created, nil
+}
@@ -0,0 +1,257 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Worker runs the jobs of the types in its registry, Concurrency at a time. A failed job is retried after a wait
+// doubling from RetryBase to RetryMax until it has failed MaxAttempts times, or the job's own MaxAttempts when it sets
+// one, after which it is dead until retried by hand. StopGrace is how long Stop waits for the handlers it cancelled
+// before it leaves them behind
+type Worker struct {
+	Jobs         persistence.JobRepository
+	Registry     *Registry
+	Concurrency  int
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	StopGrace    time.Duration
+	Now          func() time.Time
+	Metrics      *metrics.Metrics
+	Logger       *zap.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	// interrupted is cancelled when Stop gives up waiting, and cancels the handlers still running with it
+	interrupted context.Context
+	interrupt   context.CancelFunc
+
+	// running holds the type of every job being run, by id
+	mu      sync.Mutex
+	running map[int64]string
+}
+
+// STOP_GRACE is the StopGrace of a new worker
+const STOP_GRACE = 5 * time.Second
+
+func NewWorker(jobs persistence.JobRepository, registry *Registry, cfg config.JobsConfig, metrics *metrics.Metrics, logger *zap.Logger) *Worker {
+	return &Worker{
+		Jobs:         jobs,
+		Registry:     registry,
+		Concurrency:  cfg.Concurrency,
+		PollInterval: cfg.PollInterval,
+		Timeout:      cfg.Timeout,
+		MaxAttempts:  cfg.MaxAttempts,
+		RetryBase:    cfg.RetryBase,
+		RetryMax:     cfg.RetryMax,
+		StopGrace:    STOP_GRACE,
+		Now:          time.Now,
+		Metrics:      metrics,
+		Logger:       logger.Named("job_worker"),
+	}
+}
+
+// Start runs Concurrency loops in the background until Stop is called. Each claims one job at a time, and goes
+// straight on to the next while there is work waiting
+func (w *Worker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	w.interrupted, w.interrupt = context.WithCancel(context.Background())
+
+	var loops sync.WaitGroup
+	for range max(w.Concurrency, 1) {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			for {
+				ran, err := w.work(ctx, 1)
+				if err != nil {
+					w.Logger.Error("job round failed", zap.Error(err))
+				}
+
+				wait := w.PollInterval
+				if err == nil && ran > 0 {
+					wait = 0
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+		}()
+	}
+	go func() {
+		loops.Wait()
+		close(w.done)
+	}()
+}
+
+// Stop lets the jobs in flight finish, then stops the worker. When ctx ends first the handlers still running are
+// cancelled, and Stop waits up to StopGrace for them to return so their jobs are back in the queue before the caller
+// closes anything they use. Jobs still running after that are logged and left to be claimed again once their lease
+// runs out
+func (w *Worker) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.Logger.Warn("jobs still running at the stop deadline, cancelling them")
+	w.interrupt()
+	grace := time.NewTimer(w.StopGrace)
+	defer grace.Stop()
+	select {
+	case <-w.done:
+	case <-grace.C:
+		w.mu.Lock()
+		ids := slices.Sorted(maps.Keys(w.running))
+		types := make([]string, len(ids))
+		for i, id := range ids {
+			types[i] = w.running[id]
+		}
+		w.mu.Unlock()
+		w.Logger.Error("jobs did not return after being cancelled, leaving them behind",
+			zap.Int64s("job_ids", ids), zap.Strings("job_types", types))
+	}
+	return ctx.Err()
+}
+
+// WorkOnce claims up to Concurrency due jobs, runs them side by side and returns how many it ran
+func (w *Worker) WorkOnce(ctx context.Context) (int, error) {
+	return w.work(ctx, max(w.Concurrency, 1))
+}
+
+func (w *Worker) work(ctx context.Context, limit int) (int, error) {
+	// a claimed job is seen through even when ctx is cancelled, so its outcome is always recorded
+	roundCtx := context.WithoutCancel(ctx)
+	now := w.Now()
+
+	// the lease outlasts the timeout, so a job is only claimed again when its worker is gone
+	claimed, err := w.Jobs.ClaimJobs(roundCtx, w.Registry.Types(), now, now.Add(2*w.Timeout), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(claimed))
+	for i, job := range claimed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = w.run(roundCtx, job)
+		}()
+	}
+	wg.Wait()
+	return len(claimed), errors.Join(errs...)
+}
+
+// run executes one claimed job and records how it went
+func (w *Worker) run(ctx context.Context, job model.Job) error {
+	logFields := []zap.Field{
+		zap.Int64("job_id", job.Id),
+		zap.String("job_type", job.Type),
+		zap.Int("attempt", job.Attempts),
+	}
+
+	w.mu.Lock()
+	if w.running == nil {
+		w.running = map[int64]string{}
+	}
+	w.running[job.Id] = job.Type
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, job.Id)
+		w.mu.Unlock()
+	}()
+
+	started := w.Now()
+	runErr := w.call(ctx, job)
+	finished := w.Now()
+	maxAttempts := w.MaxAttempts
+	if job.MaxAttempts > 0 {
+		maxAttempts = job.MaxAttempts
+	}
+
+	var err error
+	var snooze snoozeError
+	switch {
+	case runErr != nil && w.interrupted != nil && w.interrupted.Err() != nil:
+		// cut short by Stop rather than failed, so the attempt is given back and the job is due again at once
+		err = w.Jobs.PersistJobSnoozed(ctx, job.Id, job.Attempts, finished, finished)
+		w.Metrics.JobRan(job.Type, "interrupted", finished.Sub(started))
+		w.Logger.Warn("job interrupted by shutdown, returned to the queue", append(logFields, zap.Error(runErr))...)
+	case errors.As(runErr, &snooze):
+		err = w.Jobs.PersistJobSnoozed(ctx, job.Id, job.Attempts, snooze.until, finished)
+		w.Metrics.JobRan(job.Type, "snoozed", finished.Sub(started))
+		w.Logger.Debug("job snoozed", append(logFields, zap.Time("run_at", snooze.until))...)
+	case runErr == nil:
+		err = w.Jobs.PersistJobSucceeded(ctx, job.Id, job.Attempts, finished)
+		w.Metrics.JobRan(job.Type, "succeeded", finished.Sub(started))
+		w.Logger.Debug("job succeeded", logFields...)
+	case IsPermanent(runErr) || job.Attempts >= maxAttempts:
+		err = w.Jobs.PersistJobFailed(ctx, job.Id, job.Attempts, runErr.Error(), true, finished, finished)
+		w.Metrics.JobRan(job.Type, "dead", finished.Sub(started))
+		w.Logger.Error("job failed for the last time", append(logFields, zap.Error(runErr))...)
+	default:
+		retryAt := finished.Add(utils.Backoff(w.RetryBase, w.RetryMax, job.Attempts-1))
+		err = w.Jobs.PersistJobFailed(ctx, job.Id, job.Attempts, runErr.Error(), false, retryAt, finished)
+		w.Metrics.JobRan(job.Type, "failed", finished.Sub(started))
+		w.Logger.Warn("job failed, will retry", append(logFields, zap.Time("retry_at", retryAt), zap.Error(runErr))...)
+	}
+
+	if errors.Is(err, persistence.ErrNotFound) {
+		// the job ran past its lease and another worker claimed it, whose outcome wins
+		w.Logger.Warn("job lease lost before its outcome was recorded", logFields...)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record the outcome of job %d: %w", job.Id, err)
+	}
+	return nil
+}
+
+// call runs the job's handler within the timeout, turning a panic into an error so one bad job cannot take the
+// process down
+func (w *Worker) call(ctx context.Context, job model.Job) (err error) {
+	handler, ok := w.Registry.Handler(job.Type)
+	if !ok {
+		return Permanent(fmt.Errorf("no handler registered for job type %s", job.Type))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+	if w.interrupted != nil {
+		defer context.AfterFunc(w.interrupted, cancel)()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			w.Logger.Error("job panicked", zap.Int64("job_id", job.Id), zap.Any("panic", p), zap.ByteString("stack", debug.Stack()))
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,320 @@
+// Package metrics owns every Prometheus collector the backend exports. Collectors live on a private registry rather
+// than the global default so tests can build as many independent instances as they like. All recording methods are
+// safe to call on a nil *Metrics, which keeps metrics optional for callers such as unit tests.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "codecart"
+
+// UNMATCHED_ROUTE labels requests no route pattern matched, so scanners probing random paths cannot blow up the
+// route label's cardinality
+const UNMATCHED_ROUTE = "unmatched"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	cloudFunctionDuration *prometheus.HistogramVec
+	cloudFunctionErrors   *prometheus.CounterVec
+	cloudFunctionRetries  *prometheus.CounterVec
+	cloudFunctionCircuit  *prometheus.GaugeVec
+
+	ordersCreated          *prometheus.CounterVec
+	orderStatusTransitions *prometheus.CounterVec
+
+	outboxPublished *prometheus.CounterVec
+	outboxFailures  *prometheus.CounterVec
+
+	webhookAttempts *prometheus.CounterVec
+
+	orderEventStreams prometheus.Gauge
+
+	jobRuns        *prometheus.CounterVec
+	jobRunDuration *prometheus.HistogramVec
+
+	emails      *prometheus.CounterVec
+	sms         *prometheus.CounterVec
+	smsSegments *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests served, by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency, by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		cloudFunctionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "cloud_function",
+			Name:      "call_duration_seconds",
+			Help:      "Cloud function call latency including ID token minting, by function and outcome.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"function", "outcome"}),
+		cloudFunctionErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "cloud_function",
+			Name:      "errors_total",
+			Help:      "Failed cloud function calls, by function and reason.",
+		}, []string{"function", "reason"}),
+		cloudFunctionRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "cloud_function",
+			Name:      "retries_total",
+			Help:      "Cloud function attempts repeated after a retryable failure, by function.",
+		}, []string{"function"}),
+		cloudFunctionCircuit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "cloud_function",
+			Name:      "circuit_state",
+			Help:      "Circuit breaker state per function: 0 closed, 1 half-open, 2 open.",
+		}, []string{"function"}),
+		ordersCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "orders",
+			Name:      "created_total",
+			Help:      "Orders created, by order type.",
+		}, []string{"order_type"}),
+		orderStatusTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "orders",
+			Name:      "status_transitions_total",
+			Help:      "Order status changes, by previous and new status.",
+		}, []string{"from", "to"}),
+		outboxPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "outbox",
+			Name:      "events_published_total",
+			Help:      "Domain events published from the outbox, by event type.",
+		}, []string{"event_type"}),
+		outboxFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "outbox",
+			Name:      "publish_failures_total",
+			Help:      "Failed attempts to publish a domain event, by event type.",
+		}, []string{"event_type"}),
+		webhookAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "webhook",
+			Name:      "delivery_attempts_total",
+			Help:      "Partner webhook delivery attempts, by event type and outcome: delivered, failed or dead.",
+		}, []string{"event_type", "outcome"}),
+		orderEventStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "order_events",
+			Name:      "open_streams",
+			Help:      "Order event streams currently held open by clients.",
+		}),
+		jobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "jobs",
+			Name:      "runs_total",
+			Help:      "Background job attempts, by job type and outcome: succeeded, failed, dead, snoozed or interrupted.",
+		}, []string{"type", "outcome"}),
+		jobRunDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "jobs",
+			Name:      "run_duration_seconds",
+			Help:      "Time spent running background jobs, by job type.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 9),
+		}, []string{"type"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "notifications",
+			Name:      "emails_total",
+			Help:      "Customer emails, by template and outcome: sent, failed or skipped when the customer opted out or has no address.",
+		}, []string{"template", "outcome"}),
+		sms: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "notifications",
+			Name:      "sms_total",
+			Help:      "Customer texts, by template and outcome: sent, failed or skipped when the customer has not opted in or the order moved on.",
+		}, []string{"template", "outcome"}),
+		smsSegments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Subsystem: "notifications",
+			Name:      "sms_segments_total",
+			Help:      "Segments of the customer texts sent, the unit SMS providers bill by, by template and encoding.",
+		}, []string{"template", "encoding"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.cloudFunctionDuration,
+		m.cloudFunctionErrors,
+		m.cloudFunctionRetries,
+		m.cloudFunctionCircuit,
+		m.ordersCreated,
+		m.orderStatusTransitions,
+		m.outboxPublished,
+		m.outboxFailures,
+		m.webhookAttempts,
+		m.orderEventStreams,
+		m.jobRuns,
+		m.jobRunDuration,
+		m.emails,
+		m.sms,
+		m.smsSegments,
+	)
+	return m
+}
+
+// RegisterDB exports the pool gauges and counters from sql.DBStats under the given db_name label
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	if m == nil {
+		return nil
+	}
+	return m.Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = UNMATCHED_ROUTE
+	}
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveCloudFunctionCall records one call. reason is empty for a successful call and otherwise a short, bounded
+// description of where it failed, e.g. "token" or "status_5xx"
+func (m *Metrics) ObserveCloudFunctionCall(function, reason string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	outcome := "success"
+	if reason != "" {
+		outcome = "error"
+		m.cloudFunctionErrors.WithLabelValues(function, reason).Inc()
+	}
+	m.cloudFunctionDuration.WithLabelValues(function, outcome).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) CloudFunctionRetried(function string) {
+	if m == nil {
+		return
+	}
+	m.cloudFunctionRetries.WithLabelValues(function).Inc()
+}
+
+// SetCloudFunctionCircuitState records a breaker transition; state follows the gauge's help text
+func (m *Metrics) SetCloudFunctionCircuitState(function string, state int) {
+	if m == nil {
+		return
+	}
+	m.cloudFunctionCircuit.WithLabelValues(function).Set(float64(state))
+}
+
+func (m *Metrics) OrderCreated(orderType string) {
+	if m == nil {
+		return
+	}
+	m.ordersCreated.WithLabelValues(orderType).Inc()
+}
+
+func (m *Metrics) OrderStatusChanged(from, to string) {
+	if m == nil {
+		return
+	}
+	m.orderStatusTransitions.WithLabelValues(from, to).Inc()
+}
+
+func (m *Metrics) OutboxEventPublished(eventType string) {
+	if m == nil {
+		return
+	}
+	m.outboxPublished.WithLabelValues(eventType).Inc()
+}
+
+func (m *Metrics) OutboxPublishFailed(eventType string) {
+	if m == nil {
+		return
+	}
+	m.outboxFailures.WithLabelValues(eventType).Inc()
+}
+
+// WebhookDeliveryAttempted records one attempt; outcome follows the counter's help text
+func (m *Metrics) WebhookDeliveryAttempted(eventType, outcome string) {
+	if m == nil {
+		return
+	}
+	m.webhookAttempts.WithLabelValues(eventType, outcome).Inc()
+}
+
+func (m *Metrics) OrderEventStreamOpened() {
+	if m == nil {
+		return
+	}
+	m.orderEventStreams.Inc()
+}
+
+func (m *Metrics) OrderEventStreamClosed() {
+	if m == nil {
+		return
+	}
+	m.orderEventStreams.Dec()
+}
+
+// JobRan records one attempt at a job; outcome follows the counter's help text
+func (m *Metrics) JobRan(jobType, outcome string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.jobRuns.WithLabelValues(jobType, outcome).Inc()
+	m.jobRunDuration.WithLabelValues(jobType).Observe(duration.Seconds())
+}
+
+// EmailHandled records one email; outcome follows the counter's help text
+func (m *Metrics) EmailHandled(template, outcome string) {
+	if m == nil {
+		return
+	}
+	m.emails.WithLabelValues(template, outcome).Inc()
+}
+
+// SMSHandled records one text; outcome follows the counter's help text
+func (m *Metrics) SMSHandled(template, outcome string) {
+	if m == nil {
+		return
+	}
+	m.sms.WithLabelValues(template, outcome).Inc()
+}
+
+// SMSSent records the segments of a text the provider accepted
+func (m *Metrics) SMSSent(template, encoding string, segments int) {
+	if m == nil {
+		return
+	}
+	m.sms.WithLabelValues(template, "sent").Inc()
+	m.smsSegments.WithLabelValues(template, encoding).Add(float64(segments))
+}
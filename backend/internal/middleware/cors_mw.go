@@ -2,20 +2,168 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
 )
 
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+// CORS applies the configured cross-origin policy. Preflight requests are answered here without reaching the mux;
+// every other request passes through, with the CORS headers added only when its origin is allowed. Responses always
+// carry Vary: Origin because their headers depend on it, which keeps shared caches from serving one origin's answer to
+// another
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	policy := newCORSPolicy(cfg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				policy.handlePreflight(w, r, origin)
+				return
+			}
+
+			if origin != "" && policy.allowsOrigin(origin) {
+				policy.setOriginHeaders(w, origin)
+				if len(policy.exposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.exposedHeaders, ", "))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type corsPolicy struct {
+	anyOrigin        bool
+	origins          []string
+	patterns         []originPattern
+	methods          []string
+	headers          []string
+	anyHeader        bool
+	exposedHeaders   []string
+	maxAge           string
+	allowCredentials bool
+}
+
+// originPattern matches origins of the form prefix + something + suffix, e.g. https://*.codecart.app
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+func (p originPattern) matches(origin string) bool {
+	return len(origin) > len(p.prefix)+len(p.suffix) &&
+		strings.HasPrefix(origin, p.prefix) &&
+		strings.HasSuffix(origin, p.suffix)
+}
+
+func newCORSPolicy(cfg config.CORSConfig) corsPolicy {
+	policy := corsPolicy{
+		allowCredentials: cfg.AllowCredentials,
+		exposedHeaders:   cfg.ExposedHeaders,
+	}
+	if cfg.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		// origins are compared case-insensitively, since scheme and host are
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			policy.anyOrigin = true
+		} else if prefix, suffix, ok := strings.Cut(origin, "*"); ok {
+			policy.patterns = append(policy.patterns, originPattern{prefix: prefix, suffix: suffix})
+		} else {
+			policy.origins = append(policy.origins, origin)
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		policy.methods = append(policy.methods, strings.ToUpper(method))
+	}
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			policy.anyHeader = true
+			continue
+		}
+		policy.headers = append(policy.headers, http.CanonicalHeaderKey(header))
+	}
+	return policy
+}
+
+func (p corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if slices.Contains(p.origins, origin) {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p corsPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if p.anyOrigin && !p.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PATCH, PUT, DELETE")
+	}
+}
+
+// handlePreflight answers 204 either way. A rejected preflight simply lacks the Access-Control-Allow-* headers, which is
+// what makes the browser block the actual request
+func (p corsPolicy) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	defer w.WriteHeader(http.StatusNoContent)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
+	if origin == "" || !p.allowsOrigin(origin) {
+		return
+	}
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !slices.Contains(p.methods, method) {
+		return
+	}
+	requested := requestedHeaders(r)
+	if !p.anyHeader {
+		for _, header := range requested {
+			if !slices.Contains(p.headers, header) {
+				return
+			}
 		}
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	p.setOriginHeaders(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+	if len(requested) > 0 {
+		// echoing only what was asked for keeps the answer valid for "*" policies too
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if p.maxAge != "" {
+		w.Header().Set("Access-Control-Max-Age", p.maxAge)
+	}
+}
+
+func requestedHeaders(r *http.Request) []string {
+	var headers []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers = append(headers, http.CanonicalHeaderKey(header))
+			}
+		}
+	}
+	return headers
 }
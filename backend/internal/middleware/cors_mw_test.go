@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+)
+
+var testCORSConfig = config.CORSConfig{
+	AllowedOrigins:   []string{"https://codecart.app", "https://*.codecart.app"},
+	AllowedMethods:   []string{"GET", "POST", "PATCH"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization"},
+	ExposedHeaders:   []string{"X-Request-Id"},
+	MaxAge:           10 * time.Minute,
+	AllowCredentials: true,
+}
+
+func serveCORS(t *testing.T, cfg config.CORSConfig, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	t.Helper()
+	reached := false
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, reached
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/orders", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return req
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         *http.Request
+		wantAllowed bool
+	}{
+		{"exact origin", preflight("https://codecart.app", "POST", "content-type"), true},
+		{"pattern origin", preflight("https://admin.codecart.app", "PATCH", "Authorization, Content-Type"), true},
+		{"origin case is ignored", preflight("HTTPS://CodeCart.app", "GET", ""), true},
+		{"unknown origin", preflight("https://evil.example", "POST", ""), false},
+		{"lookalike origin", preflight("https://evilcodecart.app", "POST", ""), false},
+		{"bare pattern suffix", preflight("https://.codecart.app", "POST", ""), false},
+		{"method not allowed", preflight("https://codecart.app", "DELETE", ""), false},
+		{"header not allowed", preflight("https://codecart.app", "POST", "X-Custom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, reached := serveCORS(t, testCORSConfig, tt.req)
+			if reached {
+				t.Error("preflight must not reach the wrapped handler")
+			}
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("expected 204, got %d", rec.Code)
+			}
+
+			vary := rec.Header().Values("Vary")
+			for _, want := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+				if !slices.Contains(vary, want) {
+					t.Errorf("Vary %v is missing %s", vary, want)
+				}
+			}
+
+			allowOrigin := rec.Header().Get("Access-Control-Allow-Origin")
+			if !tt.wantAllowed {
+				if allowOrigin != "" {
+					t.Errorf("expected no CORS headers, got Access-Control-Allow-Origin %q", allowOrigin)
+				}
+				return
+			}
+			if allowOrigin != tt.req.Header.Get("Origin") {
+				t.Errorf("expected the origin to be echoed, got %q", allowOrigin)
+			}
+			if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("expected credentials to be allowed")
+			}
+			if rec.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("expected max age 600, got %q", rec.Header().Get("Access-Control-Max-Age"))
+			}
+			if rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST, PATCH" {
+				t.Errorf("unexpected allowed methods %q", rec.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func TestCORS_ActualRequests(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	req.Header.Set("Origin", "https://shop.codecart.app")
+	rec, reached := serveCORS(t, testCORSConfig, req)
+	if !reached || rec.Code != http.StatusOK {
+		t.Fatalf("expected the request to reach the handler, got %d", rec.Code)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://shop.codecart.app" {
+		t.Errorf("unexpected Access-Control-Allow-Origin %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Errorf("unexpected Access-Control-Expose-Headers %q", rec.Header().Get("Access-Control-Expose-Headers"))
+	}
+
+	// disallowed origins are still served; it is the browser that withholds the response from the page
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rec, reached = serveCORS(t, testCORSConfig, req)
+	if !reached || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers for a disallowed origin, got %v", rec.Header())
+	}
+	if rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected Vary: Origin even for disallowed origins, got %q", rec.Header().Get("Vary"))
+	}
+
+	// a plain OPTIONS request without Access-Control-Request-Method is not a preflight
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/orders", nil)
+	if _, reached = serveCORS(t, testCORSConfig, req); !reached {
+		t.Error("expected a non-preflight OPTIONS request to reach the handler")
+	}
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	cfg := config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowedHeaders: []string{"*"}}
+
+	rec, _ := serveCORS(t, cfg, preflight("https://anywhere.example", "GET", "X-Anything"))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("expected a wildcard origin, got %q", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Access-Control-Allow-Headers") != "X-Anything" {
+		t.Errorf("expected requested headers to be echoed, got %q", rec.Header().Get("Access-Control-Allow-Headers"))
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials must not be allowed unless configured")
+	}
+}
@@ -1,12 +1,11 @@
 package middleware
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"net/http"
 	"time"
 
 	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -30,12 +29,18 @@ func (sr *statusRecorder) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, which streamed responses need to flush and to lift
+// the server's write timeout
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
 func RequestLogger(base *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			reqId := r.Header.Get("X-Request-Id")
+			reqId := utils.RequestIdFromContext(r.Context())
 			if reqId == "" {
-				reqId = newRequestId()
+				reqId = utils.NewRequestId()
 			}
 
 			l := base.With(
@@ -43,6 +48,13 @@ func RequestLogger(base *zap.Logger) func(http.Handler) http.Handler {
 				zap.String("httpMethod", r.Method),
 				zap.String("httpPath", r.URL.Path),
 			)
+			// stitches every log line of the request to its trace when the Tracing middleware runs further out
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				l = l.With(
+					zap.String("traceId", sc.TraceID().String()),
+					zap.String("spanId", sc.SpanID().String()),
+				)
+			}
 
 			ctx := utils.WithLogger(r.Context(), l)
 			r = r.WithContext(ctx)
@@ -62,9 +74,3 @@ func RequestLogger(base *zap.Logger) func(http.Handler) http.Handler {
 		})
 	}
 }
-
-func newRequestId() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	return hex.EncodeToString(b)
-}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+)
+
+// RequestMetrics records the count and latency of every request under its route pattern. It has to wrap the mux
+// directly: the mux stores the matched pattern on the *http.Request it is handed, and any middleware in between that
+// calls r.WithContext would hide it behind a copy
+func RequestMetrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			start := time.Now()
+
+			// recorded in a defer so requests that panic still count, as the 500 the recoverer will turn them into
+			defer func() {
+				status := rec.status
+				if p := recover(); p != nil {
+					m.ObserveHTTPRequest(r.Method, r.Pattern, http.StatusInternalServerError, time.Since(start))
+					panic(p)
+				}
+				if status == 0 {
+					status = http.StatusOK
+				}
+				m.ObserveHTTPRequest(r.Method, r.Pattern, status, time.Since(start))
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
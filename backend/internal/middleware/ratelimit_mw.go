@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/ratelimit"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+const ERR_RATE_LIMITED = "Too many requests"
+
+// RateLimit enforces the limiter's per-route limits before the request reaches its handler. The route is looked up on
+// mux ahead of dispatch and stored in r.Pattern, the same way the mux itself does, so rejected requests are still
+// labelled with their route by the metrics and tracing middleware. A failing store lets requests through: losing rate
+// limiting for a moment is better than losing the API
+func RateLimit(limiter *ratelimit.Limiter, mux *http.ServeMux, base *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, r.Pattern = mux.Handler(r)
+
+			decision, limit, err := limiter.Allow(r, r.Pattern)
+			if err != nil {
+				utils.FromContext(r.Context(), base).Warn("rate limit store failed, allowing request", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if limit.IsUnlimited() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, limit, decision)
+			if !decision.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+				utils.FromContext(r.Context(), base).Warn("rate limit exceeded",
+					zap.String("route", r.Pattern),
+					zap.Duration("retryAfter", decision.RetryAfter),
+				)
+				utils.HttpError(w, r, ERR_RATE_LIMITED, http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders follows the IETF RateLimit header fields draft: the bucket size, the tokens left, the seconds
+// until it is full again, and the policy as requests per window in seconds
+func setRateLimitHeaders(w http.ResponseWriter, limit ratelimit.Limit, decision ratelimit.Decision) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, ceilSeconds(limit.Period), limit.Burst))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
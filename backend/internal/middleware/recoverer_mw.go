@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"runtime/debug"
 
+	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
@@ -13,10 +14,13 @@ func Recoverer(base *zap.Logger) func(http.Handler) http.Handler {
 			defer func() {
 				if rec := recover(); rec != nil {
 					base.Error("panic recovered",
+						zap.String("requestId", utils.RequestIdFromContext(r.Context())),
+						zap.String("httpMethod", r.Method),
+						zap.String("httpPath", r.URL.Path),
 						zap.Any("panic", rec),
 						zap.ByteString("stack", debug.Stack()),
 					)
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					utils.HttpError(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				}
 			}()
 			next.ServeHTTP(w, r)
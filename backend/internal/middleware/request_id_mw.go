@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jshelley8117/CodeCart/internal/utils"
+)
+
+// RequestId adopts the caller's X-Request-Id, or mints one, stores it in the request context and echoes it on the
+// response. It runs outermost so everything further in, the recoverer included, can see the id
+func RequestId() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(utils.REQUEST_ID_HEADER)
+			if !utils.ValidRequestId(id) {
+				id = utils.NewRequestId()
+			}
+
+			// set before the handler runs, since headers cannot change once the status line is written
+			w.Header().Set(utils.REQUEST_ID_HEADER, id)
+			next.ServeHTTP(w, r.WithContext(utils.WithRequestId(r.Context(), id)))
+		})
+	}
+}
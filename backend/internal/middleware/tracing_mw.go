@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the caller's trace when a traceparent header is present.
+// The span starts out named after the method alone; TraceRoute renames it once the mux has matched a pattern
+func Tracing() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracing.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.UserAgentOriginal(r.UserAgent()),
+					semconv.ClientAddress(r.RemoteAddr),
+				),
+			)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				if p := recover(); p != nil {
+					span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+					span.SetStatus(codes.Error, "panic")
+					panic(p)
+				}
+				status := rec.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+				// 4xx is the client's problem, not a failure of this server
+				if status >= http.StatusInternalServerError {
+					span.SetStatus(codes.Error, http.StatusText(status))
+				}
+			}()
+
+			next.ServeHTTP(rec, r.WithContext(ctx))
+		})
+	}
+}
+
+// TraceRoute names the request's server span after the matched route pattern. Like RequestMetrics it must wrap the mux
+// directly to see the pattern
+func TraceRoute() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			if r.Pattern == "" {
+				return
+			}
+			// patterns may lead with the method, e.g. "GET /api/v1/orders/{id}", while http.route is only the path part
+			route := r.Pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		})
+	}
+}
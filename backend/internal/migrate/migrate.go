@@ -0,0 +1,168 @@
+// Package migrate applies the versioned SQL files under migrations/<dialect>/ to a database. The files are embedded
+// into the binary, named NNNN_description.sql, and applied in version order. Every dialect keeps its own copy of each
+// migration under the same version number. Applied versions are recorded in the schema_migrations table so every
+// migration runs exactly once per database (or schema).
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Load returns every embedded migration for the dialect ordered by version
+func Load(d dialect.Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(d))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded %s migrations: %w", d, err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		fileName := entry.Name()
+		versionPart, name, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", fileName)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", fileName, err)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(contents)})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestVersion is the version the schema will be at once every embedded migration has been applied
+func LatestVersion(d dialect.Dialect) (int, error) {
+	migrations, err := Load(d)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// CurrentVersion returns the highest applied migration version, or 0 for a database that has never been migrated
+func CurrentVersion(ctx context.Context, db *sql.DB, d dialect.Dialect) (int, error) {
+	if err := ensureVersionTable(ctx, db, d); err != nil {
+		return 0, err
+	}
+	return AppliedVersion(ctx, db)
+}
+
+// AppliedVersion is CurrentVersion without creating schema_migrations first, for callers such as health checks that
+// must not write. It fails on a database that has never been migrated
+func AppliedVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Apply runs every migration newer than the current version. Each migration runs in its own transaction together with
+// the insert into schema_migrations, so a failed migration leaves no partial schema behind. Returns the versions that
+// were applied
+func Apply(ctx context.Context, db *sql.DB, d dialect.Dialect) ([]int, error) {
+	migrations, err := Load(d)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := CurrentVersion(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []int{}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyOne(ctx, db, d, m); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m.Version)
+	}
+	return applied, nil
+}
+
+func applyOne(ctx context.Context, db *sql.DB, d dialect.Dialect, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+	insert := d.Rebind(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`)
+	if _, err := tx.ExecContext(ctx, insert, m.Version, m.Name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+	}
+	return nil
+}
+
+func ensureVersionTable(ctx context.Context, db *sql.DB, d dialect.Dialect) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`
+	if d == dialect.SQLite {
+		query = `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version    INTEGER PRIMARY KEY,
+				name       TEXT NOT NULL,
+				applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)
+		`
+	}
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/resource"
+)
+
+func TestApply_AdoptsOnlyTablesOfTheBaselineShape(t *testing.T) {
+	ctx := context.Background()
+	open := func(t *testing.T, existing string) error {
+		t.Helper()
+		db, err := resource.NewSQLiteDb(filepath.Join(t.TempDir(), "codecart.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.ExecContext(ctx, existing); err != nil {
+			t.Fatal(err)
+		}
+		_, err = Apply(ctx, db, dialect.SQLite)
+		if err != nil {
+			if version, _ := CurrentVersion(ctx, db, dialect.SQLite); version != 0 {
+				t.Errorf("expected no version recorded after a failed adoption, got %d", version)
+			}
+		}
+		return err
+	}
+
+	t.Run("baseline shape", func(t *testing.T) {
+		err := open(t, `CREATE TABLE customers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, first_name TEXT NOT NULL, last_name TEXT NOT NULL,
+			phone_number TEXT NOT NULL DEFAULT '', email TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+		if err != nil {
+			t.Errorf("expected a table of the baseline shape to be adopted, got %v", err)
+		}
+	})
+
+	t.Run("missing column", func(t *testing.T) {
+		err := open(t, `CREATE TABLE orders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, customer_id INTEGER NOT NULL, status TEXT NOT NULL,
+			total_price REAL NOT NULL, delivery_address TEXT, address_id INTEGER NOT NULL DEFAULT -1,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+		if err == nil || !strings.Contains(err.Error(), "order_type") {
+			t.Errorf("expected the adoption to fail on the missing order_type column, got %v", err)
+		}
+	})
+}
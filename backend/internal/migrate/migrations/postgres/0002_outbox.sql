@@ -0,0 +1,18 @@
+-- domain events written in the same transaction as the change they describe, see persistence.OutboxPersistence
+CREATE TABLE outbox (
+    id             BIGSERIAL PRIMARY KEY,
+    aggregate_type TEXT        NOT NULL,
+    aggregate_id   TEXT        NOT NULL,
+    event_type     TEXT        NOT NULL,
+    payload        JSONB       NOT NULL,
+    occurred_at    TIMESTAMPTZ NOT NULL,
+    available_at   TIMESTAMPTZ NOT NULL,
+    attempts       INTEGER     NOT NULL DEFAULT 0,
+    last_error     TEXT,
+    published_at   TIMESTAMPTZ
+);
+
+-- the relay only ever looks at unpublished events, in id order overall and per aggregate
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+CREATE INDEX outbox_pending_aggregate_idx ON outbox (aggregate_type, aggregate_id, id) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,38 @@
+-- partner webhook endpoints and the deliveries fanned out to them, see persistence.WebhookPersistence
+CREATE TABLE webhook_subscriptions (
+    id          SERIAL PRIMARY KEY,
+    url         TEXT        NOT NULL,
+    event_types JSONB       NOT NULL,
+    description TEXT        NOT NULL DEFAULT '',
+    active      BOOLEAN     NOT NULL DEFAULT TRUE,
+    secret      TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- event_id points into the outbox but is not a foreign key: published events are purged long before the delivery log
+CREATE TABLE webhook_deliveries (
+    id                  BIGSERIAL PRIMARY KEY,
+    subscription_id     INTEGER     NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id            BIGINT      NOT NULL,
+    event_type          TEXT        NOT NULL,
+    payload             JSONB       NOT NULL,
+    status              TEXT        NOT NULL,
+    -- attempts is the budget of the current round and starts over on every redelivery; total_attempts and
+    -- redeliveries keep the full history of a delivery
+    attempts            INTEGER     NOT NULL DEFAULT 0,
+    total_attempts      INTEGER     NOT NULL DEFAULT 0,
+    redeliveries        INTEGER     NOT NULL DEFAULT 0,
+    last_redelivered_at TIMESTAMPTZ,
+    next_attempt_at     TIMESTAMPTZ NOT NULL,
+    last_attempt_at     TIMESTAMPTZ,
+    last_status_code    INTEGER,
+    last_error          TEXT,
+    delivered_at        TIMESTAMPTZ,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- the relay publishes at least once, so the same event may be fanned out twice
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
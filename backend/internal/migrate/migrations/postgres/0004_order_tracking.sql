@@ -0,0 +1,7 @@
+-- who is picking and delivering an order, and when it is expected to be ready. Empty strings mean unassigned
+ALTER TABLE orders ADD COLUMN picker TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN driver TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN estimated_ready_at TIMESTAMPTZ;
+
+-- order event streams replay an aggregate's history, published or not, see persistence.OutboxPersistence
+CREATE INDEX outbox_aggregate_idx ON outbox (aggregate_type, aggregate_id, id);
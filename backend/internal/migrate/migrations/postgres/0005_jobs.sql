@@ -0,0 +1,21 @@
+-- background jobs, claimed by workers with FOR UPDATE SKIP LOCKED, see persistence.JobPersistence
+CREATE TABLE jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    type         TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    status       TEXT        NOT NULL,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    max_attempts INTEGER     NOT NULL DEFAULT 0,
+    run_at       TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    last_error   TEXT,
+    -- NULLs never conflict, so only jobs that ask for it are deduplicated, e.g. one per schedule tick
+    unique_key   TEXT UNIQUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX jobs_due_idx ON jobs (run_at, id) WHERE status = 'PENDING';
+CREATE INDEX jobs_lease_idx ON jobs (locked_until) WHERE status = 'RUNNING';
+CREATE INDEX jobs_status_idx ON jobs (status, id);
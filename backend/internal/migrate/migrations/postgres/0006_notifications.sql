@@ -0,0 +1,3 @@
+-- the language a customer's emails are written in, empty for the store default, and whether they opted out of them
+ALTER TABLE customers ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN email_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,29 @@
+-- customers are only texted once they opted in, and a STOP reply from their phone opts them out again
+ALTER TABLE customers ADD COLUMN sms_opt_in BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX customers_phone_number_idx ON customers (phone_number);
+
+-- every text message sent to a customer with its delivery status, see persistence.SMSPersistence
+CREATE TABLE sms_messages (
+    id                  BIGSERIAL PRIMARY KEY,
+    -- one message per order event and template, however often its job runs
+    dedupe_key          TEXT        NOT NULL UNIQUE,
+    customer_id         INTEGER     NOT NULL,
+    order_id            INTEGER     NOT NULL,
+    template            TEXT        NOT NULL,
+    to_number           TEXT        NOT NULL,
+    body                TEXT        NOT NULL,
+    encoding            TEXT        NOT NULL,
+    segments            INTEGER     NOT NULL,
+    status              TEXT        NOT NULL,
+    provider            TEXT        NOT NULL,
+    provider_message_id TEXT,
+    error               TEXT,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at             TIMESTAMPTZ,
+    delivered_at        TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX sms_messages_provider_idx ON sms_messages (provider, provider_message_id);
+CREATE INDEX sms_messages_status_idx ON sms_messages (status, id);
+CREATE INDEX sms_messages_customer_idx ON sms_messages (customer_id, id);
@@ -0,0 +1,55 @@
+-- mirrors postgres/0001_initial_schema.sql. Timestamps are declared as TIMESTAMP so the driver parses them back into
+-- time.Time, and delivery_address is stored as JSON text
+CREATE TABLE IF NOT EXISTS customers (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name   TEXT      NOT NULL,
+    last_name    TEXT      NOT NULL,
+    phone_number TEXT      NOT NULL DEFAULT '',
+    email        TEXT      NOT NULL UNIQUE,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    email       TEXT      NOT NULL UNIQUE,
+    is_active   BOOLEAN   NOT NULL DEFAULT TRUE,
+    customer_id INTEGER   NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    gc_auth_id  TEXT      NOT NULL UNIQUE,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS addresses (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id        INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    street_address TEXT      NOT NULL,
+    city           TEXT      NOT NULL,
+    state          TEXT      NOT NULL,
+    zip_code       TEXT      NOT NULL,
+    country        TEXT      NOT NULL,
+    is_default     BOOLEAN   NOT NULL DEFAULT FALSE,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id      INTEGER   NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    status           TEXT      NOT NULL,
+    total_price      REAL      NOT NULL,
+    delivery_address TEXT CHECK (delivery_address IS NULL OR json_valid(delivery_address)),
+    address_id       INTEGER   NOT NULL DEFAULT -1,
+    order_type       TEXT      NOT NULL,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
+
+-- an adopted table must have every column the code uses. Selecting them fails this migration, so version 1 is not
+-- recorded, when a table has a different shape, e.g. orders without order_type; bring it in line by hand and rerun
+SELECT id, first_name, last_name, phone_number, email, created_at, updated_at FROM customers WHERE 1 = 0;
+SELECT id, email, is_active, customer_id, gc_auth_id, created_at, updated_at FROM users WHERE 1 = 0;
+SELECT id, user_id, street_address, city, state, zip_code, country, is_default, created_at, updated_at FROM addresses WHERE 1 = 0;
+SELECT id, customer_id, status, total_price, delivery_address, address_id, order_type, created_at, updated_at FROM orders WHERE 1 = 0;
@@ -0,0 +1,17 @@
+-- mirrors postgres/0002_outbox.sql
+CREATE TABLE outbox (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_type TEXT      NOT NULL,
+    aggregate_id   TEXT      NOT NULL,
+    event_type     TEXT      NOT NULL,
+    payload        TEXT      NOT NULL CHECK (json_valid(payload)),
+    occurred_at    TIMESTAMP NOT NULL,
+    available_at   TIMESTAMP NOT NULL,
+    attempts       INTEGER   NOT NULL DEFAULT 0,
+    last_error     TEXT,
+    published_at   TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+CREATE INDEX outbox_pending_aggregate_idx ON outbox (aggregate_type, aggregate_id, id) WHERE published_at IS NULL;
+CREATE INDEX outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
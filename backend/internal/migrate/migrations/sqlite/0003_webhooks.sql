@@ -0,0 +1,34 @@
+-- mirrors postgres/0003_webhooks.sql
+CREATE TABLE webhook_subscriptions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    url         TEXT      NOT NULL,
+    event_types TEXT      NOT NULL CHECK (json_valid(event_types)),
+    description TEXT      NOT NULL DEFAULT '',
+    active      BOOLEAN   NOT NULL DEFAULT TRUE,
+    secret      TEXT      NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id     INTEGER   NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id            INTEGER   NOT NULL,
+    event_type          TEXT      NOT NULL,
+    payload             TEXT      NOT NULL CHECK (json_valid(payload)),
+    status              TEXT      NOT NULL,
+    attempts            INTEGER   NOT NULL DEFAULT 0,
+    total_attempts      INTEGER   NOT NULL DEFAULT 0,
+    redeliveries        INTEGER   NOT NULL DEFAULT 0,
+    last_redelivered_at TIMESTAMP,
+    next_attempt_at     TIMESTAMP NOT NULL,
+    last_attempt_at     TIMESTAMP,
+    last_status_code    INTEGER,
+    last_error          TEXT,
+    delivered_at        TIMESTAMP,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
@@ -0,0 +1,6 @@
+-- mirrors postgres/0004_order_tracking.sql
+ALTER TABLE orders ADD COLUMN picker TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN driver TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN estimated_ready_at TIMESTAMP;
+
+CREATE INDEX outbox_aggregate_idx ON outbox (aggregate_type, aggregate_id, id);
@@ -0,0 +1,20 @@
+-- mirrors postgres/0005_jobs.sql
+CREATE TABLE jobs (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    type         TEXT      NOT NULL,
+    payload      TEXT      NOT NULL CHECK (json_valid(payload)),
+    status       TEXT      NOT NULL,
+    attempts     INTEGER   NOT NULL DEFAULT 0,
+    max_attempts INTEGER   NOT NULL DEFAULT 0,
+    run_at       TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    last_error   TEXT,
+    unique_key   TEXT UNIQUE,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX jobs_due_idx ON jobs (run_at, id) WHERE status = 'PENDING';
+CREATE INDEX jobs_lease_idx ON jobs (locked_until) WHERE status = 'RUNNING';
+CREATE INDEX jobs_status_idx ON jobs (status, id);
@@ -0,0 +1,3 @@
+-- mirrors postgres/0006_notifications.sql
+ALTER TABLE customers ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN email_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
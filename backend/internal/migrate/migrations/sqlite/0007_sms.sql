@@ -0,0 +1,27 @@
+-- mirrors postgres/0007_sms.sql
+ALTER TABLE customers ADD COLUMN sms_opt_in BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX customers_phone_number_idx ON customers (phone_number);
+
+CREATE TABLE sms_messages (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    dedupe_key          TEXT      NOT NULL UNIQUE,
+    customer_id         INTEGER   NOT NULL,
+    order_id            INTEGER   NOT NULL,
+    template            TEXT      NOT NULL,
+    to_number           TEXT      NOT NULL,
+    body                TEXT      NOT NULL,
+    encoding            TEXT      NOT NULL,
+    segments            INTEGER   NOT NULL,
+    status              TEXT      NOT NULL,
+    provider            TEXT      NOT NULL,
+    provider_message_id TEXT,
+    error               TEXT,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at             TIMESTAMP,
+    delivered_at        TIMESTAMP
+);
+
+CREATE UNIQUE INDEX sms_messages_provider_idx ON sms_messages (provider, provider_message_id);
+CREATE INDEX sms_messages_status_idx ON sms_messages (status, id);
+CREATE INDEX sms_messages_customer_idx ON sms_messages (customer_id, id);
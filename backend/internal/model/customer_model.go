@@ -3,13 +3,18 @@ package model
 import "time"
 
 type Customer struct {
-	Id          int       `json:"id"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	PhoneNumber string    `json:"phone_number"`
-	Email       string    `json:"email"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	Id          int    `json:"id"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	PhoneNumber string `json:"phone_number"`
+	Email       string `json:"email"`
+	// Locale picks the language of the customer's emails and texts, empty for the store default
+	Locale      string `json:"locale"`
+	EmailOptOut bool   `json:"email_opt_out"`
+	// SMSOptIn is false until the customer agrees to be texted, and again after they reply STOP
+	SMSOptIn  bool      `json:"sms_opt_in"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type CreateCustomerRequest struct {
@@ -17,6 +22,9 @@ type CreateCustomerRequest struct {
 	LastName    string `json:"last_name" validate:"required"`
 	PhoneNumber string `json:"phone_number" validate:"e164"`
 	Email       string `json:"email" validate:"required,email"`
+	Locale      string `json:"locale" validate:"omitempty,oneof=en es"`
+	EmailOptOut bool   `json:"email_opt_out"`
+	SMSOptIn    bool   `json:"sms_opt_in"`
 }
 
 // pointers are used in some fields here because the zero value for strings is "", meaning that after unmarshaling, the empty/omitted fields will have
@@ -26,4 +34,8 @@ type UpdateCustomerRequest struct {
 	LastName    string  `json:"last_name,omitempty"`
 	PhoneNumber *string `json:"phone_number,omitempty" validate:"omitempty,e164"`
 	Email       *string `json:"email,omitempty" validate:"omitempty,email"`
+	// "" puts the customer back on the default locale
+	Locale      *string `json:"locale,omitempty" validate:"omitnil,oneof='' en es"`
+	EmailOptOut *bool   `json:"email_opt_out,omitempty"`
+	SMSOptIn    *bool   `json:"sms_opt_in,omitempty"`
 }
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// event types recorded in the outbox
+const (
+	EventOrderCreated           = "OrderCreated"
+	EventOrderStatusChanged     = "OrderStatusChanged"
+	EventOrderAssignmentChanged = "OrderAssignmentChanged"
+	EventOrderEtaChanged        = "OrderEtaChanged"
+	EventCustomerCreated        = "CustomerCreated"
+	EventUserCreated            = "UserCreated"
+)
+
+// aggregate types, i.e. the entity an event is about. Events are delivered in order per aggregate
+const (
+	AggregateOrder    = "order"
+	AggregateCustomer = "customer"
+	AggregateUser     = "user"
+)
+
+// OutboxEvent is a domain event written to the outbox table in the same transaction as the change it describes. The
+// relay publishes it afterwards, so consumers see it at least once and must be ready to drop duplicates by Id
+type OutboxEvent struct {
+	Id            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateId   string          `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+
+	// delivery bookkeeping, only meaningful to the relay
+	Attempts    int        `json:"-"`
+	AvailableAt time.Time  `json:"-"`
+	LastError   string     `json:"-"`
+	PublishedAt *time.Time `json:"-"`
+}
+
+// NewOutboxEvent builds an event about aggregate id of the given type with payload marshalled as its JSON body
+func NewOutboxEvent(aggregateType string, aggregateId int, eventType string, payload any) (OutboxEvent, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("failed to marshal %s payload: %w", eventType, err)
+	}
+	now := time.Now().UTC()
+	return OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateId:   strconv.Itoa(aggregateId),
+		Type:          eventType,
+		Payload:       body,
+		OccurredAt:    now,
+		AvailableAt:   now,
+	}, nil
+}
+
+// OrderingKey identifies the aggregate; events sharing a key are published in the order they were recorded
+func (e OutboxEvent) OrderingKey() string {
+	return e.AggregateType + ":" + e.AggregateId
+}
+
+// OrderStatusChangedPayload is the body of an OrderStatusChanged event
+type OrderStatusChangedPayload struct {
+	OrderId int         `json:"order_id"`
+	From    OrderStatus `json:"from"`
+	To      OrderStatus `json:"to"`
+}
+
+// OrderAssignmentChangedPayload is the body of an OrderAssignmentChanged event. It carries the whole assignment after
+// the change, so either name may be the one that changed
+type OrderAssignmentChangedPayload struct {
+	OrderId int    `json:"order_id"`
+	Picker  string `json:"picker"`
+	Driver  string `json:"driver"`
+}
+
+// OrderEtaChangedPayload is the body of an OrderEtaChanged event. From is null when the order had no estimate yet
+type OrderEtaChangedPayload struct {
+	OrderId int        `json:"order_id"`
+	From    *time.Time `json:"from"`
+	To      time.Time  `json:"to"`
+}
+
+// UserCreatedPayload is the body of a UserCreated event. It leaves out the user's identity provider subject, which
+// identifies callers and must not reach Pub/Sub or webhook subscribers
+type UserCreatedPayload struct {
+	Id         int       `json:"id"`
+	Email      string    `json:"email"`
+	CustomerId int       `json:"customer_id"`
+	IsActive   bool      `json:"is_active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type JobStatus string
+
+// a job is PENDING until a worker claims it, RUNNING while a worker holds its lease, and ends up SUCCEEDED or, once
+// its attempts are used up or it failed permanently, DEAD until retried by hand
+const (
+	JobPending   JobStatus = "PENDING"
+	JobRunning   JobStatus = "RUNNING"
+	JobSucceeded JobStatus = "SUCCEEDED"
+	JobDead      JobStatus = "DEAD"
+)
+
+// Job is one unit of background work. Type picks the handler and Payload is its JSON input. MaxAttempts of 0 leaves
+// the limit to the worker. Jobs sharing a UniqueKey are only ever enqueued once
+type Job struct {
+	Id          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+}
+
+// NewJob builds a pending job of the given type that is due now, with payload marshalled as its JSON body
+func NewJob(jobType string, payload any) (Job, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to marshal %s payload: %w", jobType, err)
+	}
+	now := time.Now().UTC()
+	return Job{
+		Type:      jobType,
+		Payload:   body,
+		Status:    JobPending,
+		RunAt:     now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
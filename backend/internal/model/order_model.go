@@ -7,12 +7,22 @@ import (
 
 type OrderStatus string
 
+// an order is PENDING when placed. A pickup order becomes READY_FOR_PICKUP and a delivery order OUT_FOR_DELIVERY, then
+// DELIVERED. It may be CANCELLED along the way and REFUNDED afterwards
 const (
-	OrderStatusConfirmed OrderStatus = "CONFIRMED"
-	OrderStatusPending   OrderStatus = "PENDING"
-	OrderStatusCanceled  OrderStatus = "CANCELED"
+	OrderStatusConfirmed      OrderStatus = "CONFIRMED"
+	OrderStatusPending        OrderStatus = "PENDING"
+	OrderStatusReadyForPickup OrderStatus = "READY_FOR_PICKUP"
+	OrderStatusOutForDelivery OrderStatus = "OUT_FOR_DELIVERY"
+	OrderStatusDelivered      OrderStatus = "DELIVERED"
+	OrderStatusCancelled      OrderStatus = "CANCELLED"
+	OrderStatusRefunded       OrderStatus = "REFUNDED"
 )
 
+// FinalOrderStatuses are the statuses an order's life ends in; nothing is expected to happen to it after them but a
+// late refund
+var FinalOrderStatuses = []OrderStatus{OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded}
+
 type OrderType string
 
 const (
@@ -30,13 +40,17 @@ type Order struct {
 	UpdatedAt       time.Time       `json:"updated_at"`
 	AddressId       int             `json:"address_id"`
 	OrderType       OrderType       `json:"order_type"`
+	// Picker and Driver name the staff assigned to the order, empty while unassigned
+	Picker           string     `json:"picker"`
+	Driver           string     `json:"driver"`
+	EstimatedReadyAt *time.Time `json:"estimated_ready_at"`
 }
 
 type CreateOrderRequest struct {
 	CustomerId      int             `json:"customer_id" validate:"required"`
 	TotalPrice      float64         `json:"total_price" validate:"required"`
 	DeliveryAddress json.RawMessage `json:"delivery_address"`
-	OrderType       OrderType       `json:"order_type" validate:"required"`
+	OrderType       OrderType       `json:"order_type" validate:"required,oneof=PICKUP DELIVERY"`
 	AddressId       int             `json:"address_id"`
 }
 
@@ -46,4 +60,8 @@ type UpdateOrderRequest struct {
 	DeliveryAddress json.RawMessage `json:"delivery_address"`
 	AddressId       int             `json:"address_id"`
 	OrderType       OrderType       `json:"order_type"`
+	// pointers so an assignment can be cleared with "" while omitted fields stay untouched
+	Picker           *string    `json:"picker,omitempty" validate:"omitempty,max=100"`
+	Driver           *string    `json:"driver,omitempty" validate:"omitempty,max=100"`
+	EstimatedReadyAt *time.Time `json:"estimated_ready_at,omitempty"`
 }
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+type SMSStatus string
+
+// a text is PENDING until the provider accepts it, SENT once it has, and DELIVERED or FAILED as the provider reports
+// back. One the provider would not take at all is FAILED straight away
+const (
+	SMSPending   SMSStatus = "PENDING"
+	SMSSent      SMSStatus = "SENT"
+	SMSDelivered SMSStatus = "DELIVERED"
+	SMSFailed    SMSStatus = "FAILED"
+)
+
+// SMSMessage is a text sent to a customer about an order, kept for its delivery status. Encoding is GSM-7 or UCS-2,
+// which decides how many characters fit in each of its Segments, the unit providers bill by
+type SMSMessage struct {
+	Id                int64      `json:"id"`
+	DedupeKey         string     `json:"-"`
+	CustomerId        int        `json:"customer_id"`
+	OrderId           int        `json:"order_id"`
+	Template          string     `json:"template"`
+	To                string     `json:"to"`
+	Body              string     `json:"body"`
+	Encoding          string     `json:"encoding"`
+	Segments          int        `json:"segments"`
+	Status            SMSStatus  `json:"status"`
+	Provider          string     `json:"provider"`
+	ProviderMessageId string     `json:"provider_message_id,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+}
+
+// SMSStatusCallback is what the provider posts when a text it accepted is delivered or fails
+type SMSStatusCallback struct {
+	MessageId string    `json:"message_id" validate:"required"`
+	Status    SMSStatus `json:"status" validate:"required,oneof=SENT DELIVERED FAILED"`
+	Error     string    `json:"error"`
+}
+
+// SMSInbound is a text a customer sent to the store's number, as the provider posts it
+type SMSInbound struct {
+	From string `json:"from" validate:"required,e164"`
+	Body string `json:"body"`
+}
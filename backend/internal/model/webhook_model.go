@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// WebhookEventTypes are the event types partners can subscribe to
+var WebhookEventTypes = []string{
+	EventOrderCreated,
+	EventOrderStatusChanged,
+	EventOrderAssignmentChanged,
+	EventOrderEtaChanged,
+	EventCustomerCreated,
+	EventUserCreated,
+}
+
+// WebhookSubscription is a partner endpoint that receives the listed event types. Secret signs every delivery and is
+// only shown to the admin once, when the subscription is created
+type WebhookSubscription struct {
+	Id          int       `json:"id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	Secret      string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Wants reports whether the subscription is active and subscribed to eventType
+func (ws WebhookSubscription) Wants(eventType string) bool {
+	return ws.Active && slices.Contains(ws.EventTypes, eventType)
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	URL         string   `json:"url" validate:"required,http_url"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,dive,oneof=OrderCreated OrderStatusChanged OrderAssignmentChanged OrderEtaChanged CustomerCreated UserCreated"`
+	Description string   `json:"description" validate:"max=200"`
+}
+
+// CreateWebhookSubscriptionResponse is the only response that carries the signing secret
+type CreateWebhookSubscriptionResponse struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+type UpdateWebhookSubscriptionRequest struct {
+	URL         *string  `json:"url,omitempty" validate:"omitempty,http_url"`
+	EventTypes  []string `json:"event_types,omitempty" validate:"omitempty,min=1,dive,oneof=OrderCreated OrderStatusChanged OrderAssignmentChanged OrderEtaChanged CustomerCreated UserCreated"`
+	Description *string  `json:"description,omitempty" validate:"omitempty,max=200"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending deliveries are waiting for their next attempt
+	WebhookDeliveryPending WebhookDeliveryStatus = "PENDING"
+	// WebhookDeliveryDelivered deliveries were answered with a 2xx
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "DELIVERED"
+	// WebhookDeliveryDead deliveries failed too often and are only retried when redelivered by hand
+	WebhookDeliveryDead WebhookDeliveryStatus = "DEAD"
+)
+
+// WebhookDelivery is one event on its way to one subscription, together with the outcome of its latest attempt.
+// Payload is the event's JSON, sent as the request body
+type WebhookDelivery struct {
+	Id             int64                 `json:"id"`
+	SubscriptionId int                   `json:"subscription_id"`
+	EventId        int64                 `json:"event_id"`
+	EventType      string                `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	// Attempts counts the current round against the retry budget and starts over when the delivery is redelivered;
+	// TotalAttempts and Redeliveries never do
+	Attempts          int        `json:"attempts"`
+	TotalAttempts     int        `json:"total_attempts"`
+	Redeliveries      int        `json:"redeliveries"`
+	LastRedeliveredAt *time.Time `json:"last_redelivered_at"`
+	NextAttemptAt     time.Time  `json:"next_attempt_at"`
+	LastAttemptAt     *time.Time `json:"last_attempt_at"`
+	LastStatusCode    int        `json:"last_status_code,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// WebhookDeliveryResult is the outcome of one attempt. StatusCode is 0 when no response came back
+type WebhookDeliveryResult struct {
+	StatusCode    int
+	Error         string
+	AttemptedAt   time.Time
+	Status        WebhookDeliveryStatus
+	NextAttemptAt time.Time
+}
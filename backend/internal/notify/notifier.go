@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Notifier runs EMAIL_JOB_TYPE jobs. The opt-out is checked when the job runs, so it also holds back emails queued
+// before the customer opted out
+type Notifier struct {
+	Orders    persistence.OrderRepository
+	Customers persistence.CustomerRepository
+	Templates *Templates
+	Sender    Sender
+	Store     config.StoreConfig
+	Metrics   *metrics.Metrics
+	Logger    *zap.Logger
+}
+
+func NewNotifier(
+	orders persistence.OrderRepository,
+	customers persistence.CustomerRepository,
+	templates *Templates,
+	sender Sender,
+	store config.StoreConfig,
+	metrics *metrics.Metrics,
+	logger *zap.Logger,
+) Notifier {
+	return Notifier{
+		Orders:    orders,
+		Customers: customers,
+		Templates: templates,
+		Sender:    sender,
+		Store:     store,
+		Metrics:   metrics,
+		Logger:    logger.Named("email_notifier"),
+	}
+}
+
+// HandleJob is the jobs.Handler of EMAIL_JOB_TYPE
+func (n Notifier) HandleJob(ctx context.Context, job model.Job) error {
+	var payload NotificationJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to decode the email job: %w", err))
+	}
+	zLog := utils.FromContext(ctx, n.Logger).With(
+		zap.Int64("job_id", job.Id),
+		zap.Int("order_id", payload.OrderId),
+		zap.String("template", payload.Template))
+
+	order, err := n.Orders.FetchOrderById(ctx, payload.OrderId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("order no longer exists, not emailing about it")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load order %d: %w", payload.OrderId, err)
+	}
+	customer, err := n.Customers.FetchCustomerById(ctx, order.CustomerId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("customer no longer exists, not emailing them", zap.Int("customer_id", order.CustomerId))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load customer %d: %w", order.CustomerId, err)
+	}
+
+	if customer.EmailOptOut || customer.Email == "" {
+		zLog.Info("customer does not get emails, skipping", zap.Int("customer_id", customer.Id), zap.Bool("opted_out", customer.EmailOptOut))
+		n.Metrics.EmailHandled(payload.Template, "skipped")
+		return nil
+	}
+
+	msg, err := n.Templates.Render(payload.Template, OrderMessage{Store: n.Store, Customer: customer, Order: order})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	msg.To = customer.Email
+
+	if err := n.Sender.Send(ctx, msg); err != nil {
+		n.Metrics.EmailHandled(payload.Template, "failed")
+		return err
+	}
+	n.Metrics.EmailHandled(payload.Template, "sent")
+	zLog.Info("emailed customer", zap.Int("customer_id", customer.Id), zap.String("locale", msg.Locale))
+	return nil
+}
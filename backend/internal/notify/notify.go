@@ -0,0 +1,75 @@
+// Package notify emails and texts customers about their orders. The Trigger turns order events relayed from the outbox
+// into email and SMS jobs. The Notifier runs the email jobs: it loads the order and customer, skips customers who
+// opted out, renders the template in the customer's language and hands the result to a Sender. The Texter does the
+// same for texts through an SMSProvider, only for customers who opted in and never during quiet hours. Going through
+// the job queue means a failed send is retried with backoff and a relayed event sent twice reaches the customer once.
+package notify
+
+import (
+	"context"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// EMAIL_JOB_TYPE is the job that sends one order email, see Notifier, and SMS_JOB_TYPE the one that sends a text, see
+// Texter
+const (
+	EMAIL_JOB_TYPE = "notify.order_email"
+	SMS_JOB_TYPE   = "notify.order_sms"
+)
+
+// the emails customers receive about their orders, one template each
+const (
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplateReadyForPickup    = "ready_for_pickup"
+	TemplateOutForDelivery    = "out_for_delivery"
+	TemplateOrderCancelled    = "order_cancelled"
+	TemplateOrderRefunded     = "order_refunded"
+)
+
+// TemplateNames lists every email template and SMSTemplateNames every text, each of which must exist in every locale
+var (
+	TemplateNames = []string{
+		TemplateOrderConfirmation,
+		TemplateReadyForPickup,
+		TemplateOutForDelivery,
+		TemplateOrderCancelled,
+		TemplateOrderRefunded,
+	}
+	SMSTemplateNames = []string{
+		TemplateReadyForPickup,
+		TemplateOutForDelivery,
+	}
+)
+
+// Message is a rendered email. Text and HTML carry the same content and are sent as alternatives
+type Message struct {
+	To       string
+	Subject  string
+	Text     string
+	HTML     string
+	Template string
+	Locale   string
+}
+
+// Sender delivers rendered emails. A nil error means the message was handed off; errors are retried by the job queue
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NotificationJob is the payload of EMAIL_JOB_TYPE and SMS_JOB_TYPE jobs. Only ids are queued, so the message shows
+// the order as it is when the job runs
+type NotificationJob struct {
+	Template string `json:"template"`
+	OrderId  int    `json:"order_id"`
+	EventId  int64  `json:"event_id"`
+}
+
+// OrderMessage is what the templates are executed with
+type OrderMessage struct {
+	Locale   string
+	Store    config.StoreConfig
+	Customer model.Customer
+	Order    model.Order
+}
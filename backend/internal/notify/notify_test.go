@@ -0,0 +1,615 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testStore = config.StoreConfig{Name: "CodeCart", Address: "1 Main St", Phone: "+15555550100", Currency: "USD"}
+
+func testEmail(locale string) OrderMessage {
+	return OrderMessage{
+		Store:    testStore,
+		Customer: model.Customer{Id: 1, FirstName: "<b>ana</b> maría", Email: "ana@example.com", Locale: locale},
+		Order: model.Order{
+			Id:         42,
+			CustomerId: 1,
+			TotalPrice: 12.5,
+			OrderType:  "DELIVERY",
+			Driver:     "sam",
+			CreatedAt:  time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestTemplates_RenderEveryTemplateInEveryLocale(t *testing.T) {
+	templates, err := LoadTemplates("en", "USD", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(templates.Locales(), ","); got != "en,es" {
+		t.Fatalf("expected the en and es locales, got %s", got)
+	}
+
+	for _, locale := range templates.Locales() {
+		for _, name := range TemplateNames {
+			msg, err := templates.Render(name, testEmail(locale))
+			if err != nil {
+				t.Fatalf("%s/%s: %v", locale, name, err)
+			}
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") || !strings.Contains(msg.Subject, "42") {
+				t.Errorf("%s/%s: expected a one line subject naming the order, got %q", locale, name, msg.Subject)
+			}
+			if !strings.Contains(msg.HTML, "&lt;b&gt;ana&lt;/b&gt; María") || strings.Contains(msg.HTML, "<b>ana") {
+				t.Errorf("%s/%s: expected the customer's name escaped in the html, got %s", locale, name, msg.HTML)
+			}
+			if !strings.Contains(msg.Text, "<b>ana</b> María") {
+				t.Errorf("%s/%s: expected the customer's name as is in the text, got %s", locale, name, msg.Text)
+			}
+			if msg.Template != name || msg.Locale != locale {
+				t.Errorf("%s/%s: got template %s in %s", locale, name, msg.Template, msg.Locale)
+			}
+		}
+	}
+
+	en, _ := templates.Render(TemplateOrderConfirmation, testEmail("en"))
+	es, _ := templates.Render(TemplateOrderConfirmation, testEmail("es"))
+	if !strings.Contains(en.Text, "USD 12.50") || !strings.Contains(en.Text, "Oct 19, 2026 2:30 PM UTC") {
+		t.Errorf("expected english amounts and dates, got %s", en.Text)
+	}
+	if !strings.Contains(es.Text, "12,50 USD") || !strings.Contains(es.Text, "19/10/2026 14:30 UTC") || !strings.Contains(es.Subject, "confirmado") {
+		t.Errorf("expected spanish amounts, dates and wording, got %s\n%s", es.Subject, es.Text)
+	}
+
+	fallback, _ := templates.Render(TemplateOrderConfirmation, testEmail("fr"))
+	if fallback.Locale != "en" || fallback.Subject != en.Subject {
+		t.Errorf("expected customers in an unknown locale to get the default one, got %s", fallback.Locale)
+	}
+	if _, err := templates.Render("nope", testEmail("en")); err == nil {
+		t.Error("expected an unknown template to fail")
+	}
+	if _, err := LoadTemplates("de", "USD", time.UTC); err == nil {
+		t.Error("expected a default locale without templates to fail")
+	}
+}
+
+func TestTemplates_WriteTimesInTheStoreTimeZone(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	templates, err := LoadTemplates("en", "USD", location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	en, _ := templates.Render(TemplateOrderConfirmation, testEmail("en"))
+	es, _ := templates.Render(TemplateOrderConfirmation, testEmail("es"))
+	if !strings.Contains(en.Text, "Oct 19, 2026 10:30 AM EDT") {
+		t.Errorf("expected the time in New York, got %s", en.Text)
+	}
+	if !strings.Contains(es.Text, "19/10/2026 10:30 EDT") {
+		t.Errorf("expected the time in New York, got %s", es.Text)
+	}
+}
+
+func TestTrigger_QueuesOneNotificationJobPerEvent(t *testing.T) {
+	store := memory.NewStore()
+	trigger := NewTrigger(store.Repositories().Jobs, true, false, zap.NewNop())
+	ctx := context.Background()
+
+	statusChanged := func(id int64, to model.OrderStatus) model.OutboxEvent {
+		event, _ := model.NewOutboxEvent(model.AggregateOrder, 7, model.EventOrderStatusChanged,
+			model.OrderStatusChangedPayload{OrderId: 7, From: model.OrderStatusPending, To: to})
+		event.Id = id
+		return event
+	}
+	created, _ := model.NewOutboxEvent(model.AggregateOrder, 7, model.EventOrderCreated, model.Order{Id: 7})
+	created.Id = 1
+	customer, _ := model.NewOutboxEvent(model.AggregateCustomer, 3, model.EventCustomerCreated, model.Customer{Id: 3})
+	customer.Id = 2
+	garbled := statusChanged(5, model.OrderStatusCancelled)
+	garbled.Payload = json.RawMessage(`"not an object"`)
+
+	for _, event := range []model.OutboxEvent{
+		created,
+		created, // published again by the relay
+		customer,
+		statusChanged(3, model.OrderStatusDelivered),
+		statusChanged(4, model.OrderStatusCancelled),
+		garbled,
+	} {
+		if err := trigger.Publish(ctx, event); err != nil {
+			t.Fatalf("event %d: %v", event.Id, err)
+		}
+	}
+
+	var got []NotificationJob
+	for _, job := range store.Jobs() {
+		var payload NotificationJob
+		if err := json.Unmarshal(job.Payload, &payload); err != nil || job.Type != EMAIL_JOB_TYPE {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		got = append(got, payload)
+	}
+	want := []NotificationJob{
+		{Template: TemplateOrderConfirmation, OrderId: 7, EventId: 1},
+		{Template: TemplateOrderCancelled, OrderId: 7, EventId: 4},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestNotifier_SendsInTheCustomersLocaleAndHonoursTheOptOut(t *testing.T) {
+	store := memory.NewStore()
+	repos := store.Repositories()
+	ctx := context.Background()
+	templates, err := LoadTemplates("en", "USD", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &RecordingSender{}
+	notifier := NewNotifier(repos.Orders, repos.Customers, templates, sender, testStore, nil, zap.NewNop())
+
+	customerId, _ := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ana", Email: "ana@example.com", Locale: "es"})
+	orderId, _ := repos.Orders.PersistCreateOrder(ctx, model.Order{CustomerId: customerId, TotalPrice: 9.99, Status: model.OrderStatusPending})
+	run := func(template string, orderId int) error {
+		payload, _ := json.Marshal(NotificationJob{Template: template, OrderId: orderId, EventId: 1})
+		return notifier.HandleJob(ctx, model.Job{Id: 1, Type: EMAIL_JOB_TYPE, Payload: payload})
+	}
+
+	if err := run(TemplateReadyForPickup, orderId); err != nil {
+		t.Fatal(err)
+	}
+	sent := sender.Messages()
+	if len(sent) != 1 || sent[0].To != "ana@example.com" || sent[0].Locale != "es" || !strings.Contains(sent[0].Text, "Hola, Ana:") {
+		t.Fatalf("expected one spanish email to ana, got %+v", sent)
+	}
+
+	if err := run(TemplateOrderConfirmation, orderId+100); err != nil {
+		t.Errorf("expected emails about orders that are gone to be dropped, got %v", err)
+	}
+	if err := run("nope", orderId); !jobs.IsPermanent(err) {
+		t.Errorf("expected an unknown template to fail the job for good, got %v", err)
+	}
+	if err := notifier.HandleJob(ctx, model.Job{Payload: json.RawMessage(`[]`)}); !jobs.IsPermanent(err) {
+		t.Errorf("expected a payload that does not decode to fail the job for good, got %v", err)
+	}
+
+	sender.Err = errors.New("smtp is down")
+	if err := run(TemplateOrderRefunded, orderId); err == nil || jobs.IsPermanent(err) {
+		t.Errorf("expected a failed send to be retried, got %v", err)
+	}
+	sender.Err = nil
+
+	if err := repos.Customers.PersistUpdateCustomerById(ctx, customerId, map[string]any{"email_opt_out": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(TemplateOrderCancelled, orderId); err != nil {
+		t.Fatal(err)
+	}
+	if sent := sender.Messages(); len(sent) != 1 {
+		t.Fatalf("expected no email once the customer opted out, got %+v", sent[1:])
+	}
+}
+
+func TestSMTPSender_DeliversAMultipartMessage(t *testing.T) {
+	addr, received := fakeSMTPServer(t, "250 OK")
+	host, port, _ := net.SplitHostPort(addr)
+	from, _ := mail.ParseAddress("CodeCart <orders@codecart.test>")
+	sender := NewSMTPSender(host, port, "", "", from)
+
+	msg := Message{To: "ana@example.com", Subject: "Tu pedido n.º 42 está confirmado", Text: "hola\n", HTML: "<p>hola</p>", Template: TemplateOrderConfirmation}
+	if err := sender.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(<-received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != msg.Subject || parsed.Header.Get("To") != "<ana@example.com>" || !strings.Contains(parsed.Header.Get("From"), "orders@codecart.test") {
+		t.Fatalf("unexpected headers %v", parsed.Header)
+	}
+	_, params, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []string{msg.Text, msg.HTML} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if strings.ReplaceAll(string(body), "\r\n", "\n") != want {
+			t.Errorf("expected part %q, got %q", want, body)
+		}
+	}
+
+	addr, _ = fakeSMTPServer(t, "550 no such user")
+	host, port, _ = net.SplitHostPort(addr)
+	if err := NewSMTPSender(host, port, "", "", from).Send(context.Background(), msg); !jobs.IsPermanent(err) {
+		t.Errorf("expected a rejected recipient to fail for good, got %v", err)
+	}
+}
+
+func TestFileSender_WritesEmlFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emails")
+	from, _ := mail.ParseAddress("orders@codecart.test")
+	sender := NewFileSender(dir, from)
+
+	msg := Message{To: "ana@example.com", Subject: "hi", Text: "hi\n", HTML: "<p>hi</p>", Template: TemplateOrderRefunded}
+	for range 2 {
+		if err := sender.Send(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*-"+TemplateOrderRefunded+"-*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected an .eml file per email, got %v", files)
+	}
+	contents, _ := os.ReadFile(files[0])
+	if _, err := mail.ReadMessage(strings.NewReader(string(contents))); err != nil {
+		t.Errorf("expected a readable message, got %v", err)
+	}
+}
+
+// fakeSMTPServer accepts one SMTP session, answering RCPT with rcptReply, and sends the message data on received
+func fakeSMTPServer(t *testing.T, rcptReply string) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+			case "EHLO", "HELO":
+				text.PrintfLine("250-fake")
+				text.PrintfLine("250 8BITMIME")
+			case "MAIL", "RSET", "NOOP":
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				text.PrintfLine("%s", rcptReply)
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				lines, _ := text.ReadDotLines()
+				received <- strings.Join(lines, "\r\n")
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestTemplates_RenderEveryTextInEveryLocale(t *testing.T) {
+	templates, err := LoadTemplates("en", "USD", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locale := range templates.Locales() {
+		for _, name := range SMSTemplateNames {
+			body, got, err := templates.RenderSMS(name, testEmail(locale))
+			if err != nil {
+				t.Fatalf("%s/%s: %v", locale, name, err)
+			}
+			if got != locale || strings.Contains(body, "\n") || !strings.Contains(body, "42") || !strings.Contains(body, "STOP") {
+				t.Errorf("%s/%s: expected one line naming the order and how to opt out, got %q in %s", locale, name, body, got)
+			}
+			if size := MeasureSMS(body); size.Segments > 2 {
+				t.Errorf("%s/%s: expected at most two segments, got %+v for %q", locale, name, size, body)
+			}
+		}
+	}
+	if _, _, err := templates.RenderSMS(TemplateOrderRefunded, testEmail("en")); err == nil {
+		t.Error("expected a template without a text to fail")
+	}
+}
+
+func TestMeasureSMS(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body string
+		want SMSSize
+	}{
+		{"empty", "", SMSSize{EncodingGSM7, 0, 0}},
+		{"gsm-7", "Order #42 is ready", SMSSize{EncodingGSM7, 18, 1}},
+		{"gsm-7 filling one segment", strings.Repeat("a", 160), SMSSize{EncodingGSM7, 160, 1}},
+		{"gsm-7 one past a segment", strings.Repeat("a", 161), SMSSize{EncodingGSM7, 161, 2}},
+		{"gsm-7 filling two parts", strings.Repeat("a", 306), SMSSize{EncodingGSM7, 306, 2}},
+		{"gsm-7 one past two parts", strings.Repeat("a", 307), SMSSize{EncodingGSM7, 307, 3}},
+		{"extension characters take two septets", strings.Repeat("€", 80), SMSSize{EncodingGSM7, 160, 1}},
+		{"extension characters are not split", strings.Repeat("a", 152) + "€" + strings.Repeat("a", 8), SMSSize{EncodingGSM7, 162, 2}},
+		{"accents outside gsm-7", "Ñandú está", SMSSize{EncodingUCS2, 10, 1}},
+		{"ucs-2 filling one segment", strings.Repeat("á", 70), SMSSize{EncodingUCS2, 70, 1}},
+		{"ucs-2 one past a segment", strings.Repeat("á", 71), SMSSize{EncodingUCS2, 71, 2}},
+		{"surrogate pairs take two units and are not split", strings.Repeat("a", 66) + "🍕" + "a", SMSSize{EncodingUCS2, 69, 1}},
+		{"surrogate pairs across parts", strings.Repeat("a", 66) + "🍕" + strings.Repeat("a", 5), SMSSize{EncodingUCS2, 73, 2}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MeasureSMS(test.body); got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestQuietHours_Until(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	overnight, err := ParseQuietHours("21:00-08:00", newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch, _ := ParseQuietHours("12:00-13:30", newYork)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, newYork)
+	}
+
+	for _, test := range []struct {
+		name      string
+		quiet     QuietHours
+		at        time.Time
+		wantQuiet bool
+		want      time.Time
+	}{
+		{"before the window", overnight, at(10, 19, 20, 59), false, time.Time{}},
+		{"start of the window", overnight, at(10, 19, 21, 0), true, at(10, 20, 8, 0)},
+		{"after midnight", overnight, at(10, 20, 2, 15), true, at(10, 20, 8, 0)},
+		{"end of the window", overnight, at(10, 20, 8, 0), false, time.Time{}},
+		{"across the end of daylight saving time", overnight, at(10, 31, 23, 0), true, at(11, 1, 8, 0)},
+		{"inside a daytime window", lunch, at(10, 19, 12, 45), true, at(10, 19, 13, 30)},
+		{"outside a daytime window", lunch, at(10, 19, 23, 0), false, time.Time{}},
+		{"no quiet hours", QuietHours{}, at(10, 19, 23, 0), false, time.Time{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// the clock is read in the window's time zone whatever the zone of at
+			until, quiet := test.quiet.Until(test.at.UTC())
+			if quiet != test.wantQuiet || !until.Equal(test.want) {
+				t.Errorf("expected %v until %v, got %v until %v", test.wantQuiet, test.want, quiet, until)
+			}
+		})
+	}
+	if none, err := ParseQuietHours("none", newYork); err != nil || none != (QuietHours{}) {
+		t.Errorf("expected none to turn quiet hours off, got %v, %v", none, err)
+	}
+	if overnight.String() != "21:00-08:00 America/New_York" || (QuietHours{}).String() != "none" {
+		t.Errorf("unexpected strings %q and %q", overnight.String(), QuietHours{}.String())
+	}
+
+	for _, spec := range []string{"21:00", "9pm-8am", "25:00-08:00", "08:00-08:00"} {
+		if _, err := ParseQuietHours(spec, time.UTC); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestFakeProvider_UsesUniqueIdsAndKeepsTextsOutOfTheLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	ctx := context.Background()
+	sms := SMS{To: "+15555550100", Body: "Hola, Ana: tu pedido está listo"}
+
+	// a restarted process has a new provider, whose ids must not repeat the old one's
+	first, err := NewFakeProvider(zap.New(core)).SendSMS(ctx, sms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFakeProvider(zap.New(core)).SendSMS(ctx, sms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first.MessageId, "fake-") || first.MessageId == second.MessageId {
+		t.Errorf("expected distinct fake ids, got %s and %s", first.MessageId, second.MessageId)
+	}
+
+	for _, entry := range logs.All() {
+		fields := entry.ContextMap()
+		if fields["to"] != "********0100" {
+			t.Errorf("expected the number masked, got %v", fields["to"])
+		}
+		for key, value := range fields {
+			if text, ok := value.(string); ok && (strings.Contains(text, "Ana") || strings.Contains(text, "+1555555")) {
+				t.Errorf("expected the text kept out of the log, got %s=%s", key, text)
+			}
+		}
+	}
+}
+
+func TestTexter_TextsOptedInCustomersOnceOutsideQuietHours(t *testing.T) {
+	store := memory.NewStore()
+	repos := store.Repositories()
+	ctx := context.Background()
+	templates, err := LoadTemplates("en", "USD", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewFakeProvider(zap.NewNop())
+	quietHours, _ := ParseQuietHours("21:00-08:00", time.UTC)
+	texter := NewTexter(repos.Orders, repos.Customers, repos.SMS, templates, provider, quietHours,
+		config.NotificationsConfig{SMSFrom: "+15555550199", SMSMaxSegments: 3}, testStore, nil, zap.NewNop())
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	texter.Now = func() time.Time { return now }
+
+	customerId, _ := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ana", PhoneNumber: "+15555550100", Locale: "es", SMSOptIn: true})
+	orderId, _ := repos.Orders.PersistCreateOrder(ctx, model.Order{CustomerId: customerId, TotalPrice: 9.99, Status: model.OrderStatusReadyForPickup})
+	run := func(template string, eventId int64) error {
+		payload, _ := json.Marshal(NotificationJob{Template: template, OrderId: orderId, EventId: eventId})
+		return texter.HandleJob(ctx, model.Job{Id: eventId, Type: SMS_JOB_TYPE, Payload: payload})
+	}
+
+	// run twice, as a job whose first run crashed after sending would be
+	for range 2 {
+		if err := run(TemplateReadyForPickup, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	texts := provider.Messages()
+	if len(texts) != 1 || texts[0].To != "+15555550100" || texts[0].From != "+15555550199" || !strings.Contains(texts[0].Body, "Hola, Ana") {
+		t.Fatalf("expected one spanish text to ana, got %+v", texts)
+	}
+	recorded := store.SMSMessages()
+	if len(recorded) != 1 || recorded[0].Status != model.SMSDelivered || !strings.HasPrefix(recorded[0].ProviderMessageId, "fake-") ||
+		recorded[0].Encoding != EncodingUCS2 || recorded[0].Segments != MeasureSMS(texts[0].Body).Segments || recorded[0].Body != texts[0].Body {
+		t.Fatalf("expected the text recorded as delivered, got %+v", recorded)
+	}
+
+	if err := run(TemplateOutForDelivery, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Messages()) != 1 {
+		t.Error("expected no text about a status the order is no longer in")
+	}
+
+	now = time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC)
+	until, snoozed := jobs.SnoozedUntil(run(TemplateReadyForPickup, 3))
+	if !snoozed || !until.Equal(time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the text held back until quiet hours end, got %v %v", snoozed, until)
+	}
+	now = time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC)
+
+	provider.Err = errors.New("gateway timeout")
+	if err := run(TemplateReadyForPickup, 3); err == nil || jobs.IsPermanent(err) {
+		t.Errorf("expected a failed send to be retried, got %v", err)
+	}
+	provider.Err = nil
+	if err := run(TemplateReadyForPickup, 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Messages()) != 2 {
+		t.Fatalf("expected the retry to send the text, got %+v", provider.Messages())
+	}
+
+	texter.MaxSegments = 1
+	long := strings.Repeat("a", 200)
+	repos.Customers.PersistUpdateCustomerById(ctx, customerId, map[string]any{"first_name": long})
+	if err := run(TemplateReadyForPickup, 4); !jobs.IsPermanent(err) {
+		t.Errorf("expected a text over the segment limit to fail for good, got %v", err)
+	}
+	texter.MaxSegments = 3
+
+	if _, err := repos.Customers.PersistSMSOptInByPhoneNumber(ctx, "+15555550100", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(TemplateReadyForPickup, 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Messages()) != 2 {
+		t.Fatalf("expected no text once the customer opted out, got %+v", provider.Messages()[2:])
+	}
+}
+
+func TestTexter_ReadsQuietHoursInTheStoreTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	store := memory.NewStore()
+	repos := store.Repositories()
+	ctx := context.Background()
+	templates, err := LoadTemplates("en", "USD", newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewFakeProvider(zap.NewNop())
+	quietHours, _ := ParseQuietHours("21:00-08:00", newYork)
+	texter := NewTexter(repos.Orders, repos.Customers, repos.SMS, templates, provider, quietHours,
+		config.NotificationsConfig{SMSMaxSegments: 3}, testStore, nil, zap.NewNop())
+
+	customerId, _ := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ana", PhoneNumber: "+15555550100", SMSOptIn: true})
+	orderId, _ := repos.Orders.PersistCreateOrder(ctx, model.Order{CustomerId: customerId, TotalPrice: 9.99, Status: model.OrderStatusReadyForPickup})
+	run := func(eventId int64) error {
+		payload, _ := json.Marshal(NotificationJob{Template: TemplateReadyForPickup, OrderId: orderId, EventId: eventId})
+		return texter.HandleJob(ctx, model.Job{Id: eventId, Type: SMS_JOB_TYPE, Payload: payload})
+	}
+
+	// 06:00 in New York is quiet although it is 10:00 in UTC
+	texter.Now = func() time.Time { return time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC) }
+	until, snoozed := jobs.SnoozedUntil(run(1))
+	if !snoozed || !until.Equal(time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the text held back until 08:00 in New York, got %v %v", snoozed, until)
+	}
+
+	// 19:00 in New York is not, although it is 23:00 in UTC
+	texter.Now = func() time.Time { return time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC) }
+	if err := run(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Messages()) != 1 {
+		t.Errorf("expected the text sent in the New York evening, got %+v", provider.Messages())
+	}
+}
+
+func TestTrigger_QueuesTextsForTheStatusesCustomersAreTextedAbout(t *testing.T) {
+	store := memory.NewStore()
+	trigger := NewTrigger(store.Repositories().Jobs, false, true, zap.NewNop())
+	ctx := context.Background()
+
+	created, _ := model.NewOutboxEvent(model.AggregateOrder, 7, model.EventOrderCreated, model.Order{Id: 7})
+	created.Id = 1
+	events := []model.OutboxEvent{created}
+	for i, to := range []model.OrderStatus{model.OrderStatusReadyForPickup, model.OrderStatusCancelled, model.OrderStatusOutForDelivery} {
+		event, _ := model.NewOutboxEvent(model.AggregateOrder, 7, model.EventOrderStatusChanged,
+			model.OrderStatusChangedPayload{OrderId: 7, From: model.OrderStatusPending, To: to})
+		event.Id = int64(i + 2)
+		events = append(events, event, event)
+	}
+	for _, event := range events {
+		if err := trigger.Publish(ctx, event); err != nil {
+			t.Fatalf("event %d: %v", event.Id, err)
+		}
+	}
+
+	var got []string
+	for _, job := range store.Jobs() {
+		var payload NotificationJob
+		if err := json.Unmarshal(job.Payload, &payload); err != nil || job.Type != SMS_JOB_TYPE {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		got = append(got, job.UniqueKey)
+	}
+	want := []string{"sms:2:" + TemplateReadyForPickup, "sms:4:" + TemplateOutForDelivery}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
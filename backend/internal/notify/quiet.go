@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window in which customers are not texted, such as 21:00-08:00, read in the store's time zone.
+// A window whose end is before its start runs past midnight. The zero value has no quiet hours
+type QuietHours struct {
+	start, end time.Duration
+	location   *time.Location
+}
+
+// ParseQuietHours reads a window written as HH:MM-HH:MM. An empty spec or "none" means no quiet hours
+func ParseQuietHours(spec string, location *time.Location) (QuietHours, error) {
+	if spec == "" || spec == "none" {
+		return QuietHours{}, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("quiet hours must look like 21:00-08:00, got %q", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid start of quiet hours %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("invalid end of quiet hours %q: %w", spec, err)
+	}
+	if start == end {
+		return QuietHours{}, fmt.Errorf("quiet hours %q start and end at the same time", spec)
+	}
+	return QuietHours{start: start, end: end, location: location}, nil
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	at, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute, nil
+}
+
+// Until reports whether at falls within quiet hours and, if it does, when they end
+func (q QuietHours) Until(at time.Time) (time.Time, bool) {
+	if q.location == nil {
+		return time.Time{}, false
+	}
+	local := at.In(q.location)
+	sinceMidnight := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	endOn := func(day time.Time) time.Time {
+		// built from the date rather than by adding to midnight, so the end stays on the clock across DST changes
+		return time.Date(day.Year(), day.Month(), day.Day(), int(q.end/time.Hour), int(q.end%time.Hour/time.Minute), 0, 0, q.location)
+	}
+
+	switch {
+	case q.start < q.end && sinceMidnight >= q.start && sinceMidnight < q.end:
+		return endOn(local), true
+	case q.start > q.end && sinceMidnight >= q.start:
+		return endOn(local.AddDate(0, 0, 1)), true
+	case q.start > q.end && sinceMidnight < q.end:
+		return endOn(local), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// String writes the window as HH:MM-HH:MM followed by its time zone, or "none" for the zero value
+func (q QuietHours) String() string {
+	if q.location == nil {
+		return "none"
+	}
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return clock(q.start) + "-" + clock(q.end) + " " + q.location.String()
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// the encodings a text goes out in. GSM-7 packs 160 characters into one segment but only knows the characters below;
+// anything else, such as á or an emoji, turns the whole text into UCS-2 with 70 per segment
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// the GSM 03.38 default alphabet, and its extension table whose characters take two septets each
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "^{}\\[~]|€\f"
+)
+
+// SMSSize is how a text is billed: Units are septets in GSM-7 and UTF-16 code units in UCS-2
+type SMSSize struct {
+	Encoding string
+	Units    int
+	Segments int
+}
+
+// MeasureSMS works out the encoding of body and how many segments it is sent as. A text that does not fit in one
+// segment is split into parts that each give up room to a header: 153 septets or 67 code units. A character is never
+// split across parts, so the count is exact rather than a division
+func MeasureSMS(body string) SMSSize {
+	size := SMSSize{Encoding: EncodingGSM7}
+	single, multi := 160, 153
+	widths := make([]int, 0, len(body))
+	for _, r := range body {
+		if strings.ContainsRune(gsm7Basic, r) {
+			widths = append(widths, 1)
+		} else if strings.ContainsRune(gsm7Extended, r) {
+			widths = append(widths, 2)
+		} else {
+			size.Encoding = EncodingUCS2
+			break
+		}
+	}
+	if size.Encoding == EncodingUCS2 {
+		single, multi = 70, 67
+		widths = widths[:0]
+		for _, r := range body {
+			widths = append(widths, utf16.RuneLen(r))
+		}
+	}
+
+	for _, width := range widths {
+		size.Units += width
+	}
+	if size.Units <= single {
+		size.Segments = min(size.Units, 1)
+		return size
+	}
+
+	size.Segments = 1
+	used := 0
+	for _, width := range widths {
+		if used+width > multi {
+			size.Segments++
+			used = 0
+		}
+		used += width
+	}
+	return size
+}
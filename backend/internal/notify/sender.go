@@ -0,0 +1,279 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+)
+
+// NewSender builds the sender cfg.EmailSender names, or returns nil for "none"
+func NewSender(cfg config.NotificationsConfig) (Sender, error) {
+	from, err := mail.ParseAddress(cfg.EmailFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_FROM: %w", err)
+	}
+
+	switch cfg.EmailSender {
+	case "none":
+		return nil, nil
+	case "smtp":
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, from), nil
+	case "file":
+		return NewFileSender(cfg.EmailDir, from), nil
+	case "stdout":
+		return NewWriterSender(os.Stdout, from), nil
+	default:
+		return nil, fmt.Errorf("unknown email sender %q", cfg.EmailSender)
+	}
+}
+
+// SMTPSender hands emails to an SMTP server, upgrading to TLS when the server offers STARTTLS. For local development
+// point it at a sink such as Mailpit or MailHog, e.g. SMTP_HOST=localhost and SMTP_PORT=1025
+type SMTPSender struct {
+	Addr string
+	Host string
+	From *mail.Address
+	// Auth is nil when no username is configured. PLAIN auth is refused over an unencrypted connection to anything
+	// but localhost
+	Auth smtp.Auth
+	Now  func() time.Time
+}
+
+var _ Sender = SMTPSender{}
+
+func NewSMTPSender(host, port, username, password string, from *mail.Address) SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return SMTPSender{
+		Addr: net.JoinHostPort(host, port),
+		Host: host,
+		From: from,
+		Auth: auth,
+		Now:  time.Now,
+	}
+}
+
+// Send delivers msg in one SMTP session. Rejections with a permanent (5xx) reply are returned as jobs.Permanent, since
+// sending the same message again will not change the server's mind
+func (s SMTPSender) Send(ctx context.Context, msg Message) error {
+	body, err := buildMessage(s.From, msg, s.Now())
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet the smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return fmt.Errorf("failed to start tls with the smtp server: %w", err)
+		}
+	}
+	if s.Auth != nil {
+		if err := client.Auth(s.Auth); err != nil {
+			return smtpError("failed to authenticate with the smtp server", err)
+		}
+	}
+	if err := client.Mail(s.From.Address); err != nil {
+		return smtpError("the smtp server refused the sender", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return smtpError("the smtp server refused the recipient", err)
+	}
+	data, err := client.Data()
+	if err != nil {
+		return smtpError("the smtp server refused the message", err)
+	}
+	if _, err := data.Write(body); err != nil {
+		return fmt.Errorf("failed to write the message to the smtp server: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return smtpError("the smtp server refused the message", err)
+	}
+	// the message is accepted at this point, a failed QUIT changes nothing
+	_ = client.Quit()
+	return nil
+}
+
+func smtpError(message string, err error) error {
+	err = fmt.Errorf("%s: %w", message, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// FileSender writes every email as an .eml file into Dir, where any mail client can open it
+type FileSender struct {
+	Dir  string
+	From *mail.Address
+	Now  func() time.Time
+}
+
+var _ Sender = FileSender{}
+
+func NewFileSender(dir string, from *mail.Address) FileSender {
+	return FileSender{Dir: dir, From: from, Now: time.Now}
+}
+
+func (s FileSender) Send(ctx context.Context, msg Message) error {
+	now := s.Now()
+	body, err := buildMessage(s.From, msg, now)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create the email directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(s.Dir, now.UTC().Format("20060102T150405Z")+"-"+msg.Template+"-*.eml")
+	if err != nil {
+		return fmt.Errorf("failed to create the email file: %w", err)
+	}
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write the email file: %w", err)
+	}
+	return file.Close()
+}
+
+// WriterSender prints every email to Out, one after the other
+type WriterSender struct {
+	Out  io.Writer
+	From *mail.Address
+	Now  func() time.Time
+	mu   *sync.Mutex
+}
+
+var _ Sender = WriterSender{}
+
+func NewWriterSender(out io.Writer, from *mail.Address) WriterSender {
+	return WriterSender{Out: out, From: from, Now: time.Now, mu: &sync.Mutex{}}
+}
+
+func (s WriterSender) Send(ctx context.Context, msg Message) error {
+	body, err := buildMessage(s.From, msg, s.Now())
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.Out, "%s\r\n%s\r\n", body, strings.Repeat("=", 76))
+	return err
+}
+
+// RecordingSender keeps every email it is handed, for tests. Setting Err makes every send fail with it
+type RecordingSender struct {
+	mu       sync.Mutex
+	messages []Message
+	Err      error
+}
+
+var _ Sender = (*RecordingSender)(nil)
+
+func (s *RecordingSender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (s *RecordingSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// buildMessage formats msg as a MIME message from from, with the text and HTML parts as alternatives
+func buildMessage(from *mail.Address, msg Message, date time.Time) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+	header := func(name, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", name, value) }
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageId(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	// the preferred alternative goes last
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func messageId(from *mail.Address) string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	domain := "codecart.local"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
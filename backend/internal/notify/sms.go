@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"go.uber.org/zap"
+)
+
+// SMS is a text to hand to a provider. To is an E.164 number and From the sender number or id, which the provider
+// may fill in when empty
+type SMS struct {
+	From string
+	To   string
+	Body string
+}
+
+// SMSReceipt is the provider's answer to a send: the id it reports the text's status under, and SENT or, for a
+// provider that knows straight away, DELIVERED
+type SMSReceipt struct {
+	MessageId string
+	Status    model.SMSStatus
+}
+
+// SMSProvider hands texts to a carrier gateway. Delivery reports arrive later through the SMS callback routes, keyed
+// by Name and the receipt's MessageId. Errors are retried by the job queue unless wrapped with jobs.Permanent, which
+// is what a provider should do when it rejects the number or the content
+type SMSProvider interface {
+	Name() string
+	SendSMS(ctx context.Context, sms SMS) (SMSReceipt, error)
+}
+
+// NewSMSProvider builds the provider cfg.SMSProvider names, or returns nil for "none"
+func NewSMSProvider(cfg config.NotificationsConfig, logger *zap.Logger) (SMSProvider, error) {
+	switch cfg.SMSProvider {
+	case "none":
+		return nil, nil
+	case "fake":
+		return NewFakeProvider(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", cfg.SMSProvider)
+	}
+}
+
+// FakeProvider records texts in memory and logs them instead of sending them, for development and tests. It reports
+// every text delivered straight away, under a random id so ids from different processes do not collide in
+// sms_messages. The log leaves out the body and all but the last digits of the number. Setting Err makes every send
+// fail with it
+type FakeProvider struct {
+	mu       sync.Mutex
+	messages []SMS
+	Err      error
+	Logger   *zap.Logger
+}
+
+var _ SMSProvider = (*FakeProvider)(nil)
+
+func NewFakeProvider(logger *zap.Logger) *FakeProvider {
+	return &FakeProvider{Logger: logger.Named("fake_sms_provider")}
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+func (p *FakeProvider) SendSMS(ctx context.Context, sms SMS) (SMSReceipt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return SMSReceipt{}, p.Err
+	}
+
+	p.messages = append(p.messages, sms)
+	random := make([]byte, 16)
+	rand.Read(random)
+	id := "fake-" + hex.EncodeToString(random)
+	p.Logger.Info("text recorded", zap.String("message_id", id), zap.String("to", maskPhoneNumber(sms.To)),
+		zap.Int("body_length", len([]rune(sms.Body))))
+	return SMSReceipt{MessageId: id, Status: model.SMSDelivered}, nil
+}
+
+// maskPhoneNumber keeps the last four digits of number, enough to tell texts apart in a log
+func maskPhoneNumber(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// Messages returns the texts sent so far, oldest first
+func (p *FakeProvider) Messages() []SMS {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]SMS(nil), p.messages...)
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templates/<locale>/layout.tmpl wraps every email of the locale and templates/<locale>/<name>.tmpl defines its
+// "subject", "body" (the HTML content) and "text" blocks. The layout defines "html", the document around "body".
+// templates/<locale>/sms/<name>.tmpl is the body of a text
+//
+//go:embed templates
+var templateFS embed.FS
+
+// localeFormat is how amounts and times are written in one locale
+type localeFormat struct {
+	decimalSeparator string
+	currencyFirst    bool
+	dateLayout       string
+}
+
+// formats holds the conventions of every locale there are templates for. Customer.Locale is validated against the
+// same list
+var formats = map[string]localeFormat{
+	"en": {decimalSeparator: ".", currencyFirst: true, dateLayout: "Jan 2, 2006 3:04 PM MST"},
+	"es": {decimalSeparator: ",", currencyFirst: false, dateLayout: "02/01/2006 15:04 MST"},
+}
+
+type templateSet struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders the order emails and texts. The subject and plain text parts are executed with text/template and
+// the HTML part with html/template, so customer data is escaped only where it needs to be
+type Templates struct {
+	defaultLocale string
+	sets          map[string]map[string]templateSet
+	sms           map[string]map[string]*texttemplate.Template
+}
+
+// LoadTemplates parses the embedded templates of every locale, failing when one lacks a template or a block so a
+// broken template stops the process at startup rather than at the first email. defaultLocale is used for customers
+// without a locale, or with one there are no templates for. Times are written in location, the store's time zone
+func LoadTemplates(defaultLocale string, currency string, location *time.Location) (*Templates, error) {
+	locales, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the email templates: %w", err)
+	}
+
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		sets:          map[string]map[string]templateSet{},
+		sms:           map[string]map[string]*texttemplate.Template{},
+	}
+	for _, entry := range locales {
+		locale := entry.Name()
+		format, ok := formats[locale]
+		if !ok {
+			return nil, fmt.Errorf("email templates for locale %q have no number and date format", locale)
+		}
+		funcs := format.funcs(currency, location)
+
+		t.sets[locale] = map[string]templateSet{}
+		for _, name := range TemplateNames {
+			files := []string{"templates/" + locale + "/layout.tmpl", "templates/" + locale + "/" + name + ".tmpl"}
+			text, err := texttemplate.New(name).Funcs(funcs).ParseFS(templateFS, files...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the %s email template for locale %q: %w", name, locale, err)
+			}
+			html, err := htmltemplate.New(name).Funcs(funcs).ParseFS(templateFS, files...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the %s email template for locale %q: %w", name, locale, err)
+			}
+			for _, block := range []string{"subject", "text", "body"} {
+				if text.Lookup(block) == nil {
+					return nil, fmt.Errorf("the %s email template for locale %q does not define %q", name, locale, block)
+				}
+			}
+			if html.Lookup("html") == nil {
+				return nil, fmt.Errorf("the email layout for locale %q does not define \"html\"", locale)
+			}
+			t.sets[locale][name] = templateSet{text: text, html: html}
+		}
+
+		t.sms[locale] = map[string]*texttemplate.Template{}
+		for _, name := range SMSTemplateNames {
+			text, err := texttemplate.New(name+".tmpl").Funcs(funcs).ParseFS(templateFS, "templates/"+locale+"/sms/"+name+".tmpl")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the %s text template for locale %q: %w", name, locale, err)
+			}
+			t.sms[locale][name] = text
+		}
+	}
+
+	if _, ok := t.sets[defaultLocale]; !ok {
+		return nil, fmt.Errorf("there are no email templates for the default locale %q, have %s", defaultLocale, strings.Join(t.Locales(), ", "))
+	}
+	return t, nil
+}
+
+// Locales lists the locales there are templates for, in sorted order
+func (t *Templates) Locales() []string {
+	return slices.Sorted(maps.Keys(t.sets))
+}
+
+// Render executes the named template for data in data.Customer.Locale, falling back to the default locale. The
+// returned message has no recipient yet
+func (t *Templates) Render(name string, data OrderMessage) (Message, error) {
+	locale := data.Customer.Locale
+	if _, ok := t.sets[locale]; !ok {
+		locale = t.defaultLocale
+	}
+	set, ok := t.sets[locale][name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+	data.Locale = locale
+
+	var subject, text, html bytes.Buffer
+	if err := set.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render the subject of %s: %w", name, err)
+	}
+	if err := set.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render the text of %s: %w", name, err)
+	}
+	if err := set.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render the html of %s: %w", name, err)
+	}
+
+	return Message{
+		// a header must be a single line, whatever ended up in the customer's name
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		Text:     strings.TrimSpace(text.String()) + "\n",
+		HTML:     html.String(),
+		Template: name,
+		Locale:   locale,
+	}, nil
+}
+
+// RenderSMS executes the named text template like Render does and returns the body along with the locale it is in.
+// Line breaks and runs of spaces are folded, since every character of a text is paid for
+func (t *Templates) RenderSMS(name string, data OrderMessage) (string, string, error) {
+	locale := data.Customer.Locale
+	if _, ok := t.sms[locale]; !ok {
+		locale = t.defaultLocale
+	}
+	text, ok := t.sms[locale][name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown text template %q", name)
+	}
+	data.Locale = locale
+
+	var body bytes.Buffer
+	if err := text.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to render the text %s: %w", name, err)
+	}
+	return strings.Join(strings.Fields(body.String()), " "), locale, nil
+}
+
+// funcs are the helpers the templates of one locale can call
+func (f localeFormat) funcs(currency string, location *time.Location) map[string]any {
+	return map[string]any{
+		// names are stored lowercased
+		"title": func(s string) string {
+			words := strings.Fields(s)
+			for i, word := range words {
+				first, size := utf8.DecodeRuneInString(word)
+				words[i] = string(unicode.ToUpper(first)) + word[size:]
+			}
+			return strings.Join(words, " ")
+		},
+		"money": func(amount float64) string {
+			number := strings.Replace(strconv.FormatFloat(amount, 'f', 2, 64), ".", f.decimalSeparator, 1)
+			if f.currencyFirst {
+				return currency + " " + number
+			}
+			return number + " " + currency
+		},
+		"datetime": func(at time.Time) string {
+			return at.In(location).Format(f.dateLayout)
+		},
+	}
+}
@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/jobs"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// smsTemplateStatuses is the order status each text is about. A text is only sent while the order is still in it, so
+// one held back by quiet hours is dropped once the order has moved on
+var smsTemplateStatuses = map[string]model.OrderStatus{
+	TemplateReadyForPickup: model.OrderStatusReadyForPickup,
+	TemplateOutForDelivery: model.OrderStatusOutForDelivery,
+}
+
+// Texter runs SMS_JOB_TYPE jobs. Every text is recorded in the sms_messages table before it is handed to the
+// provider, keyed by the event it is about, so a job that runs twice does not text the customer twice and the
+// provider's delivery reports have something to update
+type Texter struct {
+	Orders      persistence.OrderRepository
+	Customers   persistence.CustomerRepository
+	Messages    persistence.SMSRepository
+	Templates   *Templates
+	Provider    SMSProvider
+	From        string
+	MaxSegments int
+	QuietHours  QuietHours
+	Store       config.StoreConfig
+	Now         func() time.Time
+	Metrics     *metrics.Metrics
+	Logger      *zap.Logger
+}
+
+func NewTexter(
+	orders persistence.OrderRepository,
+	customers persistence.CustomerRepository,
+	messages persistence.SMSRepository,
+	templates *Templates,
+	provider SMSProvider,
+	quietHours QuietHours,
+	cfg config.NotificationsConfig,
+	store config.StoreConfig,
+	metrics *metrics.Metrics,
+	logger *zap.Logger,
+) Texter {
+	return Texter{
+		Orders:      orders,
+		Customers:   customers,
+		Messages:    messages,
+		Templates:   templates,
+		Provider:    provider,
+		From:        cfg.SMSFrom,
+		MaxSegments: cfg.SMSMaxSegments,
+		QuietHours:  quietHours,
+		Store:       store,
+		Now:         time.Now,
+		Metrics:     metrics,
+		Logger:      logger.Named("sms_texter"),
+	}
+}
+
+// HandleJob is the jobs.Handler of SMS_JOB_TYPE
+func (t Texter) HandleJob(ctx context.Context, job model.Job) error {
+	var payload NotificationJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to decode the sms job: %w", err))
+	}
+	zLog := utils.FromContext(ctx, t.Logger).With(
+		zap.Int64("job_id", job.Id),
+		zap.Int("order_id", payload.OrderId),
+		zap.String("template", payload.Template))
+
+	order, err := t.Orders.FetchOrderById(ctx, payload.OrderId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("order no longer exists, not texting about it")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load order %d: %w", payload.OrderId, err)
+	}
+	if status, ok := smsTemplateStatuses[payload.Template]; ok && order.Status != status {
+		zLog.Info("order moved on, not texting about it", zap.String("status", string(order.Status)))
+		t.Metrics.SMSHandled(payload.Template, "skipped")
+		return nil
+	}
+	customer, err := t.Customers.FetchCustomerById(ctx, order.CustomerId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("customer no longer exists, not texting them", zap.Int("customer_id", order.CustomerId))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load customer %d: %w", order.CustomerId, err)
+	}
+	if !customer.SMSOptIn || customer.PhoneNumber == "" {
+		zLog.Info("customer does not get texts, skipping", zap.Int("customer_id", customer.Id))
+		t.Metrics.SMSHandled(payload.Template, "skipped")
+		return nil
+	}
+
+	now := t.Now()
+	if until, quiet := t.QuietHours.Until(now); quiet {
+		zLog.Info("quiet hours, holding the text back", zap.Time("until", until))
+		return jobs.Snooze(until)
+	}
+
+	body, locale, err := t.Templates.RenderSMS(payload.Template, OrderMessage{Store: t.Store, Customer: customer, Order: order})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	size := MeasureSMS(body)
+	if size.Segments > t.MaxSegments {
+		t.Metrics.SMSHandled(payload.Template, "failed")
+		return jobs.Permanent(fmt.Errorf("the %s text in %s is %d segments long, more than the %d allowed", payload.Template, locale, size.Segments, t.MaxSegments))
+	}
+
+	message, created, err := t.Messages.PersistCreateSMSMessage(ctx, model.SMSMessage{
+		DedupeKey:  fmt.Sprintf("%d:%s", payload.EventId, payload.Template),
+		CustomerId: customer.Id,
+		OrderId:    order.Id,
+		Template:   payload.Template,
+		To:         customer.PhoneNumber,
+		Body:       body,
+		Encoding:   size.Encoding,
+		Segments:   size.Segments,
+		Status:     model.SMSPending,
+		Provider:   t.Provider.Name(),
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the text: %w", err)
+	}
+	if !created && message.Status != model.SMSPending {
+		zLog.Info("text already sent", zap.Int64("sms_id", message.Id), zap.String("status", string(message.Status)))
+		return nil
+	}
+	zLog = zLog.With(zap.Int64("sms_id", message.Id))
+
+	// a retry sends what was recorded, not whatever the template renders to now
+	receipt, err := t.Provider.SendSMS(ctx, SMS{From: t.From, To: message.To, Body: message.Body})
+	if err != nil {
+		t.Metrics.SMSHandled(payload.Template, "failed")
+		if recordErr := t.Messages.PersistSMSMessageFailed(ctx, message.Id, err.Error(), jobs.IsPermanent(err), t.Now()); recordErr != nil {
+			zLog.Error("failed to record the failed text", zap.Error(recordErr))
+		}
+		return err
+	}
+	if receipt.Status == "" {
+		receipt.Status = model.SMSSent
+	}
+	t.Metrics.SMSSent(payload.Template, message.Encoding, message.Segments)
+	if err := t.Messages.PersistSMSMessageSent(ctx, message.Id, receipt.MessageId, receipt.Status, t.Now()); err != nil {
+		// the text is out, so failing the job would only send it again
+		zLog.Error("failed to record the sent text", zap.Error(err))
+		return nil
+	}
+	zLog.Info("texted customer", zap.Int("customer_id", customer.Id), zap.String("locale", locale), zap.Int("segments", message.Segments))
+	return nil
+}
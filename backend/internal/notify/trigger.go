@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/outbox"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// statusTemplates maps the order statuses customers are emailed about to their template, and smsStatusTemplates the
+// ones they are texted about
+var (
+	statusTemplates = map[model.OrderStatus]string{
+		model.OrderStatusReadyForPickup: TemplateReadyForPickup,
+		model.OrderStatusOutForDelivery: TemplateOutForDelivery,
+		model.OrderStatusCancelled:      TemplateOrderCancelled,
+		model.OrderStatusRefunded:       TemplateOrderRefunded,
+	}
+	smsStatusTemplates = map[model.OrderStatus]string{
+		model.OrderStatusReadyForPickup: TemplateReadyForPickup,
+		model.OrderStatusOutForDelivery: TemplateOutForDelivery,
+	}
+)
+
+// Trigger is the outbox publisher that queues an email job and a text job for every order event a customer is told
+// about, on the channels that are enabled. Each job is keyed by the event, so the relay publishing the same event
+// again does not notify the customer twice
+type Trigger struct {
+	Jobs   persistence.JobRepository
+	Email  bool
+	SMS    bool
+	Logger *zap.Logger
+}
+
+var _ outbox.Publisher = Trigger{}
+
+func NewTrigger(jobs persistence.JobRepository, email, sms bool, logger *zap.Logger) Trigger {
+	return Trigger{
+		Jobs:   jobs,
+		Email:  email,
+		SMS:    sms,
+		Logger: logger.Named("notification_trigger"),
+	}
+}
+
+func (t Trigger) Publish(ctx context.Context, event model.OutboxEvent) error {
+	emailTemplate, smsTemplate, orderId, err := templatesFor(event)
+	if err != nil {
+		// publishing it again will not make it decode
+		utils.FromContext(ctx, t.Logger).Warn("skipping an order event that cannot be read", zap.Int64("event_id", event.Id), zap.Error(err))
+		return nil
+	}
+
+	if t.Email && emailTemplate != "" {
+		if err := t.enqueue(ctx, EMAIL_JOB_TYPE, "email", emailTemplate, orderId, event.Id); err != nil {
+			return err
+		}
+	}
+	if t.SMS && smsTemplate != "" {
+		if err := t.enqueue(ctx, SMS_JOB_TYPE, "sms", smsTemplate, orderId, event.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t Trigger) enqueue(ctx context.Context, jobType, channel, template string, orderId int, eventId int64) error {
+	job, err := model.NewJob(jobType, NotificationJob{Template: template, OrderId: orderId, EventId: eventId})
+	if err != nil {
+		return err
+	}
+	job.UniqueKey = fmt.Sprintf("%s:%d:%s", channel, eventId, template)
+	id, created, err := t.Jobs.PersistEnqueueJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to queue the %s %s for event %d: %w", template, channel, eventId, err)
+	}
+	if created {
+		utils.FromContext(ctx, t.Logger).Debug("queued order notification",
+			zap.Int64("job_id", id),
+			zap.Int64("event_id", eventId),
+			zap.Int("order_id", orderId),
+			zap.String("channel", channel),
+			zap.String("template", template))
+	}
+	return nil
+}
+
+// templatesFor returns the email and the text event calls for along with the order it is about. A template is empty
+// when the customer is not told about the event on that channel
+func templatesFor(event model.OutboxEvent) (string, string, int, error) {
+	switch event.Type {
+	case model.EventOrderCreated:
+		orderId, err := strconv.Atoi(event.AggregateId)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("event %d is about order %q, which is not an id: %w", event.Id, event.AggregateId, err)
+		}
+		return TemplateOrderConfirmation, "", orderId, nil
+	case model.EventOrderStatusChanged:
+		var payload model.OrderStatusChangedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return "", "", 0, fmt.Errorf("failed to decode the payload of event %d: %w", event.Id, err)
+		}
+		return statusTemplates[payload.To], smsStatusTemplates[payload.To], payload.OrderId, nil
+	default:
+		return "", "", 0, nil
+	}
+}
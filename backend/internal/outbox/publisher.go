@@ -0,0 +1,79 @@
+// Package outbox publishes the domain events services record in the outbox table. The Relay polls for pending events
+// and hands them to a Publisher one at a time, in order per aggregate, marking each one published only once the
+// publisher has accepted it. Delivery is therefore at least once: a crash between publishing and marking, or a
+// publisher that accepted an event but reported an error, leads to the event being published again.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// Publisher delivers one event to a bus. A nil error means the bus has durably accepted the event
+type Publisher interface {
+	Publish(ctx context.Context, event model.OutboxEvent) error
+}
+
+// Handler consumes events from a MemoryBus. Returning an error fails the publish, so the relay retries the event
+type Handler func(ctx context.Context, event model.OutboxEvent) error
+
+// MemoryBus delivers events to handlers in this process. It is the default bus and what tests and in-process
+// consumers subscribe to; nothing outside the process sees the events
+type MemoryBus struct {
+	mu       sync.RWMutex
+	nextId   int
+	handlers map[int]Handler
+}
+
+var _ Publisher = (*MemoryBus)(nil)
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: map[int]Handler{}}
+}
+
+// Subscribe registers handler for every event published from now on and returns a func that removes it again
+func (b *MemoryBus) Subscribe(handler Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextId
+	b.nextId++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish calls every handler in turn and joins their errors
+func (b *MemoryBus) Publish(ctx context.Context, event model.OutboxEvent) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		errs = append(errs, handler(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// Publishers publishes every event to each of its publishers in turn. The event counts as published only once all of
+// them have accepted it, so a failure in one has the relay publish it to the others again as well
+type Publishers []Publisher
+
+var _ Publisher = Publishers{}
+
+func (ps Publishers) Publish(ctx context.Context, event model.OutboxEvent) error {
+	var errs []error
+	for _, publisher := range ps {
+		errs = append(errs, publisher.Publish(ctx, event))
+	}
+	return errors.Join(errs...)
+}
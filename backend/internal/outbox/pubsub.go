@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// PUBSUB_ENDPOINT is the production Pub/Sub REST API
+const PUBSUB_ENDPOINT = "https://pubsub.googleapis.com"
+
+// PubSubPublisher publishes each event as one message through the Pub/Sub REST API, which the Pub/Sub emulator speaks
+// as well. The message data is the event's JSON, the attributes repeat its identifying fields so subscriptions can
+// filter on them, and the ordering key is the aggregate, so subscriptions with message ordering enabled keep each
+// aggregate in order
+type PubSubPublisher struct {
+	// Endpoint is PUBSUB_ENDPOINT, or http://<PUBSUB_EMULATOR_HOST> for the emulator
+	Endpoint string
+	Project  string
+	Topic    string
+	// Client must authenticate for the production endpoint; the emulator takes plain requests
+	Client *http.Client
+}
+
+var _ Publisher = PubSubPublisher{}
+
+func NewPubSubPublisher(endpoint, project, topic string, client *http.Client) PubSubPublisher {
+	return PubSubPublisher{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Project:  project,
+		Topic:    topic,
+		Client:   client,
+	}
+}
+
+type pubSubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"orderingKey"`
+}
+
+func (p PubSubPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %d: %w", event.Id, err)
+	}
+	body, err := json.Marshal(map[string][]pubSubMessage{
+		"messages": {{
+			Data: data,
+			Attributes: map[string]string{
+				"event_id":       strconv.FormatInt(event.Id, 10),
+				"event_type":     event.Type,
+				"aggregate_type": event.AggregateType,
+				"aggregate_id":   event.AggregateId,
+			},
+			OrderingKey: event.OrderingKey(),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pubsub request: %w", err)
+	}
+
+	_, err = p.do(ctx, http.MethodPost, p.topicPath()+":publish", body)
+	return err
+}
+
+// EnsureTopic creates the topic if it does not exist yet. It is meant for the emulator, which starts out empty
+func (p PubSubPublisher) EnsureTopic(ctx context.Context) error {
+	status, err := p.do(ctx, http.MethodPut, p.topicPath(), []byte(`{}`))
+	if status == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func (p PubSubPublisher) topicPath() string {
+	return fmt.Sprintf("%s/v1/projects/%s/topics/%s", p.Endpoint, p.Project, p.Topic)
+}
+
+func (p PubSubPublisher) do(ctx context.Context, method, url string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build pubsub request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("pubsub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("pubsub returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
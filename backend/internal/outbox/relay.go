@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// PURGE_INTERVAL is how often the relay deletes published events older than the retention
+const PURGE_INTERVAL = time.Hour
+
+// HISTORY_AGGREGATE_TYPES are left out of the Retention purge: order event streams replay an order's history, and
+// resume after Last-Event-ID, from the outbox. An order's history is purged OrderHistoryRetention after the order is
+// over instead
+var HISTORY_AGGREGATE_TYPES = []string{model.AggregateOrder}
+
+// Relay moves events from the outbox to a Publisher. Each round claims the outbox, publishes the due events oldest
+// first and marks each one as soon as the publisher has answered. When an event fails, the rest of its aggregate is
+// held back behind it until its retry, which backs off exponentially from RetryBase to RetryMax; other aggregates
+// carry on. Events are retried until they are published. Published events are purged after Retention, and the
+// history of an order that is over OrderHistoryRetention after its last event
+type Relay struct {
+	Claimer               persistence.OutboxClaimer
+	Publisher             Publisher
+	PollInterval          time.Duration
+	BatchSize             int
+	RetryBase             time.Duration
+	RetryMax              time.Duration
+	PublishTimeout        time.Duration
+	Retention             time.Duration
+	OrderHistoryRetention time.Duration
+	Now                   func() time.Time
+	Metrics               *metrics.Metrics
+	Logger                *zap.Logger
+
+	lastPurge time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewRelay(claimer persistence.OutboxClaimer, publisher Publisher, cfg config.OutboxConfig, metrics *metrics.Metrics, logger *zap.Logger) *Relay {
+	return &Relay{
+		Claimer:               claimer,
+		Publisher:             publisher,
+		PollInterval:          cfg.PollInterval,
+		BatchSize:             cfg.BatchSize,
+		RetryBase:             cfg.RetryBase,
+		RetryMax:              cfg.RetryMax,
+		PublishTimeout:        cfg.PublishTimeout,
+		Retention:             cfg.Retention,
+		OrderHistoryRetention: cfg.OrderHistoryRetention,
+		Now:                   time.Now,
+		Metrics:               metrics,
+		Logger:                logger.Named("outbox_relay"),
+	}
+}
+
+// Start runs rounds in the background until Stop is called
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		for {
+			published, err := r.RelayOnce(ctx)
+			if err != nil {
+				r.Logger.Error("outbox relay round failed", zap.Error(err))
+			}
+
+			// a full batch means there is probably more waiting
+			wait := r.PollInterval
+			if err == nil && published >= r.BatchSize {
+				wait = 0
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop lets the event being published finish, then stops the relay. Events still pending are published by the next
+// relay to run
+func (r *Relay) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RelayOnce runs a single round and returns how many events it published. Cancelling ctx ends the round after the
+// event in flight; the bookkeeping for events already handled is still written
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	// the claim may be a transaction, which database/sql would roll back the moment ctx is cancelled
+	roundCtx := context.WithoutCancel(ctx)
+	now := r.Now()
+	published := 0
+
+	claimed, err := r.Claimer.ClaimOutbox(roundCtx, func(roundCtx context.Context, outbox persistence.OutboxRepository) error {
+		events, err := outbox.FetchPendingEvents(roundCtx, now, r.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		held := map[string]bool{}
+		for _, event := range events {
+			if ctx.Err() != nil {
+				break
+			}
+			if held[event.OrderingKey()] {
+				continue
+			}
+
+			if err := r.publish(roundCtx, event); err != nil {
+				held[event.OrderingKey()] = true
+				retryAt := r.Now().Add(utils.Backoff(r.RetryBase, r.RetryMax, event.Attempts))
+				r.Metrics.OutboxPublishFailed(event.Type)
+				r.Logger.Warn("failed to publish event, will retry",
+					zap.Int64("event_id", event.Id),
+					zap.String("event_type", event.Type),
+					zap.String("ordering_key", event.OrderingKey()),
+					zap.Int("attempt", event.Attempts+1),
+					zap.Time("retry_at", retryAt),
+					zap.Error(err))
+				if err := outbox.MarkEventFailed(roundCtx, event.Id, err.Error(), retryAt); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := outbox.MarkEventPublished(roundCtx, event.Id, r.Now()); err != nil {
+				return err
+			}
+			r.Metrics.OutboxEventPublished(event.Type)
+			published++
+		}
+
+		return r.purge(roundCtx, outbox, now)
+	})
+	if !claimed && err == nil {
+		r.Logger.Debug("outbox is being relayed by another instance")
+	}
+	return published, err
+}
+
+func (r *Relay) publish(ctx context.Context, event model.OutboxEvent) error {
+	if r.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.PublishTimeout)
+		defer cancel()
+	}
+	return r.Publisher.Publish(ctx, event)
+}
+
+func (r *Relay) purge(ctx context.Context, outbox persistence.OutboxRepository, now time.Time) error {
+	if r.Retention <= 0 || now.Sub(r.lastPurge) < PURGE_INTERVAL {
+		return nil
+	}
+	purged, err := outbox.PurgePublishedEvents(ctx, now.Add(-r.Retention), HISTORY_AGGREGATE_TYPES)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		r.Logger.Info("purged published events", zap.Int64("count", purged), zap.Duration("retention", r.Retention))
+	}
+	if r.OrderHistoryRetention > 0 {
+		purged, err := outbox.PurgeOrderHistory(ctx, now.Add(-r.OrderHistoryRetention))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			r.Logger.Info("purged the history of finished orders", zap.Int64("count", purged),
+				zap.Duration("retention", r.OrderHistoryRetention))
+		}
+	}
+	r.lastPurge = now
+	return nil
+}
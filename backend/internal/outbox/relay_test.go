@@ -0,0 +1,248 @@
+package outbox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+)
+
+var testOutboxConfig = config.OutboxConfig{
+	PollInterval:   time.Millisecond,
+	BatchSize:      10,
+	RetryBase:      time.Second,
+	RetryMax:       time.Minute,
+	PublishTimeout: time.Second,
+	Retention:      time.Hour,
+}
+
+// recorder is a bus handler that remembers what it saw and fails events whose aggregate is in failing
+type recorder struct {
+	mu      sync.Mutex
+	seen    []string
+	failing map[string]bool
+}
+
+func (rec *recorder) handle(ctx context.Context, event model.OutboxEvent) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.failing[event.OrderingKey()] {
+		return errors.New("bus unavailable")
+	}
+	rec.seen = append(rec.seen, event.OrderingKey()+"/"+event.Type)
+	return nil
+}
+
+func recordEvents(t *testing.T, store *memory.Store, events ...[2]string) {
+	t.Helper()
+	for _, e := range events {
+		aggregateId := map[string]int{"a": 1, "b": 2}[e[0]]
+		event, err := model.NewOutboxEvent(model.AggregateOrder, aggregateId, e[1], map[string]string{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Repositories().Outbox.PersistEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestRelay(store *memory.Store, rec *recorder) (*Relay, *time.Time) {
+	bus := NewMemoryBus()
+	bus.Subscribe(rec.handle)
+	relay := NewRelay(store, bus, testOutboxConfig, nil, zap.NewNop())
+	now := time.Now()
+	relay.Now = func() time.Time { return now }
+	return relay, &now
+}
+
+func TestRelay_HoldsBackAnAggregateBehindAFailedEvent(t *testing.T) {
+	store := memory.NewStore()
+	recordEvents(t, store,
+		[2]string{"a", model.EventOrderCreated},
+		[2]string{"b", model.EventOrderCreated},
+		[2]string{"a", model.EventOrderStatusChanged},
+		[2]string{"b", model.EventOrderStatusChanged},
+	)
+	rec := &recorder{failing: map[string]bool{"order:1": true}}
+	relay, now := newTestRelay(store, rec)
+
+	published, err := relay.RelayOnce(context.Background())
+	if err != nil || published != 2 {
+		t.Fatalf("expected order 2's events to go through, got %d published and err %v", published, err)
+	}
+	if got := strings.Join(rec.seen, ","); got != "order:2/OrderCreated,order:2/OrderStatusChanged" {
+		t.Fatalf("unexpected deliveries %s", got)
+	}
+
+	// order 1 stays parked until its retry is due, even once the bus has recovered
+	rec.failing = nil
+	if published, _ := relay.RelayOnce(context.Background()); published != 0 {
+		t.Fatalf("expected nothing to be due before the backoff, got %d", published)
+	}
+
+	*now = now.Add(testOutboxConfig.RetryBase)
+	if published, err := relay.RelayOnce(context.Background()); err != nil || published != 2 {
+		t.Fatalf("expected order 1's events after the backoff, got %d and err %v", published, err)
+	}
+	if got := strings.Join(rec.seen[2:], ","); got != "order:1/OrderCreated,order:1/OrderStatusChanged" {
+		t.Errorf("expected order 1's events in order, got %s", got)
+	}
+
+	first := store.OutboxEvents()[0]
+	if first.Attempts != 2 || first.PublishedAt == nil || first.LastError != "" {
+		t.Errorf("expected the retried event to be published on its second attempt, got %+v", first)
+	}
+}
+
+func TestRelay_PurgesPublishedEvents(t *testing.T) {
+	store := memory.NewStore()
+	recordEvents(t, store, [2]string{"a", model.EventOrderCreated})
+	customerEvent, err := model.NewOutboxEvent(model.AggregateCustomer, 1, model.EventCustomerCreated, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Repositories().Outbox.PersistEvent(context.Background(), customerEvent); err != nil {
+		t.Fatal(err)
+	}
+	relay, now := newTestRelay(store, &recorder{})
+
+	relay.RelayOnce(context.Background())
+	if len(store.OutboxEvents()) != 2 {
+		t.Fatal("expected the events to be kept within the retention")
+	}
+
+	// order events are the history of the order event streams and outlive the retention
+	*now = now.Add(testOutboxConfig.Retention + PURGE_INTERVAL)
+	relay.RelayOnce(context.Background())
+	if events := store.OutboxEvents(); len(events) != 1 || events[0].AggregateType != model.AggregateOrder {
+		t.Errorf("expected only the customer event to be purged, got %+v", events)
+	}
+}
+
+func TestRelay_PurgesTheHistoryOfFinishedOrders(t *testing.T) {
+	store := memory.NewStore()
+	ctx := context.Background()
+	orders := store.Repositories().Orders
+	open, _ := orders.PersistCreateOrder(ctx, model.Order{CustomerId: 1, Status: model.OrderStatusPending})
+	delivered, _ := orders.PersistCreateOrder(ctx, model.Order{CustomerId: 1, Status: model.OrderStatusDelivered})
+	if open != 1 || delivered != 2 {
+		t.Fatalf("expected orders 1 and 2, got %d and %d", open, delivered)
+	}
+	recordEvents(t, store, [2]string{"a", model.EventOrderCreated}, [2]string{"b", model.EventOrderCreated}, [2]string{"b", model.EventOrderStatusChanged})
+	relay, now := newTestRelay(store, &recorder{})
+	relay.OrderHistoryRetention = 24 * time.Hour
+
+	relay.RelayOnce(ctx)
+	*now = now.Add(relay.OrderHistoryRetention - time.Minute)
+	relay.RelayOnce(ctx)
+	if len(store.OutboxEvents()) != 3 {
+		t.Fatal("expected the history of a finished order to be kept within the retention")
+	}
+
+	*now = now.Add(time.Minute + PURGE_INTERVAL)
+	relay.RelayOnce(ctx)
+	events := store.OutboxEvents()
+	if len(events) != 1 || events[0].AggregateId != "1" {
+		t.Errorf("expected only the open order's history to be left, got %+v", events)
+	}
+}
+
+func TestRelay_StartAndStop(t *testing.T) {
+	store := memory.NewStore()
+	recordEvents(t, store, [2]string{"a", model.EventOrderCreated})
+	delivered := make(chan struct{}, 1)
+	bus := NewMemoryBus()
+	bus.Subscribe(func(ctx context.Context, event model.OutboxEvent) error {
+		delivered <- struct{}{}
+		return nil
+	})
+
+	relay := NewRelay(store, bus, testOutboxConfig, nil, zap.NewNop())
+	relay.Start()
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("the running relay never published the event")
+	}
+	if err := relay.Stop(context.Background()); err != nil {
+		t.Errorf("Stop returned %v", err)
+	}
+}
+
+func TestPubSubPublisher(t *testing.T) {
+	var paths []string
+	var body struct {
+		Messages []struct {
+			Data        string            `json:"data"`
+			Attributes  map[string]string `json:"attributes"`
+			OrderingKey string            `json:"orderingKey"`
+		} `json:"messages"`
+	}
+	emulator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	}))
+	defer emulator.Close()
+
+	publisher := NewPubSubPublisher(emulator.URL, "codecart", "events", emulator.Client())
+	if err := publisher.EnsureTopic(context.Background()); err != nil {
+		t.Fatalf("expected an existing topic to be fine, got %v", err)
+	}
+	event := model.OutboxEvent{Id: 7, AggregateType: model.AggregateOrder, AggregateId: "3", Type: model.EventOrderCreated, Payload: json.RawMessage(`{"id":3}`)}
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish returned %v", err)
+	}
+
+	if want := "POST /v1/projects/codecart/topics/events:publish"; len(paths) != 2 || paths[1] != want {
+		t.Fatalf("expected %s, got %v", want, paths)
+	}
+	message := body.Messages[0]
+	data, _ := base64.StdEncoding.DecodeString(message.Data)
+	if message.OrderingKey != "order:3" || message.Attributes["event_id"] != "7" || !strings.Contains(string(data), `"payload":{"id":3}`) {
+		t.Errorf("unexpected message %+v with data %s", message, data)
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	status := http.StatusAccepted
+	var idempotencyKey, received string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	publisher := NewWebhookPublisher(receiver.URL, receiver.Client())
+	event := model.OutboxEvent{Id: 9, AggregateType: model.AggregateUser, AggregateId: "1", Type: model.EventUserCreated, Payload: json.RawMessage(`{}`)}
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish returned %v", err)
+	}
+	if idempotencyKey != "9" || !strings.Contains(received, `"type":"UserCreated"`) {
+		t.Errorf("unexpected delivery %q with key %q", received, idempotencyKey)
+	}
+
+	status = http.StatusInternalServerError
+	if err := publisher.Publish(context.Background(), event); err == nil {
+		t.Error("expected a 5xx to fail the publish")
+	}
+}
@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// WebhookPublisher POSTs each event's JSON to a single URL. Any 2xx answer counts as accepted. The event id is also
+// sent in the Idempotency-Key header so the receiver can drop redeliveries
+type WebhookPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+var _ Publisher = WebhookPublisher{}
+
+func NewWebhookPublisher(url string, client *http.Client) WebhookPublisher {
+	return WebhookPublisher{URL: url, Client: client}
+}
+
+func (wp WebhookPublisher) Publish(ctx context.Context, event model.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event %d: %w", event.Id, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wp.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(event.Id, 10))
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := wp.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -3,7 +3,6 @@ package persistence
 import (
 	"context"
 	"database/sql"
-	"log"
 
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/utils"
@@ -11,28 +10,34 @@ import (
 )
 
 type AddressPersistence struct {
-	DbHandle *sql.DB
+	DbHandle DBTX
 	Logger   *zap.Logger
 }
 
-func NewAddressPersistence(dbHandle *sql.DB) AddressPersistence {
+func NewAddressPersistence(dbHandle DBTX, logger *zap.Logger) AddressPersistence {
 	return AddressPersistence{
 		DbHandle: dbHandle,
+		Logger:   logger.Named("address_persistence"),
 	}
 }
 
+// returns a copy of the persistence that runs its statements against the given transaction
+func (ap AddressPersistence) WithTx(tx *sql.Tx) AddressPersistence {
+	ap.DbHandle = bindTx(ap.DbHandle, tx)
+	return ap
+}
+
 func (ap AddressPersistence) PersistCreateAddress(ctx context.Context, addressDomain model.Address) error {
 	zLog := ap.getZLog(ctx)
 	zLog.Debug("Entered PersistCreateAddress")
 	query := `
-		INSERT INTO addresses (id, user_id, street_address, city, state, zip_code, country, is_default, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO addresses (user_id, street_address, city, state, zip_code, country, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	_, err := ap.DbHandle.ExecContext(
 		ctx,
 		query,
-		addressDomain.Id,
 		addressDomain.UserId,
 		addressDomain.StreetAddress,
 		addressDomain.City,
@@ -44,13 +49,13 @@ func (ap AddressPersistence) PersistCreateAddress(ctx context.Context, addressDo
 		addressDomain.UpdatedAt,
 	)
 	if err != nil {
-		log.Printf("Error in PersistCreateAddress, %s", err)
+		zLog.Error("ExecContext failed for PersistCreateAddress", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (ap AddressPersistence) FetchAllAddresses(ctx context.Context) (*sql.Rows, error) {
+func (ap AddressPersistence) FetchAllAddresses(ctx context.Context) ([]model.Address, error) {
 	zLog := ap.getZLog(ctx)
 	zLog.Debug("Entered FetchAllAddresses")
 
@@ -64,7 +69,35 @@ func (ap AddressPersistence) FetchAllAddresses(ctx context.Context) (*sql.Rows,
 		zLog.Error("QueryContext failed for FetchAllAddresses", zap.Error(err))
 		return nil, err
 	}
-	return rows, nil
+	defer rows.Close()
+
+	addresses := make([]model.Address, 0)
+
+	for rows.Next() {
+		var addr model.Address
+		if err := rows.Scan(
+			&addr.StreetAddress,
+			&addr.City,
+			&addr.State,
+			&addr.ZipCode,
+			&addr.Country,
+			&addr.UserId,
+			&addr.Id,
+			&addr.IsDefault,
+			&addr.CreatedAt,
+			&addr.UpdatedAt,
+		); err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		addresses = append(addresses, addr)
+	}
+
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return addresses, nil
 }
 
 func (ap AddressPersistence) getZLog(ctx context.Context) *zap.Logger {
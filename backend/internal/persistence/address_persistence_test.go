@@ -0,0 +1,48 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/testutil/pgtest"
+	"go.uber.org/zap"
+)
+
+func TestAddressPersistence_CreateAndFetch(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	ap := NewAddressPersistence(db, zap.NewNop())
+	user := pgtest.CreateUser(t, db)
+	existing := pgtest.CreateAddress(t, db, func(a *model.Address) { a.UserId = user.Id })
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	newAddress := model.Address{
+		UserId:        user.Id,
+		StreetAddress: "2 second st",
+		City:          "shelbyville",
+		State:         "il",
+		ZipCode:       "62565",
+		Country:       "us",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	// creating twice proves ids come from the sequence rather than from the domain model's zero value
+	for range 2 {
+		if err := ap.PersistCreateAddress(ctx, newAddress); err != nil {
+			t.Fatalf("PersistCreateAddress returned error: %v", err)
+		}
+	}
+
+	addresses, err := ap.FetchAllAddresses(ctx)
+	if err != nil {
+		t.Fatalf("FetchAllAddresses returned error: %v", err)
+	}
+	if len(addresses) != 3 {
+		t.Fatalf("expected 3 addresses, got %d", len(addresses))
+	}
+	if addresses[0].Id != existing.Id || addresses[0].City != "springfield" {
+		t.Errorf("unexpected first address: %+v", addresses[0])
+	}
+}
@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,48 +13,60 @@ import (
 )
 
 type CustomerPersistence struct {
-	DbHandle *sql.DB
+	DbHandle DBTX
 	Logger   *zap.Logger
 }
 
-func NewCustomerPersistence(dbHandle *sql.DB, logger *zap.Logger) CustomerPersistence {
+func NewCustomerPersistence(dbHandle DBTX, logger *zap.Logger) CustomerPersistence {
 	return CustomerPersistence{
 		DbHandle: dbHandle,
 		Logger:   logger.Named("customer_persistence"),
 	}
 }
 
-func (cp CustomerPersistence) PersistCreateCustomer(ctx context.Context, customerDomain model.Customer) error {
+// returns a copy of the persistence that runs its statements against the given transaction
+func (cp CustomerPersistence) WithTx(tx *sql.Tx) CustomerPersistence {
+	cp.DbHandle = bindTx(cp.DbHandle, tx)
+	return cp
+}
+
+// PersistCreateCustomer inserts the customer and returns the id it was given
+func (cp CustomerPersistence) PersistCreateCustomer(ctx context.Context, customerDomain model.Customer) (int, error) {
 	zLog := cp.getZLog(ctx)
 	zLog.Debug("entered PersistCreateCustomer")
 	query := `
-		INSERT INTO customers (first_name, last_name, phone_number, email, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO customers (first_name, last_name, phone_number, email, locale, email_opt_out, sms_opt_in, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
 	`
 
-	_, err := cp.DbHandle.ExecContext(
+	var id int
+	err := cp.DbHandle.QueryRowContext(
 		ctx,
 		query,
 		customerDomain.FirstName,
 		customerDomain.LastName,
 		customerDomain.PhoneNumber,
 		customerDomain.Email,
+		customerDomain.Locale,
+		customerDomain.EmailOptOut,
+		customerDomain.SMSOptIn,
 		customerDomain.CreatedAt,
 		customerDomain.UpdatedAt,
-	)
+	).Scan(&id)
 	if err != nil {
-		zLog.Error("ExecContext failed for PersistCreateCustomer", zap.Error(err))
-		return err
+		zLog.Error("QueryRowContext failed for PersistCreateCustomer", zap.Error(err))
+		return 0, err
 	}
 
-	return nil
+	return id, nil
 }
 
-func (cp CustomerPersistence) FetchAllCustomers(ctx context.Context) (*sql.Rows, error) {
+func (cp CustomerPersistence) FetchAllCustomers(ctx context.Context) ([]model.Customer, error) {
 	zLog := cp.getZLog(ctx)
-	zLog.Debug("entered FetchAllCustomersById")
+	zLog.Debug("entered FetchAllCustomers")
 	query := `
-		SELECT id, first_name, last_name, phone_number, email, created_at, updated_at
+		SELECT ` + customerColumns + `
 		FROM customers
 	`
 
@@ -62,7 +75,39 @@ func (cp CustomerPersistence) FetchAllCustomers(ctx context.Context) (*sql.Rows,
 		zLog.Error("QueryContext failed for FetchAllCustomers", zap.Error(err))
 		return nil, err
 	}
-	return rows, nil
+	defer rows.Close()
+
+	customers := make([]model.Customer, 0)
+
+	for rows.Next() {
+		cust, err := scanCustomer(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		customers = append(customers, cust)
+	}
+
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (cp CustomerPersistence) FetchCustomerById(ctx context.Context, id int) (model.Customer, error) {
+	zLog := cp.getZLog(ctx)
+	zLog.Debug("entered FetchCustomerById")
+
+	customer, err := scanCustomer(cp.DbHandle.QueryRowContext(ctx, `SELECT `+customerColumns+` FROM customers WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Customer{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("scan operation failed for FetchCustomerById", zap.Error(err))
+		return model.Customer{}, err
+	}
+	return customer, nil
 }
 
 func (cp CustomerPersistence) PersistDeleteCustomerById(ctx context.Context, id int) error {
@@ -85,10 +130,13 @@ func (cp CustomerPersistence) PersistUpdateCustomerById(ctx context.Context, id
 	zLog.Debug("entered PersistUpdateCustomerById")
 
 	allowedFields := map[string]bool{
-		"first_name":   true,
-		"last_name":    true,
-		"email":        true,
-		"phone_number": true,
+		"first_name":    true,
+		"last_name":     true,
+		"email":         true,
+		"phone_number":  true,
+		"locale":        true,
+		"email_opt_out": true,
+		"sms_opt_in":    true,
 	}
 
 	query := "UPDATE customers SET "
@@ -129,6 +177,41 @@ func (cp CustomerPersistence) PersistUpdateCustomerById(ctx context.Context, id
 	return nil
 }
 
+// PersistSMSOptInByPhoneNumber opts every customer with the given phone number in or out of texts and returns how many
+// there were. It is how STOP and START replies are applied, which only carry the sender's number
+func (cp CustomerPersistence) PersistSMSOptInByPhoneNumber(ctx context.Context, phoneNumber string, optIn bool) (int64, error) {
+	zLog := cp.getZLog(ctx)
+	zLog.Debug("entered PersistSMSOptInByPhoneNumber")
+
+	result, err := cp.DbHandle.ExecContext(ctx,
+		`UPDATE customers SET sms_opt_in = $1, updated_at = $2 WHERE phone_number = $3`,
+		optIn, time.Now().UTC(), phoneNumber)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistSMSOptInByPhoneNumber", zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const customerColumns = `id, first_name, last_name, phone_number, email, locale, email_opt_out, sms_opt_in, created_at, updated_at`
+
+func scanCustomer(row rowScanner) (model.Customer, error) {
+	var customer model.Customer
+	err := row.Scan(
+		&customer.Id,
+		&customer.FirstName,
+		&customer.LastName,
+		&customer.PhoneNumber,
+		&customer.Email,
+		&customer.Locale,
+		&customer.EmailOptOut,
+		&customer.SMSOptIn,
+		&customer.CreatedAt,
+		&customer.UpdatedAt,
+	)
+	return customer, err
+}
+
 func (cp CustomerPersistence) getZLog(ctx context.Context) *zap.Logger {
 	return utils.FromContext(ctx, cp.Logger)
 }
@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/testutil/pgtest"
+	"go.uber.org/zap"
+)
+
+func TestCustomerPersistence_CreateFetchUpdateDelete(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	cp := NewCustomerPersistence(db, zap.NewNop())
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if _, err := cp.PersistCreateCustomer(ctx, model.Customer{
+		FirstName:   "ada",
+		LastName:    "lovelace",
+		PhoneNumber: "+15555550100",
+		Email:       "ada@example.com",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}); err != nil {
+		t.Fatalf("PersistCreateCustomer returned error: %v", err)
+	}
+
+	customers, err := cp.FetchAllCustomers(ctx)
+	if err != nil {
+		t.Fatalf("FetchAllCustomers returned error: %v", err)
+	}
+	if len(customers) != 1 || customers[0].Email != "ada@example.com" {
+		t.Fatalf("unexpected customers: %+v", customers)
+	}
+	id := customers[0].Id
+
+	if err := cp.PersistUpdateCustomerById(ctx, id, map[string]any{"last_name": "byron"}); err != nil {
+		t.Fatalf("PersistUpdateCustomerById returned error: %v", err)
+	}
+	customers, _ = cp.FetchAllCustomers(ctx)
+	if customers[0].LastName != "byron" || customers[0].FirstName != "ada" {
+		t.Errorf("unexpected customer after update: %+v", customers[0])
+	}
+
+	if err := cp.PersistDeleteCustomerById(ctx, id); err != nil {
+		t.Fatalf("PersistDeleteCustomerById returned error: %v", err)
+	}
+	customers, _ = cp.FetchAllCustomers(ctx)
+	if len(customers) != 0 {
+		t.Errorf("expected no customers after delete, got %+v", customers)
+	}
+}
+
+func TestUserPersistence_PersistCreateUser(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	up := NewUserPersistence(db, zap.NewNop())
+	customer := pgtest.CreateCustomer(t, db)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	user := model.User{
+		Email:      "user@example.com",
+		CustomerId: customer.Id,
+		GCAuthId:   "gc-auth-1",
+		IsActive:   true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if _, err := up.PersistCreateUser(ctx, user); err != nil {
+		t.Fatalf("PersistCreateUser returned error: %v", err)
+	}
+
+	// gc_auth_id identifies the user with the identity provider and must stay unique
+	user.Email = "other@example.com"
+	if _, err := up.PersistCreateUser(ctx, user); err == nil {
+		t.Fatal("expected duplicate gc_auth_id to be rejected")
+	}
+}
@@ -0,0 +1,123 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DBTX is the subset of *sql.DB that the persistence structs use. *sql.Tx satisfies it as well, which lets the same
+// persistence code run either directly against the pool or inside a transaction started by the UnitOfWork
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// dialectDB rebinds every query for its dialect before handing it to the wrapped handle, which lets the persistence
+// structs keep their postgres-flavoured SQL regardless of the engine underneath
+type dialectDB struct {
+	DBTX
+	dialect dialect.Dialect
+}
+
+func (d dialectDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DBTX.ExecContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+func (d dialectDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DBTX.QueryContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+func (d dialectDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DBTX.QueryRowContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+// WithDialect wraps a handle so the postgres queries in this package run against the given dialect. Postgres handles
+// are returned as is
+func WithDialect(dbHandle DBTX, d dialect.Dialect) DBTX {
+	if d == dialect.Postgres {
+		return dbHandle
+	}
+	return dialectDB{DBTX: dbHandle, dialect: d}
+}
+
+// txBinder is implemented by the DBTX wrappers in this package so a transaction can be wrapped in the same layers as
+// the pool it was started from
+type txBinder interface {
+	bindTx(tx *sql.Tx) DBTX
+}
+
+func (d dialectDB) bindTx(tx *sql.Tx) DBTX {
+	return dialectDB{DBTX: bindTx(d.DBTX, tx), dialect: d.dialect}
+}
+
+// bindTx wraps tx the same way current is wrapped, so transaction-scoped copies keep speaking the right dialect and
+// keep being traced
+func bindTx(current DBTX, tx *sql.Tx) DBTX {
+	if b, ok := current.(txBinder); ok {
+		return b.bindTx(tx)
+	}
+	return tx
+}
+
+// tracedDB starts a client span around every statement. It wraps the handle before dialectDB does, so spans record
+// the SQL exactly as the driver received it
+type tracedDB struct {
+	DBTX
+	system attribute.KeyValue
+}
+
+// WithTracing wraps a handle so every statement gets its own span under the caller's span
+func WithTracing(dbHandle DBTX, d dialect.Dialect) DBTX {
+	system := semconv.DBSystemNamePostgreSQL
+	if d == dialect.SQLite {
+		system = semconv.DBSystemNameSQLite
+	}
+	return tracedDB{DBTX: dbHandle, system: system}
+}
+
+func (t tracedDB) bindTx(tx *sql.Tx) DBTX {
+	return tracedDB{DBTX: bindTx(t.DBTX, tx), system: t.system}
+}
+
+func (t tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracing.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.system, semconv.DBOperationName(operation), semconv.DBQueryText(query)),
+	)
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	result, err := t.DBTX.ExecContext(ctx, query, args...)
+	tracing.RecordError(span, err)
+	return result, err
+}
+
+// QueryContext's span covers executing the query, not iterating the rows
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	rows, err := t.DBTX.QueryContext(ctx, query, args...)
+	tracing.RecordError(span, err)
+	return rows, err
+}
+
+// QueryRowContext defers its error to Scan, which happens after the span has ended, so only the timing is recorded
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	return t.DBTX.QueryRowContext(ctx, query, args...)
+}
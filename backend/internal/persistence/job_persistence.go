@@ -0,0 +1,296 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type JobPersistence struct {
+	DbHandle DBTX
+	Dialect  dialect.Dialect
+	Logger   *zap.Logger
+}
+
+func NewJobPersistence(dbHandle DBTX, d dialect.Dialect, logger *zap.Logger) JobPersistence {
+	return JobPersistence{
+		DbHandle: dbHandle,
+		Dialect:  d,
+		Logger:   logger,
+	}
+}
+
+// returns a copy of the persistence that runs its statements against the given transaction
+func (jp JobPersistence) WithTx(tx *sql.Tx) JobPersistence {
+	jp.DbHandle = bindTx(jp.DbHandle, tx)
+	return jp
+}
+
+const jobColumns = `id, type, payload, status, attempts, max_attempts, run_at, locked_until, COALESCE(last_error, ''),
+	COALESCE(unique_key, ''), created_at, updated_at, completed_at`
+
+// PersistEnqueueJob inserts the job and returns the id it was given. created is false, and the job left out, when a
+// job with the same unique key already exists. Call it through a UnitOfWork to enqueue work together with the change
+// that calls for it
+func (jp JobPersistence) PersistEnqueueJob(ctx context.Context, job model.Job) (id int64, created bool, err error) {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PersistEnqueueJob")
+
+	var uniqueKey any
+	if job.UniqueKey != "" {
+		uniqueKey = job.UniqueKey
+	}
+	payload := job.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	}
+	query := `
+		INSERT INTO jobs (type, payload, status, max_attempts, run_at, unique_key, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING id
+	`
+	err = jp.DbHandle.QueryRowContext(
+		ctx,
+		query,
+		job.Type,
+		jsonParam(payload),
+		model.JobPending,
+		job.MaxAttempts,
+		job.RunAt.UTC(),
+		uniqueKey,
+		job.CreatedAt.UTC(),
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		zLog.Error("QueryRowContext failed for PersistEnqueueJob", zap.Error(err))
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// ClaimJobs leases up to limit jobs of the given types until leaseUntil and returns them, oldest due first. A job is
+// claimable when it is pending and due, or running with a lease that ran out because its worker died. Every claim
+// counts as an attempt. Rows other workers are claiming at the same moment are skipped rather than waited for
+func (jp JobPersistence) ClaimJobs(ctx context.Context, types []string, now, leaseUntil time.Time, limit int) ([]model.Job, error) {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered ClaimJobs")
+
+	if len(types) == 0 {
+		return []model.Job{}, nil
+	}
+	args := []any{now.UTC(), leaseUntil.UTC(), limit, model.JobPending, model.JobRunning}
+	placeholders := make([]string, len(types))
+	for i, jobType := range types {
+		args = append(args, jobType)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	query := `
+		UPDATE jobs SET status = $5, attempts = attempts + 1, locked_until = $2, updated_at = $1
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE ((status = $4 AND run_at <= $1) OR (status = $5 AND locked_until <= $1))
+				AND type IN (` + strings.Join(placeholders, ", ") + `)
+			ORDER BY run_at, id
+			LIMIT $3
+			` + jp.Dialect.SkipLocked() + `
+		)
+		RETURNING ` + jobColumns
+
+	jobs, err := jp.queryJobs(ctx, query, args...)
+	if err != nil {
+		zLog.Error("QueryContext failed for ClaimJobs", zap.Error(err))
+		return nil, err
+	}
+	// RETURNING makes no promise about order
+	slices.SortFunc(jobs, func(a, b model.Job) int {
+		if c := a.RunAt.Compare(b.RunAt); c != 0 {
+			return c
+		}
+		return int(a.Id - b.Id)
+	})
+	return jobs, nil
+}
+
+// PersistJobSucceeded finishes the attempt ClaimJobs started. attempts is the job's count as claimed; it returns
+// ErrNotFound when the lease ran out and another worker has claimed the job since
+func (jp JobPersistence) PersistJobSucceeded(ctx context.Context, id int64, attempts int, at time.Time) error {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PersistJobSucceeded")
+
+	query := `
+		UPDATE jobs SET status = $1, locked_until = NULL, last_error = NULL, completed_at = $2, updated_at = $2
+		WHERE id = $3 AND status = $4 AND attempts = $5
+	`
+	result, err := jp.DbHandle.ExecContext(ctx, query, model.JobSucceeded, at.UTC(), id, model.JobRunning, attempts)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistJobSucceeded", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PersistJobFailed records a failed attempt. The job runs again at retryAt, or, when dead is true, waits to be retried
+// by hand. Like PersistJobSucceeded it returns ErrNotFound when the lease was lost
+func (jp JobPersistence) PersistJobFailed(ctx context.Context, id int64, attempts int, lastError string, dead bool, retryAt, at time.Time) error {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PersistJobFailed")
+
+	status, runAt, completedAt := model.JobPending, any(retryAt.UTC()), any(nil)
+	if dead {
+		status, completedAt = model.JobDead, at.UTC()
+		runAt = nil
+	}
+	query := `
+		UPDATE jobs SET status = $1, run_at = COALESCE($2, run_at), locked_until = NULL, last_error = $3,
+			completed_at = $4, updated_at = $5
+		WHERE id = $6 AND status = $7 AND attempts = $8
+	`
+	result, err := jp.DbHandle.ExecContext(ctx, query, status, runAt, lastError, completedAt, at.UTC(), id, model.JobRunning, attempts)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistJobFailed", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PersistJobSnoozed returns a running job to the queue, due at runAt, and gives back the attempt it was claimed with
+func (jp JobPersistence) PersistJobSnoozed(ctx context.Context, id int64, attempts int, runAt, at time.Time) error {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PersistJobSnoozed")
+
+	query := `
+		UPDATE jobs SET status = $1, run_at = $2, attempts = attempts - 1, locked_until = NULL, updated_at = $3
+		WHERE id = $4 AND status = $5 AND attempts = $6
+	`
+	result, err := jp.DbHandle.ExecContext(ctx, query, model.JobPending, runAt.UTC(), at.UTC(), id, model.JobRunning, attempts)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistJobSnoozed", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// FetchJobs returns up to limit jobs, newest first. status and jobType narrow the list when not empty
+func (jp JobPersistence) FetchJobs(ctx context.Context, status model.JobStatus, jobType string, limit int) ([]model.Job, error) {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered FetchJobs")
+
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	jobs, err := jp.queryJobs(ctx, query, status, jobType, limit)
+	if err != nil {
+		zLog.Error("QueryContext failed for FetchJobs", zap.Error(err))
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (jp JobPersistence) FetchJobById(ctx context.Context, id int64) (model.Job, error) {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered FetchJobById")
+
+	job, err := scanJob(jp.DbHandle.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Job{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("scan operation failed for FetchJobById", zap.Error(err))
+		return model.Job{}, err
+	}
+	return job, nil
+}
+
+// PersistRetryJob makes a job that is not running due at with a fresh attempt budget. It returns ErrNotFound for
+// unknown jobs and for jobs a worker holds at the moment
+func (jp JobPersistence) PersistRetryJob(ctx context.Context, id int64, at time.Time) error {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PersistRetryJob")
+
+	query := `
+		UPDATE jobs SET status = $1, attempts = 0, run_at = $2, locked_until = NULL, completed_at = NULL, updated_at = $2
+		WHERE id = $3 AND status <> $4
+	`
+	result, err := jp.DbHandle.ExecContext(ctx, query, model.JobPending, at.UTC(), id, model.JobRunning)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistRetryJob", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PurgeSucceededJobs deletes jobs that succeeded before the cutoff and returns how many went. Dead jobs are kept until
+// someone retries them
+func (jp JobPersistence) PurgeSucceededJobs(ctx context.Context, before time.Time) (int64, error) {
+	zLog := jp.getZLog(ctx)
+	zLog.Debug("entered PurgeSucceededJobs")
+
+	result, err := jp.DbHandle.ExecContext(ctx, `DELETE FROM jobs WHERE status = $1 AND completed_at < $2`, model.JobSucceeded, before.UTC())
+	if err != nil {
+		zLog.Error("ExecContext failed for PurgeSucceededJobs", zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (jp JobPersistence) queryJobs(ctx context.Context, query string, args ...any) ([]model.Job, error) {
+	rows, err := jp.DbHandle.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]model.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanJob(row rowScanner) (model.Job, error) {
+	var job model.Job
+	var payload []byte
+	err := row.Scan(
+		&job.Id,
+		&job.Type,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LockedUntil,
+		&job.LastError,
+		&job.UniqueKey,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.CompletedAt,
+	)
+	job.Payload = payload
+	return job, err
+}
+
+func (jp JobPersistence) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, jp.Logger).Named("job_persistence")
+}
@@ -0,0 +1,1160 @@
+// Package memory is an in-memory implementation of the persistence repository interfaces. It exists so the service
+// layer can be exercised without a running postgres instance and is not meant for production use.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+)
+
+type Store struct {
+	mu        sync.Mutex
+	txMu      sync.Mutex
+	failWith  error
+	lastId    int
+	users     map[int]model.User
+	customers map[int]model.Customer
+	addresses map[int]model.Address
+	orders    map[int]model.Order
+
+	lastEventId int64
+	events      []model.OutboxEvent
+
+	subscriptions  map[int]model.WebhookSubscription
+	lastDeliveryId int64
+	deliveries     []model.WebhookDelivery
+
+	lastJobId int64
+	jobs      []model.Job
+
+	lastSMSId   int64
+	smsMessages []model.SMSMessage
+}
+
+var (
+	_ persistence.Transactor         = (*Store)(nil)
+	_ persistence.UserRepository     = UserRepository{}
+	_ persistence.CustomerRepository = CustomerRepository{}
+	_ persistence.AddressRepository  = AddressRepository{}
+	_ persistence.OrderRepository    = OrderRepository{}
+	_ persistence.OutboxRepository   = OutboxRepository{}
+	_ persistence.OutboxClaimer      = (*Store)(nil)
+	_ persistence.WebhookRepository  = WebhookRepository{}
+	_ persistence.JobRepository      = JobRepository{}
+	_ persistence.SMSRepository      = SMSRepository{}
+)
+
+func NewStore() *Store {
+	return &Store{
+		users:     map[int]model.User{},
+		customers: map[int]model.Customer{},
+		addresses: map[int]model.Address{},
+		orders:    map[int]model.Order{},
+
+		subscriptions: map[int]model.WebhookSubscription{},
+	}
+}
+
+// FailWith makes every subsequent repository call return err, which lets tests drive the service error paths.
+// Passing nil restores normal behaviour
+func (s *Store) FailWith(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failWith = err
+}
+
+func (s *Store) Repositories() persistence.Repositories {
+	return persistence.Repositories{
+		Users:     UserRepository{store: s},
+		Customers: CustomerRepository{store: s},
+		Addresses: AddressRepository{store: s},
+		Orders:    OrderRepository{store: s},
+		Outbox:    OutboxRepository{store: s},
+		Webhooks:  WebhookRepository{store: s},
+		Jobs:      JobRepository{store: s},
+		SMS:       SMSRepository{store: s},
+	}
+}
+
+// Do mirrors persistence.UnitOfWork: transactions are serialized, and if fn returns an error every change made while
+// it ran is discarded. Writes made outside of Do while a transaction is in flight are discarded with it as well
+func (s *Store) Do(ctx context.Context, fn func(ctx context.Context, repos persistence.Repositories) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.snapshot()
+	s.mu.Unlock()
+
+	if err := fn(ctx, s.Repositories()); err != nil {
+		s.mu.Lock()
+		s.restore(snapshot)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+type storeSnapshot struct {
+	lastId      int
+	users       map[int]model.User
+	customers   map[int]model.Customer
+	addresses   map[int]model.Address
+	orders      map[int]model.Order
+	lastEventId int64
+	events      []model.OutboxEvent
+
+	subscriptions  map[int]model.WebhookSubscription
+	lastDeliveryId int64
+	deliveries     []model.WebhookDelivery
+
+	lastJobId int64
+	jobs      []model.Job
+
+	lastSMSId   int64
+	smsMessages []model.SMSMessage
+}
+
+func (s *Store) snapshot() storeSnapshot {
+	return storeSnapshot{
+		lastId:    s.lastId,
+		users:     maps.Clone(s.users),
+		customers: maps.Clone(s.customers),
+		addresses: maps.Clone(s.addresses),
+		orders:    maps.Clone(s.orders),
+
+		lastEventId: s.lastEventId,
+		events:      slices.Clone(s.events),
+
+		subscriptions:  maps.Clone(s.subscriptions),
+		lastDeliveryId: s.lastDeliveryId,
+		deliveries:     slices.Clone(s.deliveries),
+
+		lastJobId: s.lastJobId,
+		jobs:      slices.Clone(s.jobs),
+
+		lastSMSId:   s.lastSMSId,
+		smsMessages: slices.Clone(s.smsMessages),
+	}
+}
+
+func (s *Store) restore(snap storeSnapshot) {
+	s.lastId = snap.lastId
+	s.users = snap.users
+	s.customers = snap.customers
+	s.addresses = snap.addresses
+	s.orders = snap.orders
+	s.lastEventId = snap.lastEventId
+	s.events = snap.events
+	s.subscriptions = snap.subscriptions
+	s.lastDeliveryId = snap.lastDeliveryId
+	s.deliveries = snap.deliveries
+	s.lastJobId = snap.lastJobId
+	s.jobs = snap.jobs
+	s.lastSMSId = snap.lastSMSId
+	s.smsMessages = snap.smsMessages
+}
+
+// ids are shared across tables, which is fine for tests and makes accidental cross-table lookups fail loudly
+func (s *Store) nextId() int {
+	s.lastId++
+	return s.lastId
+}
+
+// returns the map's values ordered by id, matching the insertion order a serial primary key would give
+func sortedValues[T any](m map[int]T) []T {
+	values := make([]T, 0, len(m))
+	for _, id := range slices.Sorted(maps.Keys(m)) {
+		values = append(values, m[id])
+	}
+	return values
+}
+
+// ---------- USERS ----------
+
+type UserRepository struct {
+	store *Store
+}
+
+func (ur UserRepository) PersistCreateUser(ctx context.Context, userDomain model.User) (int, error) {
+	s := ur.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	userDomain.Id = s.nextId()
+	s.users[userDomain.Id] = userDomain
+	return userDomain.Id, nil
+}
+
+func (ur UserRepository) FetchUserByAuthId(ctx context.Context, gcAuthId string) (model.User, error) {
+	s := ur.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.User{}, s.failWith
+	}
+
+	for _, user := range s.users {
+		if user.GCAuthId == gcAuthId {
+			return user, nil
+		}
+	}
+	return model.User{}, persistence.ErrNotFound
+}
+
+// ---------- CUSTOMERS ----------
+
+type CustomerRepository struct {
+	store *Store
+}
+
+func (cr CustomerRepository) PersistCreateCustomer(ctx context.Context, customerDomain model.Customer) (int, error) {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	customerDomain.Id = s.nextId()
+	s.customers[customerDomain.Id] = customerDomain
+	return customerDomain.Id, nil
+}
+
+func (cr CustomerRepository) FetchAllCustomers(ctx context.Context) ([]model.Customer, error) {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	return sortedValues(s.customers), nil
+}
+
+func (cr CustomerRepository) FetchCustomerById(ctx context.Context, id int) (model.Customer, error) {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.Customer{}, s.failWith
+	}
+
+	customer, ok := s.customers[id]
+	if !ok {
+		return model.Customer{}, persistence.ErrNotFound
+	}
+	return customer, nil
+}
+
+func (cr CustomerRepository) PersistDeleteCustomerById(ctx context.Context, id int) error {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	delete(s.customers, id)
+	return nil
+}
+
+func (cr CustomerRepository) PersistUpdateCustomerById(ctx context.Context, id int, updates map[string]any) error {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	customer, ok := s.customers[id]
+	if !ok {
+		// an UPDATE that matches no rows is not an error in postgres either
+		return nil
+	}
+
+	for field, value := range updates {
+		var ok bool
+		switch field {
+		case "first_name":
+			customer.FirstName, ok = value.(string)
+		case "last_name":
+			customer.LastName, ok = value.(string)
+		case "email":
+			customer.Email, ok = value.(string)
+		case "phone_number":
+			customer.PhoneNumber, ok = value.(string)
+		case "locale":
+			customer.Locale, ok = value.(string)
+		case "email_opt_out":
+			customer.EmailOptOut, ok = value.(bool)
+		case "sms_opt_in":
+			customer.SMSOptIn, ok = value.(bool)
+		default:
+			return fmt.Errorf("invalid field: %s", field)
+		}
+		if !ok {
+			return fmt.Errorf("invalid value for field %s: %v", field, value)
+		}
+	}
+	customer.UpdatedAt = time.Now()
+
+	s.customers[id] = customer
+	return nil
+}
+
+func (cr CustomerRepository) PersistSMSOptInByPhoneNumber(ctx context.Context, phoneNumber string, optIn bool) (int64, error) {
+	s := cr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	var updated int64
+	for id, customer := range s.customers {
+		if customer.PhoneNumber == phoneNumber {
+			customer.SMSOptIn = optIn
+			customer.UpdatedAt = time.Now()
+			s.customers[id] = customer
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// ---------- ADDRESSES ----------
+
+type AddressRepository struct {
+	store *Store
+}
+
+func (ar AddressRepository) PersistCreateAddress(ctx context.Context, addressDomain model.Address) error {
+	s := ar.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	addressDomain.Id = s.nextId()
+	s.addresses[addressDomain.Id] = addressDomain
+	return nil
+}
+
+func (ar AddressRepository) FetchAllAddresses(ctx context.Context) ([]model.Address, error) {
+	s := ar.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	return sortedValues(s.addresses), nil
+}
+
+// ---------- ORDERS ----------
+
+type OrderRepository struct {
+	store *Store
+}
+
+func (or OrderRepository) PersistCreateOrder(ctx context.Context, orderDomain model.Order) (int, error) {
+	s := or.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	orderDomain.Id = s.nextId()
+	s.orders[orderDomain.Id] = orderDomain
+	return orderDomain.Id, nil
+}
+
+func (or OrderRepository) FetchAllOrders(ctx context.Context) ([]model.Order, error) {
+	s := or.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	return sortedValues(s.orders), nil
+}
+
+func (or OrderRepository) FetchOrderById(ctx context.Context, id int) (model.Order, error) {
+	s := or.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.Order{}, s.failWith
+	}
+
+	order, ok := s.orders[id]
+	if !ok {
+		return model.Order{}, persistence.ErrNotFound
+	}
+	return order, nil
+}
+
+func (or OrderRepository) PersistUpdateOrderById(ctx context.Context, id int, updates map[string]any) error {
+	s := or.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	order, ok := s.orders[id]
+	if !ok {
+		return nil
+	}
+
+	for field, value := range updates {
+		var ok bool
+		switch field {
+		case "status":
+			order.Status, ok = value.(model.OrderStatus)
+		case "total_price":
+			order.TotalPrice, ok = value.(float64)
+		case "delivery_address":
+			order.DeliveryAddress, ok = value.(json.RawMessage)
+		case "address_id":
+			order.AddressId, ok = value.(int)
+		case "order_type":
+			order.OrderType, ok = value.(model.OrderType)
+		case "picker":
+			order.Picker, ok = value.(string)
+		case "driver":
+			order.Driver, ok = value.(string)
+		case "estimated_ready_at":
+			var eta time.Time
+			eta, ok = value.(time.Time)
+			order.EstimatedReadyAt = &eta
+		default:
+			return fmt.Errorf("invalid field: %s", field)
+		}
+		if !ok {
+			return fmt.Errorf("invalid value for field %s: %v", field, value)
+		}
+	}
+	order.UpdatedAt = time.Now()
+
+	s.orders[id] = order
+	return nil
+}
+
+// ---------- OUTBOX ----------
+
+type OutboxRepository struct {
+	store *Store
+}
+
+// ClaimOutbox always claims: a single process owns the store
+func (s *Store) ClaimOutbox(ctx context.Context, fn func(ctx context.Context, outbox persistence.OutboxRepository) error) (bool, error) {
+	return true, fn(ctx, OutboxRepository{store: s})
+}
+
+// OutboxEvents returns every event recorded so far, published or not, in the order they were recorded
+func (s *Store) OutboxEvents() []model.OutboxEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.events)
+}
+
+func (obr OutboxRepository) PersistEvent(ctx context.Context, event model.OutboxEvent) error {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	s.lastEventId++
+	event.Id = s.lastEventId
+	s.events = append(s.events, event)
+	return nil
+}
+
+// FetchPendingEvents follows the SQL version: due events oldest first, skipping any queued behind an earlier event of
+// the same aggregate that is waiting for a retry
+func (obr OutboxRepository) FetchPendingEvents(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	held := map[string]bool{}
+	pending := make([]model.OutboxEvent, 0)
+	for _, event := range s.events {
+		if event.PublishedAt != nil {
+			continue
+		}
+		if held[event.OrderingKey()] || event.AvailableAt.After(now) {
+			held[event.OrderingKey()] = true
+			continue
+		}
+		if len(pending) < limit {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+func (obr OutboxRepository) FetchEventsByAggregate(ctx context.Context, aggregateType, aggregateId string, afterId int64, limit int) ([]model.OutboxEvent, error) {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	events := make([]model.OutboxEvent, 0)
+	for _, event := range s.events {
+		if event.AggregateType == aggregateType && event.AggregateId == aggregateId && event.Id > afterId && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (obr OutboxRepository) MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) error {
+	return obr.update(id, func(event *model.OutboxEvent) {
+		event.Attempts++
+		event.LastError = ""
+		event.PublishedAt = &publishedAt
+	})
+}
+
+func (obr OutboxRepository) MarkEventFailed(ctx context.Context, id int64, lastError string, retryAt time.Time) error {
+	return obr.update(id, func(event *model.OutboxEvent) {
+		event.Attempts++
+		event.LastError = lastError
+		event.AvailableAt = retryAt
+	})
+}
+
+func (obr OutboxRepository) PurgePublishedEvents(ctx context.Context, before time.Time, keepAggregateTypes []string) (int64, error) {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if event.PublishedAt == nil || !event.PublishedAt.Before(before) || slices.Contains(keepAggregateTypes, event.AggregateType) {
+			kept = append(kept, event)
+		}
+	}
+	purged := int64(len(s.events) - len(kept))
+	s.events = kept
+	return purged, nil
+}
+
+func (obr OutboxRepository) PurgeOrderHistory(ctx context.Context, before time.Time) (int64, error) {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	// an order's history goes once the order is over, or gone, and all of its events were published before the cutoff
+	live := map[string]bool{}
+	for _, event := range s.events {
+		if event.AggregateType != model.AggregateOrder || live[event.AggregateId] {
+			continue
+		}
+		id, _ := strconv.Atoi(event.AggregateId)
+		order, exists := s.orders[id]
+		if (exists && !slices.Contains(model.FinalOrderStatuses, order.Status)) || event.PublishedAt == nil || !event.PublishedAt.Before(before) {
+			live[event.AggregateId] = true
+		}
+	}
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if event.AggregateType != model.AggregateOrder || live[event.AggregateId] {
+			kept = append(kept, event)
+		}
+	}
+	purged := int64(len(s.events) - len(kept))
+	s.events = kept
+	return purged, nil
+}
+
+func (obr OutboxRepository) update(id int64, apply func(event *model.OutboxEvent)) error {
+	s := obr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for i := range s.events {
+		if s.events[i].Id == id {
+			apply(&s.events[i])
+		}
+	}
+	return nil
+}
+
+// ---------- WEBHOOKS ----------
+
+type WebhookRepository struct {
+	store *Store
+}
+
+func (wr WebhookRepository) PersistCreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (int, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	subscription.Id = s.nextId()
+	subscription.EventTypes = slices.Clone(subscription.EventTypes)
+	s.subscriptions[subscription.Id] = subscription
+	return subscription.Id, nil
+}
+
+func (wr WebhookRepository) FetchAllSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	return sortedValues(s.subscriptions), nil
+}
+
+func (wr WebhookRepository) FetchSubscriptionById(ctx context.Context, id int) (model.WebhookSubscription, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.WebhookSubscription{}, s.failWith
+	}
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return model.WebhookSubscription{}, persistence.ErrNotFound
+	}
+	return subscription, nil
+}
+
+func (wr WebhookRepository) PersistUpdateSubscriptionById(ctx context.Context, id int, updates map[string]any) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	for field, value := range updates {
+		var ok bool
+		switch field {
+		case "url":
+			subscription.URL, ok = value.(string)
+		case "event_types":
+			subscription.EventTypes, ok = value.([]string)
+			subscription.EventTypes = slices.Clone(subscription.EventTypes)
+		case "description":
+			subscription.Description, ok = value.(string)
+		case "active":
+			subscription.Active, ok = value.(bool)
+		default:
+			return fmt.Errorf("invalid field: %s", field)
+		}
+		if !ok {
+			return fmt.Errorf("invalid value for field %s: %v", field, value)
+		}
+	}
+	subscription.UpdatedAt = time.Now()
+
+	s.subscriptions[id] = subscription
+	return nil
+}
+
+// PersistDeleteSubscriptionById drops the subscription's deliveries with it, as the foreign key cascade does
+func (wr WebhookRepository) PersistDeleteSubscriptionById(ctx context.Context, id int) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return persistence.ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(delivery model.WebhookDelivery) bool {
+		return delivery.SubscriptionId == id
+	})
+	return nil
+}
+
+func (wr WebhookRepository) PersistDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for _, existing := range s.deliveries {
+		if existing.SubscriptionId == delivery.SubscriptionId && existing.EventId == delivery.EventId {
+			return nil
+		}
+	}
+	s.lastDeliveryId++
+	delivery.Id = s.lastDeliveryId
+	s.deliveries = append(s.deliveries, delivery)
+	return nil
+}
+
+func (wr WebhookRepository) FetchDueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	due := make([]model.WebhookDelivery, 0)
+	for _, delivery := range s.deliveries {
+		if delivery.Status == model.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) && s.subscriptions[delivery.SubscriptionId].Active {
+			due = append(due, delivery)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b model.WebhookDelivery) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+	return due[:min(limit, len(due))], nil
+}
+
+func (wr WebhookRepository) FetchDeliveriesBySubscription(ctx context.Context, subscriptionId int, status model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for _, delivery := range slices.Backward(s.deliveries) {
+		if delivery.SubscriptionId == subscriptionId && (status == "" || delivery.Status == status) && len(deliveries) < limit {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (wr WebhookRepository) FetchDeliveryById(ctx context.Context, id int64) (model.WebhookDelivery, error) {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.WebhookDelivery{}, s.failWith
+	}
+
+	for _, delivery := range s.deliveries {
+		if delivery.Id == id {
+			return delivery, nil
+		}
+	}
+	return model.WebhookDelivery{}, persistence.ErrNotFound
+}
+
+func (wr WebhookRepository) ClaimDelivery(ctx context.Context, id int64, attempts int, now, leaseUntil time.Time) (bool, error) {
+	claimed := false
+	err := wr.update(id, func(delivery *model.WebhookDelivery) {
+		if delivery.Status != model.WebhookDeliveryPending || delivery.Attempts != attempts {
+			return
+		}
+		claimed = true
+		delivery.Attempts++
+		delivery.TotalAttempts++
+		delivery.LastAttemptAt = &now
+		delivery.NextAttemptAt = leaseUntil
+	})
+	return claimed, err
+}
+
+func (wr WebhookRepository) PersistDeliveryResult(ctx context.Context, id int64, result model.WebhookDeliveryResult) error {
+	return wr.update(id, func(delivery *model.WebhookDelivery) {
+		delivery.Status = result.Status
+		delivery.NextAttemptAt = result.NextAttemptAt
+		delivery.LastStatusCode = result.StatusCode
+		delivery.LastError = result.Error
+		delivery.DeliveredAt = nil
+		if result.Status == model.WebhookDeliveryDelivered {
+			delivery.DeliveredAt = &result.AttemptedAt
+		}
+	})
+}
+
+func (wr WebhookRepository) PersistRequeueDelivery(ctx context.Context, id int64, at time.Time) error {
+	found := false
+	err := wr.update(id, func(delivery *model.WebhookDelivery) {
+		found = true
+		delivery.Status = model.WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.Redeliveries++
+		delivery.LastRedeliveredAt = &at
+		delivery.NextAttemptAt = at
+		delivery.DeliveredAt = nil
+	})
+	if err == nil && !found {
+		return persistence.ErrNotFound
+	}
+	return err
+}
+
+func (wr WebhookRepository) update(id int64, apply func(delivery *model.WebhookDelivery)) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for i := range s.deliveries {
+		if s.deliveries[i].Id == id {
+			apply(&s.deliveries[i])
+		}
+	}
+	return nil
+}
+
+// ---------- JOBS ----------
+
+type JobRepository struct {
+	store *Store
+}
+
+func (jr JobRepository) PersistEnqueueJob(ctx context.Context, job model.Job) (int64, bool, error) {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, false, s.failWith
+	}
+
+	if job.UniqueKey != "" && slices.ContainsFunc(s.jobs, func(existing model.Job) bool { return existing.UniqueKey == job.UniqueKey }) {
+		return 0, false, nil
+	}
+	s.lastJobId++
+	job.Id = s.lastJobId
+	job.Status = model.JobPending
+	job.Attempts = 0
+	job.UpdatedAt = job.CreatedAt
+	if len(job.Payload) == 0 {
+		job.Payload = json.RawMessage("null")
+	}
+	s.jobs = append(s.jobs, job)
+	return job.Id, true, nil
+}
+
+func (jr JobRepository) ClaimJobs(ctx context.Context, types []string, now, leaseUntil time.Time, limit int) ([]model.Job, error) {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	due := make([]int, 0)
+	for i, job := range s.jobs {
+		claimable := (job.Status == model.JobPending && !job.RunAt.After(now)) ||
+			(job.Status == model.JobRunning && job.LockedUntil != nil && !job.LockedUntil.After(now))
+		if claimable && slices.Contains(types, job.Type) {
+			due = append(due, i)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b int) int {
+		return s.jobs[a].RunAt.Compare(s.jobs[b].RunAt)
+	})
+
+	claimed := make([]model.Job, 0)
+	for _, i := range due[:min(limit, len(due))] {
+		job := &s.jobs[i]
+		job.Status = model.JobRunning
+		job.Attempts++
+		job.LockedUntil = &leaseUntil
+		job.UpdatedAt = now
+		claimed = append(claimed, *job)
+	}
+	return claimed, nil
+}
+
+func (jr JobRepository) PersistJobSucceeded(ctx context.Context, id int64, attempts int, at time.Time) error {
+	return jr.finish(id, attempts, func(job *model.Job) {
+		job.Status = model.JobSucceeded
+		job.LastError = ""
+		job.CompletedAt = &at
+		job.UpdatedAt = at
+	})
+}
+
+func (jr JobRepository) PersistJobFailed(ctx context.Context, id int64, attempts int, lastError string, dead bool, retryAt, at time.Time) error {
+	return jr.finish(id, attempts, func(job *model.Job) {
+		if dead {
+			job.Status = model.JobDead
+			job.CompletedAt = &at
+		} else {
+			job.Status = model.JobPending
+			job.RunAt = retryAt
+		}
+		job.LastError = lastError
+		job.UpdatedAt = at
+	})
+}
+
+func (jr JobRepository) PersistJobSnoozed(ctx context.Context, id int64, attempts int, runAt, at time.Time) error {
+	return jr.finish(id, attempts, func(job *model.Job) {
+		job.Status = model.JobPending
+		job.RunAt = runAt
+		job.Attempts--
+		job.UpdatedAt = at
+	})
+}
+
+func (jr JobRepository) FetchJobs(ctx context.Context, status model.JobStatus, jobType string, limit int) ([]model.Job, error) {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	jobs := make([]model.Job, 0)
+	for _, job := range slices.Backward(s.jobs) {
+		if (status == "" || job.Status == status) && (jobType == "" || job.Type == jobType) && len(jobs) < limit {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (jr JobRepository) FetchJobById(ctx context.Context, id int64) (model.Job, error) {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.Job{}, s.failWith
+	}
+
+	for _, job := range s.jobs {
+		if job.Id == id {
+			return job, nil
+		}
+	}
+	return model.Job{}, persistence.ErrNotFound
+}
+
+func (jr JobRepository) PersistRetryJob(ctx context.Context, id int64, at time.Time) error {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for i := range s.jobs {
+		job := &s.jobs[i]
+		if job.Id != id || job.Status == model.JobRunning {
+			continue
+		}
+		job.Status = model.JobPending
+		job.Attempts = 0
+		job.RunAt = at
+		job.LockedUntil = nil
+		job.CompletedAt = nil
+		job.UpdatedAt = at
+		return nil
+	}
+	return persistence.ErrNotFound
+}
+
+func (jr JobRepository) PurgeSucceededJobs(ctx context.Context, before time.Time) (int64, error) {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return 0, s.failWith
+	}
+
+	kept := len(s.jobs)
+	s.jobs = slices.DeleteFunc(s.jobs, func(job model.Job) bool {
+		return job.Status == model.JobSucceeded && job.CompletedAt.Before(before)
+	})
+	return int64(kept - len(s.jobs)), nil
+}
+
+// finish applies the outcome of an attempt, provided the job is still held by the attempt that ran it
+func (jr JobRepository) finish(id int64, attempts int, apply func(job *model.Job)) error {
+	s := jr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for i := range s.jobs {
+		job := &s.jobs[i]
+		if job.Id == id && job.Status == model.JobRunning && job.Attempts == attempts {
+			apply(job)
+			job.LockedUntil = nil
+			return nil
+		}
+	}
+	return persistence.ErrNotFound
+}
+
+// Jobs returns every job in the order they were enqueued, for tests to inspect
+func (s *Store) Jobs() []model.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.jobs)
+}
+
+// ---------- SMS ----------
+
+type SMSRepository struct {
+	store *Store
+}
+
+func (sr SMSRepository) PersistCreateSMSMessage(ctx context.Context, message model.SMSMessage) (model.SMSMessage, bool, error) {
+	s := sr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return model.SMSMessage{}, false, s.failWith
+	}
+
+	for _, existing := range s.smsMessages {
+		if existing.DedupeKey == message.DedupeKey {
+			return existing, false, nil
+		}
+	}
+	s.lastSMSId++
+	message.Id = s.lastSMSId
+	message.UpdatedAt = message.CreatedAt
+	s.smsMessages = append(s.smsMessages, message)
+	return message, true, nil
+}
+
+func (sr SMSRepository) PersistSMSMessageSent(ctx context.Context, id int64, providerMessageId string, status model.SMSStatus, at time.Time) error {
+	return sr.update(func(message *model.SMSMessage) bool {
+		if message.Id != id || message.Status != model.SMSPending {
+			return false
+		}
+		message.Status = status
+		message.ProviderMessageId = providerMessageId
+		message.Error = ""
+		message.SentAt = &at
+		if status == model.SMSDelivered {
+			message.DeliveredAt = &at
+		}
+		message.UpdatedAt = at
+		return true
+	})
+}
+
+func (sr SMSRepository) PersistSMSMessageFailed(ctx context.Context, id int64, sendError string, final bool, at time.Time) error {
+	return sr.update(func(message *model.SMSMessage) bool {
+		if message.Id != id || message.Status != model.SMSPending {
+			return false
+		}
+		if final {
+			message.Status = model.SMSFailed
+		}
+		message.Error = sendError
+		message.UpdatedAt = at
+		return true
+	})
+}
+
+func (sr SMSRepository) PersistSMSStatus(ctx context.Context, provider, providerMessageId string, status model.SMSStatus, statusError string, at time.Time) error {
+	return sr.update(func(message *model.SMSMessage) bool {
+		if message.Provider != provider || message.ProviderMessageId != providerMessageId ||
+			(message.Status != model.SMSPending && message.Status != model.SMSSent) {
+			return false
+		}
+		message.Status = status
+		if statusError != "" {
+			message.Error = statusError
+		}
+		if status == model.SMSDelivered {
+			message.DeliveredAt = &at
+		}
+		message.UpdatedAt = at
+		return true
+	})
+}
+
+func (sr SMSRepository) FetchSMSMessages(ctx context.Context, status model.SMSStatus, customerId int, limit int) ([]model.SMSMessage, error) {
+	s := sr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return nil, s.failWith
+	}
+
+	messages := make([]model.SMSMessage, 0)
+	for _, message := range slices.Backward(s.smsMessages) {
+		if (status == "" || message.Status == status) && (customerId == 0 || message.CustomerId == customerId) && len(messages) < limit {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// update applies fn to the first message it matches, returning persistence.ErrNotFound when it matches none
+func (sr SMSRepository) update(fn func(message *model.SMSMessage) bool) error {
+	s := sr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failWith != nil {
+		return s.failWith
+	}
+
+	for i := range s.smsMessages {
+		if fn(&s.smsMessages[i]) {
+			return nil
+		}
+	}
+	return persistence.ErrNotFound
+}
+
+// SMSMessages returns every text in the order they were recorded, for tests to inspect
+func (s *Store) SMSMessages() []model.SMSMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.smsMessages)
+}
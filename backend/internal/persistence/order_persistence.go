@@ -3,6 +3,8 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,52 +14,62 @@ import (
 )
 
 type OrderPersistence struct {
-	DbHandle *sql.DB
+	DbHandle DBTX
 	Logger   *zap.Logger
 }
 
-func NewOrderPersistence(dbHandle *sql.DB, logger *zap.Logger) OrderPersistence {
+func NewOrderPersistence(dbHandle DBTX, logger *zap.Logger) OrderPersistence {
 	return OrderPersistence{
 		DbHandle: dbHandle,
 		Logger:   logger,
 	}
 }
 
-func (op OrderPersistence) PersistCreateOrder(ctx context.Context, orderDomain model.Order) error {
+// returns a copy of the persistence that runs its statements against the given transaction
+func (op OrderPersistence) WithTx(tx *sql.Tx) OrderPersistence {
+	op.DbHandle = bindTx(op.DbHandle, tx)
+	return op
+}
+
+// PersistCreateOrder inserts the order and returns the id it was given
+func (op OrderPersistence) PersistCreateOrder(ctx context.Context, orderDomain model.Order) (int, error) {
 	zLog := op.getZLog(ctx)
 	zLog.Debug("Entered PersistCreateOrder")
 
 	query := `
-		INSERT INTO orders (customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, "orderType")
+		INSERT INTO orders (customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
 	`
 
-	_, err := op.DbHandle.ExecContext(
+	var id int
+	err := op.DbHandle.QueryRowContext(
 		ctx,
 		query,
 		orderDomain.CustomerId,
 		orderDomain.Status,
 		orderDomain.TotalPrice,
-		orderDomain.DeliveryAddress,
+		jsonParam(orderDomain.DeliveryAddress),
 		orderDomain.CreatedAt,
 		orderDomain.UpdatedAt,
 		orderDomain.AddressId,
 		orderDomain.OrderType,
-	)
+	).Scan(&id)
 	if err != nil {
-		zLog.Error("ExecContext failed: %w", zap.Error(err))
-		return err
+		zLog.Error("QueryRowContext failed for PersistCreateOrder", zap.Error(err))
+		return 0, err
 	}
 
-	return nil
+	return id, nil
 }
 
-func (op OrderPersistence) FetchAllOrders(ctx context.Context) (*sql.Rows, error) {
+func (op OrderPersistence) FetchAllOrders(ctx context.Context) ([]model.Order, error) {
 	zLog := op.getZLog(ctx)
 	zLog.Debug("Entered FetchAllOrders")
 
 	query := `
-		SELECT id, customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type
+		SELECT id, customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type,
+			picker, driver, estimated_ready_at
 		FROM orders
 	`
 
@@ -66,21 +78,46 @@ func (op OrderPersistence) FetchAllOrders(ctx context.Context) (*sql.Rows, error
 		zLog.Error("QueryContext failed for FetchAllOrders", zap.Error(err))
 		return nil, err
 	}
-	return rows, nil
+	defer rows.Close()
+
+	orders := make([]model.Order, 0)
+
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return orders, nil
 }
 
-func (op OrderPersistence) FetchOrderById(ctx context.Context, id int) *sql.Row {
+func (op OrderPersistence) FetchOrderById(ctx context.Context, id int) (model.Order, error) {
 	zLog := op.getZLog(ctx)
 	zLog.Debug("Entered FetchOrderById")
 
 	query := `
-		SELECT id, customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type
-		FROM customers
+		SELECT id, customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type,
+			picker, driver, estimated_ready_at
+		FROM orders
 		WHERE id = $1
 	`
 
-	row := op.DbHandle.QueryRowContext(ctx, query, id)
-	return row
+	order, err := scanOrder(op.DbHandle.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Order{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("scan operation failed for FetchOrderById", zap.Error(err))
+		return model.Order{}, err
+	}
+	return order, nil
 }
 
 func (op OrderPersistence) PersistUpdateOrderById(ctx context.Context, id int, updates map[string]any) error {
@@ -88,14 +125,17 @@ func (op OrderPersistence) PersistUpdateOrderById(ctx context.Context, id int, u
 	zLog.Debug("Entered PersistUpdateOrderById")
 
 	allowedFields := map[string]bool{
-		"status":           true,
-		"total_price":      true,
-		"delivery_address": true,
-		"address_id":       true,
-		"order_type":       true,
+		"status":             true,
+		"total_price":        true,
+		"delivery_address":   true,
+		"address_id":         true,
+		"order_type":         true,
+		"picker":             true,
+		"driver":             true,
+		"estimated_ready_at": true,
 	}
 
-	query := "UPDATE customers SET"
+	query := "UPDATE orders SET "
 	args := []any{}
 	argPosition := 1
 
@@ -108,6 +148,10 @@ func (op OrderPersistence) PersistUpdateOrderById(ctx context.Context, id int, u
 		if argPosition > 1 {
 			query += ", "
 		}
+		if raw, ok := value.(json.RawMessage); ok {
+			value = jsonParam(raw)
+		}
+
 		query += field + " = $" + fmt.Sprintf("%d", argPosition)
 		args = append(args, value)
 		argPosition++
@@ -128,6 +172,37 @@ func (op OrderPersistence) PersistUpdateOrderById(ctx context.Context, id int, u
 	return nil
 }
 
+func scanOrder(row rowScanner) (model.Order, error) {
+	var order model.Order
+	// database/sql can only scan a NULL into a plain []byte, not into the json.RawMessage named type
+	var deliveryAddress []byte
+	err := row.Scan(
+		&order.Id,
+		&order.CustomerId,
+		&order.Status,
+		&order.TotalPrice,
+		&deliveryAddress,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&order.AddressId,
+		&order.OrderType,
+		&order.Picker,
+		&order.Driver,
+		&order.EstimatedReadyAt,
+	)
+	order.DeliveryAddress = deliveryAddress
+	return order, err
+}
+
+// lib/pq sends []byte parameters as bytea, which postgres refuses to cast to jsonb, so JSON is passed as text instead.
+// An empty document is stored as NULL
+func jsonParam(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
 func (op OrderPersistence) getZLog(ctx context.Context) *zap.Logger {
 	return utils.FromContext(ctx, op.Logger)
 }
@@ -0,0 +1,134 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/testutil/pgtest"
+	"go.uber.org/zap"
+)
+
+func TestOrderPersistence_CreateAndFetch(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	op := NewOrderPersistence(db, zap.NewNop())
+	customer := pgtest.CreateCustomer(t, db)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	_, err := op.PersistCreateOrder(ctx, model.Order{
+		CustomerId:      customer.Id,
+		Status:          model.OrderStatusPending,
+		TotalPrice:      42.5,
+		DeliveryAddress: json.RawMessage(`{"street_address": "1 main st"}`),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		AddressId:       -1,
+		OrderType:       model.OrderType("DELIVERY"),
+	})
+	if err != nil {
+		t.Fatalf("PersistCreateOrder returned error: %v", err)
+	}
+
+	orders, err := op.FetchAllOrders(ctx)
+	if err != nil {
+		t.Fatalf("FetchAllOrders returned error: %v", err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("expected 1 order, got %d", len(orders))
+	}
+
+	got, err := op.FetchOrderById(ctx, orders[0].Id)
+	if err != nil {
+		t.Fatalf("FetchOrderById returned error: %v", err)
+	}
+	if got.CustomerId != customer.Id || got.TotalPrice != 42.5 || got.OrderType != "DELIVERY" || got.AddressId != -1 {
+		t.Errorf("unexpected order: %+v", got)
+	}
+
+	var address map[string]string
+	if err := json.Unmarshal(got.DeliveryAddress, &address); err != nil || address["street_address"] != "1 main st" {
+		t.Errorf("delivery address did not round trip: %s (%v)", got.DeliveryAddress, err)
+	}
+}
+
+func TestOrderPersistence_FetchOrderById_NotFound(t *testing.T) {
+	db := pgtest.New(t)
+	op := NewOrderPersistence(db, zap.NewNop())
+
+	// a customer with the same id must not be mistaken for an order
+	customer := pgtest.CreateCustomer(t, db)
+
+	if _, err := op.FetchOrderById(context.Background(), customer.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOrderPersistence_FetchOrderById_NullDeliveryAddress(t *testing.T) {
+	db := pgtest.New(t)
+	op := NewOrderPersistence(db, zap.NewNop())
+	order := pgtest.CreateOrder(t, db)
+
+	got, err := op.FetchOrderById(context.Background(), order.Id)
+	if err != nil {
+		t.Fatalf("FetchOrderById returned error: %v", err)
+	}
+	if got.DeliveryAddress != nil {
+		t.Errorf("expected nil delivery address for pickup order, got %s", got.DeliveryAddress)
+	}
+}
+
+func TestOrderPersistence_PersistUpdateOrderById(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+	op := NewOrderPersistence(db, zap.NewNop())
+	customer := pgtest.CreateCustomer(t, db)
+	order := pgtest.CreateOrder(t, db, func(o *model.Order) { o.CustomerId = customer.Id })
+	other := pgtest.CreateOrder(t, db, func(o *model.Order) { o.CustomerId = customer.Id })
+
+	err := op.PersistUpdateOrderById(ctx, order.Id, map[string]any{
+		"status":           model.OrderStatus("CANCELLED"),
+		"delivery_address": json.RawMessage(`{"city": "springfield"}`),
+	})
+	if err != nil {
+		t.Fatalf("PersistUpdateOrderById returned error: %v", err)
+	}
+
+	got, err := op.FetchOrderById(ctx, order.Id)
+	if err != nil {
+		t.Fatalf("FetchOrderById returned error: %v", err)
+	}
+	if got.Status != "CANCELLED" {
+		t.Errorf("expected status CANCELLED, got %s", got.Status)
+	}
+	if !got.UpdatedAt.After(order.UpdatedAt) {
+		t.Errorf("expected updated_at to move forward, was %v now %v", order.UpdatedAt, got.UpdatedAt)
+	}
+
+	untouched, _ := op.FetchOrderById(ctx, other.Id)
+	if untouched.Status != model.OrderStatusPending {
+		t.Errorf("update leaked into another order: %+v", untouched)
+	}
+
+	// the customer row shares the id space with orders and must not have been touched either
+	var firstName string
+	if err := db.QueryRowContext(ctx, `SELECT first_name FROM customers WHERE id = $1`, customer.Id).Scan(&firstName); err != nil {
+		t.Fatalf("failed to read customer: %v", err)
+	}
+	if firstName != customer.FirstName {
+		t.Errorf("customer was modified by an order update: %q", firstName)
+	}
+}
+
+func TestOrderPersistence_PersistUpdateOrderById_RejectsUnknownField(t *testing.T) {
+	db := pgtest.New(t)
+	op := NewOrderPersistence(db, zap.NewNop())
+	order := pgtest.CreateOrder(t, db)
+
+	if err := op.PersistUpdateOrderById(context.Background(), order.Id, map[string]any{"customer_id": 1}); err == nil {
+		t.Fatal("expected an error for a field outside the allow list")
+	}
+}
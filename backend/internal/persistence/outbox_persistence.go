@@ -0,0 +1,300 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// OUTBOX_RELAY_LOCK_KEY is the postgres advisory lock a relay holds for the duration of a round
+const OUTBOX_RELAY_LOCK_KEY int64 = 0x636f6465636172
+
+type OutboxPersistence struct {
+	DbHandle DBTX
+	Logger   *zap.Logger
+}
+
+func NewOutboxPersistence(dbHandle DBTX, logger *zap.Logger) OutboxPersistence {
+	return OutboxPersistence{
+		DbHandle: dbHandle,
+		Logger:   logger,
+	}
+}
+
+// returns a copy of the persistence that runs its statements against the given transaction
+func (obp OutboxPersistence) WithTx(tx *sql.Tx) OutboxPersistence {
+	obp.DbHandle = bindTx(obp.DbHandle, tx)
+	return obp
+}
+
+// PersistEvent appends event to the outbox. Call it through a UnitOfWork so the event commits or rolls back together
+// with the change it describes
+func (obp OutboxPersistence) PersistEvent(ctx context.Context, event model.OutboxEvent) error {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered PersistEvent")
+
+	query := `
+		INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload, occurred_at, available_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := obp.DbHandle.ExecContext(
+		ctx,
+		query,
+		event.AggregateType,
+		event.AggregateId,
+		event.Type,
+		jsonParam(event.Payload),
+		event.OccurredAt.UTC(),
+		event.AvailableAt.UTC(),
+	)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistEvent", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// FetchPendingEvents returns up to limit unpublished events that are due at now, oldest first. An event is held back
+// while an earlier event of the same aggregate is still waiting for a retry, which keeps each aggregate in order
+func (obp OutboxPersistence) FetchPendingEvents(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error) {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered FetchPendingEvents")
+
+	query := `
+		SELECT o.id, o.aggregate_type, o.aggregate_id, o.event_type, o.payload, o.occurred_at, o.available_at, o.attempts,
+			COALESCE(o.last_error, '')
+		FROM outbox o
+		WHERE o.published_at IS NULL
+			AND o.available_at <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox earlier
+				WHERE earlier.published_at IS NULL
+					AND earlier.aggregate_type = o.aggregate_type
+					AND earlier.aggregate_id = o.aggregate_id
+					AND earlier.id < o.id
+					AND earlier.available_at > $1
+			)
+		ORDER BY o.id
+		LIMIT $2
+	`
+	rows, err := obp.DbHandle.QueryContext(ctx, query, now.UTC(), limit)
+	if err != nil {
+		zLog.Error("QueryContext failed for FetchPendingEvents", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.OutboxEvent, 0)
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+// FetchEventsByAggregate returns up to limit events of one aggregate recorded after afterId, oldest first, whether or
+// not they have been published yet. It is how order event streams replay what a client missed
+func (obp OutboxPersistence) FetchEventsByAggregate(ctx context.Context, aggregateType, aggregateId string, afterId int64, limit int) ([]model.OutboxEvent, error) {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered FetchEventsByAggregate")
+
+	query := `
+		SELECT id, aggregate_type, aggregate_id, event_type, payload, occurred_at, available_at, attempts,
+			COALESCE(last_error, '')
+		FROM outbox
+		WHERE aggregate_type = $1 AND aggregate_id = $2 AND id > $3
+		ORDER BY id
+		LIMIT $4
+	`
+	rows, err := obp.DbHandle.QueryContext(ctx, query, aggregateType, aggregateId, afterId, limit)
+	if err != nil {
+		zLog.Error("QueryContext failed for FetchEventsByAggregate", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.OutboxEvent, 0)
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+func (obp OutboxPersistence) MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) error {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered MarkEventPublished")
+
+	query := `UPDATE outbox SET published_at = $1, attempts = attempts + 1, last_error = NULL WHERE id = $2`
+	if _, err := obp.DbHandle.ExecContext(ctx, query, publishedAt.UTC(), id); err != nil {
+		zLog.Error("ExecContext failed for MarkEventPublished", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// MarkEventFailed records a failed attempt and holds the event, and with it the rest of its aggregate, back until
+// retryAt
+func (obp OutboxPersistence) MarkEventFailed(ctx context.Context, id int64, lastError string, retryAt time.Time) error {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered MarkEventFailed")
+
+	query := `UPDATE outbox SET attempts = attempts + 1, last_error = $1, available_at = $2 WHERE id = $3`
+	if _, err := obp.DbHandle.ExecContext(ctx, query, lastError, retryAt.UTC(), id); err != nil {
+		zLog.Error("ExecContext failed for MarkEventFailed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PurgePublishedEvents deletes events published before the cutoff and returns how many went. Events of the aggregate
+// types in keepAggregateTypes are kept however old they are
+func (obp OutboxPersistence) PurgePublishedEvents(ctx context.Context, before time.Time, keepAggregateTypes []string) (int64, error) {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered PurgePublishedEvents")
+
+	args := []any{before.UTC()}
+	query := `DELETE FROM outbox WHERE published_at < $1`
+	if len(keepAggregateTypes) > 0 {
+		placeholders := make([]string, len(keepAggregateTypes))
+		for i, aggregateType := range keepAggregateTypes {
+			args = append(args, aggregateType)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += ` AND aggregate_type NOT IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+	result, err := obp.DbHandle.ExecContext(ctx, query, args...)
+	if err != nil {
+		zLog.Error("ExecContext failed for PurgePublishedEvents", zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeOrderHistory deletes the events of the orders that are in one of model.FinalOrderStatuses, or no longer exist,
+// once every event of the order was published before the cutoff, and returns how many went
+func (obp OutboxPersistence) PurgeOrderHistory(ctx context.Context, before time.Time) (int64, error) {
+	zLog := obp.getZLog(ctx)
+	zLog.Debug("entered PurgeOrderHistory")
+
+	args := []any{model.AggregateOrder, before.UTC()}
+	placeholders := make([]string, len(model.FinalOrderStatuses))
+	for i, status := range model.FinalOrderStatuses {
+		args = append(args, string(status))
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	query := `
+		DELETE FROM outbox
+		WHERE aggregate_type = $1
+			AND aggregate_id IN (
+				SELECT aggregate_id FROM outbox
+				WHERE aggregate_type = $1
+				GROUP BY aggregate_id
+				HAVING COUNT(published_at) = COUNT(*) AND MAX(published_at) < $2
+			)
+			AND aggregate_id NOT IN (
+				SELECT CAST(id AS TEXT) FROM orders WHERE status NOT IN (` + strings.Join(placeholders, ", ") + `)
+			)`
+	result, err := obp.DbHandle.ExecContext(ctx, query, args...)
+	if err != nil {
+		zLog.Error("ExecContext failed for PurgeOrderHistory", zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanOutboxEvent(row rowScanner) (model.OutboxEvent, error) {
+	var event model.OutboxEvent
+	var payload []byte
+	err := row.Scan(
+		&event.Id,
+		&event.AggregateType,
+		&event.AggregateId,
+		&event.Type,
+		&payload,
+		&event.OccurredAt,
+		&event.AvailableAt,
+		&event.Attempts,
+		&event.LastError,
+	)
+	event.Payload = payload
+	return event, err
+}
+
+func (obp OutboxPersistence) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, obp.Logger).Named("outbox_persistence")
+}
+
+var _ OutboxClaimer = SQLOutboxClaimer{}
+
+// SQLOutboxClaimer hands the relay the outbox one round at a time. On postgres each round runs in its own transaction
+// holding OUTBOX_RELAY_LOCK_KEY, so with several instances only one relay publishes at a time and no aggregate is
+// published out of order. sqlite is single-process and allows a single connection, so rounds run without either
+type SQLOutboxClaimer struct {
+	DbHandle *sql.DB
+	Dialect  dialect.Dialect
+	Outbox   OutboxPersistence
+	Logger   *zap.Logger
+}
+
+func NewSQLOutboxClaimer(dbHandle *sql.DB, d dialect.Dialect, logger *zap.Logger) SQLOutboxClaimer {
+	return SQLOutboxClaimer{
+		DbHandle: dbHandle,
+		Dialect:  d,
+		Outbox:   NewOutboxPersistence(WithDialect(WithTracing(dbHandle, d), d), logger),
+		Logger:   logger.Named("outbox_claimer"),
+	}
+}
+
+func (c SQLOutboxClaimer) ClaimOutbox(ctx context.Context, fn func(ctx context.Context, outbox OutboxRepository) error) (bool, error) {
+	if c.Dialect != dialect.Postgres {
+		return true, fn(ctx, c.Outbox)
+	}
+
+	// read committed is enough here: the lock already serializes relays, and it keeps the round from conflicting with
+	// the serializable request transactions appending events meanwhile
+	tx, err := c.DbHandle.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, OUTBOX_RELAY_LOCK_KEY).Scan(&locked); err != nil {
+		return false, fmt.Errorf("failed to take the outbox relay lock: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+
+	if err := fn(ctx, c.Outbox.WithTx(tx)); err != nil {
+		return true, err
+	}
+	if err := tx.Commit(); err != nil {
+		return true, fmt.Errorf("failed to commit outbox transaction: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// ErrNotFound is returned by single-row lookups when no row matches
+var ErrNotFound = errors.New("record not found")
+
+// the repository interfaces below are what the service layer depends on. The postgres-backed persistence structs in
+// this package implement them, and so does the in-memory store in persistence/memory that the service tests run against
+
+type UserRepository interface {
+	PersistCreateUser(ctx context.Context, userDomain model.User) (int, error)
+	FetchUserByAuthId(ctx context.Context, gcAuthId string) (model.User, error)
+}
+
+type CustomerRepository interface {
+	PersistCreateCustomer(ctx context.Context, customerDomain model.Customer) (int, error)
+	FetchAllCustomers(ctx context.Context) ([]model.Customer, error)
+	FetchCustomerById(ctx context.Context, id int) (model.Customer, error)
+	PersistDeleteCustomerById(ctx context.Context, id int) error
+	PersistUpdateCustomerById(ctx context.Context, id int, updates map[string]any) error
+	PersistSMSOptInByPhoneNumber(ctx context.Context, phoneNumber string, optIn bool) (int64, error)
+}
+
+type AddressRepository interface {
+	PersistCreateAddress(ctx context.Context, addressDomain model.Address) error
+	FetchAllAddresses(ctx context.Context) ([]model.Address, error)
+}
+
+type OrderRepository interface {
+	PersistCreateOrder(ctx context.Context, orderDomain model.Order) (int, error)
+	FetchAllOrders(ctx context.Context) ([]model.Order, error)
+	FetchOrderById(ctx context.Context, id int) (model.Order, error)
+	PersistUpdateOrderById(ctx context.Context, id int, updates map[string]any) error
+}
+
+type OutboxRepository interface {
+	PersistEvent(ctx context.Context, event model.OutboxEvent) error
+	FetchPendingEvents(ctx context.Context, now time.Time, limit int) ([]model.OutboxEvent, error)
+	FetchEventsByAggregate(ctx context.Context, aggregateType, aggregateId string, afterId int64, limit int) ([]model.OutboxEvent, error)
+	MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) error
+	MarkEventFailed(ctx context.Context, id int64, lastError string, retryAt time.Time) error
+	PurgePublishedEvents(ctx context.Context, before time.Time, keepAggregateTypes []string) (int64, error)
+	PurgeOrderHistory(ctx context.Context, before time.Time) (int64, error)
+}
+
+type WebhookRepository interface {
+	PersistCreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (int, error)
+	FetchAllSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	FetchSubscriptionById(ctx context.Context, id int) (model.WebhookSubscription, error)
+	PersistUpdateSubscriptionById(ctx context.Context, id int, updates map[string]any) error
+	PersistDeleteSubscriptionById(ctx context.Context, id int) error
+	PersistDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+	FetchDueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	FetchDeliveriesBySubscription(ctx context.Context, subscriptionId int, status model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error)
+	FetchDeliveryById(ctx context.Context, id int64) (model.WebhookDelivery, error)
+	ClaimDelivery(ctx context.Context, id int64, attempts int, now, leaseUntil time.Time) (bool, error)
+	PersistDeliveryResult(ctx context.Context, id int64, result model.WebhookDeliveryResult) error
+	PersistRequeueDelivery(ctx context.Context, id int64, at time.Time) error
+}
+
+type JobRepository interface {
+	PersistEnqueueJob(ctx context.Context, job model.Job) (id int64, created bool, err error)
+	ClaimJobs(ctx context.Context, types []string, now, leaseUntil time.Time, limit int) ([]model.Job, error)
+	PersistJobSucceeded(ctx context.Context, id int64, attempts int, at time.Time) error
+	PersistJobFailed(ctx context.Context, id int64, attempts int, lastError string, dead bool, retryAt, at time.Time) error
+	PersistJobSnoozed(ctx context.Context, id int64, attempts int, runAt, at time.Time) error
+	FetchJobs(ctx context.Context, status model.JobStatus, jobType string, limit int) ([]model.Job, error)
+	FetchJobById(ctx context.Context, id int64) (model.Job, error)
+	PersistRetryJob(ctx context.Context, id int64, at time.Time) error
+	PurgeSucceededJobs(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SMSRepository interface {
+	PersistCreateSMSMessage(ctx context.Context, message model.SMSMessage) (model.SMSMessage, bool, error)
+	PersistSMSMessageSent(ctx context.Context, id int64, providerMessageId string, status model.SMSStatus, at time.Time) error
+	PersistSMSMessageFailed(ctx context.Context, id int64, sendError string, final bool, at time.Time) error
+	PersistSMSStatus(ctx context.Context, provider, providerMessageId string, status model.SMSStatus, statusError string, at time.Time) error
+	FetchSMSMessages(ctx context.Context, status model.SMSStatus, customerId int, limit int) ([]model.SMSMessage, error)
+}
+
+// OutboxClaimer runs one relay round against the outbox. claimed is false when a relay elsewhere holds the outbox and
+// fn was not run. SQLOutboxClaimer is the SQL implementation
+type OutboxClaimer interface {
+	ClaimOutbox(ctx context.Context, fn func(ctx context.Context, outbox OutboxRepository) error) (claimed bool, err error)
+}
+
+var (
+	_ UserRepository     = UserPersistence{}
+	_ CustomerRepository = CustomerPersistence{}
+	_ AddressRepository  = AddressPersistence{}
+	_ OrderRepository    = OrderPersistence{}
+	_ OutboxRepository   = OutboxPersistence{}
+	_ WebhookRepository  = WebhookPersistence{}
+	_ JobRepository      = JobPersistence{}
+)
+
+// Repositories bundles one repository per domain. Inside a Transactor callback every repository shares the same
+// transaction
+type Repositories struct {
+	Users     UserRepository
+	Customers CustomerRepository
+	Addresses AddressRepository
+	Orders    OrderRepository
+	Outbox    OutboxRepository
+	Webhooks  WebhookRepository
+	Jobs      JobRepository
+	SMS       SMSRepository
+}
+
+// Transactor runs a callback atomically against a set of repositories. UnitOfWork is the postgres implementation
+type Transactor interface {
+	Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows so single-row and multi-row queries can share scan helpers
+type rowScanner interface {
+	Scan(dest ...any) error
+}
@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type SMSPersistence struct {
+	DbHandle DBTX
+	Logger   *zap.Logger
+}
+
+func NewSMSPersistence(dbHandle DBTX, logger *zap.Logger) SMSPersistence {
+	return SMSPersistence{
+		DbHandle: dbHandle,
+		Logger:   logger,
+	}
+}
+
+// returns a copy of the persistence that runs its statements against the given transaction
+func (sp SMSPersistence) WithTx(tx *sql.Tx) SMSPersistence {
+	sp.DbHandle = bindTx(sp.DbHandle, tx)
+	return sp
+}
+
+const smsColumns = `id, dedupe_key, customer_id, order_id, template, to_number, body, encoding, segments, status, provider,
+	COALESCE(provider_message_id, ''), COALESCE(error, ''), created_at, updated_at, sent_at, delivered_at`
+
+// PersistCreateSMSMessage records a text about to be sent and returns it with its id. When one with the same dedupe
+// key exists it is returned instead with created false, so a job that runs twice can tell the text already went out
+func (sp SMSPersistence) PersistCreateSMSMessage(ctx context.Context, message model.SMSMessage) (model.SMSMessage, bool, error) {
+	zLog := sp.getZLog(ctx)
+	zLog.Debug("entered PersistCreateSMSMessage")
+
+	query := `
+		INSERT INTO sms_messages (dedupe_key, customer_id, order_id, template, to_number, body, encoding, segments, status,
+			provider, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+		ON CONFLICT (dedupe_key) DO NOTHING
+		RETURNING id
+	`
+	err := sp.DbHandle.QueryRowContext(
+		ctx,
+		query,
+		message.DedupeKey,
+		message.CustomerId,
+		message.OrderId,
+		message.Template,
+		message.To,
+		message.Body,
+		message.Encoding,
+		message.Segments,
+		message.Status,
+		message.Provider,
+		message.CreatedAt.UTC(),
+	).Scan(&message.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err := scanSMSMessage(sp.DbHandle.QueryRowContext(ctx, `SELECT `+smsColumns+` FROM sms_messages WHERE dedupe_key = $1`, message.DedupeKey))
+		if err != nil {
+			zLog.Error("scan operation failed for PersistCreateSMSMessage", zap.Error(err))
+			return model.SMSMessage{}, false, err
+		}
+		return existing, false, nil
+	}
+	if err != nil {
+		zLog.Error("QueryRowContext failed for PersistCreateSMSMessage", zap.Error(err))
+		return model.SMSMessage{}, false, err
+	}
+	message.UpdatedAt = message.CreatedAt
+	return message, true, nil
+}
+
+// PersistSMSMessageSent records that the provider accepted a pending text under providerMessageId. status is SENT, or
+// DELIVERED for providers that know straight away
+func (sp SMSPersistence) PersistSMSMessageSent(ctx context.Context, id int64, providerMessageId string, status model.SMSStatus, at time.Time) error {
+	zLog := sp.getZLog(ctx)
+	zLog.Debug("entered PersistSMSMessageSent")
+
+	var deliveredAt any
+	if status == model.SMSDelivered {
+		deliveredAt = at.UTC()
+	}
+	query := `
+		UPDATE sms_messages SET status = $1, provider_message_id = $2, error = NULL, sent_at = $3, delivered_at = $4,
+			updated_at = $3
+		WHERE id = $5 AND status = $6
+	`
+	result, err := sp.DbHandle.ExecContext(ctx, query, status, providerMessageId, at.UTC(), deliveredAt, id, model.SMSPending)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistSMSMessageSent", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PersistSMSMessageFailed records why sending a pending text failed. It stays pending for the next attempt unless
+// final is set, which marks it FAILED
+func (sp SMSPersistence) PersistSMSMessageFailed(ctx context.Context, id int64, sendError string, final bool, at time.Time) error {
+	zLog := sp.getZLog(ctx)
+	zLog.Debug("entered PersistSMSMessageFailed")
+
+	status := model.SMSPending
+	if final {
+		status = model.SMSFailed
+	}
+	query := `UPDATE sms_messages SET status = $1, error = $2, updated_at = $3 WHERE id = $4 AND status = $5`
+	result, err := sp.DbHandle.ExecContext(ctx, query, status, sendError, at.UTC(), id, model.SMSPending)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistSMSMessageFailed", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PersistSMSStatus applies a status the provider reported for one of its messages. Texts already DELIVERED or FAILED
+// keep their status, since providers do not promise to report in order, and like unknown messages return ErrNotFound
+func (sp SMSPersistence) PersistSMSStatus(ctx context.Context, provider, providerMessageId string, status model.SMSStatus, statusError string, at time.Time) error {
+	zLog := sp.getZLog(ctx)
+	zLog.Debug("entered PersistSMSStatus")
+
+	var deliveredAt, errorText any
+	if status == model.SMSDelivered {
+		deliveredAt = at.UTC()
+	}
+	if statusError != "" {
+		errorText = statusError
+	}
+	query := `
+		UPDATE sms_messages SET status = $1, error = COALESCE($2, error), delivered_at = COALESCE($3, delivered_at),
+			updated_at = $4
+		WHERE provider = $5 AND provider_message_id = $6 AND status IN ($7, $8)
+	`
+	result, err := sp.DbHandle.ExecContext(ctx, query, status, errorText, deliveredAt, at.UTC(), provider, providerMessageId,
+		model.SMSPending, model.SMSSent)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistSMSStatus", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// FetchSMSMessages returns up to limit texts, newest first. status and customerId narrow the list when not empty
+// and not 0
+func (sp SMSPersistence) FetchSMSMessages(ctx context.Context, status model.SMSStatus, customerId int, limit int) ([]model.SMSMessage, error) {
+	zLog := sp.getZLog(ctx)
+	zLog.Debug("entered FetchSMSMessages")
+
+	query := `
+		SELECT ` + smsColumns + `
+		FROM sms_messages
+		WHERE ($1 = '' OR status = $1) AND ($2 = 0 OR customer_id = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := sp.DbHandle.QueryContext(ctx, query, status, customerId, limit)
+	if err != nil {
+		zLog.Error("QueryContext failed for FetchSMSMessages", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]model.SMSMessage, 0)
+	for rows.Next() {
+		message, err := scanSMSMessage(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func scanSMSMessage(row rowScanner) (model.SMSMessage, error) {
+	var message model.SMSMessage
+	err := row.Scan(
+		&message.Id,
+		&message.DedupeKey,
+		&message.CustomerId,
+		&message.OrderId,
+		&message.Template,
+		&message.To,
+		&message.Body,
+		&message.Encoding,
+		&message.Segments,
+		&message.Status,
+		&message.Provider,
+		&message.ProviderMessageId,
+		&message.Error,
+		&message.CreatedAt,
+		&message.UpdatedAt,
+		&message.SentAt,
+		&message.DeliveredAt,
+	)
+	return message, err
+}
+
+func (sp SMSPersistence) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, sp.Logger).Named("sms_persistence")
+}
@@ -0,0 +1,578 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/testutil/sqlitetest"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.uber.org/zap"
+)
+
+// these run the postgres-flavoured persistence code against sqlite through the dialect wrapper, which checks
+// placeholder rebinding, JSON text columns, timestamp round trips and transactions without needing a database server
+
+func TestSQLitePersistence_RoundTrip(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, _ := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := repos.Customers.PersistCreateCustomer(ctx, model.Customer{
+		FirstName: "ada", LastName: "lovelace", PhoneNumber: "+15555550100", Email: "ada@example.com", Locale: "es", EmailOptOut: true,
+		CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("PersistCreateCustomer returned error: %v", err)
+	}
+	customers, err := repos.Customers.FetchAllCustomers(ctx)
+	if err != nil || len(customers) != 1 {
+		t.Fatalf("FetchAllCustomers = %+v, %v", customers, err)
+	}
+	customer := customers[0]
+	if !customer.CreatedAt.Equal(now) {
+		t.Errorf("created_at did not round trip: want %v, got %v", now, customer.CreatedAt)
+	}
+	if customer.Locale != "es" || !customer.EmailOptOut {
+		t.Errorf("expected the email preferences to round trip, got %+v", customer)
+	}
+	if err := repos.Customers.PersistUpdateCustomerById(ctx, customer.Id, map[string]any{"locale": "en", "email_opt_out": false}); err != nil {
+		t.Fatalf("PersistUpdateCustomerById returned error: %v", err)
+	}
+	if byId, err := repos.Customers.FetchCustomerById(ctx, customer.Id); err != nil || byId.Locale != "en" || byId.EmailOptOut || byId.Email != customer.Email {
+		t.Errorf("FetchCustomerById = %+v, %v", byId, err)
+	}
+	if _, err := repos.Customers.FetchCustomerById(ctx, customer.Id+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown customer, got %v", err)
+	}
+
+	if _, err := repos.Users.PersistCreateUser(ctx, model.User{
+		Email: "ada@example.com", CustomerId: customer.Id, GCAuthId: "gc-1", IsActive: true, CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("PersistCreateUser returned error: %v", err)
+	}
+
+	if err := repos.Addresses.PersistCreateAddress(ctx, model.Address{
+		UserId: 1, StreetAddress: "1 main st", City: "springfield", State: "il", ZipCode: "62701", Country: "us", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("PersistCreateAddress returned error: %v", err)
+	}
+	addresses, err := repos.Addresses.FetchAllAddresses(ctx)
+	if err != nil || len(addresses) != 1 || addresses[0].IsDefault {
+		t.Fatalf("FetchAllAddresses = %+v, %v", addresses, err)
+	}
+
+	for _, order := range []model.Order{
+		{CustomerId: customer.Id, Status: model.OrderStatusPending, TotalPrice: 12.5, AddressId: -1, OrderType: "PICKUP", CreatedAt: now, UpdatedAt: now},
+		{CustomerId: customer.Id, Status: model.OrderStatusPending, TotalPrice: 30, AddressId: addresses[0].Id, OrderType: "DELIVERY",
+			DeliveryAddress: json.RawMessage(`{"city":"springfield"}`), CreatedAt: now, UpdatedAt: now},
+	} {
+		if _, err := repos.Orders.PersistCreateOrder(ctx, order); err != nil {
+			t.Fatalf("PersistCreateOrder returned error: %v", err)
+		}
+	}
+
+	orders, err := repos.Orders.FetchAllOrders(ctx)
+	if err != nil || len(orders) != 2 {
+		t.Fatalf("FetchAllOrders = %+v, %v", orders, err)
+	}
+	if orders[0].DeliveryAddress != nil {
+		t.Errorf("expected NULL delivery address for pickup, got %s", orders[0].DeliveryAddress)
+	}
+	if string(orders[1].DeliveryAddress) != `{"city":"springfield"}` {
+		t.Errorf("delivery address did not round trip: %s", orders[1].DeliveryAddress)
+	}
+
+	eta := now.Add(20 * time.Minute)
+	if err := repos.Orders.PersistUpdateOrderById(ctx, orders[1].Id, map[string]any{
+		"status":             model.OrderStatus("CANCELLED"),
+		"total_price":        31.0,
+		"driver":             "grace",
+		"estimated_ready_at": eta,
+	}); err != nil {
+		t.Fatalf("PersistUpdateOrderById returned error: %v", err)
+	}
+	updated, err := repos.Orders.FetchOrderById(ctx, orders[1].Id)
+	if err != nil {
+		t.Fatalf("FetchOrderById returned error: %v", err)
+	}
+	if updated.Status != "CANCELLED" || updated.TotalPrice != 31 || updated.CreatedAt.IsZero() || updated.Driver != "grace" || updated.Picker != "" {
+		t.Errorf("unexpected order after update: %+v", updated)
+	}
+	if updated.EstimatedReadyAt == nil || !updated.EstimatedReadyAt.Equal(eta) || orders[0].EstimatedReadyAt != nil {
+		t.Errorf("estimated_ready_at did not round trip: %v", updated.EstimatedReadyAt)
+	}
+
+	user, err := repos.Users.FetchUserByAuthId(ctx, "gc-1")
+	if err != nil || user.CustomerId != customer.Id || !user.IsActive {
+		t.Errorf("FetchUserByAuthId = %+v, %v", user, err)
+	}
+	if _, err := repos.Users.FetchUserByAuthId(ctx, "gc-unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown auth id, got %v", err)
+	}
+
+	if _, err := repos.Orders.FetchOrderById(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSQLitePersistence_UnitOfWorkRollsBack(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, uow := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+
+	now := time.Now()
+	wantErr := errors.New("abort")
+	err := uow.Do(ctx, func(ctx context.Context, txRepos Repositories) error {
+		if _, err := txRepos.Customers.PersistCreateCustomer(ctx, model.Customer{
+			FirstName: "a", LastName: "b", Email: "a@b.co", CreatedAt: now, UpdatedAt: now,
+		}); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+
+	customers, err := repos.Customers.FetchAllCustomers(ctx)
+	if err != nil {
+		t.Fatalf("FetchAllCustomers returned error: %v", err)
+	}
+	if len(customers) != 0 {
+		t.Errorf("expected the insert to be rolled back, got %+v", customers)
+	}
+}
+
+func TestSQLitePersistence_TracesStatementsInsideTransactions(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	db := sqlitetest.New(t)
+	_, uow := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+
+	now := time.Now().UTC()
+	if err := uow.Do(context.Background(), func(ctx context.Context, repos Repositories) error {
+		_, err := repos.Customers.PersistCreateCustomer(ctx, model.Customer{
+			FirstName: "ada", LastName: "lovelace", PhoneNumber: "+15555550100", Email: "ada@example.com", CreatedAt: now, UpdatedAt: now,
+		})
+		return err
+	}); err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	var insert, tx sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.Name() {
+		case "INSERT":
+			insert = span
+		case "UnitOfWork.Do":
+			tx = span
+		}
+	}
+	if insert == nil || tx == nil {
+		t.Fatalf("expected INSERT and UnitOfWork.Do spans, got %d spans", len(spans))
+	}
+	if insert.Parent().SpanID() != tx.SpanContext().SpanID() {
+		t.Error("statement span should be a child of the transaction span")
+	}
+
+	var statement string
+	for _, attr := range insert.Attributes() {
+		if attr.Key == semconv.DBQueryTextKey {
+			statement = attr.Value.AsString()
+		}
+	}
+	// the span records the SQL as the driver received it, after rebinding
+	if !strings.Contains(statement, "?1") {
+		t.Errorf("expected rebound sqlite placeholders in db.query.text, got %q", statement)
+	}
+}
+
+func TestSQLitePersistence_Outbox(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, uow := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+	claimer := NewSQLOutboxClaimer(db, dialect.SQLite, zap.NewNop())
+
+	record := func(aggregateId int, eventType string) {
+		t.Helper()
+		event, err := model.NewOutboxEvent(model.AggregateOrder, aggregateId, eventType, map[string]int{"order_id": aggregateId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Outbox.PersistEvent(ctx, event); err != nil {
+			t.Fatalf("PersistEvent returned error: %v", err)
+		}
+	}
+	record(1, model.EventOrderCreated)
+	record(2, model.EventOrderCreated)
+	record(1, model.EventOrderStatusChanged)
+
+	// an event recorded in a transaction that rolls back is never seen
+	uow.Do(ctx, func(ctx context.Context, txRepos Repositories) error {
+		event, _ := model.NewOutboxEvent(model.AggregateOrder, 3, model.EventOrderCreated, struct{}{})
+		txRepos.Outbox.PersistEvent(ctx, event)
+		return errors.New("abort")
+	})
+
+	now := time.Now()
+	var pending []model.OutboxEvent
+	claimed, err := claimer.ClaimOutbox(ctx, func(ctx context.Context, outbox OutboxRepository) error {
+		var err error
+		pending, err = outbox.FetchPendingEvents(ctx, now, 10)
+		return err
+	})
+	if !claimed || err != nil || len(pending) != 3 {
+		t.Fatalf("expected the three committed events, got claimed=%v err=%v events=%+v", claimed, err, pending)
+	}
+	if string(pending[0].Payload) != `{"order_id":1}` || pending[0].AggregateId != "1" || pending[0].Type != model.EventOrderCreated {
+		t.Errorf("event did not round trip: %+v", pending[0])
+	}
+
+	// a failed event holds back the later events of its aggregate but not those of others
+	if err := repos.Outbox.MarkEventFailed(ctx, pending[0].Id, "bus unavailable", now.Add(time.Minute)); err != nil {
+		t.Fatalf("MarkEventFailed returned error: %v", err)
+	}
+	if err := repos.Outbox.MarkEventPublished(ctx, pending[1].Id, now); err != nil {
+		t.Fatalf("MarkEventPublished returned error: %v", err)
+	}
+	pending, err = repos.Outbox.FetchPendingEvents(ctx, now, 10)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("expected order 1 to be held back, got %+v, %v", pending, err)
+	}
+
+	pending, err = repos.Outbox.FetchPendingEvents(ctx, now.Add(time.Minute), 10)
+	if err != nil || len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError != "bus unavailable" {
+		t.Fatalf("expected both order 1 events once the retry is due, got %+v, %v", pending, err)
+	}
+
+	// an aggregate's history includes published and pending events alike
+	history, err := repos.Outbox.FetchEventsByAggregate(ctx, model.AggregateOrder, "1", 0, 10)
+	if err != nil || len(history) != 2 || history[0].Type != model.EventOrderCreated || history[1].Type != model.EventOrderStatusChanged {
+		t.Fatalf("unexpected history for order 1: %+v, %v", history, err)
+	}
+	if history, _ := repos.Outbox.FetchEventsByAggregate(ctx, model.AggregateOrder, "1", history[0].Id, 10); len(history) != 1 {
+		t.Errorf("expected only the events after the given id, got %+v", history)
+	}
+
+	if purged, err := repos.Outbox.PurgePublishedEvents(ctx, now.Add(time.Second), []string{model.AggregateOrder}); err != nil || purged != 0 {
+		t.Errorf("expected the kept aggregate's events to survive the purge, got %d, %v", purged, err)
+	}
+	purged, err := repos.Outbox.PurgePublishedEvents(ctx, now.Add(time.Second), nil)
+	if err != nil || purged != 1 {
+		t.Errorf("expected the published event to be purged, got %d, %v", purged, err)
+	}
+}
+
+func TestSQLitePersistence_PurgeOrderHistory(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, _ := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+
+	customerId, err := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ada", LastName: "lovelace", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("PersistCreateCustomer returned error: %v", err)
+	}
+	var orderIds []int
+	for _, status := range []model.OrderStatus{model.OrderStatusPending, model.OrderStatusDelivered, model.OrderStatusRefunded} {
+		id, err := repos.Orders.PersistCreateOrder(ctx, model.Order{CustomerId: customerId, Status: status, TotalPrice: 1, AddressId: -1, OrderType: "PICKUP"})
+		if err != nil {
+			t.Fatalf("PersistCreateOrder returned error: %v", err)
+		}
+		orderIds = append(orderIds, id)
+	}
+	// an order that is gone, e.g. with its customer, counts as over
+	orderIds = append(orderIds, 99)
+
+	now := time.Now().UTC()
+	publish := func(orderId int, publishedAt *time.Time) {
+		t.Helper()
+		event, _ := model.NewOutboxEvent(model.AggregateOrder, orderId, model.EventOrderCreated, struct{}{})
+		if err := repos.Outbox.PersistEvent(ctx, event); err != nil {
+			t.Fatalf("PersistEvent returned error: %v", err)
+		}
+		if publishedAt == nil {
+			return
+		}
+		history, _ := repos.Outbox.FetchEventsByAggregate(ctx, model.AggregateOrder, strconv.Itoa(orderId), 0, 10)
+		if err := repos.Outbox.MarkEventPublished(ctx, history[len(history)-1].Id, *publishedAt); err != nil {
+			t.Fatalf("MarkEventPublished returned error: %v", err)
+		}
+	}
+	old := now.Add(-48 * time.Hour)
+	for _, id := range orderIds {
+		publish(id, &old)
+	}
+	// the refunded order's refund is recent and still has to be published
+	publish(orderIds[2], nil)
+
+	purged, err := repos.Outbox.PurgeOrderHistory(ctx, now.Add(-24*time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("expected the delivered and the missing order's events to be purged, got %d, %v", purged, err)
+	}
+	for i, want := range []int{1, 0, 2, 0} {
+		history, _ := repos.Outbox.FetchEventsByAggregate(ctx, model.AggregateOrder, strconv.Itoa(orderIds[i]), 0, 10)
+		if len(history) != want {
+			t.Errorf("expected %d events left for order %d, got %d", want, orderIds[i], len(history))
+		}
+	}
+}
+
+func TestSQLitePersistence_Webhooks(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, _ := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+	webhooks := repos.Webhooks
+
+	now := time.Now().UTC().Truncate(time.Second)
+	id, err := webhooks.PersistCreateSubscription(ctx, model.WebhookSubscription{
+		URL: "https://partner.example/hook", EventTypes: []string{model.EventOrderCreated}, Active: true, Secret: "whsec_1", CreatedAt: now, UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("PersistCreateSubscription returned error: %v", err)
+	}
+	if err := webhooks.PersistUpdateSubscriptionById(ctx, id, map[string]any{"event_types": []string{model.EventOrderCreated, model.EventOrderStatusChanged}}); err != nil {
+		t.Fatalf("PersistUpdateSubscriptionById returned error: %v", err)
+	}
+	subscription, err := webhooks.FetchSubscriptionById(ctx, id)
+	if err != nil || len(subscription.EventTypes) != 2 || subscription.Secret != "whsec_1" || !subscription.Active {
+		t.Fatalf("FetchSubscriptionById = %+v, %v", subscription, err)
+	}
+	if err := webhooks.PersistUpdateSubscriptionById(ctx, 999, map[string]any{"active": false}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating an unknown subscription, got %v", err)
+	}
+
+	delivery := model.WebhookDelivery{
+		SubscriptionId: id, EventId: 7, EventType: model.EventOrderCreated, Payload: json.RawMessage(`{"id":7}`),
+		Status: model.WebhookDeliveryPending, NextAttemptAt: now, CreatedAt: now,
+	}
+	for range 2 {
+		if err := webhooks.PersistDelivery(ctx, delivery); err != nil {
+			t.Fatalf("PersistDelivery returned error: %v", err)
+		}
+	}
+	due, err := webhooks.FetchDueDeliveries(ctx, now, 10)
+	if err != nil || len(due) != 1 || string(due[0].Payload) != `{"id":7}` || due[0].LastAttemptAt != nil {
+		t.Fatalf("expected the duplicate to be dropped, got %+v, %v", due, err)
+	}
+
+	if claimed, err := webhooks.ClaimDelivery(ctx, due[0].Id, 0, now, now.Add(time.Minute)); err != nil || !claimed {
+		t.Fatalf("ClaimDelivery = %v, %v", claimed, err)
+	}
+	if claimed, _ := webhooks.ClaimDelivery(ctx, due[0].Id, 0, now, now.Add(time.Minute)); claimed {
+		t.Error("expected a second claim on the same attempt to lose")
+	}
+	if err := webhooks.PersistDeliveryResult(ctx, due[0].Id, model.WebhookDeliveryResult{
+		StatusCode: 500, Error: "boom", AttemptedAt: now, Status: model.WebhookDeliveryDead, NextAttemptAt: now,
+	}); err != nil {
+		t.Fatalf("PersistDeliveryResult returned error: %v", err)
+	}
+
+	dead, err := webhooks.FetchDeliveriesBySubscription(ctx, id, model.WebhookDeliveryDead, 10)
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 1 || dead[0].LastStatusCode != 500 || dead[0].LastError != "boom" || !dead[0].LastAttemptAt.Equal(now) {
+		t.Fatalf("FetchDeliveriesBySubscription(DEAD) = %+v, %v", dead, err)
+	}
+	if pending, _ := webhooks.FetchDeliveriesBySubscription(ctx, id, model.WebhookDeliveryPending, 10); len(pending) != 0 {
+		t.Errorf("expected no pending deliveries, got %+v", pending)
+	}
+
+	if err := webhooks.PersistRequeueDelivery(ctx, dead[0].Id, now); err != nil {
+		t.Fatalf("PersistRequeueDelivery returned error: %v", err)
+	}
+	due, _ = webhooks.FetchDueDeliveries(ctx, now, 10)
+	if len(due) != 1 || due[0].Attempts != 0 {
+		t.Fatalf("expected the requeued delivery to be due with a fresh budget, got %+v", due)
+	}
+	if due[0].TotalAttempts != 1 || due[0].Redeliveries != 1 || !due[0].LastRedeliveredAt.Equal(now) || due[0].LastError != "boom" {
+		t.Errorf("expected the requeue to keep the delivery's history, got %+v", due[0])
+	}
+
+	if err := webhooks.PersistUpdateSubscriptionById(ctx, id, map[string]any{"active": false}); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := webhooks.FetchDueDeliveries(ctx, now, 10); len(due) != 0 {
+		t.Errorf("expected deliveries to an inactive subscription to wait, got %+v", due)
+	}
+
+	if err := webhooks.PersistDeleteSubscriptionById(ctx, id); err != nil {
+		t.Fatalf("PersistDeleteSubscriptionById returned error: %v", err)
+	}
+	if _, err := webhooks.FetchDeliveryById(ctx, dead[0].Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the delivery log to go with the subscription, got %v", err)
+	}
+}
+
+func TestSQLitePersistence_Jobs(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, _ := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+	jobs := repos.Jobs
+
+	now := time.Now().UTC().Truncate(time.Second)
+	first, created, err := jobs.PersistEnqueueJob(ctx, model.Job{Type: "email.send", Payload: json.RawMessage(`{"to":"a"}`), RunAt: now, UniqueKey: "once", CreatedAt: now})
+	if err != nil || !created {
+		t.Fatalf("PersistEnqueueJob = %d, %v, %v", first, created, err)
+	}
+	if id, created, err := jobs.PersistEnqueueJob(ctx, model.Job{Type: "email.send", RunAt: now, UniqueKey: "once", CreatedAt: now}); err != nil || created || id != 0 {
+		t.Fatalf("expected the duplicate unique key to be skipped, got %d, %v, %v", id, created, err)
+	}
+	later, _, _ := jobs.PersistEnqueueJob(ctx, model.Job{Type: "email.send", RunAt: now.Add(time.Hour), CreatedAt: now})
+	other, _, _ := jobs.PersistEnqueueJob(ctx, model.Job{Type: "report.build", RunAt: now, CreatedAt: now})
+
+	claimed, err := jobs.ClaimJobs(ctx, []string{"email.send"}, now, now.Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 || claimed[0].Id != first || claimed[0].Attempts != 1 || claimed[0].Status != model.JobRunning || string(claimed[0].Payload) != `{"to":"a"}` {
+		t.Fatalf("expected only the due job of the claimed type, got %+v, %v", claimed, err)
+	}
+	if again, _ := jobs.ClaimJobs(ctx, []string{"email.send"}, now, now.Add(time.Minute), 10); len(again) != 0 {
+		t.Fatalf("expected a leased job not to be claimed twice, got %+v", again)
+	}
+
+	// the lease runs out and another worker takes over, so the first worker's outcome is refused
+	reclaimed, _ := jobs.ClaimJobs(ctx, []string{"email.send"}, now.Add(time.Minute), now.Add(2*time.Minute), 10)
+	if len(reclaimed) != 1 || reclaimed[0].Attempts != 2 {
+		t.Fatalf("expected the expired lease to be claimed again, got %+v", reclaimed)
+	}
+	if err := jobs.PersistJobSucceeded(ctx, first, 1, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a stale attempt to be refused, got %v", err)
+	}
+	if err := jobs.PersistJobFailed(ctx, first, 2, "smtp down", false, now.Add(5*time.Minute), now); err != nil {
+		t.Fatalf("PersistJobFailed returned error: %v", err)
+	}
+	job, err := jobs.FetchJobById(ctx, first)
+	if err != nil || job.Status != model.JobPending || job.LastError != "smtp down" || !job.RunAt.Equal(now.Add(5*time.Minute)) || job.LockedUntil != nil {
+		t.Fatalf("FetchJobById after failure = %+v, %v", job, err)
+	}
+
+	claimed, _ = jobs.ClaimJobs(ctx, []string{"email.send", "report.build"}, now.Add(5*time.Minute), now.Add(6*time.Minute), 10)
+	if len(claimed) != 2 || claimed[0].Id != other || claimed[1].Id != first {
+		t.Fatalf("expected both due jobs, oldest due first, got %+v", claimed)
+	}
+	if err := jobs.PersistJobFailed(ctx, first, 3, "bounced", true, now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.PersistJobSucceeded(ctx, other, 1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed, _ := jobs.ClaimJobs(ctx, []string{"email.send"}, now.Add(time.Hour), now.Add(2*time.Hour), 10); len(claimed) != 1 || claimed[0].Id != later {
+		t.Fatalf("expected the later job to be due, got %+v", claimed)
+	}
+	if err := jobs.PersistJobSnoozed(ctx, later, 1, now.Add(3*time.Hour), now); err != nil {
+		t.Fatalf("PersistJobSnoozed returned error: %v", err)
+	}
+	if job, err := jobs.FetchJobById(ctx, later); err != nil || job.Status != model.JobPending || job.Attempts != 0 || !job.RunAt.Equal(now.Add(3*time.Hour)) {
+		t.Fatalf("FetchJobById after snoozing = %+v, %v", job, err)
+	}
+
+	dead, err := jobs.FetchJobs(ctx, model.JobDead, "", 10)
+	if err != nil || len(dead) != 1 || dead[0].Id != first || dead[0].CompletedAt == nil {
+		t.Fatalf("FetchJobs(DEAD) = %+v, %v", dead, err)
+	}
+	if all, _ := jobs.FetchJobs(ctx, "", "email.send", 10); len(all) != 2 || all[0].Id != later {
+		t.Errorf("expected the email jobs newest first, got %+v", all)
+	}
+
+	if err := jobs.PersistRetryJob(ctx, first, now); err != nil {
+		t.Fatalf("PersistRetryJob returned error: %v", err)
+	}
+	if job, _ := jobs.FetchJobById(ctx, first); job.Status != model.JobPending || job.Attempts != 0 || job.CompletedAt != nil {
+		t.Errorf("expected a fresh pending job, got %+v", job)
+	}
+	if err := jobs.PersistRetryJob(ctx, 999, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound retrying an unknown job, got %v", err)
+	}
+
+	if purged, err := jobs.PurgeSucceededJobs(ctx, now.Add(time.Second)); err != nil || purged != 1 {
+		t.Fatalf("PurgeSucceededJobs = %d, %v", purged, err)
+	}
+	if _, err := jobs.FetchJobById(ctx, other); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the succeeded job to be purged, got %v", err)
+	}
+}
+
+func TestSQLitePersistence_SMS(t *testing.T) {
+	db := sqlitetest.New(t)
+	ctx := context.Background()
+	repos, _ := NewSQLRepositories(db, dialect.SQLite, zap.NewNop())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	customerId, err := repos.Customers.PersistCreateCustomer(ctx, model.Customer{FirstName: "ada", PhoneNumber: "+15555550100", SMSOptIn: true, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer, _ := repos.Customers.FetchCustomerById(ctx, customerId); !customer.SMSOptIn {
+		t.Fatalf("expected the sms opt-in to round trip, got %+v", customer)
+	}
+	if updated, err := repos.Customers.PersistSMSOptInByPhoneNumber(ctx, "+15555550100", false); err != nil || updated != 1 {
+		t.Fatalf("PersistSMSOptInByPhoneNumber = %d, %v", updated, err)
+	}
+	if updated, _ := repos.Customers.PersistSMSOptInByPhoneNumber(ctx, "+15555550199", false); updated != 0 {
+		t.Errorf("expected an unknown number to change nothing, got %d", updated)
+	}
+	if customer, _ := repos.Customers.FetchCustomerById(ctx, customerId); customer.SMSOptIn {
+		t.Errorf("expected the customer to be opted out, got %+v", customer)
+	}
+
+	sms := repos.SMS
+	pending := model.SMSMessage{DedupeKey: "1:ready_for_pickup", CustomerId: customerId, OrderId: 7, Template: "ready_for_pickup",
+		To: "+15555550100", Body: "ready", Encoding: "GSM-7", Segments: 1, Status: model.SMSPending, Provider: "fake", CreatedAt: now}
+	first, created, err := sms.PersistCreateSMSMessage(ctx, pending)
+	if err != nil || !created || first.Id == 0 {
+		t.Fatalf("PersistCreateSMSMessage = %+v, %v, %v", first, created, err)
+	}
+	if again, created, err := sms.PersistCreateSMSMessage(ctx, pending); err != nil || created || again.Id != first.Id || again.Body != "ready" {
+		t.Fatalf("expected the text with the same dedupe key back, got %+v, %v, %v", again, created, err)
+	}
+
+	if err := sms.PersistSMSMessageFailed(ctx, first.Id, "gateway timeout", false, now); err != nil {
+		t.Fatalf("PersistSMSMessageFailed returned error: %v", err)
+	}
+	if err := sms.PersistSMSMessageSent(ctx, first.Id, "msg-1", model.SMSSent, now); err != nil {
+		t.Fatalf("PersistSMSMessageSent returned error: %v", err)
+	}
+	if err := sms.PersistSMSMessageSent(ctx, first.Id, "msg-2", model.SMSSent, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a text that is no longer pending not to be sent again, got %v", err)
+	}
+
+	if err := sms.PersistSMSStatus(ctx, "fake", "msg-1", model.SMSDelivered, "", now.Add(time.Minute)); err != nil {
+		t.Fatalf("PersistSMSStatus returned error: %v", err)
+	}
+	if err := sms.PersistSMSStatus(ctx, "fake", "msg-1", model.SMSFailed, "late report", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a delivered text to keep its status, got %v", err)
+	}
+	if err := sms.PersistSMSStatus(ctx, "other", "msg-1", model.SMSDelivered, "", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another provider's message id not to match, got %v", err)
+	}
+
+	second, _, _ := sms.PersistCreateSMSMessage(ctx, model.SMSMessage{DedupeKey: "2:out_for_delivery", CustomerId: customerId, OrderId: 7,
+		Template: "out_for_delivery", To: "+15555550100", Body: "on its way", Encoding: "GSM-7", Segments: 1, Status: model.SMSPending, Provider: "fake", CreatedAt: now})
+	if err := sms.PersistSMSMessageFailed(ctx, second.Id, "invalid number", true, now); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered, err := sms.FetchSMSMessages(ctx, model.SMSDelivered, 0, 10)
+	if err != nil || len(delivered) != 1 || delivered[0].ProviderMessageId != "msg-1" || delivered[0].Error != "" ||
+		delivered[0].SentAt == nil || delivered[0].DeliveredAt == nil || !delivered[0].DeliveredAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("FetchSMSMessages(DELIVERED) = %+v, %v", delivered, err)
+	}
+	all, err := sms.FetchSMSMessages(ctx, "", customerId, 10)
+	if err != nil || len(all) != 2 || all[0].Id != second.Id || all[0].Status != model.SMSFailed || all[0].Error != "invalid number" {
+		t.Fatalf("expected the customer's texts newest first, got %+v, %v", all, err)
+	}
+	if none, _ := sms.FetchSMSMessages(ctx, "", customerId+1, 10); len(none) != 0 {
+		t.Errorf("expected no texts for another customer, got %+v", none)
+	}
+}
@@ -0,0 +1,203 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_TX_MAX_RETRIES = 3
+	txRetryBaseDelay       = 25 * time.Millisecond
+)
+
+// postgres SQLSTATE codes and sqlite primary result codes that mean the transaction lost a race and can safely be
+// replayed from the start
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+	sqliteBusy                   = 5
+	sqliteLocked                 = 6
+)
+
+// TxPersistence holds the postgres persistence structs the UnitOfWork hands out transaction-scoped copies of.
+// Everything done through those copies inside a UnitOfWork callback is committed or rolled back together
+type TxPersistence struct {
+	Users     UserPersistence
+	Customers CustomerPersistence
+	Addresses AddressPersistence
+	Orders    OrderPersistence
+	Outbox    OutboxPersistence
+	Webhooks  WebhookPersistence
+	Jobs      JobPersistence
+	SMS       SMSPersistence
+}
+
+var _ Transactor = UnitOfWork{}
+
+// NewSQLRepositories builds every SQL persistence struct on top of one connection pool, along with a UnitOfWork that
+// hands out transaction-scoped copies of the same structs
+func NewSQLRepositories(dbHandle *sql.DB, d dialect.Dialect, logger *zap.Logger) (Repositories, UnitOfWork) {
+	handle := WithDialect(WithTracing(dbHandle, d), d)
+	persisters := TxPersistence{
+		Users:     NewUserPersistence(handle, logger),
+		Customers: NewCustomerPersistence(handle, logger),
+		Addresses: NewAddressPersistence(handle, logger),
+		Orders:    NewOrderPersistence(handle, logger),
+		Outbox:    NewOutboxPersistence(handle, logger),
+		Webhooks:  NewWebhookPersistence(handle, logger),
+		Jobs:      NewJobPersistence(handle, d, logger),
+		SMS:       NewSMSPersistence(handle, logger),
+	}
+
+	repos := Repositories{
+		Users:     persisters.Users,
+		Customers: persisters.Customers,
+		Addresses: persisters.Addresses,
+		Orders:    persisters.Orders,
+		Outbox:    persisters.Outbox,
+		Webhooks:  persisters.Webhooks,
+		Jobs:      persisters.Jobs,
+		SMS:       persisters.SMS,
+	}
+	return repos, NewUnitOfWork(dbHandle, persisters, logger)
+}
+
+type UnitOfWork struct {
+	DbHandle   *sql.DB
+	Persisters TxPersistence
+	TxOptions  *sql.TxOptions
+	MaxRetries int
+	Logger     *zap.Logger
+}
+
+func NewUnitOfWork(dbHandle *sql.DB, persisters TxPersistence, logger *zap.Logger) UnitOfWork {
+	return UnitOfWork{
+		DbHandle:   dbHandle,
+		Persisters: persisters,
+		TxOptions:  &sql.TxOptions{Isolation: sql.LevelSerializable},
+		MaxRetries: DEFAULT_TX_MAX_RETRIES,
+		Logger:     logger.Named("unit_of_work"),
+	}
+}
+
+// Do runs fn inside a single database transaction. The transaction is committed if fn returns nil and rolled back
+// otherwise. When postgres aborts the transaction with a serialization failure or deadlock, the whole callback is
+// replayed in a fresh transaction up to MaxRetries times, so fn must not have side effects outside of the database
+func (uow UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	ctx, span := tracing.Start(ctx, "UnitOfWork.Do")
+	defer span.End()
+	zLog := uow.getZLog(ctx)
+
+	for attempt := 0; ; attempt++ {
+		err := uow.runOnce(ctx, fn)
+		if err == nil {
+			span.SetAttributes(attribute.Int("tx.attempts", attempt+1))
+			return nil
+		}
+
+		if !isRetryableTxError(err) || attempt >= uow.MaxRetries {
+			span.SetAttributes(attribute.Int("tx.attempts", attempt+1))
+			tracing.RecordError(span, err)
+			return err
+		}
+
+		delay := txRetryDelay(attempt)
+		span.AddEvent("transaction aborted, retrying", trace.WithAttributes(attribute.String("error", err.Error())))
+		zLog.Warn("transaction aborted, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			tracing.RecordError(span, ctx.Err())
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (uow UnitOfWork) runOnce(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	zLog := uow.getZLog(ctx)
+
+	tx, err := uow.DbHandle.BeginTx(ctx, uow.TxOptions)
+	if err != nil {
+		zLog.Error("BeginTx failed", zap.Error(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// a panic inside the callback must not leave the connection checked out with an open transaction
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, uow.Persisters.withTx(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			zLog.Error("Rollback failed", zap.Error(rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		zLog.Error("Commit failed", zap.Error(err))
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (tp TxPersistence) withTx(tx *sql.Tx) Repositories {
+	return Repositories{
+		Users:     tp.Users.WithTx(tx),
+		Customers: tp.Customers.WithTx(tx),
+		Addresses: tp.Addresses.WithTx(tx),
+		Orders:    tp.Orders.WithTx(tx),
+		Outbox:    tp.Outbox.WithTx(tx),
+		Webhooks:  tp.Webhooks.WithTx(tx),
+		Jobs:      tp.Jobs.WithTx(tx),
+		SMS:       tp.SMS.WithTx(tx),
+	}
+}
+
+// both lib/pq and pgx expose the postgres error code through an SQLState method, and the sqlite driver exposes its
+// extended result code through Code, which keeps this check driver agnostic
+func isRetryableTxError(err error) bool {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		code := stateErr.SQLState()
+		return code == sqlStateSerializationFailure || code == sqlStateDeadlockDetected
+	}
+
+	var codeErr interface{ Code() int }
+	if errors.As(err, &codeErr) {
+		// the low byte of an extended result code is the primary code
+		code := codeErr.Code() & 0xff
+		return code == sqliteBusy || code == sqliteLocked
+	}
+	return false
+}
+
+// exponential backoff with full jitter: 0-25ms, 0-50ms, 0-100ms, ...
+func txRetryDelay(attempt int) time.Duration {
+	ceiling := txRetryBaseDelay << attempt
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
+}
+
+func (uow UnitOfWork) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, uow.Logger)
+}
@@ -0,0 +1,178 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/testutil/pgtest"
+	"go.uber.org/zap"
+)
+
+// stubConnector hands out connections whose transactions always begin and commit, so the retry loop can run without
+// a database
+type stubConnector struct{}
+
+func (stubConnector) Connect(context.Context) (driver.Conn, error) { return stubConn{}, nil }
+func (stubConnector) Driver() driver.Driver                        { return stubDriver{} }
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stub connection runs no queries")
+}
+
+func (c stubConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c stubConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+
+func (stubConn) Close() error    { return nil }
+func (stubConn) Commit() error   { return nil }
+func (stubConn) Rollback() error { return nil }
+
+func newStubUnitOfWork(t *testing.T) UnitOfWork {
+	t.Helper()
+	db := sql.OpenDB(stubConnector{})
+	t.Cleanup(func() { db.Close() })
+	return NewUnitOfWork(db, TxPersistence{}, zap.NewNop())
+}
+
+func newTestUnitOfWork(t *testing.T) (UnitOfWork, OrderPersistence) {
+	t.Helper()
+	db := pgtest.New(t)
+	logger := zap.NewNop()
+	orders := NewOrderPersistence(db, logger)
+	uow := NewUnitOfWork(db, TxPersistence{
+		Users:     NewUserPersistence(db, logger),
+		Customers: NewCustomerPersistence(db, logger),
+		Addresses: NewAddressPersistence(db, logger),
+		Orders:    orders,
+	}, logger)
+	return uow, orders
+}
+
+func TestUnitOfWork_CommitsOnSuccess(t *testing.T) {
+	uow, orders := newTestUnitOfWork(t)
+	ctx := context.Background()
+	order := pgtest.CreateOrder(t, uow.DbHandle)
+
+	err := uow.Do(ctx, func(ctx context.Context, repos Repositories) error {
+		return repos.Orders.PersistUpdateOrderById(ctx, order.Id, map[string]any{"total_price": 1.25})
+	})
+	if err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+
+	got, _ := orders.FetchOrderById(ctx, order.Id)
+	if got.TotalPrice != 1.25 {
+		t.Errorf("expected committed total price 1.25, got %v", got.TotalPrice)
+	}
+}
+
+func TestUnitOfWork_RollsBackOnError(t *testing.T) {
+	uow, orders := newTestUnitOfWork(t)
+	ctx := context.Background()
+	order := pgtest.CreateOrder(t, uow.DbHandle)
+
+	wantErr := errors.New("abort")
+	err := uow.Do(ctx, func(ctx context.Context, repos Repositories) error {
+		if err := repos.Orders.PersistUpdateOrderById(ctx, order.Id, map[string]any{"total_price": 1.25}); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+
+	got, _ := orders.FetchOrderById(ctx, order.Id)
+	if got.TotalPrice != order.TotalPrice {
+		t.Errorf("expected rollback to keep total price %v, got %v", order.TotalPrice, got.TotalPrice)
+	}
+}
+
+type fakeStateError struct{ code string }
+
+func (e fakeStateError) Error() string    { return "sqlstate " + e.code }
+func (e fakeStateError) SQLState() string { return e.code }
+
+func TestIsRetryableTxError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", fakeStateError{"40001"}, true},
+		{"deadlock", fakeStateError{"40P01"}, true},
+		{"wrapped serialization failure", fmt.Errorf("commit: %w", fakeStateError{"40001"}), true},
+		{"unique violation", fakeStateError{"23505"}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableTxError(tt.err); got != tt.want {
+				t.Errorf("isRetryableTxError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitOfWork_RetriesSerializationFailures(t *testing.T) {
+	uow := newStubUnitOfWork(t)
+
+	attempts := 0
+	err := uow.Do(context.Background(), func(ctx context.Context, repos Repositories) error {
+		attempts++
+		if attempts < 3 {
+			return fakeStateError{"40001"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	attempts = 0
+	err = uow.Do(context.Background(), func(ctx context.Context, repos Repositories) error {
+		attempts++
+		return fakeStateError{"40001"}
+	})
+	if err == nil {
+		t.Fatal("expected the error to surface once retries are exhausted")
+	}
+	if attempts != DEFAULT_TX_MAX_RETRIES+1 {
+		t.Errorf("expected %d attempts, got %d", DEFAULT_TX_MAX_RETRIES+1, attempts)
+	}
+}
+
+func TestUnitOfWork_DoesNotRetryOtherErrors(t *testing.T) {
+	uow := newStubUnitOfWork(t)
+
+	attempts := 0
+	wantErr := errors.New("abort")
+	err := uow.Do(context.Background(), func(ctx context.Context, repos Repositories) error {
+		attempts++
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
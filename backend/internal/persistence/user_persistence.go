@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/utils"
@@ -10,25 +11,34 @@ import (
 )
 
 type UserPersistence struct {
-	DbHandle *sql.DB
+	DbHandle DBTX
 	Logger   *zap.Logger
 }
 
-func NewUserPersistence(dbHandle *sql.DB, logger *zap.Logger) UserPersistence {
+func NewUserPersistence(dbHandle DBTX, logger *zap.Logger) UserPersistence {
 	return UserPersistence{
 		DbHandle: dbHandle,
 		Logger:   logger,
 	}
 }
 
-func (up UserPersistence) PersistCreateUser(ctx context.Context, userDomain model.User) error {
+// returns a copy of the persistence that runs its statements against the given transaction
+func (up UserPersistence) WithTx(tx *sql.Tx) UserPersistence {
+	up.DbHandle = bindTx(up.DbHandle, tx)
+	return up
+}
+
+// PersistCreateUser inserts the user and returns the id it was given
+func (up UserPersistence) PersistCreateUser(ctx context.Context, userDomain model.User) (int, error) {
 	zLog := utils.FromContext(ctx, up.Logger).Named("user_persistence")
 	zLog.Debug("Entered PersistCreateUser")
 	query := `
 		INSERT INTO users (email, created_at, updated_at, is_active, customer_id, gc_auth_id)
 		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
 	`
-	_, err := up.DbHandle.ExecContext(
+	var id int
+	err := up.DbHandle.QueryRowContext(
 		ctx,
 		query,
 		userDomain.Email,
@@ -37,11 +47,40 @@ func (up UserPersistence) PersistCreateUser(ctx context.Context, userDomain mode
 		userDomain.IsActive,
 		userDomain.CustomerId,
 		userDomain.GCAuthId,
-	)
+	).Scan(&id)
 	if err != nil {
-		zLog.Error("ExecContext failed: %w", zap.Error(err))
-		return err
+		zLog.Error("QueryRowContext failed for PersistCreateUser", zap.Error(err))
+		return 0, err
 	}
 
-	return nil
+	return id, nil
+}
+
+// FetchUserByAuthId looks a user up by the id their identity provider knows them by
+func (up UserPersistence) FetchUserByAuthId(ctx context.Context, gcAuthId string) (model.User, error) {
+	zLog := utils.FromContext(ctx, up.Logger).Named("user_persistence")
+	zLog.Debug("Entered FetchUserByAuthId")
+	query := `
+		SELECT id, email, created_at, updated_at, is_active, customer_id, gc_auth_id
+		FROM users
+		WHERE gc_auth_id = $1
+	`
+	var user model.User
+	err := up.DbHandle.QueryRowContext(ctx, query, gcAuthId).Scan(
+		&user.Id,
+		&user.Email,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+		&user.CustomerId,
+		&user.GCAuthId,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("QueryRowContext failed for FetchUserByAuthId", zap.Error(err))
+		return model.User{}, err
+	}
+	return user, nil
 }
@@ -0,0 +1,414 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+type WebhookPersistence struct {
+	DbHandle DBTX
+	Logger   *zap.Logger
+}
+
+func NewWebhookPersistence(dbHandle DBTX, logger *zap.Logger) WebhookPersistence {
+	return WebhookPersistence{
+		DbHandle: dbHandle,
+		Logger:   logger,
+	}
+}
+
+// returns a copy of the persistence that runs its statements against the given transaction
+func (wp WebhookPersistence) WithTx(tx *sql.Tx) WebhookPersistence {
+	wp.DbHandle = bindTx(wp.DbHandle, tx)
+	return wp
+}
+
+const webhookSubscriptionColumns = `id, url, event_types, description, active, secret, created_at, updated_at`
+
+// PersistCreateSubscription inserts the subscription and returns the id it was given
+func (wp WebhookPersistence) PersistCreateSubscription(ctx context.Context, subscription model.WebhookSubscription) (int, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistCreateSubscription")
+
+	eventTypes, err := json.Marshal(subscription.EventTypes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event types: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (url, event_types, description, active, secret, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	var id int
+	err = wp.DbHandle.QueryRowContext(
+		ctx,
+		query,
+		subscription.URL,
+		jsonParam(eventTypes),
+		subscription.Description,
+		subscription.Active,
+		subscription.Secret,
+		subscription.CreatedAt,
+		subscription.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		zLog.Error("QueryRowContext failed for PersistCreateSubscription", zap.Error(err))
+		return 0, err
+	}
+	return id, nil
+}
+
+func (wp WebhookPersistence) FetchAllSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered FetchAllSubscriptions")
+
+	rows, err := wp.DbHandle.QueryContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		zLog.Error("QueryContext failed for FetchAllSubscriptions", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]model.WebhookSubscription, 0)
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (wp WebhookPersistence) FetchSubscriptionById(ctx context.Context, id int) (model.WebhookSubscription, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered FetchSubscriptionById")
+
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	subscription, err := scanWebhookSubscription(wp.DbHandle.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.WebhookSubscription{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("scan operation failed for FetchSubscriptionById", zap.Error(err))
+		return model.WebhookSubscription{}, err
+	}
+	return subscription, nil
+}
+
+// PersistUpdateSubscriptionById applies updates keyed by column. event_types takes a []string. Returns ErrNotFound
+// when no subscription has the id
+func (wp WebhookPersistence) PersistUpdateSubscriptionById(ctx context.Context, id int, updates map[string]any) error {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistUpdateSubscriptionById")
+
+	allowedFields := map[string]bool{
+		"url":         true,
+		"event_types": true,
+		"description": true,
+		"active":      true,
+	}
+
+	query := "UPDATE webhook_subscriptions SET "
+	args := []any{}
+	argPosition := 1
+
+	for field, value := range updates {
+		if !allowedFields[field] {
+			zLog.Error("Attempted to update invalid field", zap.String("field", field))
+			return fmt.Errorf("invalid field: %s", field)
+		}
+		if eventTypes, ok := value.([]string); ok {
+			raw, err := json.Marshal(eventTypes)
+			if err != nil {
+				return fmt.Errorf("failed to marshal event types: %w", err)
+			}
+			value = jsonParam(raw)
+		}
+
+		query += field + " = $" + fmt.Sprintf("%d", argPosition) + ", "
+		args = append(args, value)
+		argPosition++
+	}
+
+	query += "updated_at = $" + fmt.Sprintf("%d", argPosition)
+	args = append(args, time.Now())
+	argPosition++
+
+	query += " WHERE id = $" + fmt.Sprintf("%d", argPosition)
+	args = append(args, id)
+
+	result, err := wp.DbHandle.ExecContext(ctx, query, args...)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistUpdateSubscriptionById", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+// PersistDeleteSubscriptionById deletes the subscription along with its delivery log. Returns ErrNotFound when no
+// subscription has the id
+func (wp WebhookPersistence) PersistDeleteSubscriptionById(ctx context.Context, id int) error {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistDeleteSubscriptionById")
+
+	result, err := wp.DbHandle.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistDeleteSubscriptionById", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+const webhookDeliveryColumns = `d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.total_attempts, d.redeliveries, d.last_redelivered_at, d.next_attempt_at, d.last_attempt_at, COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.delivered_at,
+	d.created_at`
+
+// PersistDelivery queues a delivery. A delivery of the same event to the same subscription already queued is left
+// as it is, which absorbs the relay publishing an event twice
+func (wp WebhookPersistence) PersistDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistDelivery")
+
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+	_, err := wp.DbHandle.ExecContext(
+		ctx,
+		query,
+		delivery.SubscriptionId,
+		delivery.EventId,
+		delivery.EventType,
+		jsonParam(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt.UTC(),
+		delivery.CreatedAt.UTC(),
+	)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistDelivery", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// FetchDueDeliveries returns up to limit pending deliveries whose next attempt is due at now, oldest first. Deliveries
+// to inactive subscriptions wait until the subscription is switched back on
+func (wp WebhookPersistence) FetchDueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered FetchDueDeliveries")
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = $1 AND d.next_attempt_at <= $2 AND s.active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT $3
+	`
+	return wp.queryDeliveries(ctx, zLog, "FetchDueDeliveries", query, model.WebhookDeliveryPending, now.UTC(), limit)
+}
+
+// FetchDeliveriesBySubscription returns the subscription's most recent deliveries first, optionally only those with
+// the given status
+func (wp WebhookPersistence) FetchDeliveriesBySubscription(ctx context.Context, subscriptionId int, status model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered FetchDeliveriesBySubscription")
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		WHERE d.subscription_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3
+	`
+	return wp.queryDeliveries(ctx, zLog, "FetchDeliveriesBySubscription", query, subscriptionId, string(status), limit)
+}
+
+func (wp WebhookPersistence) FetchDeliveryById(ctx context.Context, id int64) (model.WebhookDelivery, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered FetchDeliveryById")
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d WHERE d.id = $1`
+	delivery, err := scanWebhookDelivery(wp.DbHandle.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.WebhookDelivery{}, ErrNotFound
+	}
+	if err != nil {
+		zLog.Error("scan operation failed for FetchDeliveryById", zap.Error(err))
+		return model.WebhookDelivery{}, err
+	}
+	return delivery, nil
+}
+
+// ClaimDelivery starts an attempt at a delivery fetched with the given attempt count. It pushes the next attempt out
+// to leaseUntil, so a dispatcher that dies mid-attempt only delays the delivery, and reports false when another
+// dispatcher claimed the delivery first
+func (wp WebhookPersistence) ClaimDelivery(ctx context.Context, id int64, attempts int, now, leaseUntil time.Time) (bool, error) {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered ClaimDelivery")
+
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, total_attempts = total_attempts + 1, last_attempt_at = $1, next_attempt_at = $2
+		WHERE id = $3 AND status = $4 AND attempts = $5
+	`
+	result, err := wp.DbHandle.ExecContext(ctx, query, now.UTC(), leaseUntil.UTC(), id, model.WebhookDeliveryPending, attempts)
+	if err != nil {
+		zLog.Error("ExecContext failed for ClaimDelivery", zap.Error(err))
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// PersistDeliveryResult records the outcome of the attempt ClaimDelivery started
+func (wp WebhookPersistence) PersistDeliveryResult(ctx context.Context, id int64, result model.WebhookDeliveryResult) error {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistDeliveryResult")
+
+	var deliveredAt, lastError, statusCode any
+	if result.Status == model.WebhookDeliveryDelivered {
+		deliveredAt = result.AttemptedAt.UTC()
+	}
+	if result.Error != "" {
+		lastError = result.Error
+	}
+	if result.StatusCode != 0 {
+		statusCode = result.StatusCode
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, next_attempt_at = $2, last_status_code = $3, last_error = $4, delivered_at = $5
+		WHERE id = $6
+	`
+	if _, err := wp.DbHandle.ExecContext(ctx, query, result.Status, result.NextAttemptAt.UTC(), statusCode, lastError, deliveredAt, id); err != nil {
+		zLog.Error("ExecContext failed for PersistDeliveryResult", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PersistRequeueDelivery puts a delivery, whatever its status, back in line for an attempt at the given time with a
+// fresh attempt budget. The total attempt count and last result are kept, and the redelivery is recorded. Returns
+// ErrNotFound when no delivery has the id
+func (wp WebhookPersistence) PersistRequeueDelivery(ctx context.Context, id int64, at time.Time) error {
+	zLog := wp.getZLog(ctx)
+	zLog.Debug("entered PersistRequeueDelivery")
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, redeliveries = redeliveries + 1, last_redelivered_at = $2, next_attempt_at = $2,
+			delivered_at = NULL
+		WHERE id = $3
+	`
+	result, err := wp.DbHandle.ExecContext(ctx, query, model.WebhookDeliveryPending, at.UTC(), id)
+	if err != nil {
+		zLog.Error("ExecContext failed for PersistRequeueDelivery", zap.Error(err))
+		return err
+	}
+	return requireRow(result)
+}
+
+func (wp WebhookPersistence) queryDeliveries(ctx context.Context, zLog *zap.Logger, name, query string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := wp.DbHandle.QueryContext(ctx, query, args...)
+	if err != nil {
+		zLog.Error("QueryContext failed for "+name, zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			zLog.Error("scan operation failed", zap.Error(err))
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func scanWebhookSubscription(row rowScanner) (model.WebhookSubscription, error) {
+	var subscription model.WebhookSubscription
+	var eventTypes []byte
+	err := row.Scan(
+		&subscription.Id,
+		&subscription.URL,
+		&eventTypes,
+		&subscription.Description,
+		&subscription.Active,
+		&subscription.Secret,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return subscription, err
+	}
+	if err := json.Unmarshal(eventTypes, &subscription.EventTypes); err != nil {
+		return subscription, fmt.Errorf("invalid event types for webhook subscription %d: %w", subscription.Id, err)
+	}
+	return subscription, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	var payload []byte
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.SubscriptionId,
+		&delivery.EventId,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.TotalAttempts,
+		&delivery.Redeliveries,
+		&delivery.LastRedeliveredAt,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+	)
+	delivery.Payload = payload
+	return delivery, err
+}
+
+// requireRow turns a statement that touched no rows into ErrNotFound
+func requireRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (wp WebhookPersistence) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, wp.Logger).Named("webhook_persistence")
+}
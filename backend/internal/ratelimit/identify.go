@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Identifier decides who a request counts against, preferring the most specific identity available: the
+// authenticated user, then the API key, then the client IP. Header-based identities must only be configured when a
+// proxy in front of the server sets (and strips client-supplied copies of) those headers, otherwise clients could
+// pick their own bucket
+type Identifier struct {
+	// UserHeader carries the authenticated principal, e.g. X-Apigateway-Api-Userinfo behind GCP API Gateway
+	UserHeader string
+	// APIKeyHeader carries the caller's API key
+	APIKeyHeader string
+	// ClientIPHeader is the X-Forwarded-For style header the trusted proxy appends the client address to. Empty means
+	// the connection's remote address is used
+	ClientIPHeader string
+	// TrustedProxies is how many proxies append to ClientIPHeader; the client is the entry that many from the right
+	TrustedProxies int
+}
+
+// Key returns a bucket key such as "user:…", "apikey:…" or "ip:203.0.113.7". Secrets are hashed so raw keys never
+// sit in a store or show up in its logs
+func (id Identifier) Key(r *http.Request) string {
+	if id.UserHeader != "" {
+		if user := r.Header.Get(id.UserHeader); user != "" {
+			return "user:" + digest(user)
+		}
+	}
+	if id.APIKeyHeader != "" {
+		if key := r.Header.Get(id.APIKeyHeader); key != "" {
+			return "apikey:" + digest(key)
+		}
+	}
+	return "ip:" + id.clientIP(r)
+}
+
+func (id Identifier) clientIP(r *http.Request) string {
+	if id.ClientIPHeader != "" {
+		var hops []string
+		for _, value := range r.Header.Values(id.ClientIPHeader) {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+		// entries further left were supplied by the client itself and cannot be trusted
+		trusted := max(id.TrustedProxies, 1)
+		if len(hops) >= trusted {
+			if ip := net.ParseIP(hops[len(hops)-trusted]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func digest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// how often MemoryStore drops buckets that have refilled completely; a full bucket is indistinguishable from a missing
+// one, so forgetting it changes nothing but the memory footprint
+const DEFAULT_SWEEP_INTERVAL = time.Minute
+
+// MemoryStore keeps buckets in process memory. Limits are per instance, so N instances allow up to N times the
+// configured rate in total
+type MemoryStore struct {
+	SweepInterval time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		SweepInterval: DEFAULT_SWEEP_INTERVAL,
+		buckets:       make(map[string]*memoryBucket),
+	}
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	// fullAt is when the bucket will have refilled completely, used by the sweep
+	fullAt time.Time
+}
+
+func (ms *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Decision, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sweep(now)
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Burst), updated: now}
+		ms.buckets[key] = b
+	}
+
+	decision := b.take(limit, now)
+	b.fullAt = now.Add(decision.Reset)
+	return decision, nil
+}
+
+// Len reports how many buckets are currently held
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.buckets)
+}
+
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < ms.SweepInterval {
+		return
+	}
+	ms.lastSweep = now
+	for key, b := range ms.buckets {
+		if !now.Before(b.fullAt) {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+// take refills the bucket for the time elapsed since its last update, then tries to spend one token
+func (b *memoryBucket) take(limit Limit, now time.Time) Decision {
+	rate := limit.ratePerSecond()
+	capacity := float64(limit.Burst)
+
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+
+	decision := Decision{}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return decision
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,150 @@
+// Package ratelimit implements per-client token buckets. A Limit describes a bucket, Rules map route patterns to
+// limits, and a Store holds the buckets themselves. MemoryStore suits a single instance; a shared Store (e.g. backed by
+// Redis) makes the limits hold across every instance behind the load balancer.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period on average, with bursts of up to Burst requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Unlimited marks a route that is never limited
+var Unlimited = Limit{}
+
+func (l Limit) IsUnlimited() bool {
+	return l.Requests <= 0
+}
+
+// ratePerSecond is how fast the bucket refills
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// ParseLimit reads "N/period" or "N/period:burst", e.g. "10/1m" or "100/1s:200". "off" means Unlimited
+func ParseLimit(raw string) (Limit, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "off" {
+		return Unlimited, nil
+	}
+
+	rate, burstPart, hasBurst := strings.Cut(raw, ":")
+	requestsPart, periodPart, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like N/period[:burst]", raw)
+	}
+
+	requests, err := strconv.Atoi(requestsPart)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid request count", raw)
+	}
+	period, err := time.ParseDuration(periodPart)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid period", raw)
+	}
+
+	burst := requests
+	if hasBurst {
+		burst, err = strconv.Atoi(burstPart)
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("limit %q has an invalid burst", raw)
+		}
+	}
+	return Limit{Requests: requests, Period: period, Burst: burst}, nil
+}
+
+// Rules picks the limit for a route pattern, falling back to Default for routes without their own rule
+type Rules struct {
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// ParseRules reads the default limit and "pattern=limit" route entries, e.g. "POST /api/v1/users=10/1m"
+func ParseRules(defaultLimit string, routes []string) (Rules, error) {
+	rules := Rules{Routes: make(map[string]Limit, len(routes))}
+
+	if defaultLimit != "" {
+		limit, err := ParseLimit(defaultLimit)
+		if err != nil {
+			return Rules{}, fmt.Errorf("default rate limit: %w", err)
+		}
+		rules.Default = limit
+	}
+
+	for _, entry := range routes {
+		pattern, rawLimit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return Rules{}, fmt.Errorf("rate limit route %q must look like pattern=limit", entry)
+		}
+		limit, err := ParseLimit(rawLimit)
+		if err != nil {
+			return Rules{}, fmt.Errorf("rate limit for %s: %w", pattern, err)
+		}
+		rules.Routes[strings.TrimSpace(pattern)] = limit
+	}
+	return rules, nil
+}
+
+func (r Rules) For(pattern string) Limit {
+	if limit, ok := r.Routes[pattern]; ok {
+		return limit
+	}
+	return r.Default
+}
+
+// Decision is the outcome of taking a token from a bucket
+type Decision struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token is available; zero when Allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store holds the token buckets. Take must be atomic per key: concurrent calls for the same key may not both spend
+// the last token, including across processes for shared implementations
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Decision, error)
+}
+
+// Limiter ties the rules, the store and the client identity together
+type Limiter struct {
+	Store      Store
+	Rules      Rules
+	Identifier Identifier
+	Now        func() time.Time
+}
+
+func NewLimiter(store Store, rules Rules, identifier Identifier) *Limiter {
+	return &Limiter{
+		Store:      store,
+		Rules:      rules,
+		Identifier: identifier,
+		Now:        time.Now,
+	}
+}
+
+// Allow takes a token for the request's client on the given route. Every route has its own buckets, so a client that
+// exhausted one route's limit can still use the others. The returned limit is Unlimited for routes without a rule, in
+// which case the store is not consulted at all
+func (l *Limiter) Allow(r *http.Request, route string) (Decision, Limit, error) {
+	limit := l.Rules.For(route)
+	if limit.IsUnlimited() {
+		return Decision{Allowed: true}, limit, nil
+	}
+
+	key := route + "|" + l.Identifier.Key(r)
+	decision, err := l.Store.Take(r.Context(), key, limit, l.Now())
+	return decision, limit, err
+}
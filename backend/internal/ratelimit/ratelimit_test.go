@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{Requests: 10, Period: time.Minute, Burst: 10}, false},
+		{"100/1s:200", Limit{Requests: 100, Period: time.Second, Burst: 200}, false},
+		{" off ", Unlimited, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"10/soon", Limit{}, true},
+		{"10/1m:x", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseLimit(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("300/1m", []string{"POST /api/v1/users=10/1m", "GET /healthz=off"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rules.For("POST /api/v1/users"); got.Requests != 10 {
+		t.Errorf("expected the route rule, got %+v", got)
+	}
+	if got := rules.For("GET /healthz"); !got.IsUnlimited() {
+		t.Errorf("expected the route to be unlimited, got %+v", got)
+	}
+	if got := rules.For("GET /api/v1/orders"); got.Requests != 300 {
+		t.Errorf("expected the default, got %+v", got)
+	}
+
+	if _, err := ParseRules("300/1m", []string{"POST /api/v1/users"}); err == nil {
+		t.Error("expected an entry without a limit to be rejected")
+	}
+}
+
+func TestMemoryStore_RefillsOverTime(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 2}
+	now := time.Unix(1_700_000_000, 0)
+	take := func() Decision {
+		t.Helper()
+		decision, err := store.Take(context.Background(), "k", limit, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return decision
+	}
+
+	for i := range 2 {
+		if d := take(); !d.Allowed || d.Remaining != 1-i {
+			t.Fatalf("request %d: expected to be allowed with %d remaining, got %+v", i, 1-i, d)
+		}
+	}
+	d := take()
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != time.Second {
+		t.Fatalf("expected an empty bucket refilling at 2/s, got %+v", d)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d := take(); !d.Allowed {
+		t.Errorf("expected a token after half a second, got %+v", d)
+	}
+
+	// once a bucket has refilled it is dropped by the next sweep
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "other", limit, now)
+	if store.Len() != 1 {
+		t.Errorf("expected the full bucket to be swept, %d buckets left", store.Len())
+	}
+}
+
+func TestIdentifier_Key(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      Identifier
+		headers map[string]string
+		want    string
+	}{
+		{"remote address", Identifier{}, nil, "ip:192.0.2.1"},
+		{"forwarded header ignored unless configured", Identifier{}, map[string]string{"X-Forwarded-For": "203.0.113.7"}, "ip:192.0.2.1"},
+		{"last hop appended by the proxy", Identifier{ClientIPHeader: "X-Forwarded-For", TrustedProxies: 1}, map[string]string{"X-Forwarded-For": "10.0.0.1, 203.0.113.7"}, "ip:203.0.113.7"},
+		{"two trusted proxies", Identifier{ClientIPHeader: "X-Forwarded-For", TrustedProxies: 2}, map[string]string{"X-Forwarded-For": "10.0.0.1, 203.0.113.7, 198.51.100.2"}, "ip:203.0.113.7"},
+		{"garbage falls back to remote address", Identifier{ClientIPHeader: "X-Forwarded-For", TrustedProxies: 1}, map[string]string{"X-Forwarded-For": "unknown"}, "ip:192.0.2.1"},
+		{"api key", Identifier{APIKeyHeader: "X-Api-Key"}, map[string]string{"X-Api-Key": "secret"}, "apikey:" + digest("secret")},
+		{"user wins over api key", Identifier{UserHeader: "X-User", APIKeyHeader: "X-Api-Key"}, map[string]string{"X-User": "ada", "X-Api-Key": "secret"}, "user:" + digest("ada")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := tt.id.Key(req); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
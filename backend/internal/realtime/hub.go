@@ -0,0 +1,123 @@
+// Package realtime pushes domain events to clients holding a connection open, such as the order event streams. The
+// Hub is fed by the outbox relay like any other bus and fans each event out to the subscribers of its aggregate. It
+// only ever sees events relayed by this process and never blocks the relay, so subscribers treat it as a fast path
+// and fall back to the outbox itself for anything they missed.
+package realtime
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/outbox"
+)
+
+// Hub fans events out to subscribers by aggregate. It is safe for concurrent use
+type Hub struct {
+	buffer int
+
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ outbox.Publisher = (*Hub)(nil)
+
+// NewHub builds a hub whose subscribers may fall buffer events behind before they are told to catch up
+func NewHub(buffer int) *Hub {
+	return &Hub{
+		buffer: max(buffer, 1),
+		topics: map[string]map[*Subscription]struct{}{},
+		done:   make(chan struct{}),
+	}
+}
+
+// Close tells every subscriber to finish, so a shutting down server is not kept waiting on connections that would
+// otherwise stay open for good. Clients reconnect to another instance
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// Subscription receives the events of one aggregate until it is closed
+type Subscription struct {
+	hub    *Hub
+	key    string
+	events chan model.OutboxEvent
+	missed chan struct{}
+	once   sync.Once
+}
+
+// Subscribe registers for the events of the aggregate, e.g. model.AggregateOrder and "12". Callers must Close the
+// subscription when they are done with it
+func (h *Hub) Subscribe(aggregateType, aggregateId string) *Subscription {
+	key := model.OutboxEvent{AggregateType: aggregateType, AggregateId: aggregateId}.OrderingKey()
+	sub := &Subscription{
+		hub:    h,
+		key:    key,
+		events: make(chan model.OutboxEvent, h.buffer),
+		missed: make(chan struct{}, 1),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[key] == nil {
+		h.topics[key] = map[*Subscription]struct{}{}
+	}
+	h.topics[key][sub] = struct{}{}
+	return sub
+}
+
+// Publish hands the event to every subscriber of its aggregate without waiting on any of them. A subscriber whose
+// buffer is full is signalled on Missed instead. It never fails, so a slow client cannot hold up the relay
+func (h *Hub) Publish(ctx context.Context, event model.OutboxEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.topics[event.OrderingKey()] {
+		select {
+		case sub.events <- event:
+		default:
+			select {
+			case sub.missed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribers returns how many subscriptions the aggregate has
+func (h *Hub) Subscribers(aggregateType, aggregateId string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[model.OutboxEvent{AggregateType: aggregateType, AggregateId: aggregateId}.OrderingKey()])
+}
+
+// Events delivers the aggregate's events in the order the relay published them
+func (s *Subscription) Events() <-chan model.OutboxEvent {
+	return s.events
+}
+
+// Missed receives when events were dropped because the subscriber fell behind; it should catch up from the outbox
+func (s *Subscription) Missed() <-chan struct{} {
+	return s.missed
+}
+
+// Done is closed once the hub shuts down
+func (s *Subscription) Done() <-chan struct{} {
+	return s.hub.done
+}
+
+// Close unregisters the subscription. It is safe to call more than once
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.topics[s.key], s)
+		if len(h.topics[s.key]) == 0 {
+			delete(h.topics, s.key)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package realtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+func orderEvent(id int64, orderId string) model.OutboxEvent {
+	return model.OutboxEvent{Id: id, AggregateType: model.AggregateOrder, AggregateId: orderId, Type: model.EventOrderStatusChanged}
+}
+
+func TestHub_FansOutByAggregate(t *testing.T) {
+	hub := NewHub(4)
+	first, second, other := hub.Subscribe(model.AggregateOrder, "1"), hub.Subscribe(model.AggregateOrder, "1"), hub.Subscribe(model.AggregateOrder, "2")
+	defer first.Close()
+	defer second.Close()
+	defer other.Close()
+
+	hub.Publish(context.Background(), orderEvent(7, "1"))
+
+	for _, sub := range []*Subscription{first, second} {
+		if event := <-sub.Events(); event.Id != 7 {
+			t.Errorf("expected event 7, got %+v", event)
+		}
+	}
+	select {
+	case event := <-other.Events():
+		t.Errorf("expected nothing for another order, got %+v", event)
+	default:
+	}
+}
+
+func TestHub_SignalsSlowSubscribersInsteadOfBlocking(t *testing.T) {
+	hub := NewHub(1)
+	sub := hub.Subscribe(model.AggregateOrder, "1")
+	defer sub.Close()
+
+	for id := range int64(3) {
+		if err := hub.Publish(context.Background(), orderEvent(id+1, "1")); err != nil {
+			t.Fatalf("Publish returned %v", err)
+		}
+	}
+
+	if event := <-sub.Events(); event.Id != 1 {
+		t.Errorf("expected the buffered event, got %+v", event)
+	}
+	select {
+	case <-sub.Missed():
+	default:
+		t.Error("expected the subscriber to be told it missed events")
+	}
+}
+
+func TestHub_CloseReleasesSubscribers(t *testing.T) {
+	hub := NewHub(1)
+	sub := hub.Subscribe(model.AggregateOrder, "1")
+	sub.Close()
+	sub.Close()
+	if n := hub.Subscribers(model.AggregateOrder, "1"); n != 0 {
+		t.Errorf("expected no subscribers after Close, got %d", n)
+	}
+
+	live := hub.Subscribe(model.AggregateOrder, "1")
+	defer live.Close()
+	hub.Close()
+	select {
+	case <-live.Done():
+	default:
+		t.Error("expected subscribers to be told the hub closed")
+	}
+}
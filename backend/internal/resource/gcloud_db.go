@@ -3,28 +3,15 @@ package resource
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
 	"cloud.google.com/go/cloudsqlconn"
 	"cloud.google.com/go/cloudsqlconn/postgres/pgxv5"
+	"github.com/jshelley8117/CodeCart/internal/config"
 	"golang.org/x/oauth2"
 )
 
-func NewGCloudDB(tokenSource oauth2.TokenSource) (*sql.DB, error) {
-	dbUser, err := getEnv("GCP_DB_USER")
-	if err != nil {
-		return nil, err
-	}
-	dbName, err := getEnv("GCP_DB_NAME")
-	if err != nil {
-		return nil, err
-	}
-	instanceName, err := getEnv("GCP_INSTANCE_CONNECTION_NAME")
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = pgxv5.RegisterDriver("cloudsqlpostgres",
+func NewGCloudDB(tokenSource oauth2.TokenSource, cfg config.GCPConfig) (*sql.DB, error) {
+	_, err := pgxv5.RegisterDriver("cloudsqlpostgres",
 		cloudsqlconn.WithIAMAuthN(),
 		cloudsqlconn.WithIAMAuthNTokenSources(tokenSource, tokenSource),
 	)
@@ -33,9 +20,9 @@ func NewGCloudDB(tokenSource oauth2.TokenSource) (*sql.DB, error) {
 	}
 
 	dsn := fmt.Sprintf("user=%s dbname=%s host=%s sslmode=disable",
-		dbUser,
-		dbName,
-		instanceName,
+		cfg.DBUser,
+		cfg.DBName,
+		cfg.InstanceConnectionName,
 	)
 
 	db, err := sql.Open("cloudsqlpostgres", dsn)
@@ -49,11 +36,3 @@ func NewGCloudDB(tokenSource oauth2.TokenSource) (*sql.DB, error) {
 
 	return db, nil
 }
-
-func getEnv(key string) (string, error) {
-	value := os.Getenv(key)
-	if value == "" {
-		return "", fmt.Errorf("required environment variable %s is not set", key)
-	}
-	return value, nil
-}
@@ -3,17 +3,12 @@ package resource
 import (
 	"database/sql"
 	"fmt"
-	"os"
-)
 
-func NewPostgreSqlDb() (*sql.DB, error) {
-	host := os.Getenv("LOCAL_DB_HOST")
-	port := os.Getenv("LOCAL_DB_PORT")
-	user := os.Getenv("LOCAL_DB_USER")
-	password := os.Getenv("LOCAL_DB_PASSWORD")
-	dbname := os.Getenv("LOCAL_DB_NAME")
+	"github.com/jshelley8117/CodeCart/internal/config"
+)
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
+func NewPostgreSqlDb(cfg config.LocalDBConfig) (*sql.DB, error) {
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name)
 
 	dbHandle, err := sql.Open("postgres", connStr)
 	if err != nil {
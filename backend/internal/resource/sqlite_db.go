@@ -0,0 +1,43 @@
+package resource
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+const DEFAULT_SQLITE_PATH = "codecart.db"
+
+// NewSQLiteDb opens (creating if needed) a single-file database with the pure-Go sqlite driver, so no external
+// database server is required. Foreign keys are off by default in sqlite and have to be switched on per connection
+func NewSQLiteDb(path string) (*sql.DB, error) {
+	if path == "" {
+		path = DEFAULT_SQLITE_PATH
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	// take the write lock when the transaction starts instead of upgrading mid-way, which is what produces SQLITE_BUSY
+	// deadlocks between two writers
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	dbHandle, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+
+	// sqlite allows a single writer at a time; funnelling everything through one connection turns lock contention
+	// into queueing inside database/sql rather than busy errors
+	dbHandle.SetMaxOpenConns(1)
+
+	if err := dbHandle.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping sqlite database %s: %w", path, err)
+	}
+
+	return dbHandle, nil
+}
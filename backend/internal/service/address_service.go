@@ -10,22 +10,26 @@ import (
 	"github.com/jshelley8117/CodeCart/internal/common"
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
 type AddressService struct {
-	AddressPersistence persistence.AddressPersistence
+	AddressPersistence persistence.AddressRepository
 	Logger             *zap.Logger
 }
 
-func NewAddressService(addressPersistence persistence.AddressPersistence) AddressService {
+func NewAddressService(addressPersistence persistence.AddressRepository) AddressService {
 	return AddressService{
 		AddressPersistence: addressPersistence,
 	}
 }
 
 func (as AddressService) CreateAddress(ctx context.Context, request model.CreateAddressRequest) error {
+	ctx, span := tracing.Start(ctx, "AddressService.CreateAddress")
+	defer span.End()
+
 	log.Println("Entered CreateAddress")
 	addressDomainModel := model.Address{
 		StreetAddress: strings.ToLower(request.StreetAddress),
@@ -40,6 +44,7 @@ func (as AddressService) CreateAddress(ctx context.Context, request model.Create
 	}
 
 	if err := as.AddressPersistence.PersistCreateAddress(ctx, addressDomainModel); err != nil {
+		tracing.RecordError(span, err)
 		return err
 	}
 
@@ -47,40 +52,16 @@ func (as AddressService) CreateAddress(ctx context.Context, request model.Create
 }
 
 func (as AddressService) GetAllAddresses(ctx context.Context) ([]model.Address, error) {
+	ctx, span := tracing.Start(ctx, "AddressService.GetAllAddresses")
+	defer span.End()
+
 	zLog := as.getZLog(ctx)
 	zLog.Debug("Entered GetAllAddresses")
 
-	addressRows, err := as.AddressPersistence.FetchAllAddresses(ctx)
+	addresses, err := as.AddressPersistence.FetchAllAddresses(ctx)
 	if err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
-		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
-	}
-	defer addressRows.Close()
-
-	addresses := make([]model.Address, 0)
-
-	for addressRows.Next() {
-		var addr model.Address
-		if err := addressRows.Scan(
-			&addr.StreetAddress,
-			&addr.City,
-			&addr.State,
-			&addr.ZipCode,
-			&addr.Country,
-			&addr.UserId,
-			&addr.Id,
-			&addr.IsDefault,
-			&addr.CreatedAt,
-			&addr.UpdatedAt,
-		); err != nil {
-			zLog.Error("scan operation failed", zap.Error(err))
-			return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
-		}
-		addresses = append(addresses, addr)
-	}
-
-	if err := addressRows.Err(); err != nil {
-		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		tracing.RecordError(span, err)
 		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
 	}
 
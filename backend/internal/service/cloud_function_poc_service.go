@@ -4,33 +4,41 @@ import (
 	"context"
 
 	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
 type CloudFunctionService struct {
 	CloudFunctionClient *client.CloudFunctionClient
-	HelloWorldURL       string
 	Logger              *zap.Logger
 }
 
-func NewCloudFunctionService(cfClient *client.CloudFunctionClient, helloWorldUrl string, logger *zap.Logger) CloudFunctionService {
+type HelloWorldResponse struct {
+	Message string `json:"message"`
+}
+
+func NewCloudFunctionService(cfClient *client.CloudFunctionClient, logger *zap.Logger) CloudFunctionService {
 	return CloudFunctionService{
 		CloudFunctionClient: cfClient,
-		HelloWorldURL:       helloWorldUrl,
 		Logger:              logger.Named("cloud_function_service"),
 	}
 }
 
-func (cfs CloudFunctionService) GetHelloWorld(ctx context.Context) (*client.HelloWorldResponse, error) {
+func (cfs CloudFunctionService) GetHelloWorld(ctx context.Context) (*HelloWorldResponse, error) {
+	ctx, span := tracing.Start(ctx, "CloudFunctionService.GetHelloWorld")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, cfs.Logger)
 	zLog.Debug("entered GetHelloWorld")
 
-	response, err := cfs.CloudFunctionClient.InvokeHelloWorld(ctx, cfs.HelloWorldURL)
+	response, err := client.Invoke[client.NoRequest, HelloWorldResponse](ctx, cfs.CloudFunctionClient, config.FUNCTION_HELLO_WORLD, client.NoRequest{})
 	if err != nil {
 		zLog.Error("cloud function invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
-	return response, nil
+	return &response, nil
 }
@@ -10,35 +10,53 @@ import (
 	"github.com/jshelley8117/CodeCart/internal/common"
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
 type CustomerService struct {
-	CustomerPersistence persistence.CustomerPersistence
+	CustomerPersistence persistence.CustomerRepository
+	UnitOfWork          persistence.Transactor
 	Logger              *zap.Logger
 }
 
-func NewCustomerService(customerPersistence persistence.CustomerPersistence, logger *zap.Logger) CustomerService {
+func NewCustomerService(customerPersistence persistence.CustomerRepository, unitOfWork persistence.Transactor, logger *zap.Logger) CustomerService {
 	return CustomerService{
 		CustomerPersistence: customerPersistence,
+		UnitOfWork:          unitOfWork,
 		Logger:              logger.Named("customer_service"),
 	}
 }
 
 func (cs CustomerService) CreateCustomer(ctx context.Context, request model.CreateCustomerRequest) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.CreateCustomer")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, cs.Logger).Named("customer_service")
 	zLog.Debug("entered CustomerService")
 
-	if err := cs.CustomerPersistence.PersistCreateCustomer(ctx, model.Customer{
+	customer := model.Customer{
 		FirstName:   strings.ToLower(request.FirstName),
 		LastName:    strings.ToLower(request.LastName),
 		PhoneNumber: request.PhoneNumber,
 		Email:       strings.ToLower(request.Email),
+		Locale:      request.Locale,
+		EmailOptOut: request.EmailOptOut,
+		SMSOptIn:    request.SMSOptIn,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
+	}
+	if err := cs.UnitOfWork.Do(ctx, func(ctx context.Context, repos persistence.Repositories) error {
+		id, err := repos.Customers.PersistCreateCustomer(ctx, customer)
+		if err != nil {
+			return err
+		}
+		customer.Id = id
+		return recordEvent(ctx, repos, model.AggregateCustomer, id, model.EventCustomerCreated, customer)
 	}); err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
 	}
 
@@ -46,37 +64,16 @@ func (cs CustomerService) CreateCustomer(ctx context.Context, request model.Crea
 }
 
 func (cs CustomerService) GetAllCustomers(ctx context.Context) ([]model.Customer, error) {
+	ctx, span := tracing.Start(ctx, "CustomerService.GetAllCustomers")
+	defer span.End()
+
 	zLog := cs.getZLog(ctx)
 	zLog.Debug("entered GetAllCustomers")
 
-	customerRows, err := cs.CustomerPersistence.FetchAllCustomers(ctx)
+	customers, err := cs.CustomerPersistence.FetchAllCustomers(ctx)
 	if err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
-		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
-	}
-	defer customerRows.Close()
-
-	customers := make([]model.Customer, 0)
-
-	for customerRows.Next() {
-		var cust model.Customer
-		if err := customerRows.Scan(
-			&cust.Id,
-			&cust.FirstName,
-			&cust.LastName,
-			&cust.PhoneNumber,
-			&cust.Email,
-			&cust.CreatedAt,
-			&cust.UpdatedAt,
-		); err != nil {
-			zLog.Error("scan operation failed", zap.Error(err))
-			return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
-		}
-		customers = append(customers, cust)
-	}
-
-	if err := customerRows.Err(); err != nil {
-		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		tracing.RecordError(span, err)
 		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
 	}
 
@@ -84,17 +81,24 @@ func (cs CustomerService) GetAllCustomers(ctx context.Context) ([]model.Customer
 }
 
 func (cs CustomerService) DeleteCustomerById(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.DeleteCustomerById")
+	defer span.End()
+
 	zLog := cs.getZLog(ctx)
 	zLog.Debug("entered DeleteCustomerById")
 
 	if err := cs.CustomerPersistence.PersistDeleteCustomerById(ctx, id); err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return fmt.Errorf(common.ERR_CLIENT_DB_DELETE_FAIL)
 	}
 	return nil
 }
 
 func (cs CustomerService) UpdateCustomerById(ctx context.Context, request model.UpdateCustomerRequest, id int) error {
+	ctx, span := tracing.Start(ctx, "CustomerService.UpdateCustomerById")
+	defer span.End()
+
 	zLog := cs.getZLog(ctx)
 	zLog.Debug("entered UpdateCustomerById")
 
@@ -112,6 +116,15 @@ func (cs CustomerService) UpdateCustomerById(ctx context.Context, request model.
 	if request.Email != nil && *request.Email != "" {
 		updates["email"] = strings.ToLower(*request.Email)
 	}
+	if request.Locale != nil {
+		updates["locale"] = *request.Locale
+	}
+	if request.EmailOptOut != nil {
+		updates["email_opt_out"] = *request.EmailOptOut
+	}
+	if request.SMSOptIn != nil {
+		updates["sms_opt_in"] = *request.SMSOptIn
+	}
 
 	if len(updates) == 0 {
 		zLog.Error("No updates found", zap.String("customer_id", strconv.Itoa(id)))
@@ -120,6 +133,7 @@ func (cs CustomerService) UpdateCustomerById(ctx context.Context, request model.
 
 	if err := cs.CustomerPersistence.PersistUpdateCustomerById(ctx, id, updates); err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
 	}
 
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+)
+
+func newTestCustomerService(t *testing.T) (CustomerService, *memory.Store) {
+	t.Helper()
+	store := memory.NewStore()
+	return NewCustomerService(store.Repositories().Customers, store, zap.NewNop()), store
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestCustomerService_CreateCustomer(t *testing.T) {
+	ctx := context.Background()
+	cs, _ := newTestCustomerService(t)
+
+	err := cs.CreateCustomer(ctx, model.CreateCustomerRequest{
+		FirstName:   "Ada",
+		LastName:    "LOVELACE",
+		PhoneNumber: "+15555550100",
+		Email:       "Ada@Example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateCustomer returned error: %v", err)
+	}
+
+	customers, err := cs.GetAllCustomers(ctx)
+	if err != nil {
+		t.Fatalf("GetAllCustomers returned error: %v", err)
+	}
+	if len(customers) != 1 {
+		t.Fatalf("expected 1 customer, got %d", len(customers))
+	}
+
+	got := customers[0]
+	if got.FirstName != "ada" || got.LastName != "lovelace" || got.Email != "ada@example.com" {
+		t.Errorf("expected names and email to be lowercased, got %+v", got)
+	}
+	if got.PhoneNumber != "+15555550100" {
+		t.Errorf("expected phone number to be stored as given, got %q", got.PhoneNumber)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Errorf("expected timestamps to be set, got %+v", got)
+	}
+}
+
+func TestCustomerService_CreateCustomer_PersistenceFailure(t *testing.T) {
+	cs, store := newTestCustomerService(t)
+	store.FailWith(errors.New("connection reset"))
+
+	err := cs.CreateCustomer(context.Background(), model.CreateCustomerRequest{FirstName: "a", LastName: "b", Email: "a@b.co"})
+	if err == nil || err.Error() != common.ERR_CLIENT_DB_PERSISTENCE_FAIL {
+		t.Fatalf("expected %q, got %v", common.ERR_CLIENT_DB_PERSISTENCE_FAIL, err)
+	}
+}
+
+func TestCustomerService_GetAllCustomers_Empty(t *testing.T) {
+	cs, _ := newTestCustomerService(t)
+
+	customers, err := cs.GetAllCustomers(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllCustomers returned error: %v", err)
+	}
+	// the handler marshals this straight to JSON, so it must be [] rather than null
+	if customers == nil || len(customers) != 0 {
+		t.Fatalf("expected empty non-nil slice, got %#v", customers)
+	}
+}
+
+func TestCustomerService_GetAllCustomers_PersistenceFailure(t *testing.T) {
+	cs, store := newTestCustomerService(t)
+	store.FailWith(errors.New("connection reset"))
+
+	_, err := cs.GetAllCustomers(context.Background())
+	if err == nil || err.Error() != common.ERR_CLIENT_DB_RETRIEVAL_FAIL {
+		t.Fatalf("expected %q, got %v", common.ERR_CLIENT_DB_RETRIEVAL_FAIL, err)
+	}
+}
+
+func TestCustomerService_DeleteCustomerById(t *testing.T) {
+	ctx := context.Background()
+	cs, _ := newTestCustomerService(t)
+
+	for _, name := range []string{"first", "second"} {
+		if err := cs.CreateCustomer(ctx, model.CreateCustomerRequest{FirstName: name, LastName: "x", Email: name + "@x.co"}); err != nil {
+			t.Fatalf("CreateCustomer returned error: %v", err)
+		}
+	}
+	customers, _ := cs.GetAllCustomers(ctx)
+
+	if err := cs.DeleteCustomerById(ctx, customers[0].Id); err != nil {
+		t.Fatalf("DeleteCustomerById returned error: %v", err)
+	}
+
+	remaining, _ := cs.GetAllCustomers(ctx)
+	if len(remaining) != 1 || remaining[0].FirstName != "second" {
+		t.Fatalf("expected only the second customer to remain, got %+v", remaining)
+	}
+}
+
+func TestCustomerService_UpdateCustomerById(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		request model.UpdateCustomerRequest
+		wantErr bool
+		check   func(t *testing.T, c model.Customer)
+	}{
+		{
+			name:    "updates provided fields and lowercases them",
+			request: model.UpdateCustomerRequest{FirstName: "Grace", Email: strPtr("Grace@Navy.mil")},
+			check: func(t *testing.T, c model.Customer) {
+				if c.FirstName != "grace" || c.Email != "grace@navy.mil" {
+					t.Errorf("unexpected customer after update: %+v", c)
+				}
+				if c.LastName != "hopper" {
+					t.Errorf("expected last name to be untouched, got %q", c.LastName)
+				}
+			},
+		},
+		{
+			name:    "empty pointer fields are ignored",
+			request: model.UpdateCustomerRequest{LastName: "Murray", PhoneNumber: strPtr("")},
+			check: func(t *testing.T, c model.Customer) {
+				if c.LastName != "murray" || c.PhoneNumber != "+15555550100" {
+					t.Errorf("unexpected customer after update: %+v", c)
+				}
+			},
+		},
+		{
+			name:    "no updates is an error",
+			request: model.UpdateCustomerRequest{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, _ := newTestCustomerService(t)
+			if err := cs.CreateCustomer(ctx, model.CreateCustomerRequest{
+				FirstName:   "grace",
+				LastName:    "hopper",
+				PhoneNumber: "+15555550100",
+				Email:       "grace@example.com",
+			}); err != nil {
+				t.Fatalf("CreateCustomer returned error: %v", err)
+			}
+			customers, _ := cs.GetAllCustomers(ctx)
+			id := customers[0].Id
+
+			err := cs.UpdateCustomerById(ctx, tt.request, id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateCustomerById returned error: %v", err)
+			}
+
+			customers, _ = cs.GetAllCustomers(ctx)
+			tt.check(t, customers[0])
+		})
+	}
+}
+
+func TestCustomerService_CreateCustomer_RecordsEvent(t *testing.T) {
+	cs, store := newTestCustomerService(t)
+	if err := cs.CreateCustomer(context.Background(), model.CreateCustomerRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}); err != nil {
+		t.Fatalf("CreateCustomer returned error: %v", err)
+	}
+
+	events := store.OutboxEvents()
+	if len(events) != 1 || events[0].Type != model.EventCustomerCreated || events[0].AggregateType != model.AggregateCustomer {
+		t.Fatalf("expected one CustomerCreated event, got %+v", events)
+	}
+	customers, _ := cs.GetAllCustomers(context.Background())
+	if events[0].AggregateId != strconv.Itoa(customers[0].Id) {
+		t.Errorf("expected the event to carry the new customer's id %d, got %s", customers[0].Id, events[0].AggregateId)
+	}
+}
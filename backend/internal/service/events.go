@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+)
+
+// recordEvent appends a domain event to the outbox. Pass the transaction's repositories so the event commits or rolls
+// back together with the change it describes
+func recordEvent(ctx context.Context, repos persistence.Repositories, aggregateType string, aggregateId int, eventType string, payload any) error {
+	event, err := model.NewOutboxEvent(aggregateType, aggregateId, eventType, payload)
+	if err != nil {
+		return err
+	}
+	return repos.Outbox.PersistEvent(ctx, event)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_JOB_LIST_LIMIT and MAX_JOB_LIST_LIMIT bound how many jobs one request lists
+const (
+	DEFAULT_JOB_LIST_LIMIT = 50
+	MAX_JOB_LIST_LIMIT     = 500
+)
+
+// ErrJobRunning is returned when a job cannot be retried because a worker holds it
+var ErrJobRunning = errors.New("job is running")
+
+// JobService lets admins look into the background job queue and retry jobs by hand. The jobs themselves are run by
+// jobs.Worker
+type JobService struct {
+	JobPersistence persistence.JobRepository
+	Logger         *zap.Logger
+}
+
+func NewJobService(jobPersistence persistence.JobRepository, logger *zap.Logger) JobService {
+	return JobService{
+		JobPersistence: jobPersistence,
+		Logger:         logger.Named("job_service"),
+	}
+}
+
+// GetJobs returns jobs newest first. status and jobType narrow the list when not empty, and limit is clamped to
+// MAX_JOB_LIST_LIMIT, with 0 meaning DEFAULT_JOB_LIST_LIMIT
+func (js JobService) GetJobs(ctx context.Context, status model.JobStatus, jobType string, limit int) ([]model.Job, error) {
+	ctx, span := tracing.Start(ctx, "JobService.GetJobs")
+	defer span.End()
+
+	zLog := js.getZLog(ctx)
+	zLog.Debug("entered GetJobs")
+
+	if limit <= 0 {
+		limit = DEFAULT_JOB_LIST_LIMIT
+	}
+	jobs, err := js.JobPersistence.FetchJobs(ctx, status, jobType, min(limit, MAX_JOB_LIST_LIMIT))
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
+	}
+	return jobs, nil
+}
+
+func (js JobService) GetJobById(ctx context.Context, id int64) (model.Job, error) {
+	ctx, span := tracing.Start(ctx, "JobService.GetJobById")
+	defer span.End()
+
+	zLog := js.getZLog(ctx).With(zap.Int64("job_id", id))
+	zLog.Debug("entered GetJobById")
+
+	job, err := js.JobPersistence.FetchJobById(ctx, id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("job not found")
+		return model.Job{}, err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return model.Job{}, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
+	}
+	return job, nil
+}
+
+// RetryJob makes a job due now with a fresh attempt budget, whether it is dead, succeeded or still waiting for its
+// next attempt. It returns persistence.ErrNotFound for unknown jobs and ErrJobRunning while a worker holds the job
+func (js JobService) RetryJob(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "JobService.RetryJob")
+	defer span.End()
+
+	zLog := js.getZLog(ctx).With(zap.Int64("job_id", id))
+	zLog.Debug("entered RetryJob")
+
+	job, err := js.JobPersistence.FetchJobById(ctx, id)
+	if err == nil && job.Status == model.JobRunning {
+		zLog.Warn("job is running and cannot be retried")
+		return ErrJobRunning
+	}
+	if err == nil {
+		err = js.JobPersistence.PersistRetryJob(ctx, id, time.Now())
+		if errors.Is(err, persistence.ErrNotFound) {
+			// claimed by a worker since it was read
+			zLog.Warn("job is running and cannot be retried")
+			return ErrJobRunning
+		}
+	}
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("job not found")
+		return err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+
+	zLog.Info("job queued for retry", zap.String("job_type", job.Type), zap.String("previous_status", string(job.Status)))
+	return nil
+}
+
+func (js JobService) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, js.Logger)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jshelley8117/CodeCart/internal/auth"
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ORDER_EVENT_HISTORY_BATCH is how many past events one outbox read returns
+const ORDER_EVENT_HISTORY_BATCH = 100
+
+// ErrForbidden is returned when the caller is identified but the resource is not theirs
+var ErrForbidden = errors.New("forbidden")
+
+// OrderEventService backs the order event streams: it decides who may follow an order and reads the order's history
+// from the outbox, which every change to an order is recorded in
+type OrderEventService struct {
+	OrderPersistence  persistence.OrderRepository
+	UserPersistence   persistence.UserRepository
+	OutboxPersistence persistence.OutboxRepository
+	Logger            *zap.Logger
+}
+
+func NewOrderEventService(repos persistence.Repositories, logger *zap.Logger) OrderEventService {
+	return OrderEventService{
+		OrderPersistence:  repos.Orders,
+		UserPersistence:   repos.Users,
+		OutboxPersistence: repos.Outbox,
+		Logger:            logger.Named("order_event_service"),
+	}
+}
+
+// AuthorizeOrder lets admins follow any order and users only the orders of the customer they belong to. It returns
+// persistence.ErrNotFound for unknown orders and ErrForbidden when the order is not the caller's
+func (oes OrderEventService) AuthorizeOrder(ctx context.Context, principal auth.Principal, orderId int) error {
+	ctx, span := tracing.Start(ctx, "OrderEventService.AuthorizeOrder")
+	defer span.End()
+
+	zLog := oes.getZLog(ctx).With(zap.Int("order_id", orderId))
+	zLog.Debug("entered AuthorizeOrder")
+
+	order, err := oes.OrderPersistence.FetchOrderById(ctx, orderId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("order not found")
+		return err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf("%s: %w", common.ERR_CLIENT_DB_RETRIEVAL_FAIL, err)
+	}
+	err = authorizeOrderAccess(ctx, oes.UserPersistence, principal, order, zLog)
+	if err != nil && !errors.Is(err, ErrForbidden) {
+		tracing.RecordError(span, err)
+	}
+	return err
+}
+
+// authorizeOrderAccess lets admins at any order and users only at the orders of the customer they belong to. It
+// returns ErrForbidden when order is not the caller's
+func authorizeOrderAccess(ctx context.Context, users persistence.UserRepository, principal auth.Principal, order model.Order, zLog *zap.Logger) error {
+	if principal.Admin {
+		return nil
+	}
+
+	user, err := users.FetchUserByAuthId(ctx, principal.AuthId)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("no user for the caller's identity")
+		return ErrForbidden
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		return fmt.Errorf("%s: %w", common.ERR_CLIENT_DB_RETRIEVAL_FAIL, err)
+	}
+	if !user.IsActive || user.CustomerId != order.CustomerId {
+		zLog.Warn("order does not belong to the caller", zap.Int("user_id", user.Id))
+		return ErrForbidden
+	}
+	return nil
+}
+
+// GetEventsSince returns up to ORDER_EVENT_HISTORY_BATCH of the order's events recorded after afterId, oldest first.
+// A full batch means there may be more
+func (oes OrderEventService) GetEventsSince(ctx context.Context, orderId int, afterId int64) ([]model.OutboxEvent, error) {
+	ctx, span := tracing.Start(ctx, "OrderEventService.GetEventsSince")
+	defer span.End()
+
+	zLog := oes.getZLog(ctx)
+	zLog.Debug("entered GetEventsSince")
+
+	events, err := oes.OutboxPersistence.FetchEventsByAggregate(ctx, model.AggregateOrder, strconv.Itoa(orderId), afterId, ORDER_EVENT_HISTORY_BATCH)
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Int("order_id", orderId), zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf("%s: %w", common.ERR_CLIENT_DB_RETRIEVAL_FAIL, err)
+	}
+	return events, nil
+}
+
+func (oes OrderEventService) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, oes.Logger)
+}
@@ -2,29 +2,39 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
 type OrderService struct {
-	OrderPersistence persistence.OrderPersistence
+	OrderPersistence persistence.OrderRepository
+	UnitOfWork       persistence.Transactor
+	Metrics          *metrics.Metrics
 	Logger           *zap.Logger
 }
 
-func NewOrderService(orderPersistence persistence.OrderPersistence, logger *zap.Logger) OrderService {
+func NewOrderService(orderPersistence persistence.OrderRepository, unitOfWork persistence.Transactor, metrics *metrics.Metrics, logger *zap.Logger) OrderService {
 	return OrderService{
 		OrderPersistence: orderPersistence,
+		UnitOfWork:       unitOfWork,
+		Metrics:          metrics,
 		Logger:           logger,
 	}
 }
 
 func (os OrderService) CreateOrder(ctx context.Context, request model.CreateOrderRequest) error {
+	ctx, span := tracing.Start(ctx, "OrderService.CreateOrder")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, os.Logger).Named("order_service")
 	zLog.Debug("entered OrderService")
 
@@ -53,75 +63,55 @@ func (os OrderService) CreateOrder(ctx context.Context, request model.CreateOrde
 		}
 	}
 
-	if err := os.OrderPersistence.PersistCreateOrder(ctx, orderDomainModel); err != nil {
+	if err := os.UnitOfWork.Do(ctx, func(ctx context.Context, repos persistence.Repositories) error {
+		id, err := repos.Orders.PersistCreateOrder(ctx, orderDomainModel)
+		if err != nil {
+			return err
+		}
+		created := orderDomainModel
+		created.Id = id
+		return recordEvent(ctx, repos, model.AggregateOrder, id, model.EventOrderCreated, created)
+	}); err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return err
 	}
+
+	os.Metrics.OrderCreated(string(orderDomainModel.OrderType))
 	return nil
 }
 
 func (os OrderService) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetAllOrders")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, os.Logger).Named("order_service")
 	zLog.Debug("entered GetAllOrders")
 
-	orderRows, err := os.OrderPersistence.FetchAllOrders(ctx)
+	orders, err := os.OrderPersistence.FetchAllOrders(ctx)
 	if err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
-		return nil, err
-	}
-	defer orderRows.Close()
-
-	orders := make([]model.Order, 0)
-
-	for orderRows.Next() {
-		var order model.Order
-		if err := orderRows.Scan(
-			&order.Id,
-			&order.CustomerId,
-			&order.Status,
-			&order.TotalPrice,
-			&order.DeliveryAddress,
-			&order.CreatedAt,
-			&order.UpdatedAt,
-			&order.AddressId,
-			&order.OrderType,
-		); err != nil {
-			zLog.Error("scan operation failed", zap.Error(err))
-			return nil, err
-		}
-		orders = append(orders, order)
-	}
-
-	if err := orderRows.Err(); err != nil {
-		zLog.Error("error occured while iterating through sql rows", zap.Error(err))
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 	return orders, nil
 }
 
 func (os OrderService) FetchOrderById(ctx context.Context, id int) (model.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.FetchOrderById")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, os.Logger).Named("order_service")
 	zLog.Debug("entered FetchOrderById")
 
-	orderRow := os.OrderPersistence.FetchOrderById(ctx, id)
-	if orderRow == nil {
+	order, err := os.OrderPersistence.FetchOrderById(ctx, id)
+	if errors.Is(err, persistence.ErrNotFound) {
 		zLog.Warn("order not found", zap.Int("order_id", id))
-		return model.Order{}, nil
-	}
-
-	var order model.Order
-	if err := orderRow.Scan(
-		&order.Id,
-		&order.CustomerId,
-		&order.Status,
-		&order.TotalPrice,
-		&order.DeliveryAddress,
-		&order.CreatedAt,
-		&order.UpdatedAt,
-		&order.AddressId,
-		&order.OrderType,
-	); err != nil {
-		zLog.Error("scan operation failed", zap.Error(err))
+		return model.Order{}, err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return model.Order{}, err
 	}
 
@@ -129,6 +119,9 @@ func (os OrderService) FetchOrderById(ctx context.Context, id int) (model.Order,
 }
 
 func (os OrderService) UpdateOrderById(ctx context.Context, request model.UpdateOrderRequest, id int) error {
+	ctx, span := tracing.Start(ctx, "OrderService.UpdateOrderById")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, os.Logger).Named("order_service")
 	zLog.Debug("entered UpdateOrderById")
 
@@ -158,21 +151,100 @@ func (os OrderService) UpdateOrderById(ctx context.Context, request model.Update
 		updates["order_type"] = request.OrderType
 	}
 
+	if request.Picker != nil {
+		updates["picker"] = *request.Picker
+	}
+	if request.Driver != nil {
+		updates["driver"] = *request.Driver
+	}
+	if request.EstimatedReadyAt != nil {
+		updates["estimated_ready_at"] = request.EstimatedReadyAt.UTC()
+	}
+
 	if len(updates) == 0 {
 		zLog.Error("No updates found", zap.Int("order_id", id))
 		return fmt.Errorf("no updates found")
 	}
 
-	if err := os.OrderPersistence.PersistUpdateOrderById(ctx, id, updates); err != nil {
+	// the current order is read in the same transaction as the update so the recorded changes are the ones that
+	// actually happened, even with concurrent updates to the same order
+	var previous model.Order
+	if err := os.UnitOfWork.Do(ctx, func(ctx context.Context, repos persistence.Repositories) error {
+		current, err := repos.Orders.FetchOrderById(ctx, id)
+		if err != nil {
+			return err
+		}
+		previous = current
+		if err := repos.Orders.PersistUpdateOrderById(ctx, id, updates); err != nil {
+			return err
+		}
+		for _, event := range orderChangeEvents(current, request) {
+			if err := recordEvent(ctx, repos, model.AggregateOrder, id, event.eventType, event.payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
 		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
 		return err
 	}
 
+	if request.Status != "" && previous.Status != request.Status {
+		os.Metrics.OrderStatusChanged(string(previous.Status), string(request.Status))
+	}
 	return nil
 }
 
+type orderChangeEvent struct {
+	eventType string
+	payload   any
+}
+
+// orderChangeEvents lists the events an update to current records: one per kind of change, and none for fields that
+// were sent but did not change
+func orderChangeEvents(current model.Order, request model.UpdateOrderRequest) []orderChangeEvent {
+	var events []orderChangeEvent
+	if request.Status != "" && request.Status != current.Status {
+		events = append(events, orderChangeEvent{model.EventOrderStatusChanged, model.OrderStatusChangedPayload{
+			OrderId: current.Id,
+			From:    current.Status,
+			To:      request.Status,
+		}})
+	}
+
+	picker, driver := current.Picker, current.Driver
+	if request.Picker != nil {
+		picker = *request.Picker
+	}
+	if request.Driver != nil {
+		driver = *request.Driver
+	}
+	if picker != current.Picker || driver != current.Driver {
+		events = append(events, orderChangeEvent{model.EventOrderAssignmentChanged, model.OrderAssignmentChangedPayload{
+			OrderId: current.Id,
+			Picker:  picker,
+			Driver:  driver,
+		}})
+	}
+
+	if eta := request.EstimatedReadyAt; eta != nil && (current.EstimatedReadyAt == nil || !eta.Equal(*current.EstimatedReadyAt)) {
+		events = append(events, orderChangeEvent{model.EventOrderEtaChanged, model.OrderEtaChangedPayload{
+			OrderId: current.Id,
+			From:    current.EstimatedReadyAt,
+			To:      eta.UTC(),
+		}})
+	}
+	return events
+}
+
 func validateStatus(status model.OrderStatus) bool {
-	return status == model.OrderStatus("PENDING") || status == model.OrderStatus("DELIVERED") || status == model.OrderStatus("CANCELLED")
+	switch status {
+	case model.OrderStatusPending, model.OrderStatusReadyForPickup, model.OrderStatusOutForDelivery, model.OrderStatusDelivered,
+		model.OrderStatusCancelled, model.OrderStatusRefunded:
+		return true
+	}
+	return false
 }
 
 func validateType(orderType model.OrderType) bool {
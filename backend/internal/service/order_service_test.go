@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+)
+
+func newTestOrderService(t *testing.T) (OrderService, *memory.Store) {
+	t.Helper()
+	store := memory.NewStore()
+	return NewOrderService(store.Repositories().Orders, store, nil, zap.NewNop()), store
+}
+
+func createTestOrder(t *testing.T, os OrderService, request model.CreateOrderRequest) model.Order {
+	t.Helper()
+	ctx := context.Background()
+	if err := os.CreateOrder(ctx, request); err != nil {
+		t.Fatalf("CreateOrder returned error: %v", err)
+	}
+	orders, err := os.GetAllOrders(ctx)
+	if err != nil {
+		t.Fatalf("GetAllOrders returned error: %v", err)
+	}
+	return orders[len(orders)-1]
+}
+
+func TestOrderService_CreateOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       model.CreateOrderRequest
+		wantAddressId int
+	}{
+		{
+			name: "pickup order without address gets the sentinel address id",
+			request: model.CreateOrderRequest{
+				CustomerId: 7,
+				TotalPrice: 12.5,
+				OrderType:  model.OrderType("PICKUP"),
+			},
+			wantAddressId: -1,
+		},
+		{
+			name: "delivery order keeps its address id",
+			request: model.CreateOrderRequest{
+				CustomerId:      7,
+				TotalPrice:      40,
+				OrderType:       model.OrderType("DELIVERY"),
+				AddressId:       3,
+				DeliveryAddress: json.RawMessage(`{"street_address":"1 main st"}`),
+			},
+			wantAddressId: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os, _ := newTestOrderService(t)
+			order := createTestOrder(t, os, tt.request)
+
+			if order.Status != model.OrderStatusPending {
+				t.Errorf("expected new orders to be %s, got %s", model.OrderStatusPending, order.Status)
+			}
+			if order.AddressId != tt.wantAddressId {
+				t.Errorf("expected address id %d, got %d", tt.wantAddressId, order.AddressId)
+			}
+			if order.CustomerId != tt.request.CustomerId || order.TotalPrice != tt.request.TotalPrice || order.OrderType != tt.request.OrderType {
+				t.Errorf("order does not match request: %+v", order)
+			}
+			if order.CreatedAt.IsZero() {
+				t.Error("expected created_at to be set")
+			}
+		})
+	}
+}
+
+func TestOrderService_CreateOrder_PersistenceFailure(t *testing.T) {
+	os, store := newTestOrderService(t)
+	wantErr := errors.New("connection reset")
+	store.FailWith(wantErr)
+
+	err := os.CreateOrder(context.Background(), model.CreateOrderRequest{CustomerId: 1, TotalPrice: 1, OrderType: "PICKUP"})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func TestOrderService_FetchOrderById(t *testing.T) {
+	ctx := context.Background()
+	os, _ := newTestOrderService(t)
+	created := createTestOrder(t, os, model.CreateOrderRequest{CustomerId: 2, TotalPrice: 9.99, OrderType: "PICKUP"})
+
+	got, err := os.FetchOrderById(ctx, created.Id)
+	if err != nil {
+		t.Fatalf("FetchOrderById returned error: %v", err)
+	}
+	if got.Id != created.Id || got.TotalPrice != 9.99 {
+		t.Errorf("unexpected order: %+v", got)
+	}
+
+	if _, err := os.FetchOrderById(ctx, created.Id+100); !errors.Is(err, persistence.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for unknown id, got %v", err)
+	}
+}
+
+func TestOrderService_UpdateOrderById(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		request model.UpdateOrderRequest
+		wantErr bool
+		check   func(t *testing.T, o model.Order)
+	}{
+		{
+			name:    "updates status and price",
+			request: model.UpdateOrderRequest{Status: "CANCELLED", TotalPrice: 20},
+			check: func(t *testing.T, o model.Order) {
+				if o.Status != "CANCELLED" || o.TotalPrice != 20 {
+					t.Errorf("unexpected order after update: %+v", o)
+				}
+			},
+		},
+		{
+			name:    "switches to delivery with an address",
+			request: model.UpdateOrderRequest{OrderType: "DELIVERY", AddressId: 11},
+			check: func(t *testing.T, o model.Order) {
+				if o.OrderType != "DELIVERY" || o.AddressId != 11 {
+					t.Errorf("unexpected order after update: %+v", o)
+				}
+			},
+		},
+		{
+			name:    "rejects unknown status",
+			request: model.UpdateOrderRequest{Status: "SHIPPED"},
+			wantErr: true,
+		},
+		{
+			name:    "rejects unknown order type",
+			request: model.UpdateOrderRequest{OrderType: "DRONE"},
+			wantErr: true,
+		},
+		{
+			name:    "rejects empty update",
+			request: model.UpdateOrderRequest{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os, _ := newTestOrderService(t)
+			created := createTestOrder(t, os, model.CreateOrderRequest{CustomerId: 1, TotalPrice: 10, OrderType: "PICKUP"})
+
+			err := os.UpdateOrderById(ctx, tt.request, created.Id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				unchanged, _ := os.FetchOrderById(ctx, created.Id)
+				if unchanged.Status != created.Status || unchanged.TotalPrice != created.TotalPrice {
+					t.Errorf("expected rejected update to leave the order untouched, got %+v", unchanged)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateOrderById returned error: %v", err)
+			}
+
+			updated, err := os.FetchOrderById(ctx, created.Id)
+			if err != nil {
+				t.Fatalf("FetchOrderById returned error: %v", err)
+			}
+			tt.check(t, updated)
+		})
+	}
+}
+
+func TestOrderService_UpdateOrderById_RollsBackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	os, store := newTestOrderService(t)
+	created := createTestOrder(t, os, model.CreateOrderRequest{CustomerId: 1, TotalPrice: 10, OrderType: "PICKUP"})
+
+	wantErr := errors.New("boom")
+	err := store.Do(ctx, func(ctx context.Context, repos persistence.Repositories) error {
+		if err := repos.Orders.PersistUpdateOrderById(ctx, created.Id, map[string]any{"total_price": 99.0}); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+
+	got, _ := os.FetchOrderById(ctx, created.Id)
+	if got.TotalPrice != 10 {
+		t.Errorf("expected the update to be rolled back, got total price %v", got.TotalPrice)
+	}
+}
+
+func TestOrderService_RecordsEvents(t *testing.T) {
+	ctx := context.Background()
+	os, store := newTestOrderService(t)
+	created := createTestOrder(t, os, model.CreateOrderRequest{CustomerId: 1, TotalPrice: 10, OrderType: "PICKUP"})
+
+	for _, request := range []model.UpdateOrderRequest{
+		{Status: "DELIVERED"},
+		{Status: "DELIVERED"},
+		{TotalPrice: 12},
+	} {
+		if err := os.UpdateOrderById(ctx, request, created.Id); err != nil {
+			t.Fatalf("UpdateOrderById returned error: %v", err)
+		}
+	}
+
+	events := store.OutboxEvents()
+	if len(events) != 2 {
+		t.Fatalf("expected a created and a single status change event, got %+v", events)
+	}
+
+	var order model.Order
+	json.Unmarshal(events[0].Payload, &order)
+	if events[0].Type != model.EventOrderCreated || order.Id != created.Id || events[0].OrderingKey() != "order:"+strconv.Itoa(created.Id) {
+		t.Errorf("unexpected created event %+v", events[0])
+	}
+
+	var change model.OrderStatusChangedPayload
+	json.Unmarshal(events[1].Payload, &change)
+	want := model.OrderStatusChangedPayload{OrderId: created.Id, From: model.OrderStatusPending, To: "DELIVERED"}
+	if events[1].Type != model.EventOrderStatusChanged || change != want {
+		t.Errorf("expected %+v, got %+v", want, change)
+	}
+}
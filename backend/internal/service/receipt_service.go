@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/auth"
+	"github.com/jshelley8117/CodeCart/internal/client"
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ReceiptService renders order receipts through the receipt cloud function
+type ReceiptService struct {
+	OrderPersistence    persistence.OrderRepository
+	UserPersistence     persistence.UserRepository
+	CloudFunctionClient *client.CloudFunctionClient
+	Store               config.StoreConfig
+	Logger              *zap.Logger
+}
+
+// ReceiptRequest is the body the receipt function expects. The function is a module of its own and never linked into
+// the backend, so both sides check their types against cloud/functions/receipt/testdata/request.json
+type ReceiptRequest struct {
+	Store ReceiptStore `json:"store"`
+	Order ReceiptOrder `json:"order"`
+}
+
+type ReceiptStore struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Phone   string `json:"phone"`
+}
+
+type ReceiptOrder struct {
+	Id         int           `json:"id"`
+	CustomerId int           `json:"customer_id"`
+	Type       string        `json:"type"`
+	Status     string        `json:"status"`
+	PlacedAt   time.Time     `json:"placed_at"`
+	Currency   string        `json:"currency"`
+	Lines      []ReceiptLine `json:"lines"`
+	Subtotal   float64       `json:"subtotal"`
+	Tax        float64       `json:"tax"`
+	Total      float64       `json:"total"`
+}
+
+type ReceiptLine struct {
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+func NewReceiptService(orderPersistence persistence.OrderRepository, userPersistence persistence.UserRepository, cfClient *client.CloudFunctionClient, store config.StoreConfig, logger *zap.Logger) ReceiptService {
+	return ReceiptService{
+		OrderPersistence:    orderPersistence,
+		UserPersistence:     userPersistence,
+		CloudFunctionClient: cfClient,
+		Store:               store,
+		Logger:              logger.Named("receipt_service"),
+	}
+}
+
+// RenderReceipt returns the PDF receipt for order id, which principal must be allowed to see. persistence.ErrNotFound
+// is returned for unknown orders and ErrForbidden when the order is not the caller's
+func (rs ReceiptService) RenderReceipt(ctx context.Context, principal auth.Principal, id int) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "ReceiptService.RenderReceipt")
+	defer span.End()
+
+	zLog := utils.FromContext(ctx, rs.Logger)
+	zLog.Debug("entered RenderReceipt")
+
+	order, err := rs.OrderPersistence.FetchOrderById(ctx, id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("order not found", zap.Int("order_id", id))
+		return nil, err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	if err := authorizeOrderAccess(ctx, rs.UserPersistence, principal, order, zLog.With(zap.Int("order_id", id))); err != nil {
+		if !errors.Is(err, ErrForbidden) {
+			tracing.RecordError(span, err)
+		}
+		return nil, err
+	}
+
+	pdf, err := client.Invoke[ReceiptRequest, []byte](ctx, rs.CloudFunctionClient, config.FUNCTION_RECEIPT, rs.receiptRequest(order))
+	if err != nil {
+		zLog.Error("cloud function invocation failed", zap.Int("order_id", id), zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf("failed to render receipt for order %d: %w", id, err)
+	}
+	return pdf, nil
+}
+
+// receiptRequest describes order to the receipt function. Orders only record their total so far, so the receipt has a
+// single line for the whole order and no separate tax
+func (rs ReceiptService) receiptRequest(order model.Order) ReceiptRequest {
+	description := "Order"
+	if orderType := string(order.OrderType); orderType != "" {
+		description = strings.ToUpper(orderType[:1]) + strings.ToLower(orderType[1:]) + " order"
+	}
+	return ReceiptRequest{
+		Store: ReceiptStore{
+			Name:    rs.Store.Name,
+			Address: rs.Store.Address,
+			Phone:   rs.Store.Phone,
+		},
+		Order: ReceiptOrder{
+			Id:         order.Id,
+			CustomerId: order.CustomerId,
+			Type:       string(order.OrderType),
+			Status:     string(order.Status),
+			PlacedAt:   order.CreatedAt,
+			Currency:   rs.Store.Currency,
+			Lines: []ReceiptLine{{
+				Description: description,
+				Quantity:    1,
+				UnitPrice:   order.TotalPrice,
+				Amount:      order.TotalPrice,
+			}},
+			Subtotal: order.TotalPrice,
+			Total:    order.TotalPrice,
+		},
+	}
+}
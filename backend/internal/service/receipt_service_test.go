@@ -0,0 +1,48 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// the receipt function keeps the same fixture in its own tests, so a change to either side of the contract fails one
+// of them
+const RECEIPT_CONTRACT_FIXTURE = "../../../cloud/functions/receipt/testdata/request.json"
+
+func TestReceiptService_RequestMatchesTheFunctionContract(t *testing.T) {
+	fixture, err := os.ReadFile(RECEIPT_CONTRACT_FIXTURE)
+	if err != nil {
+		t.Fatalf("failed to read the contract fixture: %v", err)
+	}
+
+	rs := ReceiptService{Store: config.StoreConfig{Name: "CodeCart", Address: "1 Main St, Springfield", Phone: "+1 555 555 0100", Currency: "USD"}}
+	request := rs.receiptRequest(model.Order{
+		Id:         42,
+		CustomerId: 7,
+		OrderType:  model.OrderType("PICKUP"),
+		Status:     model.OrderStatusPending,
+		TotalPrice: 12.5,
+		CreatedAt:  time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+	})
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("failed to encode the request: %v", err)
+	}
+
+	var got, want any
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatalf("failed to decode the request: %v", err)
+	}
+	if err := json.Unmarshal(fixture, &want); err != nil {
+		t.Fatalf("failed to decode the contract fixture: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("receipt request drifted from the function's contract\n got: %s\nwant: %s", encoded, fixture)
+	}
+}
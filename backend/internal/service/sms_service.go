@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_SMS_LIST_LIMIT and MAX_SMS_LIST_LIMIT bound how many texts one request lists
+const (
+	DEFAULT_SMS_LIST_LIMIT = 50
+	MAX_SMS_LIST_LIMIT     = 500
+)
+
+// the keywords carriers expect an inbound text to be honoured for. A customer who texts one of smsStopKeywords is
+// no longer texted until they text one of smsStartKeywords
+var (
+	smsStopKeywords  = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT"}
+	smsStartKeywords = []string{"START", "UNSTOP"}
+)
+
+// SMSService handles what the SMS provider reports back, delivery statuses and the texts customers send, and lets
+// admins look through the texts sent. The texts themselves are sent by notify.Texter
+type SMSService struct {
+	SMSPersistence      persistence.SMSRepository
+	CustomerPersistence persistence.CustomerRepository
+	Provider            string
+	Logger              *zap.Logger
+}
+
+func NewSMSService(
+	smsPersistence persistence.SMSRepository,
+	customerPersistence persistence.CustomerRepository,
+	provider string,
+	logger *zap.Logger,
+) SMSService {
+	return SMSService{
+		SMSPersistence:      smsPersistence,
+		CustomerPersistence: customerPersistence,
+		Provider:            provider,
+		Logger:              logger.Named("sms_service"),
+	}
+}
+
+// GetSMSMessages returns texts newest first. status and customerId narrow the list when not empty or 0, and limit is
+// clamped to MAX_SMS_LIST_LIMIT, with 0 meaning DEFAULT_SMS_LIST_LIMIT
+func (ss SMSService) GetSMSMessages(ctx context.Context, status model.SMSStatus, customerId int, limit int) ([]model.SMSMessage, error) {
+	ctx, span := tracing.Start(ctx, "SMSService.GetSMSMessages")
+	defer span.End()
+
+	zLog := ss.getZLog(ctx)
+	zLog.Debug("entered GetSMSMessages")
+
+	if limit <= 0 {
+		limit = DEFAULT_SMS_LIST_LIMIT
+	}
+	messages, err := ss.SMSPersistence.FetchSMSMessages(ctx, status, customerId, min(limit, MAX_SMS_LIST_LIMIT))
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
+	}
+	return messages, nil
+}
+
+// RecordStatus applies a delivery report. Reports about texts that are unknown or already final are acknowledged and
+// dropped, since the provider would otherwise keep sending them
+func (ss SMSService) RecordStatus(ctx context.Context, callback model.SMSStatusCallback) error {
+	ctx, span := tracing.Start(ctx, "SMSService.RecordStatus")
+	defer span.End()
+
+	zLog := ss.getZLog(ctx).With(zap.String("provider_message_id", callback.MessageId), zap.String("status", string(callback.Status)))
+	zLog.Debug("entered RecordStatus")
+
+	err := ss.SMSPersistence.PersistSMSStatus(ctx, ss.Provider, callback.MessageId, callback.Status, callback.Error, time.Now())
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("delivery report for an unknown or settled text, ignoring it")
+		return nil
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+	zLog.Info("delivery report recorded")
+	return nil
+}
+
+// HandleInbound opts the sender out of texts when the text is a stop keyword and back in when it is a start keyword,
+// matched case-insensitively against the whole body. Anything else is logged and ignored
+func (ss SMSService) HandleInbound(ctx context.Context, inbound model.SMSInbound) error {
+	ctx, span := tracing.Start(ctx, "SMSService.HandleInbound")
+	defer span.End()
+
+	zLog := ss.getZLog(ctx)
+	zLog.Debug("entered HandleInbound")
+
+	keyword := strings.ToUpper(strings.TrimSpace(inbound.Body))
+	var optIn bool
+	switch {
+	case slices.Contains(smsStopKeywords, keyword):
+		optIn = false
+	case slices.Contains(smsStartKeywords, keyword):
+		optIn = true
+	default:
+		zLog.Info("inbound text is not a keyword, ignoring it")
+		return nil
+	}
+
+	updated, err := ss.CustomerPersistence.PersistSMSOptInByPhoneNumber(ctx, inbound.From, optIn)
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+	// the number is not logged, only whether it belongs to anyone
+	zLog.Info("sms opt-in changed by text", zap.String("keyword", keyword), zap.Bool("sms_opt_in", optIn), zap.Int64("customers", updated))
+	return nil
+}
+
+func (ss SMSService) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, ss.Logger)
+}
@@ -7,23 +7,29 @@ import (
 
 	"github.com/jshelley8117/CodeCart/internal/model"
 	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
 	"github.com/jshelley8117/CodeCart/internal/utils"
 	"go.uber.org/zap"
 )
 
 type UserService struct {
-	UserPersistence persistence.UserPersistence
+	UserPersistence persistence.UserRepository
+	UnitOfWork      persistence.Transactor
 	Logger          *zap.Logger
 }
 
-func NewUserService(userPersistence persistence.UserPersistence, logger *zap.Logger) UserService {
+func NewUserService(userPersistence persistence.UserRepository, unitOfWork persistence.Transactor, logger *zap.Logger) UserService {
 	return UserService{
 		UserPersistence: userPersistence,
+		UnitOfWork:      unitOfWork,
 		Logger:          logger,
 	}
 }
 
 func (us UserService) CreateUser(ctx context.Context, request model.CreateUserRequest) error {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
 	zLog := utils.FromContext(ctx, us.Logger).Named("user_service")
 	zLog.Debug("entered CreateUser")
 	userDomainModel := model.User{
@@ -35,8 +41,22 @@ func (us UserService) CreateUser(ctx context.Context, request model.CreateUserRe
 		IsActive:   true,
 	}
 
-	if err := us.UserPersistence.PersistCreateUser(ctx, userDomainModel); err != nil {
+	if err := us.UnitOfWork.Do(ctx, func(ctx context.Context, repos persistence.Repositories) error {
+		id, err := repos.Users.PersistCreateUser(ctx, userDomainModel)
+		if err != nil {
+			return err
+		}
+		userDomainModel.Id = id
+		return recordEvent(ctx, repos, model.AggregateUser, id, model.EventUserCreated, model.UserCreatedPayload{
+			Id:         id,
+			Email:      userDomainModel.Email,
+			CustomerId: userDomainModel.CustomerId,
+			IsActive:   userDomainModel.IsActive,
+			CreatedAt:  userDomainModel.CreatedAt,
+		})
+	}); err != nil {
 		zLog.Error("persistence invocation failed: %w", zap.Error(err))
+		tracing.RecordError(span, err)
 		return err
 	}
 
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+)
+
+func TestUserService_CreateUser_KeepsTheAuthIdOutOfTheEvent(t *testing.T) {
+	store := memory.NewStore()
+	us := NewUserService(store.Repositories().Users, store, zap.NewNop())
+	request := model.CreateUserRequest{Email: "Ada@Example.com", CustomerId: 7, GCAuthId: "firebase-subject-123"}
+	if err := us.CreateUser(context.Background(), request); err != nil {
+		t.Fatalf("CreateUser returned error: %v", err)
+	}
+
+	events := store.OutboxEvents()
+	if len(events) != 1 || events[0].Type != model.EventUserCreated || events[0].AggregateType != model.AggregateUser {
+		t.Fatalf("expected one UserCreated event, got %+v", events)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["gc_auth_id"]; ok {
+		t.Errorf("expected no gc_auth_id in the payload, got %s", events[0].Payload)
+	}
+	if payload["email"] != "ada@example.com" || payload["customer_id"] != float64(7) || payload["is_active"] != true {
+		t.Errorf("expected the user's public fields in the payload, got %s", events[0].Payload)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/common"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/tracing"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"github.com/jshelley8117/CodeCart/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// DEFAULT_DELIVERY_LOG_LIMIT and MAX_DELIVERY_LOG_LIMIT bound how much of a subscription's delivery log one request reads
+const (
+	DEFAULT_DELIVERY_LOG_LIMIT = 50
+	MAX_DELIVERY_LOG_LIMIT     = 500
+)
+
+// WebhookService manages partner webhook subscriptions and their delivery log. Deliveries themselves are queued by
+// webhook.Fanout and sent by webhook.Dispatcher
+type WebhookService struct {
+	WebhookPersistence persistence.WebhookRepository
+	Logger             *zap.Logger
+}
+
+func NewWebhookService(webhookPersistence persistence.WebhookRepository, logger *zap.Logger) WebhookService {
+	return WebhookService{
+		WebhookPersistence: webhookPersistence,
+		Logger:             logger.Named("webhook_service"),
+	}
+}
+
+// CreateSubscription registers an active subscription with a fresh signing secret. The response is the only place the
+// secret is ever returned
+func (ws WebhookService) CreateSubscription(ctx context.Context, request model.CreateWebhookSubscriptionRequest) (model.CreateWebhookSubscriptionResponse, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered CreateSubscription")
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		zLog.Error("failed to generate webhook secret", zap.Error(err))
+		tracing.RecordError(span, err)
+		return model.CreateWebhookSubscriptionResponse{}, fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+
+	now := time.Now()
+	subscription := model.WebhookSubscription{
+		URL:         request.URL,
+		EventTypes:  request.EventTypes,
+		Description: request.Description,
+		Active:      true,
+		Secret:      secret,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	subscription.Id, err = ws.WebhookPersistence.PersistCreateSubscription(ctx, subscription)
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return model.CreateWebhookSubscriptionResponse{}, fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+
+	zLog.Info("webhook subscription created", zap.Int("subscription_id", subscription.Id), zap.Strings("event_types", subscription.EventTypes))
+	return model.CreateWebhookSubscriptionResponse{WebhookSubscription: subscription, Secret: secret}, nil
+}
+
+func (ws WebhookService) GetAllSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetAllSubscriptions")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered GetAllSubscriptions")
+
+	subscriptions, err := ws.WebhookPersistence.FetchAllSubscriptions(ctx)
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscriptionById returns persistence.ErrNotFound for unknown subscriptions
+func (ws WebhookService) GetSubscriptionById(ctx context.Context, id int) (model.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscriptionById")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered GetSubscriptionById")
+
+	subscription, err := ws.WebhookPersistence.FetchSubscriptionById(ctx, id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("webhook subscription not found", zap.Int("subscription_id", id))
+		return model.WebhookSubscription{}, err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return model.WebhookSubscription{}, err
+	}
+	return subscription, nil
+}
+
+// UpdateSubscriptionById returns persistence.ErrNotFound for unknown subscriptions
+func (ws WebhookService) UpdateSubscriptionById(ctx context.Context, request model.UpdateWebhookSubscriptionRequest, id int) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.UpdateSubscriptionById")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered UpdateSubscriptionById")
+
+	updates := make(map[string]any)
+	if request.URL != nil {
+		updates["url"] = *request.URL
+	}
+	if request.EventTypes != nil {
+		updates["event_types"] = request.EventTypes
+	}
+	if request.Description != nil {
+		updates["description"] = *request.Description
+	}
+	if request.Active != nil {
+		updates["active"] = *request.Active
+	}
+
+	if len(updates) == 0 {
+		zLog.Error("No updates found", zap.Int("subscription_id", id))
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+
+	err := ws.WebhookPersistence.PersistUpdateSubscriptionById(ctx, id, updates)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("webhook subscription not found", zap.Int("subscription_id", id))
+		return err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+	return nil
+}
+
+// DeleteSubscriptionById removes the subscription and its delivery log. It returns persistence.ErrNotFound for
+// unknown subscriptions
+func (ws WebhookService) DeleteSubscriptionById(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscriptionById")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered DeleteSubscriptionById")
+
+	err := ws.WebhookPersistence.PersistDeleteSubscriptionById(ctx, id)
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("webhook subscription not found", zap.Int("subscription_id", id))
+		return err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_DELETE_FAIL)
+	}
+	return nil
+}
+
+// GetDeliveries returns the subscription's delivery log, newest first. status narrows it to one status when not
+// empty, and limit is clamped to MAX_DELIVERY_LOG_LIMIT, with 0 meaning DEFAULT_DELIVERY_LOG_LIMIT. It returns
+// persistence.ErrNotFound for unknown subscriptions
+func (ws WebhookService) GetDeliveries(ctx context.Context, subscriptionId int, status model.WebhookDeliveryStatus, limit int) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx)
+	zLog.Debug("entered GetDeliveries")
+
+	if _, err := ws.GetSubscriptionById(ctx, subscriptionId); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DEFAULT_DELIVERY_LOG_LIMIT
+	}
+	deliveries, err := ws.WebhookPersistence.FetchDeliveriesBySubscription(ctx, subscriptionId, status, min(limit, MAX_DELIVERY_LOG_LIMIT))
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return nil, fmt.Errorf(common.ERR_CLIENT_DB_RETRIEVAL_FAIL)
+	}
+	return deliveries, nil
+}
+
+// Redeliver queues a delivery for an immediate attempt with a fresh attempt budget, whether it is dead, delivered or
+// still pending. It returns persistence.ErrNotFound unless the delivery belongs to the subscription
+func (ws WebhookService) Redeliver(ctx context.Context, subscriptionId int, deliveryId int64) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver")
+	defer span.End()
+
+	zLog := ws.getZLog(ctx).With(zap.Int("subscription_id", subscriptionId), zap.Int64("delivery_id", deliveryId))
+	zLog.Debug("entered Redeliver")
+
+	delivery, err := ws.WebhookPersistence.FetchDeliveryById(ctx, deliveryId)
+	if err == nil && delivery.SubscriptionId != subscriptionId {
+		err = persistence.ErrNotFound
+	}
+	if err == nil {
+		err = ws.WebhookPersistence.PersistRequeueDelivery(ctx, deliveryId, time.Now())
+	}
+	if errors.Is(err, persistence.ErrNotFound) {
+		zLog.Warn("webhook delivery not found")
+		return err
+	}
+	if err != nil {
+		zLog.Error("persistence invocation failed", zap.Error(err))
+		tracing.RecordError(span, err)
+		return fmt.Errorf(common.ERR_CLIENT_DB_PERSISTENCE_FAIL)
+	}
+
+	zLog.Info("webhook delivery queued for redelivery", zap.String("previous_status", string(delivery.Status)))
+	return nil
+}
+
+func (ws WebhookService) getZLog(ctx context.Context) *zap.Logger {
+	return utils.FromContext(ctx, ws.Logger)
+}
@@ -0,0 +1,157 @@
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+)
+
+// the factories below insert rows directly with SQL rather than through the persistence structs, so a bug in the code
+// under test cannot also corrupt its own fixtures. Each factory fills every required column with a sensible unique
+// default; pass option funcs to override whatever the test cares about
+
+func CreateCustomer(t testing.TB, db *sql.DB, opts ...func(*model.Customer)) model.Customer {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	c := model.Customer{
+		FirstName:   "test",
+		LastName:    "customer",
+		PhoneNumber: "+15555550100",
+		Email:       "customer-" + uniqueToken(t) + "@example.com",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	query := `
+		INSERT INTO customers (first_name, last_name, phone_number, email, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	if err := db.QueryRowContext(context.Background(), query,
+		c.FirstName, c.LastName, c.PhoneNumber, c.Email, c.CreatedAt, c.UpdatedAt,
+	).Scan(&c.Id); err != nil {
+		t.Fatalf("pgtest: failed to create customer fixture: %v", err)
+	}
+	return c
+}
+
+// CreateUser also creates the owning customer unless CustomerId is set by an option
+func CreateUser(t testing.TB, db *sql.DB, opts ...func(*model.User)) model.User {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	u := model.User{
+		Email:     "user-" + uniqueToken(t) + "@example.com",
+		GCAuthId:  "gc-" + uniqueToken(t),
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, opt := range opts {
+		opt(&u)
+	}
+	if u.CustomerId == 0 {
+		u.CustomerId = CreateCustomer(t, db).Id
+	}
+
+	query := `
+		INSERT INTO users (email, created_at, updated_at, is_active, customer_id, gc_auth_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	if err := db.QueryRowContext(context.Background(), query,
+		u.Email, u.CreatedAt, u.UpdatedAt, u.IsActive, u.CustomerId, u.GCAuthId,
+	).Scan(&u.Id); err != nil {
+		t.Fatalf("pgtest: failed to create user fixture: %v", err)
+	}
+	return u
+}
+
+// CreateAddress also creates the owning user unless UserId is set by an option
+func CreateAddress(t testing.TB, db *sql.DB, opts ...func(*model.Address)) model.Address {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	a := model.Address{
+		StreetAddress: "1 test st",
+		City:          "springfield",
+		State:         "il",
+		ZipCode:       "62701",
+		Country:       "us",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	if a.UserId == 0 {
+		a.UserId = CreateUser(t, db).Id
+	}
+
+	query := `
+		INSERT INTO addresses (user_id, street_address, city, state, zip_code, country, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	if err := db.QueryRowContext(context.Background(), query,
+		a.UserId, a.StreetAddress, a.City, a.State, a.ZipCode, a.Country, a.IsDefault, a.CreatedAt, a.UpdatedAt,
+	).Scan(&a.Id); err != nil {
+		t.Fatalf("pgtest: failed to create address fixture: %v", err)
+	}
+	return a
+}
+
+// CreateOrder defaults to a pending pickup order and creates the owning customer unless CustomerId is set by an option
+func CreateOrder(t testing.TB, db *sql.DB, opts ...func(*model.Order)) model.Order {
+	t.Helper()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	o := model.Order{
+		Status:     model.OrderStatusPending,
+		TotalPrice: 19.99,
+		AddressId:  -1,
+		OrderType:  model.OrderType("PICKUP"),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.CustomerId == 0 {
+		o.CustomerId = CreateCustomer(t, db).Id
+	}
+
+	var deliveryAddress any
+	if len(o.DeliveryAddress) > 0 {
+		deliveryAddress = string(o.DeliveryAddress)
+	}
+
+	query := `
+		INSERT INTO orders (customer_id, status, total_price, delivery_address, created_at, updated_at, address_id, order_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	if err := db.QueryRowContext(context.Background(), query,
+		o.CustomerId, o.Status, o.TotalPrice, deliveryAddress, o.CreatedAt, o.UpdatedAt, o.AddressId, o.OrderType,
+	).Scan(&o.Id); err != nil {
+		t.Fatalf("pgtest: failed to create order fixture: %v", err)
+	}
+	return o
+}
+
+func uniqueToken(t testing.TB) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("pgtest: failed to generate fixture token: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
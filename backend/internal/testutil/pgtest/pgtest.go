@@ -0,0 +1,107 @@
+// Package pgtest gives integration tests a migrated postgres schema of their own. It connects with the same LOCAL_DB_*
+// variables the server uses for -db=local, creates a uniquely named schema per test, applies every migration into it
+// and drops it again when the test finishes. Tests are skipped, not failed, when no database is configured or reachable.
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/migrate"
+	_ "github.com/lib/pq"
+)
+
+const connectTimeout = 3 * time.Second
+
+// New returns a handle whose connections all use a fresh, fully migrated schema
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("pgtest: skipping postgres integration test in -short mode")
+	}
+
+	baseDSN, ok := dsnFromEnv()
+	if !ok {
+		t.Skip("pgtest: LOCAL_DB_HOST is not set, skipping postgres integration test")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	admin, err := sql.Open("postgres", baseDSN)
+	if err != nil {
+		t.Skipf("pgtest: cannot open postgres connection: %v", err)
+	}
+	if err := admin.PingContext(ctx); err != nil {
+		admin.Close()
+		t.Skipf("pgtest: postgres is not reachable: %v", err)
+	}
+
+	schema := "pgtest_" + randomSuffix(t)
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA %s", schema)); err != nil {
+		admin.Close()
+		t.Fatalf("pgtest: failed to create schema %s: %v", schema, err)
+	}
+
+	// lib/pq forwards unknown connection parameters to the server as run-time settings, so every pooled connection
+	// starts out with the test schema as its search_path
+	db, err := sql.Open("postgres", baseDSN+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("pgtest: failed to open schema-scoped connection: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+		defer cancel()
+		if _, err := admin.ExecContext(ctx, fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)); err != nil {
+			t.Logf("pgtest: failed to drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	if _, err := migrate.Apply(context.Background(), db, dialect.Postgres); err != nil {
+		t.Fatalf("pgtest: failed to apply migrations: %v", err)
+	}
+
+	return db
+}
+
+func dsnFromEnv() (string, bool) {
+	host := os.Getenv("LOCAL_DB_HOST")
+	if host == "" {
+		return "", false
+	}
+
+	port := os.Getenv("LOCAL_DB_PORT")
+	if port == "" {
+		port = "5432"
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable connect_timeout=3",
+		host,
+		port,
+		os.Getenv("LOCAL_DB_USER"),
+		os.Getenv("LOCAL_DB_NAME"),
+	)
+	if password := os.Getenv("LOCAL_DB_PASSWORD"); password != "" {
+		dsn += " password=" + password
+	}
+	return dsn, true
+}
+
+func randomSuffix(t testing.TB) string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("pgtest: failed to generate schema name: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,29 @@
+// Package sqlitetest gives tests a migrated, file-backed sqlite database in the test's temp dir. Unlike pgtest it
+// needs no external server, so tests using it always run.
+package sqlitetest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jshelley8117/CodeCart/internal/dialect"
+	"github.com/jshelley8117/CodeCart/internal/migrate"
+	"github.com/jshelley8117/CodeCart/internal/resource"
+)
+
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := resource.NewSQLiteDb(filepath.Join(t.TempDir(), "codecart.db"))
+	if err != nil {
+		t.Fatalf("sqlitetest: failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := migrate.Apply(context.Background(), db, dialect.SQLite); err != nil {
+		t.Fatalf("sqlitetest: failed to apply migrations: %v", err)
+	}
+	return db
+}
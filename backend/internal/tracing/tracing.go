@@ -0,0 +1,116 @@
+// Package tracing configures OpenTelemetry for the backend and holds the small helpers the other layers use to start
+// spans. Spans are always created through the global tracer provider, so code that runs without Setup (unit tests, the
+// config command) gets no-op spans for free.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const INSTRUMENTATION_NAME = "github.com/jshelley8117/CodeCart"
+
+const (
+	EXPORTER_NONE   = "none"
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_FILE   = "file"
+	EXPORTER_OTLP   = "otlp"
+)
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned func flushes buffered
+// spans and releases the exporter; call it during shutdown. With the "none" exporter only the propagator is installed,
+// so incoming traceparent headers are still forwarded on outbound calls
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.Exporter == EXPORTER_NONE {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closeOutput, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// honour the caller's sampling decision so a trace is either complete or absent across services
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeErr := closeOutput(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+func newExporter(ctx context.Context, cfg config.TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch cfg.Exporter {
+	case EXPORTER_STDOUT:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		return exporter, noClose, err
+	case EXPORTER_FILE:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file %s: %w", cfg.File, err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file.Close, nil
+	case EXPORTER_OTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithTimeout(10 * time.Second)}
+		if cfg.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		return exporter, noClose, err
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(INSTRUMENTATION_NAME)
+}
+
+// Start begins an internal span under whatever span ctx already carries
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed. It is a no-op for a nil error so it can sit next to the existing error logging
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
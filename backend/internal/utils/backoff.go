@@ -0,0 +1,12 @@
+package utils
+
+import "time"
+
+// Backoff is the wait before the next try after failures failed ones: base doubled with every failure, up to limit
+func Backoff(base, limit time.Duration, failures int) time.Duration {
+	wait := base
+	for i := 0; i < failures && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for failures, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := Backoff(time.Second, time.Minute, failures); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+	if got := Backoff(time.Second, time.Minute, 100); got != time.Minute {
+		t.Errorf("expected the backoff to be capped at 1m, got %s", got)
+	}
+}
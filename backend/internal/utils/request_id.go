@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// ids longer than this, or containing anything but visible ASCII, are replaced rather than echoed back and logged
+const maxRequestIdLength = 128
+
+type requestIdKey struct{}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestIdFromContext returns the id of the request ctx belongs to, or "" outside of a request
+func RequestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+func NewRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestId reports whether an id supplied by a client is safe to adopt
+func ValidRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// HttpError is http.Error with the request id appended to the body, so a client reporting a failure can hand over
+// the id that finds the matching log lines
+func HttpError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if id := RequestIdFromContext(r.Context()); id != "" {
+		message = fmt.Sprintf("%s (request id: %s)", message, id)
+	}
+	http.Error(w, message, status)
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"context"
-	"os"
 	"strings"
 
 	"go.uber.org/zap"
@@ -10,7 +9,8 @@ import (
 )
 
 type Config struct {
-	Env string // "dev" or "prod"
+	Env   string // "dev" or "prod"
+	Level string // any zapcore level name; empty keeps the environment's default
 }
 
 func NewLogger(cfg Config) (*zap.Logger, error) {
@@ -23,7 +23,7 @@ func NewLogger(cfg Config) (*zap.Logger, error) {
 		zcfg = zap.NewProductionConfig()
 	}
 
-	if lvl := strings.TrimSpace(os.Getenv("LOG_LEVEL")); lvl != "" {
+	if lvl := strings.TrimSpace(cfg.Level); lvl != "" {
 		var parsed zapcore.Level
 		if err := parsed.Set(lvl); err == nil {
 			zcfg.Level = zap.NewAtomicLevelAt(parsed)
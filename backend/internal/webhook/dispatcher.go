@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/metrics"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// USER_AGENT identifies deliveries in partners' logs
+const USER_AGENT = "CodeCart-Webhooks/1.0"
+
+// Dispatcher sends due deliveries to their subscriptions. Every attempt is claimed first, so several dispatchers can
+// share the table without sending a delivery twice at once. A 2xx answer delivers it; anything else, redirects
+// included, is a failure that is retried after a wait doubling from RetryBase to RetryMax, until MaxAttempts attempts
+// have failed and the delivery is dead
+type Dispatcher struct {
+	Webhooks     persistence.WebhookRepository
+	Client       *http.Client
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	Now          func() time.Time
+	Metrics      *metrics.Metrics
+	Logger       *zap.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewDispatcher(webhooks persistence.WebhookRepository, cfg config.WebhooksConfig, metrics *metrics.Metrics, logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		Webhooks: webhooks,
+		Client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		PollInterval: cfg.PollInterval,
+		BatchSize:    cfg.BatchSize,
+		Timeout:      cfg.Timeout,
+		MaxAttempts:  cfg.MaxAttempts,
+		RetryBase:    cfg.RetryBase,
+		RetryMax:     cfg.RetryMax,
+		Now:          time.Now,
+		Metrics:      metrics,
+		Logger:       logger.Named("webhook_dispatcher"),
+	}
+}
+
+// Start runs rounds in the background until Stop is called
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+		for {
+			attempted, err := d.DispatchOnce(ctx)
+			if err != nil {
+				d.Logger.Error("webhook dispatch round failed", zap.Error(err))
+			}
+
+			// a full batch means there is probably more waiting
+			wait := d.PollInterval
+			if err == nil && attempted >= d.BatchSize {
+				wait = 0
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop lets the attempt in flight finish, then stops the dispatcher
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d.cancel == nil {
+		return nil
+	}
+	d.cancel()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DispatchOnce attempts every delivery due now, up to BatchSize, and returns how many it attempted. Cancelling ctx
+// ends the round after the attempt in flight, whose outcome is still recorded
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	roundCtx := context.WithoutCancel(ctx)
+	now := d.Now()
+
+	deliveries, err := d.Webhooks.FetchDueDeliveries(roundCtx, now, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	subscriptions := map[int]model.WebhookSubscription{}
+	attempted := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// a dispatcher that dies mid-attempt leaves the delivery to be picked up again once the lease runs out
+		claimed, err := d.Webhooks.ClaimDelivery(roundCtx, delivery.Id, delivery.Attempts, now, now.Add(2*d.Timeout))
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+		delivery.Attempts++
+
+		subscription, ok := subscriptions[delivery.SubscriptionId]
+		if !ok {
+			subscription, err = d.Webhooks.FetchSubscriptionById(roundCtx, delivery.SubscriptionId)
+			if errors.Is(err, persistence.ErrNotFound) {
+				// deleted since the fetch, and its deliveries with it
+				continue
+			}
+			if err != nil {
+				return attempted, err
+			}
+			subscriptions[subscription.Id] = subscription
+		}
+
+		result := d.attempt(roundCtx, subscription, delivery)
+		if err := d.Webhooks.PersistDeliveryResult(roundCtx, delivery.Id, result); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// attempt POSTs the delivery once and works out what happens to it next
+func (d *Dispatcher) attempt(ctx context.Context, subscription model.WebhookSubscription, delivery model.WebhookDelivery) model.WebhookDeliveryResult {
+	attemptedAt := d.Now()
+	statusCode, err := d.send(ctx, subscription, delivery, attemptedAt)
+	result := model.WebhookDeliveryResult{StatusCode: statusCode, AttemptedAt: attemptedAt}
+
+	logFields := []zap.Field{
+		zap.Int64("delivery_id", delivery.Id),
+		zap.Int("subscription_id", subscription.Id),
+		zap.String("event_type", delivery.EventType),
+		zap.Int("attempt", delivery.Attempts),
+		zap.Int("status_code", statusCode),
+	}
+
+	switch {
+	case err == nil:
+		result.Status = model.WebhookDeliveryDelivered
+		result.NextAttemptAt = attemptedAt
+		d.Metrics.WebhookDeliveryAttempted(delivery.EventType, "delivered")
+		d.Logger.Debug("webhook delivered", logFields...)
+	case delivery.Attempts >= d.MaxAttempts:
+		result.Status = model.WebhookDeliveryDead
+		result.Error = err.Error()
+		result.NextAttemptAt = attemptedAt
+		d.Metrics.WebhookDeliveryAttempted(delivery.EventType, "dead")
+		d.Logger.Error("webhook delivery failed for the last time", append(logFields, zap.Error(err))...)
+	default:
+		result.Status = model.WebhookDeliveryPending
+		result.Error = err.Error()
+		result.NextAttemptAt = attemptedAt.Add(utils.Backoff(d.RetryBase, d.RetryMax, delivery.Attempts-1))
+		d.Metrics.WebhookDeliveryAttempted(delivery.EventType, "failed")
+		d.Logger.Warn("webhook delivery failed, will retry", append(logFields, zap.Time("retry_at", result.NextAttemptAt), zap.Error(err))...)
+	}
+	return result
+}
+
+// send returns the response status, or 0 when there was none, and an error unless the status was a 2xx
+func (d *Dispatcher) send(ctx context.Context, subscription model.WebhookSubscription, delivery model.WebhookDelivery, sentAt time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", USER_AGENT)
+	req.Header.Set(EVENT_HEADER, delivery.EventType)
+	req.Header.Set(DELIVERY_HEADER, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(sentAt.Unix(), 10))
+	req.Header.Set(SIGNATURE_HEADER, Sign(subscription.Secret, sentAt, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/config"
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/persistence/memory"
+	"go.uber.org/zap"
+)
+
+var testWebhooksConfig = config.WebhooksConfig{
+	PollInterval: time.Millisecond,
+	BatchSize:    10,
+	Timeout:      time.Second,
+	MaxAttempts:  3,
+	RetryBase:    time.Minute,
+	RetryMax:     time.Hour,
+}
+
+func subscribe(t *testing.T, webhooks persistence.WebhookRepository, url string, active bool, eventTypes ...string) model.WebhookSubscription {
+	t.Helper()
+	subscription := model.WebhookSubscription{URL: url, EventTypes: eventTypes, Active: active, Secret: "whsec_test"}
+	id, err := webhooks.PersistCreateSubscription(context.Background(), subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription.Id = id
+	return subscription
+}
+
+func newTestDispatcher(webhooks persistence.WebhookRepository) (*Dispatcher, *time.Time) {
+	dispatcher := NewDispatcher(webhooks, testWebhooksConfig, nil, zap.NewNop())
+	now := time.Now()
+	dispatcher.Now = func() time.Time { return now }
+	return dispatcher, &now
+}
+
+func TestFanout_QueuesOnePerMatchingSubscription(t *testing.T) {
+	webhooks := memory.NewStore().Repositories().Webhooks
+	wanted := subscribe(t, webhooks, "http://partner", true, model.EventOrderCreated)
+	subscribe(t, webhooks, "http://other", true, model.EventCustomerCreated)
+	subscribe(t, webhooks, "http://paused", false, model.EventOrderCreated)
+
+	fanout := NewFanout(webhooks, zap.NewNop())
+	event := model.OutboxEvent{Id: 4, AggregateType: model.AggregateOrder, AggregateId: "1", Type: model.EventOrderCreated, Payload: json.RawMessage(`{}`)}
+	for range 2 {
+		if err := fanout.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Publish returned %v", err)
+		}
+	}
+
+	deliveries, _ := webhooks.FetchDeliveriesBySubscription(context.Background(), wanted.Id, "", 10)
+	if len(deliveries) != 1 || deliveries[0].EventId != 4 || deliveries[0].Status != model.WebhookDeliveryPending {
+		t.Fatalf("expected a single pending delivery despite publishing twice, got %+v", deliveries)
+	}
+	var body model.OutboxEvent
+	if err := json.Unmarshal(deliveries[0].Payload, &body); err != nil || body.Id != 4 {
+		t.Errorf("expected the event as the payload, got %s", deliveries[0].Payload)
+	}
+}
+
+func TestDispatcher_SignsAndDelivers(t *testing.T) {
+	var verifyErr error
+	var deliveryHeader string
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = Verify(secret, r.Header.Get(SIGNATURE_HEADER), r.Header.Get(TIMESTAMP_HEADER), body, time.Now(), time.Minute)
+		deliveryHeader = r.Header.Get(DELIVERY_HEADER)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	webhooks := memory.NewStore().Repositories().Webhooks
+	subscription := subscribe(t, webhooks, receiver.URL, true, model.EventOrderCreated)
+	secret = subscription.Secret
+	NewFanout(webhooks, zap.NewNop()).Publish(context.Background(), model.OutboxEvent{Id: 1, Type: model.EventOrderCreated, Payload: json.RawMessage(`{"id":1}`)})
+
+	dispatcher := NewDispatcher(webhooks, testWebhooksConfig, nil, zap.NewNop())
+	if attempted, err := dispatcher.DispatchOnce(context.Background()); err != nil || attempted != 1 {
+		t.Fatalf("expected one attempt, got %d and err %v", attempted, err)
+	}
+	if verifyErr != nil || deliveryHeader == "" {
+		t.Errorf("expected a signed delivery with an id, got %v and %q", verifyErr, deliveryHeader)
+	}
+
+	delivery, _ := webhooks.FetchDeliveryById(context.Background(), 1)
+	if delivery.Status != model.WebhookDeliveryDelivered || delivery.DeliveredAt == nil || delivery.LastStatusCode != http.StatusNoContent {
+		t.Errorf("expected the delivery to be marked delivered, got %+v", delivery)
+	}
+}
+
+func TestDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "partner down", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	webhooks := memory.NewStore().Repositories().Webhooks
+	subscribe(t, webhooks, receiver.URL, true, model.EventOrderCreated)
+	NewFanout(webhooks, zap.NewNop()).Publish(context.Background(), model.OutboxEvent{Id: 1, Type: model.EventOrderCreated, Payload: json.RawMessage(`{}`)})
+	dispatcher, now := newTestDispatcher(webhooks)
+
+	for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		dispatcher.DispatchOnce(context.Background())
+		delivery, _ := webhooks.FetchDeliveryById(context.Background(), 1)
+		if delivery.Status != model.WebhookDeliveryPending || delivery.Attempts != attempt+1 || !delivery.NextAttemptAt.Equal(now.Add(wait)) {
+			t.Fatalf("attempt %d: expected a retry in %s, got %+v", attempt+1, wait, delivery)
+		}
+		if attempted, _ := dispatcher.DispatchOnce(context.Background()); attempted != 0 {
+			t.Fatalf("attempt %d: expected nothing due before the backoff", attempt+1)
+		}
+		*now = now.Add(wait)
+	}
+
+	dispatcher.DispatchOnce(context.Background())
+	delivery, _ := webhooks.FetchDeliveryById(context.Background(), 1)
+	if delivery.Status != model.WebhookDeliveryDead || delivery.LastStatusCode != http.StatusServiceUnavailable || delivery.LastError == "" {
+		t.Fatalf("expected the delivery to be dead after %d attempts, got %+v", testWebhooksConfig.MaxAttempts, delivery)
+	}
+	*now = now.Add(time.Hour)
+	if attempted, _ := dispatcher.DispatchOnce(context.Background()); attempted != 0 || calls.Load() != 3 {
+		t.Fatalf("expected a dead delivery to stay put, got %d more attempts and %d calls", attempted, calls.Load())
+	}
+
+	if err := webhooks.PersistRequeueDelivery(context.Background(), 1, *now); err != nil {
+		t.Fatal(err)
+	}
+	if attempted, _ := dispatcher.DispatchOnce(context.Background()); attempted != 1 || calls.Load() != 4 {
+		t.Errorf("expected the requeued delivery to be attempted again, got %d", attempted)
+	}
+	delivery, _ = webhooks.FetchDeliveryById(context.Background(), 1)
+	if delivery.Attempts != 1 || delivery.TotalAttempts != 4 || delivery.Redeliveries != 1 {
+		t.Errorf("expected a fresh budget on top of the full history, got %+v", delivery)
+	}
+}
+
+func TestDispatcher_ClaimsEachAttemptOnce(t *testing.T) {
+	webhooks := memory.NewStore().Repositories().Webhooks
+	subscribe(t, webhooks, "http://partner", true, model.EventOrderCreated)
+	NewFanout(webhooks, zap.NewNop()).Publish(context.Background(), model.OutboxEvent{Id: 1, Type: model.EventOrderCreated, Payload: json.RawMessage(`{}`)})
+
+	due, _ := webhooks.FetchDueDeliveries(context.Background(), time.Now(), 10)
+	now := time.Now()
+	first, _ := webhooks.ClaimDelivery(context.Background(), due[0].Id, due[0].Attempts, now, now.Add(time.Minute))
+	second, _ := webhooks.ClaimDelivery(context.Background(), due[0].Id, due[0].Attempts, now, now.Add(time.Minute))
+	if !first || second {
+		t.Errorf("expected only the first claim to win, got %v and %v", first, second)
+	}
+	if due, _ := webhooks.FetchDueDeliveries(context.Background(), now, 10); len(due) != 0 {
+		t.Errorf("expected the claimed delivery to be leased, got %+v", due)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":1}`)
+	signature := Sign("secret", now, body)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	if err := Verify("secret", signature, timestamp, body, now, time.Minute); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+	if err := Verify("other", signature, timestamp, body, now, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("expected the wrong secret to fail, got %v", err)
+	}
+	if err := Verify("secret", signature, timestamp, []byte(`{"id":2}`), now, time.Minute); err != ErrInvalidSignature {
+		t.Errorf("expected a tampered body to fail, got %v", err)
+	}
+	if err := Verify("secret", signature, timestamp, body, now.Add(10*time.Minute), time.Minute); err != ErrStaleTimestamp {
+		t.Errorf("expected a replay to fail, got %v", err)
+	}
+}
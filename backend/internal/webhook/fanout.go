@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jshelley8117/CodeCart/internal/model"
+	"github.com/jshelley8117/CodeCart/internal/outbox"
+	"github.com/jshelley8117/CodeCart/internal/persistence"
+	"github.com/jshelley8117/CodeCart/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Fanout is the outbox publisher that queues an event for every active subscription that wants it. Queuing the same
+// event twice is a no-op, so the relay's redeliveries do not reach partners twice
+type Fanout struct {
+	Webhooks persistence.WebhookRepository
+	Now      func() time.Time
+	Logger   *zap.Logger
+}
+
+var _ outbox.Publisher = Fanout{}
+
+func NewFanout(webhooks persistence.WebhookRepository, logger *zap.Logger) Fanout {
+	return Fanout{
+		Webhooks: webhooks,
+		Now:      time.Now,
+		Logger:   logger.Named("webhook_fanout"),
+	}
+}
+
+func (f Fanout) Publish(ctx context.Context, event model.OutboxEvent) error {
+	subscriptions, err := f.Webhooks.FetchAllSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+
+	var payload []byte
+	for _, subscription := range subscriptions {
+		if !subscription.Wants(event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to marshal event %d: %w", event.Id, err)
+			}
+		}
+
+		now := f.Now()
+		if err := f.Webhooks.PersistDelivery(ctx, model.WebhookDelivery{
+			SubscriptionId: subscription.Id,
+			EventId:        event.Id,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         model.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}); err != nil {
+			return fmt.Errorf("failed to queue event %d for webhook subscription %d: %w", event.Id, subscription.Id, err)
+		}
+		utils.FromContext(ctx, f.Logger).Debug("queued webhook delivery",
+			zap.Int("subscription_id", subscription.Id),
+			zap.Int64("event_id", event.Id),
+			zap.String("event_type", event.Type))
+	}
+	return nil
+}
@@ -2,11 +2,15 @@ package helloworldpoc
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 )
 
+// REQUEST_ID_HEADER carries the id the backend assigned to the request that triggered this call
+const REQUEST_ID_HEADER = "X-Request-Id"
+
 func init() {
 	functions.HTTP("HelloWorldPOC", HelloWorldPOC)
 }
@@ -16,12 +20,20 @@ type HelloWorldResponse struct {
 }
 
 func HelloWorldPOC(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER)
+	if requestId != "" {
+		// echoed so the id survives any proxy between us and the backend
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+	}
+	log.Printf("HelloWorldPOC invoked requestId=%q", requestId)
+
 	response := HelloWorldResponse{
 		Message: "Hello World from Cloud Function!",
 	}
 
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
+		log.Printf("failed to serialize response requestId=%q: %v", requestId, err)
 		http.Error(w, "Failed to serialize response", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,36 @@
+// Command local serves every cloud function in this repository from a single process through the functions framework,
+// which is what Cloud Functions itself runs them on. Each function is served at /<name>, e.g.
+// http://localhost:8080/HelloWorldPOC. Setting FUNCTION_TARGET serves only that function, at "/".
+//
+// Run it from this directory with `go run .` and point the backend at it with CLOUD_FUNCTION_EMULATOR=true.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
+
+	// each function registers itself with the framework in its init
+	_ "github.com/jshelley8117/CodeCart/cloud/functions/helloworld-poc"
+	_ "github.com/jshelley8117/CodeCart/cloud/functions/receipt"
+)
+
+const DEFAULT_PORT = "8080"
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DEFAULT_PORT
+	}
+	// loopback only unless asked otherwise, the functions run without authentication here
+	host := os.Getenv("HOST")
+	if host == "" {
+		host = "localhost"
+	}
+
+	log.Printf("serving cloud functions on http://%s:%s", host, port)
+	if err := funcframework.StartHostPort(host, port); err != nil {
+		log.Fatalf("functions framework stopped: %v", err)
+	}
+}
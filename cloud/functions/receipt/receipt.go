@@ -0,0 +1,227 @@
+// Package receipt renders PDF receipts for orders. The backend sends the order, its lines and totals, and the store
+// details; the function answers with the PDF itself.
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/go-pdf/fpdf"
+)
+
+// REQUEST_ID_HEADER carries the id the backend assigned to the request that triggered this call
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// MAX_REQUEST_BYTES is far beyond any real order, it only stops runaway payloads
+const MAX_REQUEST_BYTES = 1 << 20
+
+func init() {
+	functions.HTTP("Receipt", Receipt)
+}
+
+type ReceiptRequest struct {
+	Store Store `json:"store"`
+	Order Order `json:"order"`
+}
+
+type Store struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Phone   string `json:"phone"`
+}
+
+type Order struct {
+	Id         int       `json:"id"`
+	CustomerId int       `json:"customer_id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	PlacedAt   time.Time `json:"placed_at"`
+	Currency   string    `json:"currency"`
+	Lines      []Line    `json:"lines"`
+	Subtotal   float64   `json:"subtotal"`
+	Tax        float64   `json:"tax"`
+	Total      float64   `json:"total"`
+}
+
+type Line struct {
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+func (rr ReceiptRequest) validate() error {
+	var problems []error
+	if rr.Store.Name == "" {
+		problems = append(problems, errors.New("store.name is required"))
+	}
+	if rr.Order.Id <= 0 {
+		problems = append(problems, errors.New("order.id must be positive"))
+	}
+	if len(rr.Order.Lines) == 0 {
+		problems = append(problems, errors.New("order.lines must not be empty"))
+	}
+	for i, line := range rr.Order.Lines {
+		if line.Description == "" || line.Quantity <= 0 {
+			problems = append(problems, fmt.Errorf("order.lines[%d] needs a description and a positive quantity", i))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func Receipt(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER)
+	if requestId != "" {
+		// echoed so the id survives any proxy between us and the backend
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request ReceiptRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BYTES))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		log.Printf("Receipt rejected a malformed request requestId=%q: %v", requestId, err)
+		http.Error(w, "Malformed receipt request", http.StatusBadRequest)
+		return
+	}
+	if err := request.validate(); err != nil {
+		log.Printf("Receipt rejected an invalid request requestId=%q: %v", requestId, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Receipt invoked requestId=%q orderId=%d", requestId, request.Order.Id)
+
+	pdf, err := Render(request)
+	if err != nil {
+		log.Printf("failed to render receipt requestId=%q orderId=%d: %v", requestId, request.Order.Id, err)
+		http.Error(w, "Failed to render receipt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="receipt-%d.pdf"`, request.Order.Id))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// Render lays the receipt out on a single A5 page using only the PDF core fonts, so no font files are needed
+func Render(request ReceiptRequest) ([]byte, error) {
+	store, order := request.Store, request.Order
+
+	pdf := fpdf.New("P", "mm", "A5", "")
+	// the core fonts are cp1252; this maps UTF-8 input onto them
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	// pinned, and the resource catalogs sorted, so the same order always renders to the same bytes
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(order.PlacedAt)
+	pdf.SetModificationDate(order.PlacedAt)
+	pdf.SetTitle(tr(fmt.Sprintf("%s receipt for order %d", store.Name, order.Id)), false)
+	pdf.SetMargins(12, 12, 12)
+	pdf.AddPage()
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageWidth - left - right
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(width, 8, tr(store.Name), "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, detail := range []string{store.Address, store.Phone} {
+		if detail != "" {
+			pdf.CellFormat(width, 5, tr(detail), "", 1, "C", false, 0, "")
+		}
+	}
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(width, 6, fmt.Sprintf("Receipt for order #%d", order.Id), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, row := range [][2]string{
+		{"Date", order.PlacedAt.UTC().Format("2006-01-02 15:04 MST")},
+		{"Type", order.Type},
+		{"Status", order.Status},
+	} {
+		if row[1] == "" {
+			continue
+		}
+		pdf.CellFormat(25, 5, row[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(width-25, 5, tr(row[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(3)
+
+	columns := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"Item", width - 75, "L"},
+		{"Qty", 15, "R"},
+		{"Unit price", 30, "R"},
+		{"Amount", 30, "R"},
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	for _, col := range columns {
+		pdf.CellFormat(col.width, 6, col.title, "B", 0, col.align, false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range order.Lines {
+		values := []string{
+			tr(line.Description),
+			fmt.Sprintf("%d", line.Quantity),
+			formatMoney(line.UnitPrice, order.Currency),
+			formatMoney(line.Amount, order.Currency),
+		}
+		for i, col := range columns {
+			pdf.CellFormat(col.width, 6, values[i], "", 0, col.align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Line(left, pdf.GetY(), left+width, pdf.GetY())
+	pdf.Ln(2)
+
+	totals := [][2]string{
+		{"Subtotal", formatMoney(order.Subtotal, order.Currency)},
+		{"Tax", formatMoney(order.Tax, order.Currency)},
+		{"Total", formatMoney(order.Total, order.Currency)},
+	}
+	for i, row := range totals {
+		style := ""
+		if i == len(totals)-1 {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.CellFormat(width-30, 6, row[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, row[1], "", 1, "R", false, 0, "")
+	}
+
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "I", 9)
+	pdf.CellFormat(width, 5, tr("Thank you for shopping with "+store.Name+"!"), "", 1, "C", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write pdf: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatMoney(amount float64, currency string) string {
+	if currency == "" || currency == "USD" {
+		return fmt.Sprintf("$%.2f", amount)
+	}
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
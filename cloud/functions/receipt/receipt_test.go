@@ -0,0 +1,107 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testdata/request.json is what the backend sends, its own tests check it against the same file
+func loadFixture(t *testing.T) ([]byte, ReceiptRequest) {
+	t.Helper()
+	body, err := os.ReadFile("testdata/request.json")
+	if err != nil {
+		t.Fatalf("failed to read the fixture: %v", err)
+	}
+	var request ReceiptRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		t.Fatalf("the backend's request no longer decodes: %v", err)
+	}
+	return body, request
+}
+
+func TestRender(t *testing.T) {
+	_, request := loadFixture(t)
+	if err := request.validate(); err != nil {
+		t.Fatalf("the backend's request does not validate: %v", err)
+	}
+
+	pdf, err := Render(request)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("expected a PDF document, got %q", pdf[:min(len(pdf), 8)])
+	}
+	if !bytes.Contains(pdf, []byte("CodeCart receipt for order 42")) {
+		t.Error("expected the document title to name the store and order")
+	}
+
+	again, err := Render(request)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !bytes.Equal(pdf, again) {
+		t.Error("expected the same order to render to the same bytes")
+	}
+}
+
+func TestRender_NonASCIIText(t *testing.T) {
+	_, request := loadFixture(t)
+	request.Store.Name = "Café Zoë"
+	request.Order.Lines[0].Description = "Crème brûlée × 2"
+	request.Order.Currency = "EUR"
+
+	pdf, err := Render(request)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("expected a PDF document, got %q", pdf[:min(len(pdf), 8)])
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	fixture, _ := loadFixture(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{"renders", http.MethodPost, string(fixture), http.StatusOK, "%PDF-"},
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"malformed", http.MethodPost, `{"store":`, http.StatusBadRequest, "Malformed receipt request"},
+		{"unknown field", http.MethodPost, `{"store":{"name":"CodeCart"},"coupon":"FREE"}`, http.StatusBadRequest, "Malformed receipt request"},
+		{"invalid", http.MethodPost, `{"store":{"name":""},"order":{"id":0}}`, http.StatusBadRequest, "order.lines must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			req.Header.Set(REQUEST_ID_HEADER, "req-1")
+			rec := httptest.NewRecorder()
+			Receipt(rec, req)
+
+			if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("expected %d with %q, got %d %q", tt.want, tt.wantBody, rec.Code, rec.Body.String()[:min(rec.Body.Len(), 80)])
+			}
+			if rec.Header().Get(REQUEST_ID_HEADER) != "req-1" {
+				t.Error("expected the request id to be echoed")
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	Receipt(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(fixture)))
+	if rec.Header().Get("Content-Type") != "application/pdf" || rec.Header().Get("Content-Disposition") != `inline; filename="receipt-42.pdf"` {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+}